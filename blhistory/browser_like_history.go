@@ -63,3 +63,28 @@ func (h *BLHistory) Next() *Item {
 	item := h.items[h.curIdx]
 	return &item
 }
+
+// Items returns a copy of all the items in the history, together with the
+// index of the current one.
+func (h *BLHistory) Items() ([]Item, int) {
+	items := make([]Item, len(h.items))
+	copy(items, h.items)
+
+	return items, h.curIdx
+}
+
+// Restore replaces the whole history with the given items, as previously
+// returned by Items.
+func (h *BLHistory) Restore(items []Item, curIdx int) {
+	h.items = make([]Item, len(items))
+	copy(h.items, items)
+
+	if curIdx < 0 {
+		curIdx = 0
+	}
+	if curIdx >= len(h.items) && len(h.items) > 0 {
+		curIdx = len(h.items) - 1
+	}
+
+	h.curIdx = curIdx
+}
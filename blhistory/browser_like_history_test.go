@@ -73,3 +73,23 @@ func TestBLHistory(t *testing.T) {
 		}
 	}
 }
+
+func TestBLHistoryRestore(t *testing.T) {
+	h := New()
+	h.Add("item 1")
+	h.Add("item 2")
+	h.Add("item 3")
+	h.Prev()
+
+	items, curIdx := h.Items()
+	assert.Equal(t, 3, len(items))
+	assert.Equal(t, 1, curIdx)
+
+	h2 := New()
+	h2.Restore(items, curIdx)
+
+	assert.Equal(t, "item 3", h2.Next().Str)
+	assert.Equal(t, "item 2", h2.Prev().Str)
+	assert.Equal(t, "item 1", h2.Prev().Str)
+	assert.Nil(t, h2.Prev())
+}
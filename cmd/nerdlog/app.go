@@ -6,12 +6,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dimonomid/clock"
 	"github.com/dimonomid/nerdlog/blhistory"
 	"github.com/dimonomid/nerdlog/clhistory"
 	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/daemon"
 	"github.com/dimonomid/nerdlog/log"
 	"github.com/dimonomid/ssh_config"
 	"github.com/juju/errors"
@@ -20,6 +22,7 @@ import (
 
 type nerdlogApp struct {
 	params nerdlogAppParams
+	logger *log.Logger
 
 	options *OptionsShared
 
@@ -27,9 +30,15 @@ type nerdlogApp struct {
 	// to nil.
 	tviewApp *tview.Application
 
-	lsman    *core.LStreamsManager
+	// lsman is either a *core.LStreamsManager, or a *daemon.Client if we're
+	// attached to the daemon.
+	lsman    daemon.LStreamsManager
 	mainView *MainView
 
+	// daemonClient is the same as lsman if we're attached to the daemon, or nil
+	// otherwise.
+	daemonClient *daemon.Client
+
 	// cmdLineHistory is the command line history
 	cmdLineHistory *clhistory.CLHistory
 
@@ -44,8 +53,25 @@ type nerdlogApp struct {
 
 	lastQueryFull QueryFull
 
+	// lastQueryParams are the params of the last query (not counting loading
+	// older logs for it).
+	lastQueryParams core.QueryLogsParams
+
 	// lastLogResp contains the last response from LStreamsManager.
 	lastLogResp *core.LogRespTotal
+
+	// integrations is the config of the integrations with the external tools;
+	// nil if there's no config.
+	integrations *ConfigIntegrations
+
+	// logstreamsCfg is the config from ~/.config/nerdlog/logstreams.yaml; nil
+	// if there's no config.
+	logstreamsCfg core.ConfigLogStreams
+
+	// session is the current session state, to be saved to disk if nerdlog
+	// crashes; see recoverPanic.
+	sessionMtx sync.Mutex
+	session    crashSession
 }
 
 type nerdlogAppParams struct {
@@ -56,10 +82,31 @@ type nerdlogAppParams struct {
 	sshConfigPath    string
 	sshKeys          []string
 
+	// authHelper is the shell command supplying the credentials, see
+	// core.NewAuthHelperCallback; empty if the credentials are only requested
+	// interactively.
+	authHelper string
+
+	// allowPasswordAuth enables the ssh password and keyboard-interactive auth,
+	// see core.ShellTransportSSHParams.AllowPasswordAuth.
+	allowPasswordAuth bool
+
 	noJournalctlAccessWarn bool
 
 	// EphemeralKeyProvider specifies which ephemeral key provider to use.
 	EphemeralKeyProvider string
+
+	// If useDaemon is true, instead of connecting to the logstreams directly,
+	// we'll attach to the session daemonSession of the daemon listening on
+	// daemonSocketPath.
+	useDaemon        bool
+	daemonSocketPath string
+	daemonSession    string
+
+	// scheduledQueriesPath is the path to the config of the queries which the
+	// daemon runs on schedule (see ConfigScheduledQueries); it's fine if the
+	// file doesn't exist.
+	scheduledQueriesPath string
 }
 
 type cmdWithOpts struct {
@@ -84,12 +131,55 @@ func newNerdlogApp(
 		return nil, errors.Annotatef(err, "initializing cmdline history")
 	}
 
+	// If any of the configs is invalid, we refuse to start: ignoring e.g. the
+	// redaction rules would leak the very data they're supposed to hide. The
+	// warnings are only shown once the UI is up.
+	logstreamsCfg, configWarnings, err := loadLogstreamsConfig(homeDir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var customRedactionRules []RedactionRule
+	redactionRulesCfgPath := filepath.Join(homeDir, ".config", "nerdlog", "redaction_rules.yaml")
+	if _, err := os.Stat(redactionRulesCfgPath); err == nil {
+		customRedactionRules, err = LoadRedactionRulesConfigFromFile(redactionRulesCfgPath)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	var transactionRules []TransactionRule
+	transactionRulesCfgPath := filepath.Join(homeDir, ".config", "nerdlog", "transaction_rules.yaml")
+	if _, err := os.Stat(transactionRulesCfgPath); err == nil {
+		transactionRules, err = LoadTransactionRulesConfigFromFile(transactionRulesCfgPath)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	var integrations *ConfigIntegrations
+	integrationsCfgPath := filepath.Join(homeDir, ".config", "nerdlog", "integrations.yaml")
+	if _, err := os.Stat(integrationsCfgPath); err == nil {
+		integrations, err = LoadIntegrationsConfigFromFile(integrationsCfgPath)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
 	app := &nerdlogApp{
 		params: params,
+		logger: logger,
 
 		options: NewOptionsShared(Options{
 			Timezone:             time.Local,
 			MaxNumLines:          250,
+			HistogramLevels:      true,
+			GapThreshold:         5 * time.Minute,
+			StormThreshold:       200,
+			DetectSecrets:        true,
+			CustomRedactionRules: customRedactionRules,
+			Transactions:         transactionRuleNames(transactionRules),
+			TransactionRules:     transactionRules,
 			EphemeralKeyProvider: params.EphemeralKeyProvider,
 		}),
 
@@ -98,6 +188,9 @@ func newNerdlogApp(
 		cmdLineHistory: cmdLineHistory,
 		queryBLHistory: blhistory.New(),
 		queryCLHistory: queryCLHistory,
+
+		integrations:  integrations,
+		logstreamsCfg: logstreamsCfg,
 	}
 
 	cmdCh := make(chan cmdWithOpts, 8)
@@ -106,12 +199,41 @@ func newNerdlogApp(
 		App:     app.tviewApp,
 		Options: app.options,
 		OnLogQuery: func(params core.QueryLogsParams) {
-			params.MaxNumLines = app.options.GetMaxNumLines()
+			if app.isReadOnly() {
+				if params.Follow {
+					// The client in control is following, if needed.
+					return
+				}
+
+				app.printError("Read-only: the query is controlled by another client of the same daemon session")
+				return
+			}
+
+			if params.MaxNumLines == 0 {
+				params.MaxNumLines = app.options.GetMaxNumLines()
+			}
+
+			if !params.LoadEarlier {
+				app.lastQueryParams = params
+			}
+
+			if params.Follow {
+				// It's just the same query repeated, so there's nothing to add to the
+				// history or to share.
+				app.lsman.QueryLogs(params)
+				return
+			}
 
 			// Get the current QueryFull and marshal it to a shell command.
 			qf := app.mainView.getQueryFull()
 			qfStr := qf.MarshalShellCmd()
 
+			// If there are read-only clients attached to the same daemon session,
+			// let them follow.
+			if app.daemonClient != nil {
+				app.daemonClient.ShareQuery(qfStr)
+			}
+
 			// Add this query shell command to the commandline-like history.
 			app.queryCLHistory.Add(qfStr)
 
@@ -123,6 +245,8 @@ func newNerdlogApp(
 				}
 			}
 
+			app.updateCrashSession(qfStr)
+
 			app.lsman.QueryLogs(params)
 		},
 		OnLStreamsChange: func(lstreamsSpec string) error {
@@ -133,6 +257,9 @@ func newNerdlogApp(
 
 			return nil
 		},
+		OnLStreamsCheck: func(lstreamsSpec string) {
+			app.checkLStreams(lstreamsSpec)
+		},
 		OnDisconnectRequest: func() {
 			app.lsman.Disconnect()
 		},
@@ -153,24 +280,61 @@ func newNerdlogApp(
 	})
 
 	// NOTE: initLStreamsManager has to be called _after_ app.mainView is initialized.
-	if err := app.initLStreamsManager(params, "", homeDir, logger); err != nil {
+	if err := app.initLStreamsManager(params, "", logger); err != nil {
 		return nil, errors.Trace(err)
 	}
 
-	if !params.connectRightAway {
-		app.mainView.params.App.SetFocus(app.mainView.logsTable)
-		app.mainView.queryEditView.Show(params.initialQueryData)
+	if app.isReadOnly() {
+		// We're just following another client, so there's no initial query to
+		// apply; it'll be shared by that other client. The crash session, if
+		// any, is left for the next client which can restore it.
+		app.printMsg("Attached to the daemon session in read-only mode, following another client")
 	} else {
-		if err := app.mainView.applyQueryEditData(params.initialQueryData, doQueryParams{}); err != nil {
-			panic(err.Error())
+		crashSess, err := takeCrashSession()
+		if err != nil {
+			logger.Errorf("Failed to load the session saved during the last crash: %s", err)
+		}
+
+		if crashSess != nil && crashSess.Query != "" {
+			// The messagebox can only be sized properly once the screen size is
+			// known, which is after the first draw, so show it later.
+			app.mainView.queueUpdateLater(func() {
+				app.offerCrashSessionRestore(crashSess, app.applyInitialQuery)
+			})
+		} else {
+			app.applyInitialQuery()
 		}
 	}
 
+	if len(configWarnings) > 0 {
+		app.mainView.queueUpdateLater(func() {
+			app.mainView.showMessagebox(
+				"config_warn", "Config warning", tview.Escape(configWarnings.Error())+
+					"\n\nThe unknown fields are ignored.",
+				&MessageboxParams{CopyButton: true, Priority: ModalPriorityError},
+			)
+		})
+	}
+
 	go app.handleCmdLine(cmdCh)
 
 	return app, nil
 }
 
+// applyInitialQuery either runs the initial query right away, or opens the
+// query edit form with it, depending on whether we're supposed to connect
+// right away.
+func (app *nerdlogApp) applyInitialQuery() {
+	if !app.params.connectRightAway {
+		app.mainView.params.App.SetFocus(app.mainView.logsTable)
+		app.mainView.queryEditView.Show(app.params.initialQueryData)
+	} else {
+		if err := app.mainView.applyQueryEditData(app.params.initialQueryData, doQueryParams{}); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
 func (app *nerdlogApp) runTViewApp() error {
 	err := app.tviewApp.SetRoot(app.mainView.GetUIPrimitive(), true).Run()
 
@@ -196,19 +360,22 @@ func createEphemeralKeyProvider(providerType string) core.EphemeralKeyProvider {
 func (app *nerdlogApp) initLStreamsManager(
 	params nerdlogAppParams,
 	initialLStreams string,
-	homeDir string,
 	logger *log.Logger,
 ) error {
 	updatesCh := make(chan core.LStreamsManagerUpdate, 128)
 	go func() {
+		defer app.recoverPanic()
+
 		// We don't want to necessarily update UI on _every_ state update, since
 		// they might be getting a lot of those messages due to those progress
 		// percentage updates; so we just remember the last state, and only update
 		// the UI once we don't have more messages yet.
 		var lastState *core.LStreamsManagerState
 		var logResps []*core.LogRespTotal // TODO: perhaps we should also only keep the last one?
+		var firstLastResps []*core.FirstLastRespTotal
 		var bootstrapErrors []error
 		var bootstrapWarnings []error
+		var logFormatsDetected []*core.LogFormatDetected
 		var dataRequests []*core.ShellConnDataRequest
 
 		handleUpdate := func(upd core.LStreamsManagerUpdate) {
@@ -217,6 +384,8 @@ func (app *nerdlogApp) initLStreamsManager(
 				lastState = upd.State
 			case upd.LogResp != nil:
 				logResps = append(logResps, upd.LogResp)
+			case upd.FirstLastResp != nil:
+				firstLastResps = append(firstLastResps, upd.FirstLastResp)
 			case upd.BootstrapIssue != nil:
 				if upd.BootstrapIssue.Err != "" {
 					bootstrapErrors = append(
@@ -232,6 +401,9 @@ func (app *nerdlogApp) initLStreamsManager(
 					)
 				}
 
+			case upd.LogFormatDetected != nil:
+				logFormatsDetected = append(logFormatsDetected, upd.LogFormatDetected)
+
 			case upd.DataRequest != nil:
 				dataRequests = append(dataRequests, upd.DataRequest)
 
@@ -254,8 +426,10 @@ func (app *nerdlogApp) initLStreamsManager(
 				if app.tviewApp != nil &&
 					(lastState != nil ||
 						len(logResps) > 0 ||
+						len(firstLastResps) > 0 ||
 						len(bootstrapErrors) > 0 ||
 						len(bootstrapWarnings) > 0 ||
+						len(logFormatsDetected) > 0 ||
 						len(dataRequests) > 0) {
 
 					app.tviewApp.QueueUpdateDraw(func() {
@@ -271,6 +445,14 @@ func (app *nerdlogApp) initLStreamsManager(
 
 							app.mainView.applyLogs(logResp)
 							app.lastLogResp = logResp
+
+							if logResp.TransferBudgetExceeded {
+								app.handleTransferBudgetExceeded(logResp)
+							}
+						}
+
+						for _, flResp := range firstLastResps {
+							app.mainView.showFirstLastResp(flResp)
 						}
 
 						if len(bootstrapErrors) > 0 {
@@ -281,6 +463,10 @@ func (app *nerdlogApp) initLStreamsManager(
 							app.mainView.handleBootstrapWarning(combineErrors(bootstrapWarnings))
 						}
 
+						if len(logFormatsDetected) > 0 {
+							app.handleLogFormatsDetected(logFormatsDetected)
+						}
+
 						for _, dataReq := range dataRequests {
 							app.mainView.handleDataRequest(dataReq)
 						}
@@ -288,8 +474,10 @@ func (app *nerdlogApp) initLStreamsManager(
 
 					lastState = nil
 					logResps = nil
+					firstLastResps = nil
 					bootstrapErrors = nil
 					bootstrapWarnings = nil
+					logFormatsDetected = nil
 					dataRequests = nil
 				}
 
@@ -302,25 +490,68 @@ func (app *nerdlogApp) initLStreamsManager(
 		}
 	}()
 
-	envUser := os.Getenv("USER")
-
-	var logstreamsCfg core.ConfigLogStreams
-	logstreamsCfgPath := filepath.Join(homeDir, ".config", "nerdlog", "logstreams.yaml")
-	_, statErr := os.Stat(logstreamsCfgPath)
-	if statErr == nil {
-		appLogstreamsCfg, err := LoadLogstreamsConfigFromFile(logstreamsCfgPath)
+	if params.useDaemon {
+		client, err := daemon.NewClient(daemon.ClientParams{
+			SocketPath:    params.daemonSocketPath,
+			Session:       params.daemonSession,
+			UpdatesCh:     updatesCh,
+			OnSharedQuery: app.handleSharedQuery,
+			Logger:        logger,
+		})
 		if err != nil {
 			return errors.Trace(err)
 		}
 
-		logstreamsCfg = appLogstreamsCfg.LogStreams
+		app.lsman = client
+		app.daemonClient = client
+		return nil
 	}
 
+	lsmanParams, err := makeLStreamsManagerParams(params, app.logstreamsCfg, logger)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	lsmanParams.InitialLStreams = initialLStreams
+	lsmanParams.UpdatesCh = updatesCh
+
+	app.lsman = core.NewLStreamsManager(lsmanParams)
+
+	return nil
+}
+
+// loadLogstreamsConfig loads ~/.config/nerdlog/logstreams.yaml, if it
+// exists; otherwise returns nil. See LoadLogstreamsConfigFromFile for the
+// warnings.
+func loadLogstreamsConfig(homeDir string) (core.ConfigLogStreams, ConfigErrors, error) {
+	logstreamsCfgPath := filepath.Join(homeDir, ".config", "nerdlog", "logstreams.yaml")
+	if _, err := os.Stat(logstreamsCfgPath); err != nil {
+		return nil, nil, nil
+	}
+
+	appLogstreamsCfg, warnings, err := LoadLogstreamsConfigFromFile(logstreamsCfgPath)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+
+	return appLogstreamsCfg.LogStreams, warnings, nil
+}
+
+// makeLStreamsManagerParams loads the ssh config and returns the params for
+// a new LStreamsManager with the given logstreams config; the caller still
+// needs to set InitialLStreams and UpdatesCh.
+func makeLStreamsManagerParams(
+	params nerdlogAppParams,
+	logstreamsCfg core.ConfigLogStreams,
+	logger *log.Logger,
+) (core.LStreamsManagerParams, error) {
+	envUser := os.Getenv("USER")
+
 	var sshConfig *ssh_config.Config
 	if params.sshConfigPath != "" {
 		file, err := os.Open(params.sshConfigPath)
 		if err != nil {
-			return errors.Annotatef(
+			return core.LStreamsManagerParams{}, errors.Annotatef(
 				err,
 				"opening ssh config from %s (path is configurable via --ssh-config)",
 				params.sshConfigPath,
@@ -330,7 +561,7 @@ func (app *nerdlogApp) initLStreamsManager(
 
 		sshConfig, err = ssh_config.Decode(file)
 		if err != nil {
-			return errors.Annotatef(
+			return core.LStreamsManagerParams{}, errors.Annotatef(
 				err,
 				"parsing ssh config from %s (path is configurable via --ssh-config)",
 				params.sshConfigPath,
@@ -341,28 +572,77 @@ func (app *nerdlogApp) initLStreamsManager(
 	// Create ephemeral key provider
 	ephemeralKeyProvider := createEphemeralKeyProvider(params.EphemeralKeyProvider)
 
-	app.lsman = core.NewLStreamsManager(core.LStreamsManagerParams{
+	var authCallback core.AuthCallback
+	if params.authHelper != "" {
+		authCallback = core.NewAuthHelperCallback(params.authHelper)
+	}
+
+	var capabilitiesCache core.CapabilitiesCache
+	if fname, err := capabilitiesCacheFilename(); err == nil {
+		capabilitiesCache = newFileCapabilitiesCache(fname, logger)
+	} else {
+		logger.Errorf("Not caching host capabilities: %s\n", err.Error())
+	}
+
+	var logFormatOverrides core.LogFormatOverrides
+	if fname, err := logFormatsFilename(); err == nil {
+		logFormatOverrides = newFileLogFormats(fname, logger)
+	} else {
+		logger.Errorf("Not using the confirmed log formats: %s\n", err.Error())
+	}
+
+	return core.LStreamsManagerParams{
 		Logger: logger,
 
 		ConfigLogStreams: logstreamsCfg,
 		SSHConfig:        sshConfig,
 		SSHKeys:          params.sshKeys,
 
-		InitialLStreams: initialLStreams,
-
 		ClientID: envUser,
 
-		UpdatesCh: updatesCh,
+		CapabilitiesCache:  capabilitiesCache,
+		LogFormatOverrides: logFormatOverrides,
+		AuthCallback:       authCallback,
+		AllowPasswordAuth:  params.allowPasswordAuth,
 
 		Clock: clock.New(),
 
 		EphemeralKeyProvider: ephemeralKeyProvider,
-	})
+	}, nil
+}
 
-	return nil
+// isReadOnly returns true if we're attached to a daemon session which is
+// controlled by another client.
+func (app *nerdlogApp) isReadOnly() bool {
+	return app.daemonClient != nil && app.daemonClient.ReadOnly()
+}
+
+// handleSharedQuery is called by the daemon client when the client in control
+// of the session runs a query; we mirror it on the UI, without querying
+// anything: the logs will be delivered by the daemon as well.
+func (app *nerdlogApp) handleSharedQuery(qfStr string) {
+	tviewApp := app.tviewApp
+	if tviewApp == nil {
+		return
+	}
+
+	tviewApp.QueueUpdateDraw(func() {
+		var qf QueryFull
+		if err := qf.UnmarshalShellCmd(qfStr); err != nil {
+			app.printError(fmt.Sprintf("Failed to parse shared query: %s", err))
+			return
+		}
+
+		if err := app.mainView.mirrorQueryEditData(qf); err != nil {
+			app.printError(fmt.Sprintf("Failed to apply shared query: %s", err))
+			return
+		}
+	})
 }
 
 func (app *nerdlogApp) handleCmdLine(cmdCh <-chan cmdWithOpts) {
+	defer app.recoverPanic()
+
 	for {
 		cwo := <-cmdCh
 		app.tviewApp.QueueUpdateDraw(func() {
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// asyncOpSpinnerInterval is how often the spinner of the async op
+// messagebox is updated.
+const asyncOpSpinnerInterval = 250 * time.Millisecond
+
+type asyncOpParams struct {
+	// MessageID is the ID of the messagebox shown while the op is running.
+	MessageID string
+
+	// Title and Message are shown on the messagebox, after the spinner; the
+	// Message is not escaped, so it can contain the color tags.
+	Title   string
+	Message string
+
+	// Run does the actual work in a separate goroutine, so it must not touch
+	// the UI. If the user cancels the op, the ctx is cancelled, and Run should
+	// return early.
+	Run func(ctx context.Context) error
+
+	// OnDone is called in the UI goroutine with the error returned by Run,
+	// after the messagebox is hidden; it's not called if the op is cancelled.
+	OnDone func(err error)
+}
+
+// runAsyncOp runs the long operation in a separate goroutine, while showing the
+// messagebox with a spinner and the Cancel button; once it's done, the result
+// is passed to params.OnDone in the UI goroutine.
+//
+// Like the other UI code, it must be called from the UI goroutine; it never
+// blocks it, so it can be used right from the key handlers etc.
+func (app *nerdlogApp) runAsyncOp(params asyncOpParams) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// These are only accessed from the UI goroutine.
+	spinner := '-'
+	finished := false
+
+	getText := func() string {
+		return fmt.Sprintf("%c %s", spinner, params.Message)
+	}
+
+	var msgv *MessageView
+	msgv = app.mainView.showMessagebox(params.MessageID, params.Title, getText(), &MessageboxParams{
+		Buttons:      []string{"&Cancel"},
+		CancelButton: "Cancel",
+		OnButtonPressed: func(label string, idx int) {
+			finished = true
+			cancel()
+			msgv.Hide()
+		},
+
+		Align: tview.AlignCenter,
+	})
+
+	// Keep the spinner spinning until the op is done or cancelled.
+	go func() {
+		defer app.recoverPanic()
+
+		ticker := time.NewTicker(asyncOpSpinnerInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				// The TUI might have exited already.
+				if app.tviewApp == nil {
+					return
+				}
+
+				app.tviewApp.QueueUpdateDraw(func() {
+					if finished {
+						return
+					}
+
+					spinner = nextSpinnerFrame(spinner)
+					msgv.SetText(getText(), true)
+				})
+			}
+		}
+	}()
+
+	go func() {
+		defer app.recoverPanic()
+
+		err := params.Run(ctx)
+
+		// The TUI might have exited already.
+		if app.tviewApp == nil {
+			cancel()
+			return
+		}
+
+		app.tviewApp.QueueUpdateDraw(func() {
+			// Stops the spinner too.
+			cancel()
+
+			if finished {
+				// Cancelled by the user.
+				return
+			}
+
+			finished = true
+			msgv.Hide()
+
+			if params.OnDone != nil {
+				params.OnDone(err)
+			}
+		})
+	}()
+}
+
+// nextSpinnerFrame returns the next frame of the spinner, which goes
+// "-", "\", "|", "/", and then "-" again.
+func nextSpinnerFrame(cur rune) rune {
+	switch cur {
+	case '-':
+		return '\\'
+	case '\\':
+		return '|'
+	case '|':
+		return '/'
+	default:
+		return '-'
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncOp(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+
+	// startOp starts the op which runs until the ctx is done or the result is
+	// sent to the returned channel; the error passed to OnDone is sent to
+	// doneCh.
+	doneCh := make(chan error, 1)
+	startOp := func() (chan error, chan context.Context) {
+		resCh := make(chan error)
+		runCtxCh := make(chan context.Context, 1)
+
+		h.app.tviewApp.QueueUpdateDraw(func() {
+			h.app.runAsyncOp(asyncOpParams{
+				MessageID: "test_op",
+				Title:     "Test op",
+				Message:   "Doing stuff...",
+
+				Run: func(ctx context.Context) error {
+					runCtxCh <- ctx
+					select {
+					case err := <-resCh:
+						return err
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				},
+
+				OnDone: func(err error) {
+					doneCh <- err
+				},
+			})
+		})
+
+		return resCh, runCtxCh
+	}
+
+	// Once done, the messagebox is hidden, and the result is delivered.
+	resCh, _ := startOp()
+	h.waitForText("Doing stuff...")
+	resCh <- errors.New("oops")
+
+	select {
+	case err := <-doneCh:
+		assert.EqualError(t, err, "oops")
+	case <-time.After(uiWaitTimeout):
+		t.Fatalf("OnDone wasn't called")
+	}
+	h.waitForNoText("Doing stuff...")
+
+	// On Esc, the op is cancelled, and OnDone is not called.
+	_, runCtxCh := startOp()
+	h.waitForText("Doing stuff...")
+	runCtx := <-runCtxCh
+
+	h.pressKey(tcell.KeyEsc)
+	h.waitForNoText("Doing stuff...")
+
+	select {
+	case <-runCtx.Done():
+	case <-time.After(uiWaitTimeout):
+		t.Fatalf("The op wasn't cancelled")
+	}
+
+	// Give the op a chance to deliver the result, if it was going to.
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, doneCh)
+}
+
+func TestNextSpinnerFrame(t *testing.T) {
+	frames := []rune{'-'}
+	for i := 0; i < 4; i++ {
+		frames = append(frames, nextSpinnerFrame(frames[len(frames)-1]))
+	}
+
+	assert.Equal(t, "-\\|/-", string(frames))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// brushLogs returns the logs, which must be sorted by time, within the given
+// time range; from is inclusive, to is not.
+func brushLogs(logs []core.LogMsg, from, to time.Time) []core.LogMsg {
+	fromIdx := sort.Search(len(logs), func(i int) bool {
+		return !logs[i].Time.Before(from)
+	})
+	toIdx := sort.Search(len(logs), func(i int) bool {
+		return !logs[i].Time.Before(to)
+	})
+
+	return logs[fromIdx:toIdx]
+}
+
+// setBrush filters the logs table to the given time range, without querying
+// anything: only the logs which are loaded already are filtered. Zero from
+// and to reset it, so all the loaded logs are shown again.
+func (mv *MainView) setBrush(from, to time.Time) {
+	mv.brushFrom, mv.brushTo = from, to
+
+	mv.formatTimeRange()
+	mv.formatLogs()
+	mv.logsTable.Select(mv.logsTable.GetRowCount()-1, 0)
+	mv.logsTable.ScrollToEnd()
+
+	if from.IsZero() {
+		mv.printMsg("Showing all the loaded logs", nlMsgLevelInfo)
+		return
+	}
+
+	numShown := 0
+	if mv.curLogResp != nil {
+		numShown = len(brushLogs(mv.curLogResp.Logs, from, to))
+	}
+
+	mv.printMsg(fmt.Sprintf(
+		"Showing %d loaded logs in the selected range; f on the histogram without a selection shows all of them", numShown,
+	), nlMsgLevelInfo)
+}
+
+// getShownLogs returns the logs which the table is showing: all the loaded
+// ones, or only the ones within the brush, if any.
+func (mv *MainView) getShownLogs() []core.LogMsg {
+	if mv.curLogResp == nil {
+		return nil
+	}
+
+	if mv.brushFrom.IsZero() {
+		return mv.curLogResp.Logs
+	}
+
+	return brushLogs(mv.curLogResp.Logs, mv.brushFrom, mv.brushTo)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBrushLogs(t *testing.T) {
+	t0 := time.Date(2025, 3, 11, 10, 0, 0, 0, time.UTC)
+	minute := func(n int) time.Time {
+		return t0.Add(time.Duration(n) * time.Minute)
+	}
+
+	logs := []core.LogMsg{
+		{Time: minute(0)},
+		{Time: minute(1)},
+		{Time: minute(2)},
+		{Time: minute(2)},
+		{Time: minute(3)},
+	}
+
+	assert.Equal(t, logs[1:4], brushLogs(logs, minute(1), minute(3)))
+	assert.Equal(t, logs, brushLogs(logs, minute(0), minute(4)))
+	assert.Empty(t, brushLogs(logs, minute(5), minute(6)))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+var byteSizeSuffixes = []struct {
+	suffix string
+	mult   int
+}{
+	{"G", 1024 * 1024 * 1024},
+	{"M", 1024 * 1024},
+	{"K", 1024},
+}
+
+// parseByteSize parses sizes like "500", "64K", "10M" or "1G" (suffixes are
+// powers of 1024, case-insensitive, and an optional trailing "B" is allowed).
+func parseByteSize(s string) (int, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	if len(str) > 1 {
+		str = strings.TrimSuffix(str, "B")
+	}
+
+	mult := 1
+	for _, v := range byteSizeSuffixes {
+		if strings.HasSuffix(str, v.suffix) {
+			str = strings.TrimSuffix(str, v.suffix)
+			mult = v.mult
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid size %q, try something like 500K or 10M", s)
+	}
+
+	return int(n * float64(mult)), nil
+}
+
+// formatByteSize formats the size in a human-readable way with at most one
+// decimal digit, like "10M" or "1.5G", so that it can be parsed back with
+// parseByteSize (give or take the rounding).
+func formatByteSize(n int) string {
+	for _, v := range byteSizeSuffixes {
+		if n >= v.mult {
+			str := strconv.FormatFloat(float64(n)/float64(v.mult), 'f', 1, 64)
+			return strings.TrimSuffix(str, ".0") + v.suffix
+		}
+	}
+
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "500", want: 500},
+		{in: "64K", want: 64 * 1024},
+		{in: "64kb", want: 64 * 1024},
+		{in: "10M", want: 10 * 1024 * 1024},
+		{in: "1.5G", want: 1536 * 1024 * 1024},
+		{in: "B", wantErr: true},
+		{in: "foo", wantErr: true},
+		{in: "-1M", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if tt.wantErr {
+			assert.Error(t, err, tt.in)
+			continue
+		}
+
+		assert.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	assert.Equal(t, "0", formatByteSize(0))
+	assert.Equal(t, "500", formatByteSize(500))
+	assert.Equal(t, "64K", formatByteSize(64*1024))
+	assert.Equal(t, "10M", formatByteSize(10*1024*1024))
+	assert.Equal(t, "1.5G", formatByteSize(1536*1024*1024))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+)
+
+// fileCapabilitiesCache is a core.CapabilitiesCache stored as a JSON file, so
+// that the hosts are only probed on the very first connection.
+type fileCapabilitiesCache struct {
+	path   string
+	logger *log.Logger
+
+	mtx  sync.Mutex
+	caps map[string]core.HostCapabilities
+}
+
+var _ core.CapabilitiesCache = &fileCapabilitiesCache{}
+
+// newFileCapabilitiesCache returns the cache stored at the given path. If the
+// file is missing or broken, the cache starts empty; the errors are reported
+// via the logger.
+func newFileCapabilitiesCache(path string, logger *log.Logger) *fileCapabilitiesCache {
+	c := &fileCapabilitiesCache{
+		path:   path,
+		logger: logger,
+		caps:   map[string]core.HostCapabilities{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logger.Errorf("Failed to read capabilities cache %s: %s\n", path, err.Error())
+		}
+
+		return c
+	}
+
+	if err := json.Unmarshal(data, &c.caps); err != nil {
+		c.logger.Errorf("Failed to parse capabilities cache %s: %s\n", path, err.Error())
+		c.caps = map[string]core.HostCapabilities{}
+	}
+
+	return c
+}
+
+func capabilitiesCacheFilename() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Annotatef(err, "getting cache dir")
+	}
+
+	return filepath.Join(cacheDir, "nerdlog", "capabilities.json"), nil
+}
+
+func (c *fileCapabilitiesCache) Get(hostKey string) (core.HostCapabilities, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	caps, ok := c.caps[hostKey]
+	return caps, ok
+}
+
+func (c *fileCapabilitiesCache) Put(hostKey string, caps core.HostCapabilities) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.caps[hostKey] = caps
+
+	if err := c.save(); err != nil {
+		c.logger.Errorf("Failed to save capabilities cache: %s\n", err.Error())
+	}
+}
+
+// save writes the cache to the file; must be called with mtx locked.
+func (c *fileCapabilitiesCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return errors.Annotatef(err, "creating dir for %s", c.path)
+	}
+
+	data, err := json.MarshalIndent(c.caps, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		return errors.Annotatef(err, "writing %s", c.path)
+	}
+
+	return nil
+}
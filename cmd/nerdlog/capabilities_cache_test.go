@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCapabilitiesCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nerdlog", "capabilities.json")
+
+	cache := newFileCapabilitiesCache(path, nil)
+	_, ok := cache.Get("user@host:22")
+	assert.False(t, ok)
+
+	caps := core.HostCapabilities{
+		Journalctl: true,
+		Gzip:       true,
+		Awk:        "gnu",
+		ProbedAt:   time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+	cache.Put("user@host:22", caps)
+
+	// A new cache must load what the previous one saved.
+	cache = newFileCapabilitiesCache(path, nil)
+	got, ok := cache.Get("user@host:22")
+	assert.True(t, ok)
+	assert.Equal(t, caps, got)
+}
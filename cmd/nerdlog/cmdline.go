@@ -3,9 +3,13 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dimonomid/nerdlog/clipboard"
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/log"
 	"github.com/dimonomid/nerdlog/version"
 	"github.com/gdamore/tcell/v2"
 	"github.com/juju/errors"
@@ -33,13 +37,13 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 		})
 
 	case "time":
-		ftr, err := ParseFromToRange(app.options.GetTimezone(), strings.Join(parts[1:], " "))
+		ranges, err := ParseFromToRanges(app.options.GetTimezone(), strings.Join(parts[1:], " "))
 		if err != nil {
 			app.printError(err.Error())
 			return
 		}
 
-		app.mainView.setTimeRange(ftr.From, ftr.To)
+		app.mainView.setTimeRanges(ranges)
 		app.mainView.doQuery(doQueryParams{})
 
 	case "w", "write":
@@ -145,51 +149,86 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 			return
 		}
 
-	case "prev", "bac", "bck", "back":
-		item := app.queryBLHistory.Prev()
-		if item == nil {
-			app.printError("No more history items")
+	case "prev", "bac", "bck", "back", "u", "undo":
+		app.navigateQueryHistory(true)
+
+	case "next", "fwd", "forward", "red", "redo":
+		app.navigateQueryHistory(false)
+
+	case "e", "edit":
+		app.mainView.openQueryEditView()
+
+	case "q", "quit":
+		app.tviewApp.Stop()
+
+	case "reconnect":
+		app.mainView.reconnect(true)
+
+	case "disconnect":
+		app.mainView.disconnect()
+
+	case "where":
+		if len(parts) < 2 {
+			app.printError(":where requires an awk pattern, e.g. :where /foo/")
+			return
+		}
+
+		// Take the pattern verbatim, not split into fields.
+		pattern := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd), parts[0]))
+
+		app.mainView.setQuery(addFilterStage(app.mainView.query, pattern))
+		app.mainView.doQuery(doQueryParams{})
+
+	case "uaclass", "ua":
+		if len(parts) < 2 {
+			app.printError(fmt.Sprintf(
+				":uaclass requires the user agent classes, e.g. :uaclass !bot,monitor; available ones: %s",
+				userAgentClassNames(),
+			))
 			return
 		}
 
-		if err := app.unmarshalAndApplyQuery(item.Str, doQueryParams{
-			dontAddHistoryItem: true,
-		}); err != nil {
-			// This shouldn't happen really provided a sane history.
+		classes, exclude, err := parseUserAgentClasses(strings.Join(parts[1:], ""))
+		if err != nil {
 			app.printError(err.Error())
 			return
 		}
 
-		// TODO: print history item stats
+		pattern := userAgentClassesFilterPattern(classes, exclude)
+		app.mainView.setQuery(addFilterStage(app.mainView.query, pattern))
+		app.mainView.doQuery(doQueryParams{})
 
-	case "next", "fwd", "forward":
-		item := app.queryBLHistory.Next()
-		if item == nil {
-			app.printError("No more history items")
+	case "summarize", "sum":
+		lastN, err := parseLastNArg(parts)
+		if err != nil {
+			app.printError(err.Error())
 			return
 		}
 
-		if err := app.unmarshalAndApplyQuery(item.Str, doQueryParams{
-			dontAddHistoryItem: true,
-		}); err != nil {
-			// This shouldn't happen really provided a sane history.
+		app.summarize(lastN)
+
+	case "issue":
+		lastN, err := parseLastNArg(parts)
+		if err != nil {
 			app.printError(err.Error())
 			return
 		}
 
-		// TODO: print history item stats
+		app.showCreateIssue(lastN)
 
-	case "e", "edit":
-		app.mainView.openQueryEditView()
+	case "doctor":
+		app.showDoctor()
 
-	case "q", "quit":
-		app.tviewApp.Stop()
+	case "import-ssh-hosts":
+		if len(parts) != 2 {
+			app.printError(":import-ssh-hosts requires a glob pattern of the ssh config hosts, e.g. :import-ssh-hosts web-*")
+			return
+		}
 
-	case "reconnect":
-		app.mainView.reconnect(true)
+		app.importSSHHosts(parts[1])
 
-	case "disconnect":
-		app.mainView.disconnect()
+	case "pipeline", "pl":
+		app.mainView.showFilterPipeline()
 
 	case "refresh":
 		app.mainView.doQuery(doQueryParams{})
@@ -200,7 +239,67 @@ func (app *nerdlogApp) handleCmd(cmd string) {
 		})
 
 	case "debug":
-		app.mainView.showLastQueryDebugInfo()
+		if len(parts) < 2 {
+			app.mainView.showLastQueryDebugInfo()
+			return
+		}
+
+		switch parts[1] {
+		case "console":
+			minLevel := log.Info
+			if len(parts) >= 3 {
+				var err error
+				minLevel, err = log.ParseLogLevel(parts[2])
+				if err != nil {
+					app.printError(err.Error())
+					return
+				}
+			}
+
+			app.mainView.showDebugConsole(minLevel)
+
+		default:
+			app.printError(fmt.Sprintf("unknown debug subcommand %q, try :debug or :debug console [level]", parts[1]))
+		}
+
+	case "firstlast", "fl":
+		if app.isReadOnly() {
+			app.printError("Read-only: the session is controlled by another client")
+			return
+		}
+
+		// By default, look at all the available logs; but the time range can be
+		// narrowed down using the same syntax as for the :time command.
+		params := core.FindFirstLastParams{
+			Query: filterPipelineAwkPattern(app.mainView.query),
+		}
+
+		if len(parts) > 1 {
+			ftr, err := ParseFromToRange(app.options.GetTimezone(), strings.Join(parts[1:], " "))
+			if err != nil {
+				app.printError(err.Error())
+				return
+			}
+
+			// Same as for the regular time range, relative durations are only
+			// meaningful when negative.
+			if !ftr.From.IsAbsolute() && ftr.From.Dur > 0 {
+				ftr.From.Dur = -ftr.From.Dur
+			}
+
+			if !ftr.To.IsAbsolute() && ftr.To.Dur > 0 {
+				ftr.To.Dur = -ftr.To.Dur
+			}
+
+			now := time.Now()
+			params.From = ftr.From.AbsoluteTime(now)
+			if !ftr.To.IsZero() {
+				params.To = ftr.To.AbsoluteTime(now)
+			}
+		}
+
+		app.lsman.FindFirstLast(params)
+		app.printMsg("Looking for the first and last occurrences...")
 
 	case "version", "about":
 		app.mainView.showMessagebox("version", "Version", version.VersionFullDescr(), &MessageboxParams{
@@ -225,3 +324,18 @@ func (app *nerdlogApp) unmarshalAndApplyQuery(cmd string, dqp doQueryParams) err
 
 	return nil
 }
+
+// parseLastNArg parses the optional number of the last lines, like in
+// ":summarize 20"; returns 0 if it's not given.
+func parseLastNArg(parts []string) (int, error) {
+	if len(parts) < 2 {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n <= 0 {
+		return 0, errors.Errorf("Invalid number of lines: %q", parts[1])
+	}
+
+	return n, nil
+}
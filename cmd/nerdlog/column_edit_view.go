@@ -1,6 +1,9 @@
 package main
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/juju/errors"
 	"github.com/rivo/tview"
@@ -22,6 +25,7 @@ type ColumnEditView struct {
 
 	nameInput        *tview.InputField
 	displayNameInput *tview.InputField
+	widthInput       *tview.InputField
 	stickyCheckbox   *tview.Checkbox
 	frame            *tview.Frame
 }
@@ -112,6 +116,25 @@ func NewColumnEditView(
 
 	cev.flex.AddItem(nil, 1, 0, false)
 
+	widthLabel := tview.NewTextView()
+	widthLabel.SetText("Width (empty means fit to the content):")
+	widthLabel.SetDynamicColors(true)
+	cev.flex.AddItem(widthLabel, 1, 0, false)
+
+	cev.widthInput = tview.NewInputField()
+	cev.widthInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		event = cev.genericInputHandler(event, getGenericTabHandler(cev.widthInput), nil, nil)
+		if event == nil {
+			return nil
+		}
+
+		return event
+	})
+	cev.flex.AddItem(cev.widthInput, 1, 0, true)
+	focusers = append(focusers, cev.widthInput)
+
+	cev.flex.AddItem(nil, 1, 0, false)
+
 	stickyLabel := tview.NewTextView()
 	stickyLabel.SetText("Sticky")
 	stickyLabel.SetDynamicColors(true)
@@ -153,12 +176,17 @@ func (cev *ColumnEditView) Show(field SelectQueryField) {
 	} else {
 		cev.displayNameInput.SetText("")
 	}
+	if field.Width > 0 {
+		cev.widthInput.SetText(strconv.Itoa(field.Width))
+	} else {
+		cev.widthInput.SetText("")
+	}
 	cev.stickyCheckbox.SetChecked(field.Sticky)
 
 	cev.mainView.showModal(
 		pageNameColumnDetails, cev.frame,
 		60,
-		9,
+		12,
 		true,
 	)
 }
@@ -167,7 +195,7 @@ func (cev *ColumnEditView) Hide() {
 	cev.mainView.hideModal(pageNameColumnDetails, true)
 }
 
-func (cev *ColumnEditView) GetSelectQueryField() SelectQueryField {
+func (cev *ColumnEditView) GetSelectQueryField() (SelectQueryField, error) {
 	field := SelectQueryField{
 		Name:        cev.nameInput.GetText(),
 		DisplayName: cev.displayNameInput.GetText(),
@@ -178,7 +206,16 @@ func (cev *ColumnEditView) GetSelectQueryField() SelectQueryField {
 		field.DisplayName = field.Name
 	}
 
-	return field
+	if widthStr := strings.TrimSpace(cev.widthInput.GetText()); widthStr != "" {
+		width, err := strconv.Atoi(widthStr)
+		if err != nil || width < 0 {
+			return SelectQueryField{}, errors.Errorf("invalid width %q", widthStr)
+		}
+
+		field.Width = width
+	}
+
+	return field, nil
 }
 
 func (cev *ColumnEditView) genericInputHandler(
@@ -208,7 +245,12 @@ func (cev *ColumnEditView) genericInputHandler(
 }
 
 func (cev *ColumnEditView) apply() error {
-	err := cev.params.DoneFunc(cev.GetSelectQueryField())
+	field, err := cev.GetSelectQueryField()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	err = cev.params.DoneFunc(field)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -1,38 +1,51 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/dimonomid/nerdlog/core"
 	"github.com/juju/errors"
-	"gopkg.in/yaml.v2"
 )
 
 type ConfigLogStreams struct {
 	LogStreams core.ConfigLogStreams `yaml:"log_streams"`
 }
 
-func LoadLogstreamsConfigFromFile(path string) (*ConfigLogStreams, error) {
+// LoadLogstreamsConfigFromFile loads and validates the logstreams config.
+// Unlike the other configs, the unknown fields in it are not errors, so that
+// the config can be shared with other versions of nerdlog: they are returned
+// as warnings.
+func LoadLogstreamsConfigFromFile(path string) (*ConfigLogStreams, ConfigErrors, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, errors.Annotatef(err, "opening config file: %s", path)
+		return nil, nil, errors.Annotatef(err, "opening config file: %s", path)
 	}
 	defer file.Close()
 
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
-		return nil, errors.Annotatef(err, "reading config file %s", path)
+		return nil, nil, errors.Annotatef(err, "reading config file %s", path)
 	}
 
 	var cfg ConfigLogStreams
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, errors.Annotatef(err, "unmarshaling yaml from %s", path)
+	warnings, err := unmarshalConfigLenient(path, data, &cfg)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
 	}
 
 	// Make sure the logstreams configuration is not obviously invalid.
-	for k, cls := range cfg.LogStreams {
+	var errs ConfigErrors
+	for _, k := range cfg.LogStreams.Keys() {
+		cls := cfg.LogStreams[k]
+		optionPath := func(name string) []string {
+			return []string{"log_streams", k, "options", name}
+		}
+
 		_, ok := core.ValidSudoModes[cls.Options.SudoMode]
 		if cls.Options.SudoMode != "" && !ok {
 			validModes := make([]string, 0, len(core.ValidSudoModes))
@@ -42,18 +55,51 @@ func LoadLogstreamsConfigFromFile(path string) (*ConfigLogStreams, error) {
 
 			sort.Strings(validModes)
 
-			return nil, errors.Errorf(
-				"%s: invalid sudo_mode %q; valid options are: %s",
-				k, cls.Options.SudoMode, validModes,
-			)
+			errs = append(errs, newConfigError(
+				path, data, optionPath("sudo_mode"),
+				fmt.Sprintf("invalid sudo_mode %q", cls.Options.SudoMode),
+				"valid options are: "+strings.Join(validModes, ", "),
+			))
 		}
 
 		if cls.Options.SudoMode != "" && cls.Options.Sudo {
-			return nil, errors.Errorf(
-				"%s: both sudo and sudo_mode are set; please only use one of them", k,
-			)
+			errs = append(errs, newConfigError(
+				path, data, optionPath("sudo"),
+				"both sudo and sudo_mode are set",
+				"please only use one of them",
+			))
+		}
+
+		if err := core.ValidateIONice(cls.Options.IONice); err != nil {
+			errs = append(errs, newConfigError(
+				path, data, optionPath("ionice"),
+				err.Error(),
+				`use "idle", "best-effort", or "best-effort:<level>" with the level from 0 to 7`,
+			))
+		}
+
+		if _, err := cls.Options.ParseTimeout(); err != nil {
+			errs = append(errs, newConfigError(
+				path, data, optionPath("timeout"),
+				err.Error(),
+				`use a positive duration like "5m"`,
+			))
+		}
+
+		if cls.Port != "" {
+			if port, err := strconv.Atoi(cls.Port); err != nil || port <= 0 || port > 65535 {
+				errs = append(errs, newConfigError(
+					path, data, []string{"log_streams", k, "port"},
+					fmt.Sprintf("invalid port %q", cls.Port),
+					"must be a number from 1 to 65535",
+				))
+			}
 		}
 	}
 
-	return &cfg, nil
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	return &cfg, warnings, nil
 }
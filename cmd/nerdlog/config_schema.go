@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigError is an error in a config file, pointing at the exact place in
+// it, and possibly suggesting how to fix it.
+type ConfigError struct {
+	Path string
+
+	// Line is 1-based; zero if unknown.
+	Line int
+
+	// Field is the dot-separated path to the field, like
+	// "log_streams.myhost.options.sudo_mode"; empty if unknown.
+	Field string
+
+	Msg string
+
+	// Fix is the suggested fix, like "did you mean log_files?"; empty if
+	// there's none.
+	Fix string
+
+	// unknownField is true if the error is about an unknown field; see
+	// unmarshalConfigLenient.
+	unknownField bool
+}
+
+func (e *ConfigError) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Path)
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ":%d", e.Line)
+	}
+	sb.WriteString(": ")
+
+	if e.Field != "" {
+		sb.WriteString(e.Field)
+		sb.WriteString(": ")
+	}
+
+	sb.WriteString(e.Msg)
+
+	if e.Fix != "" {
+		sb.WriteString(" (")
+		sb.WriteString(e.Fix)
+		sb.WriteString(")")
+	}
+
+	return sb.String()
+}
+
+// ConfigErrors is a list of errors found in a config file.
+type ConfigErrors []*ConfigError
+
+func (errs ConfigErrors) Error() string {
+	lines := make([]string, 0, len(errs))
+	for _, err := range errs {
+		lines = append(lines, err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// newConfigError returns the error for the field with the given path in the
+// yaml data (see findYAMLKeyLine).
+func newConfigError(path string, data []byte, fieldPath []string, msg, fix string) *ConfigError {
+	return &ConfigError{
+		Path:  path,
+		Line:  findYAMLKeyLine(data, fieldPath...),
+		Field: strings.Join(fieldPath, "."),
+		Msg:   msg,
+		Fix:   fix,
+	}
+}
+
+var (
+	yamlLineRegex          = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlUnknownFieldRegex  = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+	yamlCannotUnmarshalRgx = regexp.MustCompile(`^cannot unmarshal (\S+)(?: .*)? into (\S+)$`)
+)
+
+// unmarshalConfig strictly unmarshals the yaml data from the given config file
+// into out, which must be a pointer to the config struct. If there are errors,
+// they are returned as ConfigErrors, with the lines, fields and fixes figured
+// out as far as possible: e.g. for an unknown field, the closest known field
+// of the same struct is suggested.
+func unmarshalConfig(path string, data []byte, out interface{}) error {
+	err := yaml.UnmarshalStrict(data, out)
+	if err == nil {
+		return nil
+	}
+
+	var msgs []string
+	typeErr, isTypeErr := err.(*yaml.TypeError)
+	if isTypeErr {
+		msgs = typeErr.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+
+	fieldsByType := map[string][]string{}
+	collectYAMLFields(reflect.TypeOf(out), fieldsByType)
+
+	keyLines := parseYAMLKeyLines(data)
+
+	errs := make(ConfigErrors, 0, len(msgs))
+	for _, msg := range msgs {
+		cfgErr := &ConfigError{Path: path, Msg: msg}
+
+		if m := yamlLineRegex.FindStringSubmatch(msg); m != nil {
+			cfgErr.Line, _ = strconv.Atoi(m[1])
+			cfgErr.Msg = m[2]
+
+			for _, kl := range keyLines {
+				if kl.line == cfgErr.Line {
+					cfgErr.Field = strings.Join(kl.path, ".")
+					break
+				}
+			}
+		}
+
+		if m := yamlUnknownFieldRegex.FindStringSubmatch(cfgErr.Msg); m != nil {
+			known := fieldsByType[m[2]]
+			cfgErr.Msg = "unknown field " + m[1]
+			cfgErr.unknownField = true
+
+			if closest := closestString(m[1], known); closest != "" {
+				cfgErr.Fix = fmt.Sprintf("did you mean %s?", closest)
+			} else if len(known) > 0 {
+				cfgErr.Fix = "known fields are: " + strings.Join(known, ", ")
+			}
+		} else if m := yamlCannotUnmarshalRgx.FindStringSubmatch(cfgErr.Msg); m != nil {
+			cfgErr.Fix = fmt.Sprintf("the value must be %s", describeYAMLType(m[2]))
+		} else if !isTypeErr {
+			cfgErr.Fix = "check the indentation and the quoting around this line"
+		}
+
+		errs = append(errs, cfgErr)
+	}
+
+	return errs
+}
+
+// unmarshalConfigLenient is like unmarshalConfig, but the unknown fields are
+// not errors: they are ignored, and returned as warnings instead. Any other
+// errors are still returned as errors.
+func unmarshalConfigLenient(path string, data []byte, out interface{}) (ConfigErrors, error) {
+	err := unmarshalConfig(path, data, out)
+	if err == nil {
+		return nil, nil
+	}
+
+	cfgErrs, ok := err.(ConfigErrors)
+	if !ok {
+		return nil, err
+	}
+
+	for _, cfgErr := range cfgErrs {
+		if !cfgErr.unknownField {
+			return nil, err
+		}
+	}
+
+	// Only the unknown fields, so unmarshal it non-strictly, to make sure
+	// nothing else is missing.
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return nil, errors.Annotatef(err, "unmarshaling yaml from %s", path)
+	}
+
+	return cfgErrs, nil
+}
+
+// describeYAMLType returns the human-readable description of the Go type
+// from the yaml error message, like "a list" for "[]string".
+func describeYAMLType(typ string) string {
+	switch {
+	case strings.HasPrefix(typ, "[]"):
+		return "a list"
+	case strings.HasPrefix(typ, "map["), strings.Contains(typ, "."):
+		return "a mapping"
+	case strings.HasPrefix(typ, "int"), strings.HasPrefix(typ, "uint"):
+		return "an integer"
+	case typ == "bool":
+		return "true or false"
+	}
+
+	return "a " + typ
+}
+
+// collectYAMLFields adds the yaml names of the fields of all the structs
+// reachable from the given type to fieldsByType, keyed by the type name as
+// it's printed by the yaml package, like "core.ConfigLogStream".
+func collectYAMLFields(t reflect.Type, fieldsByType map[string][]string) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		collectYAMLFields(t.Elem(), fieldsByType)
+		return
+	case reflect.Map:
+		collectYAMLFields(t.Elem(), fieldsByType)
+		return
+	case reflect.Struct:
+		// Handled below
+	default:
+		return
+	}
+
+	if _, ok := fieldsByType[t.String()]; ok {
+		return
+	}
+
+	fields := []string{}
+	fieldsByType[t.String()] = fields
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Unexported
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+
+		fields = append(fields, name)
+		collectYAMLFields(f.Type, fieldsByType)
+	}
+
+	fieldsByType[t.String()] = fields
+}
+
+// closestString returns the candidate which is the closest to s (in terms of
+// the edit distance), if it's close enough to be a likely typo; otherwise an
+// empty string.
+func closestString(s string, candidates []string) string {
+	maxDist := len(s) / 3
+	if maxDist < 2 {
+		maxDist = 2
+	}
+
+	closest := ""
+	closestDist := maxDist + 1
+	for _, c := range candidates {
+		if d := editDistance(s, c); d < closestDist {
+			closest, closestDist = c, d
+		}
+	}
+
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between the two strings.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+
+		prev, cur = cur, prev
+	}
+
+	return prev[len(br)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// yamlKeyLine is a line in yaml data which has a key, together with the path
+// to that key, like ["log_streams", "myhost", "port"]. The indices of the list
+// items are not included in the path.
+type yamlKeyLine struct {
+	line int
+	path []string
+}
+
+// parseYAMLKeyLines returns all the lines with keys from the yaml data. It's
+// not a real parser, it only looks at the indentation, so it doesn't handle
+// flow mappings or multiline keys, but that's enough to point the user at the
+// right line for the typical configs.
+func parseYAMLKeyLines(data []byte) []yamlKeyLine {
+	type stackItem struct {
+		indent int
+		key    string
+	}
+
+	var ret []yamlKeyLine
+	var stack []stackItem
+
+	// Block scalars (like "body: |") can contain anything, so their contents
+	// are skipped: it's all the lines indented more than the key.
+	blockIndent := -1
+
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		if blockIndent >= 0 {
+			if strings.TrimSpace(trimmed) == "" || indent > blockIndent {
+				continue
+			}
+
+			blockIndent = -1
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// The keys of list items are indented by the "- " too.
+		for strings.HasPrefix(trimmed, "- ") {
+			trimmed = strings.TrimLeft(trimmed[2:], " ")
+			indent = len(line) - len(trimmed)
+		}
+
+		colonIdx := strings.Index(trimmed, ":")
+		if colonIdx <= 0 || (colonIdx+1 < len(trimmed) && trimmed[colonIdx+1] != ' ') {
+			continue
+		}
+
+		key := strings.Trim(trimmed[:colonIdx], `"'`)
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, stackItem{indent: indent, key: key})
+
+		path := make([]string, 0, len(stack))
+		for _, item := range stack {
+			path = append(path, item.key)
+		}
+
+		ret = append(ret, yamlKeyLine{line: i + 1, path: path})
+
+		value := strings.TrimSpace(trimmed[colonIdx+1:])
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			blockIndent = indent
+		}
+	}
+
+	return ret
+}
+
+// findYAMLKeyLine returns the 1-based line of the key with the given path in
+// the yaml data (see parseYAMLKeyLines), or of its closest parent if the key
+// itself isn't there; zero if none of them are found.
+func findYAMLKeyLine(data []byte, path ...string) int {
+	keyLines := parseYAMLKeyLines(data)
+
+	for n := len(path); n > 0; n-- {
+		for _, kl := range keyLines {
+			if reflect.DeepEqual(kl.path, path[:n]) {
+				return kl.line
+			}
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadLogstreamsConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nerdlog_config_schema_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logstreams.yaml")
+
+	testCases := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "wrong type",
+			yaml: `
+log_streams:
+  myhost-01:
+    log_files: /var/log/syslog
+`,
+			wantErr: path + ":4: log_streams.myhost-01.log_files: cannot unmarshal !!str `/var/lo...` into []string (the value must be a list)",
+		},
+		{
+			name: "syntax error",
+			yaml: `
+log_streams:
+  myhost-01:
+    hostname: foo: bar
+`,
+			wantErr: path + ":4: log_streams.myhost-01.hostname: mapping values are not allowed in this context " +
+				"(check the indentation and the quoting around this line)",
+		},
+		{
+			name: "invalid values",
+			yaml: `
+log_streams:
+  myhost-01:
+    port: 99999
+  myhost-02:
+    options:
+      sudo: true
+      # The sudo_mode is here
+      sudo_mode: foo
+      timeout: -5m
+`,
+			wantErr: "" +
+				path + ":4: log_streams.myhost-01.port: invalid port \"99999\" (must be a number from 1 to 65535)\n" +
+				path + ":9: log_streams.myhost-02.options.sudo_mode: invalid sudo_mode \"foo\" (valid options are: full, none)\n" +
+				path + ":7: log_streams.myhost-02.options.sudo: both sudo and sudo_mode are set (please only use one of them)\n" +
+				path + ":10: log_streams.myhost-02.options.timeout: invalid timeout \"-5m\": must be positive (use a positive duration like \"5m\")",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.yaml), 0600))
+
+			_, _, err := LoadLogstreamsConfigFromFile(path)
+			require.Error(t, err)
+			assert.Equal(t, tc.wantErr, err.Error())
+
+			_, ok := errors.Cause(err).(ConfigErrors)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestLoadLogstreamsConfigWarnings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nerdlog_config_schema_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logstreams.yaml")
+
+	// The unknown fields are only warnings, and the rest of the config is
+	// still loaded.
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+log_streams:
+  myhost-01:
+    hostname: actualhost1.com
+    log_file:
+      - /some/custom/logfile
+    options:
+      foobarbaz: true
+      sudo: true
+`), 0600))
+
+	cfg, warnings, err := LoadLogstreamsConfigFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "actualhost1.com", cfg.LogStreams["myhost-01"].Hostname)
+	assert.True(t, cfg.LogStreams["myhost-01"].Options.Sudo)
+	assert.Equal(t, ""+
+		path+":5: log_streams.myhost-01.log_file: unknown field log_file (did you mean log_files?)\n"+
+		path+":8: log_streams.myhost-01.options.foobarbaz: unknown field foobarbaz "+
+		"(known fields are: sudo, sudo_mode, shell_init, native_scan, nice, ionice, timeout, display_name)",
+		warnings.Error(),
+	)
+
+	// But if there are any actual errors, it's an error.
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+log_streams:
+  myhost-01:
+    log_file:
+      - /some/custom/logfile
+    log_files: /var/log/syslog
+`), 0600))
+
+	_, _, err = LoadLogstreamsConfigFromFile(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown field log_file")
+	assert.Contains(t, err.Error(), "the value must be a list")
+}
+
+func TestParseYAMLKeyLines(t *testing.T) {
+	data := []byte(`
+# Comment
+transaction_rules:
+  - name: http
+    begin: 'request started'
+
+  - name: "db"
+    end: |
+      not: a key
+issue:
+  headers:
+    Authorization: 'Bearer foo'
+`)
+
+	assert.Equal(t, []yamlKeyLine{
+		{line: 3, path: []string{"transaction_rules"}},
+		{line: 4, path: []string{"transaction_rules", "name"}},
+		{line: 5, path: []string{"transaction_rules", "begin"}},
+		{line: 7, path: []string{"transaction_rules", "name"}},
+		{line: 8, path: []string{"transaction_rules", "end"}},
+		{line: 10, path: []string{"issue"}},
+		{line: 11, path: []string{"issue", "headers"}},
+		{line: 12, path: []string{"issue", "headers", "Authorization"}},
+	}, parseYAMLKeyLines(data))
+
+	assert.Equal(t, 12, findYAMLKeyLine(data, "issue", "headers", "Authorization"))
+	assert.Equal(t, 11, findYAMLKeyLine(data, "issue", "headers", "Content-Type"))
+	assert.Equal(t, 0, findYAMLKeyLine(data, "foo"))
+}
+
+func TestClosestString(t *testing.T) {
+	candidates := []string{"hostname", "port", "user", "log_files", "options"}
+
+	assert.Equal(t, "hostname", closestString("hostnme", candidates))
+	assert.Equal(t, "log_files", closestString("logfiles", candidates))
+	assert.Equal(t, "port", closestString("prot", candidates))
+	assert.Equal(t, "", closestString("something", candidates))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/blhistory"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/dimonomid/nerdlog/version"
+	"github.com/juju/errors"
+)
+
+const msgIDCrashRestore = "crash_restore"
+
+// crashSession is the session state which is saved to disk when nerdlog
+// crashes, so that it can be restored on the next launch.
+type crashSession struct {
+	// Query is the last query, as a shell command like
+	// "nerdlog --lstreams 'localhost' --time -10h --pattern '/something/'".
+	Query string
+
+	// History and HistoryIdx are the browser-like query history (the one
+	// navigated with Alt+Left / Alt+Right).
+	History    []blhistory.Item
+	HistoryIdx int
+
+	// ReportFilename is the path to the crash report written at the same time.
+	ReportFilename string
+}
+
+// crashDir returns the directory where crash reports and the crash session
+// are stored.
+func crashDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Annotatef(err, "getting cache dir")
+	}
+
+	return filepath.Join(cacheDir, "nerdlog"), nil
+}
+
+func crashSessionFilename() (string, error) {
+	dir, err := crashDir()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	return filepath.Join(dir, "crash_session.json"), nil
+}
+
+// updateCrashSession remembers the current session state, to be saved in
+// case of a crash. Must be called whenever a new query is made.
+func (app *nerdlogApp) updateCrashSession(qfStr string) {
+	items, idx := app.queryBLHistory.Items()
+
+	app.sessionMtx.Lock()
+	defer app.sessionMtx.Unlock()
+
+	app.session = crashSession{
+		Query:      qfStr,
+		History:    items,
+		HistoryIdx: idx,
+	}
+}
+
+// recoverPanic must be deferred in every goroutine which runs the app code.
+// In case of a panic, it restores the terminal, writes the crash report and
+// the session state to disk, and exits.
+func (app *nerdlogApp) recoverPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	stack := debug.Stack()
+
+	// If the panic happened in the UI goroutine, tview has finalized the screen
+	// already, but if it happened in another goroutine, we need to do that
+	// ourselves, otherwise the terminal is left in a broken state. Finalizing
+	// twice is fine.
+	if tviewApp := app.tviewApp; tviewApp != nil {
+		tviewApp.Stop()
+	}
+
+	fmt.Fprintf(os.Stderr, "\nnerdlog crashed: %v\n\n%s\n", r, stack)
+
+	reportFilename, err := writeCrashReport(r, stack)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write crash report: %s\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Crash report: %s\n", reportFilename)
+	}
+
+	app.sessionMtx.Lock()
+	sess := app.session
+	app.sessionMtx.Unlock()
+
+	sess.ReportFilename = reportFilename
+
+	if sess.Query != "" {
+		if err := saveCrashSession(sess); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save the session: %s\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "The session was saved, and will be offered for restoring on the next launch.\n")
+		}
+	}
+
+	os.Exit(2)
+}
+
+// writeCrashReport writes the crash report with the panic value, the stack
+// trace and the recent internal logs, and returns the filename.
+func writeCrashReport(panicVal interface{}, stack []byte) (string, error) {
+	dir, err := crashDir()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.Annotatef(err, "creating %s", dir)
+	}
+
+	now := time.Now()
+
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Time: %s\n\n", now.Format(time.RFC3339)))
+	sb.WriteString(version.VersionFullDescr())
+	sb.WriteString(fmt.Sprintf("\nPanic: %v\n\n", panicVal))
+	sb.Write(stack)
+	sb.WriteString("\nRecent logs:\n\n")
+
+	for _, r := range log.RecentRecords(log.Verbose1) {
+		sb.WriteString(r.String())
+		sb.WriteString("\n")
+	}
+
+	fname := filepath.Join(dir, fmt.Sprintf("crash_%s.txt", now.Format("20060102_150405")))
+	if err := os.WriteFile(fname, []byte(sb.String()), 0600); err != nil {
+		return "", errors.Annotatef(err, "writing %s", fname)
+	}
+
+	return fname, nil
+}
+
+func saveCrashSession(sess crashSession) error {
+	fname, err := crashSessionFilename()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return errors.Annotatef(err, "creating %s", filepath.Dir(fname))
+	}
+
+	if err := os.WriteFile(fname, data, 0600); err != nil {
+		return errors.Annotatef(err, "writing %s", fname)
+	}
+
+	return nil
+}
+
+// takeCrashSession loads the session saved during the last crash, if any, and
+// removes the file, so that the restore is only offered once. If there is no
+// saved session, returns nil.
+func takeCrashSession() (*crashSession, error) {
+	fname, err := crashSessionFilename()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, errors.Annotatef(err, "reading %s", fname)
+	}
+
+	if err := os.Remove(fname); err != nil {
+		return nil, errors.Annotatef(err, "removing %s", fname)
+	}
+
+	var sess crashSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", fname)
+	}
+
+	return &sess, nil
+}
+
+// offerCrashSessionRestore shows a dialog asking whether to restore the
+// session saved during the last crash. If the user declines, onDiscard is
+// called.
+func (app *nerdlogApp) offerCrashSessionRestore(sess *crashSession, onDiscard func()) {
+	var msgv *MessageView
+
+	var sb strings.Builder
+	sb.WriteString("nerdlog crashed last time, but the session was saved.\n\n")
+	if sess.ReportFilename != "" {
+		sb.WriteString(fmt.Sprintf("Crash report: %s\n\n", sess.ReportFilename))
+	}
+	sb.WriteString(fmt.Sprintf("Last query:\n%s\n\nRestore the session?", sess.Query))
+
+	msgv = app.mainView.showMessagebox(
+		msgIDCrashRestore,
+		"Restore session",
+		sb.String(),
+		&MessageboxParams{
+			Buttons:       []string{"&Restore", "&Discard"},
+			DefaultButton: "Restore",
+			CancelButton:  "Discard",
+			Priority:      ModalPriorityInfo,
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+
+				if label != "Restore" {
+					onDiscard()
+					return
+				}
+
+				app.queryBLHistory.Restore(sess.History, sess.HistoryIdx)
+				if err := app.unmarshalAndApplyQuery(sess.Query, doQueryParams{
+					dontAddHistoryItem: true,
+				}); err != nil {
+					app.printError(fmt.Sprintf("Failed to restore the session: %s", err))
+				}
+			},
+
+			Width: 80,
+		},
+	)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// cronSchedule is a parsed cron-like schedule: either the classic 5 fields
+// "minute hour day-of-month month day-of-week", or "@every <duration>", or
+// one of the shortcuts like "@hourly".
+type cronSchedule struct {
+	// every is non-zero for the "@every <duration>" schedules; all the other
+	// fields are ignored then.
+	every time.Duration
+
+	minutes     [60]bool
+	hours       [24]bool
+	daysOfMonth [32]bool
+	months      [13]bool
+	daysOfWeek  [7]bool
+
+	// If both the day of month and the day of week are restricted (don't start
+	// with "*"), then, like in the classic cron, it's enough for either of them
+	// to match.
+	domRestricted, dowRestricted bool
+}
+
+var cronShortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// cronMaxLookahead is how far into the future cronSchedule.next looks for the
+// next matching minute; schedules like "0 0 30 2 *" never match anything.
+const cronMaxLookahead = 5 * 366 * 24 * time.Hour
+
+func parseCronSchedule(s string) (*cronSchedule, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "@every ") {
+		every, err := time.ParseDuration(strings.TrimSpace(s[len("@every "):]))
+		if err != nil {
+			return nil, errors.Annotatef(err, "parsing @every duration")
+		}
+
+		if every < time.Minute {
+			return nil, errors.Errorf("@every duration must be at least 1m")
+		}
+
+		return &cronSchedule{every: every}, nil
+	}
+
+	if shortcut, ok := cronShortcuts[s]; ok {
+		s = shortcut
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, errors.Errorf(
+			"expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields),
+		)
+	}
+
+	cs := &cronSchedule{}
+
+	fieldSpecs := []struct {
+		name     string
+		min, max int
+		dst      []bool
+	}{
+		{"minute", 0, 59, cs.minutes[:]},
+		{"hour", 0, 23, cs.hours[:]},
+		{"day of month", 1, 31, cs.daysOfMonth[:]},
+		{"month", 1, 12, cs.months[:]},
+		// Day of week 7 is Sunday too, and gets wrapped below.
+		{"day of week", 0, 7, nil},
+	}
+
+	var dows [8]bool
+	fieldSpecs[4].dst = dows[:]
+
+	for i, spec := range fieldSpecs {
+		if err := parseCronField(fields[i], spec.min, spec.max, spec.dst); err != nil {
+			return nil, errors.Annotatef(err, "%s", spec.name)
+		}
+	}
+
+	copy(cs.daysOfWeek[:], dows[:7])
+	if dows[7] {
+		cs.daysOfWeek[0] = true
+	}
+
+	cs.domRestricted = !strings.HasPrefix(fields[2], "*")
+	cs.dowRestricted = !strings.HasPrefix(fields[4], "*")
+
+	return cs, nil
+}
+
+// parseCronField parses a single cron field like "*", "*/5", "1-10/2" or
+// "1,15,30", and sets the matching values in dst.
+func parseCronField(field string, min, max int, dst []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangePart = part[:idx]
+
+			var err error
+			step, err = strconv.Atoi(part[idx+1:])
+			if err != nil || step <= 0 {
+				return errors.Errorf("invalid step in %q", part)
+			}
+		}
+
+		from, to := min, max
+		switch {
+		case rangePart == "*":
+			// Already set.
+
+		case strings.Contains(rangePart, "-"):
+			idx := strings.Index(rangePart, "-")
+
+			var err1, err2 error
+			from, err1 = strconv.Atoi(rangePart[:idx])
+			to, err2 = strconv.Atoi(rangePart[idx+1:])
+			if err1 != nil || err2 != nil {
+				return errors.Errorf("invalid range %q", rangePart)
+			}
+
+		default:
+			v, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return errors.Errorf("invalid value %q", rangePart)
+			}
+
+			from = v
+			to = v
+			if step != 1 {
+				// Like in the classic cron, "5/10" means "5-max/10".
+				to = max
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return errors.Errorf("%q is out of range %d-%d", rangePart, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			dst[v] = true
+		}
+	}
+
+	return nil
+}
+
+func (cs *cronSchedule) matches(t time.Time) bool {
+	if !cs.minutes[t.Minute()] || !cs.hours[t.Hour()] || !cs.months[t.Month()] {
+		return false
+	}
+
+	domMatches := cs.daysOfMonth[t.Day()]
+	dowMatches := cs.daysOfWeek[t.Weekday()]
+
+	if cs.domRestricted && cs.dowRestricted {
+		return domMatches || dowMatches
+	}
+
+	return domMatches && dowMatches
+}
+
+// next returns the first time strictly after t when the schedule fires, or
+// zero time if it never does.
+func (cs *cronSchedule) next(t time.Time) time.Time {
+	if cs.every != 0 {
+		return t.Truncate(cs.every).Add(cs.every)
+	}
+
+	cur := t.Truncate(time.Minute).Add(time.Minute)
+	until := t.Add(cronMaxLookahead)
+
+	for cur.Before(until) {
+		if cs.matches(cur) {
+			return cur
+		}
+
+		cur = cur.Add(time.Minute)
+	}
+
+	return time.Time{}
+}
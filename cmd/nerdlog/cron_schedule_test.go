@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronSchedule(t *testing.T) {
+	// It's Wednesday.
+	base := time.Date(2025, 3, 12, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		schedule string
+		want     time.Time
+	}{
+		{"* * * * *", time.Date(2025, 3, 12, 10, 8, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2025, 3, 12, 10, 10, 0, 0, time.UTC)},
+		{"7 * * * *", time.Date(2025, 3, 12, 11, 7, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 3, 12, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{"30 9-17/2 * * *", time.Date(2025, 3, 12, 11, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day of month and day of week are restricted, so either matches:
+		// the 20th, or any Friday.
+		{"0 0 20 * 5", time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"@every 15m", time.Date(2025, 3, 12, 10, 15, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			cs, err := parseCronSchedule(tt.schedule)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.want, cs.next(base))
+		})
+	}
+}
+
+func TestCronScheduleInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"foo * * * *",
+		"@every 10s",
+		"@every foo",
+		"@sometimes",
+	} {
+		_, err := parseCronSchedule(s)
+		assert.Error(t, err, "schedule %q", s)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/daemon"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+)
+
+// runDaemon runs the nerdlog daemon in the foreground, until it receives
+// SIGINT or SIGTERM. The UI can then attach to it with --use-daemon.
+func runDaemon(params nerdlogAppParams) error {
+	logger := log.NewLogger(params.logLevel).WithStdout(true)
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return errors.Annotatef(err, "getting home dir")
+	}
+
+	logstreamsCfg, configWarnings, err := loadLogstreamsConfig(homeDir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for _, warning := range configWarnings {
+		logger.Warnf("Config warning: %s; ignoring the field", warning.Error())
+	}
+
+	lsmanParams, err := makeLStreamsManagerParams(params, logstreamsCfg, logger)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	srv, err := daemon.NewServer(daemon.ServerParams{
+		SocketPath: params.daemonSocketPath,
+		NewLStreamsManager: func(
+			updatesCh chan<- core.LStreamsManagerUpdate,
+		) daemon.LStreamsManager {
+			p := lsmanParams
+			p.UpdatesCh = updatesCh
+			return core.NewLStreamsManager(p)
+		},
+		Logger: logger,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	runners, err := startScheduledQueries(params, homeDir, lsmanParams, logger)
+	if err != nil {
+		srv.Close()
+		return errors.Trace(err)
+	}
+
+	defer func() {
+		for _, r := range runners {
+			r.stop()
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		fmt.Println("Closing connections...")
+		srv.Close()
+	}()
+
+	fmt.Printf("Nerdlog daemon is listening on %s\n", params.daemonSocketPath)
+
+	if err := srv.Serve(); err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// startScheduledQueries loads the scheduled queries config, if it exists, and
+// starts running all the queries from it.
+func startScheduledQueries(
+	params nerdlogAppParams,
+	homeDir string,
+	lsmanParams core.LStreamsManagerParams,
+	logger *log.Logger,
+) ([]*scheduledQueryRunner, error) {
+	if params.scheduledQueriesPath == "" {
+		return nil, nil
+	}
+
+	if _, err := os.Stat(params.scheduledQueriesPath); err != nil {
+		return nil, nil
+	}
+
+	cfg, err := LoadScheduledQueriesConfigFromFile(params.scheduledQueriesPath)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	newLStreamsManager := func(
+		updatesCh chan<- core.LStreamsManagerUpdate, lstreams string,
+	) daemon.LStreamsManager {
+		p := lsmanParams
+		p.InitialLStreams = lstreams
+		p.UpdatesCh = updatesCh
+		return core.NewLStreamsManager(p)
+	}
+
+	runners := make([]*scheduledQueryRunner, 0, len(cfg.ScheduledQueries))
+	for _, sq := range cfg.ScheduledQueries {
+		r, err := newScheduledQueryRunner(
+			sq, homeDir, newLStreamsManager, logger.WithNamespaceAppended("Scheduled"),
+		)
+		if err != nil {
+			for _, r := range runners {
+				r.stop()
+			}
+
+			return nil, errors.Annotatef(err, "%s", sq.Name)
+		}
+
+		r.start()
+		runners = append(runners, r)
+	}
+
+	if len(runners) > 0 {
+		fmt.Printf("Running %d scheduled queries from %s\n", len(runners), params.scheduledQueriesPath)
+	}
+
+	return runners, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const msgIDDebugConsole = "debug_console"
+
+// debugConsoleLevels are the levels which can be chosen on the debug console,
+// in the same order as the buttons.
+var debugConsoleLevels = []log.LogLevel{
+	log.Error,
+	log.Warning,
+	log.Info,
+	log.Verbose1,
+	log.Verbose3,
+}
+
+// showDebugConsole shows nerdlog's own recent internal logs (as opposed to the
+// logs fetched from logstreams), with the level minLevel or higher. The level
+// can then be changed with the buttons.
+func (mv *MainView) showDebugConsole(minLevel log.LogLevel) {
+	var msgv *MessageView
+
+	buttons := make([]string, 0, len(debugConsoleLevels)+1)
+	for _, level := range debugConsoleLevels {
+		buttons = append(buttons, strings.Title(level.String()))
+	}
+	buttons = append(buttons, "Close")
+
+	msgv = mv.showMessagebox(
+		msgIDDebugConsole,
+		"Debug console",
+		formatDebugConsoleRecords(log.RecentRecords(minLevel), minLevel),
+		&MessageboxParams{
+			Buttons: buttons,
+			OnButtonPressed: func(label string, idx int) {
+				if idx >= len(debugConsoleLevels) {
+					msgv.Hide()
+					return
+				}
+
+				level := debugConsoleLevels[idx]
+				msgv.SetText(formatDebugConsoleRecords(log.RecentRecords(level), level), false)
+				msgv.textView.ScrollToEnd()
+			},
+			CopyButton: true,
+
+			Width:  mv.screenWidth - 4,
+			Height: mv.screenHeight - 4,
+
+			BackgroundColor: tcell.ColorDarkBlue,
+		},
+	)
+
+	msgv.textView.ScrollToEnd()
+}
+
+func formatDebugConsoleRecords(records []log.Record, minLevel log.LogLevel) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf(
+		"Showing %d messages with the level %s or higher\n\n",
+		len(records), minLevel,
+	))
+
+	if len(records) == 0 {
+		sb.WriteString("-- No messages --")
+	}
+
+	for _, r := range records {
+		sb.WriteString(debugConsoleLevelColor(r.Level))
+		sb.WriteString(tview.Escape(r.String()))
+		sb.WriteString("[-]\n")
+	}
+
+	return sb.String()
+}
+
+func debugConsoleLevelColor(level log.LogLevel) string {
+	switch {
+	case level >= log.Error:
+		return "[red]"
+	case level >= log.Warning:
+		return "[yellow]"
+	case level >= log.Info:
+		return "[-]"
+	default:
+		return "[gray]"
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/rivo/tview"
+)
+
+const msgIDDoctor = "doctor"
+
+// doctorText returns the text for the :doctor view: the capabilities of the
+// hosts of every current logstream, as probed on the first connection.
+func doctorText(state *core.LStreamsManagerState) string {
+	if state == nil || state.NumLStreams == 0 {
+		return "No logstreams."
+	}
+
+	var names []string
+	for _, lstreams := range state.LStreamsByState {
+		for name := range lstreams {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString("Host capabilities, probed on the first connection and cached:\n")
+
+	for _, name := range names {
+		fmt.Fprintf(&sb, "\n[::b]%s[-:-:-]: ", tview.Escape(name))
+
+		caps, ok := state.CapabilitiesByLStream[name]
+		if !ok {
+			sb.WriteString("[gray]not probed yet[-]")
+			continue
+		}
+
+		descr := caps.String()
+		if descr == "" {
+			descr = "none of the tools found"
+		}
+		sb.WriteString(descr)
+
+		var notes []string
+		if !caps.Gzip {
+			notes = append(notes, "no gzip, the logs are transferred uncompressed")
+		}
+		if caps.Awk != "gnu" {
+			notes = append(notes, "no GNU awk, the agent needs gawk to run")
+		}
+
+		for _, note := range notes {
+			fmt.Fprintf(&sb, "\n  [yellow]%s[-]", note)
+		}
+	}
+
+	return sb.String()
+}
+
+func (app *nerdlogApp) showDoctor() {
+	var msgv *MessageView
+	msgv = app.mainView.showMessagebox(
+		msgIDDoctor, "Doctor", doctorText(app.mainView.curHMState),
+		&MessageboxParams{
+			Buttons: []string{"OK"},
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+			},
+			OnEsc: func() {
+				msgv.Hide()
+			},
+			Width: 100,
+		},
+	)
+}
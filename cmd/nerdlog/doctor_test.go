@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoctorText(t *testing.T) {
+	state := &core.LStreamsManagerState{
+		NumLStreams: 2,
+		LStreamsByState: map[core.LStreamClientState]map[string]struct{}{
+			core.LStreamClientStateConnectedIdle: {"web1": {}},
+			core.LStreamClientStateConnecting:    {"web2": {}},
+		},
+		CapabilitiesByLStream: map[string]core.HostCapabilities{
+			"web1": {Journalctl: true, Awk: "mawk"},
+		},
+	}
+
+	text := doctorText(state)
+	assert.Contains(t, text, "[::b]web1[-:-:-]: journalctl, awk=mawk")
+	assert.Contains(t, text, "no gzip")
+	assert.Contains(t, text, "no GNU awk")
+	assert.Contains(t, text, "[::b]web2[-:-:-]: [gray]not probed yet[-]")
+
+	assert.Equal(t, "No logstreams.", doctorText(nil))
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/clhistory"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/require"
+)
+
+// uiWaitTimeout is how long uiHarness waits for the screen to get to the
+// expected state. It's generous, since with -race, every key takes a while
+// to handle.
+const uiWaitTimeout = 30 * time.Second
+
+// uiHarness runs the whole TUI on a tcell.SimulationScreen: the tests inject
+// keystrokes and check the rendered cells. The logstreams are the test log
+// files from core/core_testdata, scanned natively (see
+// core.ShellTransportNative), so neither ssh nor a local shell is involved,
+// and the tests can run anywhere.
+//
+// The HOME is a temporary dir, so the configs and histories of the user
+// running the tests don't interfere.
+type uiHarness struct {
+	t *testing.T
+
+	app    *nerdlogApp
+	screen tcell.SimulationScreen
+
+	// tviewApp is the same as app.tviewApp, but it's never reset, so it can be
+	// used from the test goroutine.
+	tviewApp *tview.Application
+
+	runErrCh chan error
+}
+
+type uiHarnessParams struct {
+	// Query is the initial query, which is run right away. If LStreams is
+	// empty, it's "tiny": the two log files from core_testdata; if Time is
+	// empty, it covers all the logs there, and SelectQuery defaults to
+	// DefaultSelectQuery.
+	Query QueryFull
+
+	// Width and Height are the initial screen size; 120x40 by default.
+	Width  int
+	Height int
+}
+
+// uiHarnessLogstreamsConfig is the ~/.config/nerdlog/logstreams.yaml for the
+// harness; the %s is the dir with the test log files.
+const uiHarnessLogstreamsConfig = `log_streams:
+  tiny:
+    hostname: localhost
+    log_files:
+      - %[1]s/syslog
+      - %[1]s/syslog.1
+    options:
+      native_scan: true
+`
+
+// newUIHarness starts the app on a simulation screen; it's stopped
+// automatically when the test ends.
+func newUIHarness(t *testing.T, params uiHarnessParams) *uiHarness {
+	t.Helper()
+
+	if params.Query.LStreams == "" {
+		params.Query.LStreams = "tiny"
+	}
+
+	if params.Query.Time == "" {
+		// The test logs don't have the year, so it's inferred to be within the
+		// last year.
+		params.Query.Time = "-9000h"
+	}
+
+	if params.Query.SelectQuery == "" {
+		params.Query.SelectQuery = DefaultSelectQuery
+	}
+
+	if params.Width == 0 {
+		params.Width = 120
+	}
+
+	if params.Height == 0 {
+		params.Height = 40
+	}
+
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(homeDir, ".cache"))
+
+	logsDir, err := filepath.Abs(filepath.Join("..", "..", "core", "core_testdata", "input_logfiles", "tiny"))
+	require.NoError(t, err)
+
+	cfgDir := filepath.Join(homeDir, ".config", "nerdlog")
+	require.NoError(t, os.MkdirAll(cfgDir, 0755))
+	require.NoError(t, ioutil.WriteFile(
+		filepath.Join(cfgDir, "logstreams.yaml"),
+		[]byte(fmt.Sprintf(uiHarnessLogstreamsConfig, logsDir)),
+		0644,
+	))
+
+	queryCLHistory, err := clhistory.New(clhistory.CLHistoryParams{
+		Filename: filepath.Join(homeDir, ".nerdlog_query_history"),
+	})
+	require.NoError(t, err)
+
+	app, err := newNerdlogApp(nerdlogAppParams{
+		initialQueryData: params.Query,
+		connectRightAway: true,
+		logLevel:         log.Error,
+	}, queryCLHistory)
+	require.NoError(t, err)
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	require.NoError(t, screen.Init())
+	screen.SetSize(params.Width, params.Height)
+
+	h := &uiHarness{
+		t: t,
+
+		app:    app,
+		screen: screen,
+
+		tviewApp: app.tviewApp,
+
+		runErrCh: make(chan error, 1),
+	}
+
+	tviewApp := app.tviewApp
+	tviewApp.SetScreen(screen)
+
+	go func() {
+		h.runErrCh <- app.runTViewApp()
+	}()
+
+	t.Cleanup(func() {
+		tviewApp.Stop()
+		<-h.runErrCh
+
+		app.Close()
+		app.Wait()
+	})
+
+	return h
+}
+
+// confirmLogFormat waits for the messagebox asking to confirm the detected
+// log format, which is shown on the first connection to the logstreams, and
+// confirms it.
+//
+// NOTE: it should be called once the initial query is done (see
+// waitForQueryDone), otherwise the overlay with the query progress might be
+// on top, and get the Enter instead.
+func (h *uiHarness) confirmLogFormat() {
+	h.t.Helper()
+
+	h.waitForText("Log format detected")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForNoText("Log format detected")
+}
+
+// waitForQueryDone waits until the query is done, and the status line shows
+// the given counters of the messages, like "35 / 35 / 35".
+//
+// NOTE: while the query is in progress, the overlay with the progress is
+// focused, so the tests should wait for the queries to finish before sending
+// more keys.
+func (h *uiHarness) waitForQueryDone(counters string) {
+	h.t.Helper()
+
+	h.waitFor(fmt.Sprintf("the query to finish with %q", counters), func(screen string) bool {
+		for _, line := range strings.Split(screen, "\n") {
+			if strings.HasPrefix(line, "idle ") && strings.HasSuffix(line, " "+counters) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// showTestMessagebox shows the messagebox with the given title and the
+// buttons "Confirm" (the default) and "Not now" (the cancel one); the label of
+// the pressed button is sent to the returned channel.
+func (h *uiHarness) showTestMessagebox(title string) <-chan string {
+	h.t.Helper()
+
+	pressedCh := make(chan string, 1)
+	h.tviewApp.QueueUpdateDraw(func() {
+		var msgv *MessageView
+		msgv = h.app.mainView.showMessagebox("test_msg", title, "Just a test", &MessageboxParams{
+			Buttons:       []string{"&Confirm", "&Not now"},
+			DefaultButton: "Confirm",
+			CancelButton:  "Not now",
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+				pressedCh <- label
+			},
+		})
+	})
+
+	h.waitForText(title)
+
+	return pressedCh
+}
+
+// pressKey injects a special key, like tcell.KeyEnter.
+//
+// NOTE: unlike SimulationScreen.InjectKey, which drops the events once the
+// (small) queue is full, the keys here are posted with PostEventWait, so
+// none of them get lost.
+func (h *uiHarness) pressKey(key tcell.Key) {
+	h.screen.PostEventWait(tcell.NewEventKey(key, 0, tcell.ModNone))
+}
+
+// pressAltRune injects Alt+r.
+func (h *uiHarness) pressAltRune(r rune) {
+	h.screen.PostEventWait(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModAlt))
+}
+
+// typeText injects the runes of the text one by one, as if typed.
+func (h *uiHarness) typeText(text string) {
+	for _, r := range text {
+		h.screen.PostEventWait(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+}
+
+// resize changes the size of the screen, like the terminal window being
+// resized.
+func (h *uiHarness) resize(width, height int) {
+	h.screen.SetSize(width, height)
+	h.screen.PostEventWait(tcell.NewEventResize(width, height))
+}
+
+// screenText returns the rendered screen, as lines with the trailing spaces
+// trimmed.
+//
+// NOTE: the screen is being drawn in the UI goroutine, so it's read there as
+// well; reading it from the test goroutine would be a data race.
+func (h *uiHarness) screenText() string {
+	textCh := make(chan string, 1)
+	h.tviewApp.QueueUpdate(func() {
+		textCh <- h.screenTextUnsafe()
+	})
+
+	return <-textCh
+}
+
+// screenTextUnsafe is like screenText, but must be called from the UI
+// goroutine.
+func (h *uiHarness) screenTextUnsafe() string {
+	cells, width, height := h.screen.GetContents()
+
+	lines := make([]string, 0, height)
+	for y := 0; y < height; y++ {
+		var sb strings.Builder
+		for x := 0; x < width; x++ {
+			runes := cells[y*width+x].Runes
+			if len(runes) == 0 {
+				sb.WriteRune(' ')
+				continue
+			}
+
+			sb.WriteString(string(runes))
+		}
+
+		lines = append(lines, strings.TrimRight(sb.String(), " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// waitFor waits until the cond returns true for the rendered screen, and
+// fails the test if it doesn't happen in time.
+func (h *uiHarness) waitFor(descr string, cond func(screen string) bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(uiWaitTimeout)
+	for {
+		screen := h.screenText()
+		if cond(screen) {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			h.t.Fatalf("Timed out waiting for %s; the screen:\n%s", descr, screen)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForText waits until the text is on the screen.
+func (h *uiHarness) waitForText(text string) {
+	h.t.Helper()
+
+	h.waitFor(fmt.Sprintf("%q to appear", text), func(screen string) bool {
+		return strings.Contains(screen, text)
+	})
+}
+
+// waitForNoText waits until the text is not on the screen.
+func (h *uiHarness) waitForNoText(text string) {
+	h.t.Helper()
+
+	h.waitFor(fmt.Sprintf("%q to disappear", text), func(screen string) bool {
+		return !strings.Contains(screen, text)
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUIModalFocus(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+
+	// While the messagebox is shown, it gets all the keys: they don't leak to
+	// the query input behind it.
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+	pressedCh := h.showTestMessagebox("Test message")
+	h.typeText("xyz")
+	assert.NotContains(t, h.screenText(), "xyz")
+
+	h.pressKey(tcell.KeyEnter)
+	h.waitForNoText("Test message")
+	assert.Equal(t, "Confirm", <-pressedCh)
+
+	// Once it's closed, the focus is back where it was: on the query input.
+	h.typeText("/Firewall/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("1 / 1 / 1")
+
+	// Esc moves to the logs table, where ":" opens the command line.
+	h.pressKey(tcell.KeyEsc)
+	h.typeText(":doctor")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForText("Host capabilities")
+
+	h.pressKey(tcell.KeyEsc)
+	h.waitForNoText("Host capabilities")
+
+	// And the logs table is focused again.
+	h.typeText(":doctor")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForText("Host capabilities")
+}
+
+func TestUIMessageboxButtonKeys(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+
+	// The mnemonic presses the button: "n" for "Not now".
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+	pressedCh := h.showTestMessagebox("Test message")
+	h.typeText("n")
+	h.waitForNoText("Test message")
+	assert.Equal(t, "Not now", <-pressedCh)
+
+	h.typeText("/Firewall/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("1 / 1 / 1")
+
+	// In the quick filter dialog, Esc presses "Cancel", even though the input
+	// field is focused.
+	h.pressKey(tcell.KeyEsc)
+	h.typeText("f")
+	h.waitForText("Quick filter")
+	h.pressKey(tcell.KeyEsc)
+	h.waitForNoText("Quick filter")
+
+	// And on the input field, the mnemonics need Alt: Alt+E is "Exclude".
+	h.typeText("f")
+	h.waitForText("Quick filter")
+	h.pressAltRune('e')
+	h.waitForNoText("Quick filter")
+	h.waitForQueryDone("- / 0 / 0")
+}
+
+func TestUIMessageboxValidation(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+
+	h.typeText("/Firewall/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("1 / 1 / 1")
+
+	// The empty quick filter pattern can't be submitted.
+	h.pressKey(tcell.KeyEsc)
+	h.typeText("f")
+	h.waitForText("Quick filter")
+	h.pressKey(tcell.KeyCtrlU)
+	h.pressKey(tcell.KeyEnter)
+	h.waitForText("can't be empty")
+	assert.Contains(t, h.screenText(), "Quick filter")
+
+	// Once fixed, the error is gone, and the pattern is applied.
+	h.typeText("rule")
+	h.waitForNoText("can't be empty")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForNoText("Quick filter")
+	h.waitForText("/Firewall/ && /rule/")
+	h.waitForQueryDone("1 / 1 / 1")
+}
+
+func TestUIQueryKeybindings(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+	assert.Contains(t, h.screenText(), "Insufficient privileges")
+
+	h.typeText("/Cache cleared/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("3 / 3 / 3")
+	assert.NotContains(t, h.screenText(), "Insufficient privileges")
+
+	// From the logs table, "i" gets back to the query input, where the
+	// Backspaces edit the query.
+	h.pressKey(tcell.KeyEsc)
+	h.typeText("i")
+	for i := 0; i < len(" cleared/"); i++ {
+		h.pressKey(tcell.KeyBackspace2)
+	}
+	h.typeText("/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForText("awk pattern: /Cache/")
+	h.waitForQueryDone("3 / 3 / 3")
+}
+
+func TestUIResize(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{Width: 120, Height: 40})
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+
+	statusLineAtBottom := func(width, height int) func(screen string) bool {
+		return func(screen string) bool {
+			lines := strings.Split(screen, "\n")
+			return len(lines) == height &&
+				len([]rune(lines[0])) <= width &&
+				strings.HasSuffix(lines[height-2], "35 / 35 / 35")
+		}
+	}
+
+	// After shrinking, the status line is still at the bottom, and the latest
+	// logs are still visible.
+	h.resize(70, 15)
+	h.waitFor("the status line at the bottom of the small screen", statusLineAtBottom(70, 15))
+	assert.Contains(t, h.screenText(), "Insufficient privileges")
+
+	h.resize(120, 40)
+	h.waitFor("the status line at the bottom of the big screen", statusLineAtBottom(120, 40))
+	assert.Contains(t, h.screenText(), "Insufficient privileges")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// epochRegex matches the numbers which look like unix timestamps from the
+// recent past or the near future (2001-2033): 10 digits for seconds
+// (possibly with a fraction), or 13 digits for milliseconds.
+var epochRegex = regexp.MustCompile(`\b1[0-9]{9}(?:[0-9]{3}|\.[0-9]{1,9})?\b`)
+
+// epochMatch is a unix timestamp found in a string.
+type epochMatch struct {
+	// str is the timestamp as it is in the string.
+	str string
+	t   time.Time
+}
+
+// findEpochs returns all the unix timestamps (seconds or milliseconds) found
+// in the string.
+func findEpochs(s string) []epochMatch {
+	var ret []epochMatch
+	for _, str := range epochRegex.FindAllString(s, -1) {
+		var t time.Time
+
+		switch {
+		case strings.Contains(str, "."):
+			// Not using ParseFloat, since float64 isn't precise enough for
+			// nanoseconds.
+			dotIdx := strings.IndexByte(str, '.')
+			secs, err := strconv.ParseInt(str[:dotIdx], 10, 64)
+			if err != nil {
+				continue
+			}
+			nanos, err := strconv.ParseInt((str[dotIdx+1:] + "000000000")[:9], 10, 64)
+			if err != nil {
+				continue
+			}
+			t = time.Unix(secs, nanos)
+
+		case len(str) == 13:
+			millis, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				continue
+			}
+			t = time.Unix(0, millis*int64(time.Millisecond))
+
+		default:
+			secs, err := strconv.ParseInt(str, 10, 64)
+			if err != nil {
+				continue
+			}
+			t = time.Unix(secs, 0)
+		}
+
+		ret = append(ret, epochMatch{str: str, t: t})
+	}
+
+	return ret
+}
+
+// epochsAnnotation returns the human-readable translation of all the unix
+// timestamps found in the string, like "1741687200 = 2025-03-11 10:00:00
+// UTC", or an empty string if there are none.
+func epochsAnnotation(s string, tz *time.Location) string {
+	epochs := findEpochs(s)
+	if len(epochs) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(epochs))
+	for _, e := range epochs {
+		layout := "2006-01-02 15:04:05 MST"
+		if e.t.Nanosecond() != 0 {
+			layout = "2006-01-02 15:04:05.000 MST"
+		}
+
+		parts = append(parts, e.str+" = "+e.t.In(tz).Format(layout))
+	}
+
+	return strings.Join(parts, ", ")
+}
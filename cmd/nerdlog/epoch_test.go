@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEpochsAnnotation(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   `{"ts":1741687200,"msg":"started"}`,
+			want: "1741687200 = 2025-03-11 10:00:00 UTC",
+		},
+		{
+			in:   "expires_at=1741687200123 issued_at=1741687200.5",
+			want: "1741687200123 = 2025-03-11 10:00:00.123 UTC, 1741687200.5 = 2025-03-11 10:00:00.500 UTC",
+		},
+		{
+			// Too short, too long, or too far in the future.
+			in:   "pid 174168720, id 17416872001234, n 9741687200",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, epochsAnnotation(tt.in, time.UTC), "input: %s", tt.in)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"strings"
+)
+
+// filterStageKeyword is what separates the filter stages in the query, after
+// the "|": e.g. "/foo/ | where /bar/ | where !/baz/". Disabled stages are
+// written with the "#" in front of the keyword, e.g. "| #where /bar/".
+const filterStageKeyword = "where"
+
+// filterStage is one stage of the filter pipeline: either the base awk
+// pattern (the part of the query before the first "| where"), or one of the
+// "| where <pattern>" stages which narrow it down further.
+type filterStage struct {
+	Pattern string
+
+	// Disabled stages stay in the query, but aren't applied. The base pattern
+	// can't be disabled.
+	Disabled bool
+}
+
+// parseFilterPipeline splits the query into the stages; the first one is
+// always the base pattern (which might be empty), so for the queries without
+// any "| where", it's just one stage with the whole query.
+//
+// The "|" only counts as a stage separator if it's not a part of "||", and
+// is followed by "where" or "#where" and a space. NOTE: there is no attempt to
+// parse the awk syntax, so a regexp like /a | where b/ would still be split.
+func parseFilterPipeline(query string) []filterStage {
+	var stages []filterStage
+
+	cur := filterStage{}
+	last := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '|' {
+			continue
+		}
+
+		if (i > 0 && query[i-1] == '|') || (i+1 < len(query) && query[i+1] == '|') {
+			continue
+		}
+
+		rest := strings.TrimLeft(query[i+1:], " \t")
+		disabled := strings.HasPrefix(rest, "#")
+		if disabled {
+			rest = rest[1:]
+		}
+
+		if !strings.HasPrefix(rest, filterStageKeyword) {
+			continue
+		}
+
+		rest = rest[len(filterStageKeyword):]
+		if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+
+		cur.Pattern = strings.TrimSpace(query[last:i])
+		stages = append(stages, cur)
+
+		cur = filterStage{Disabled: disabled}
+		last = len(query) - len(rest)
+		i = last - 1
+	}
+
+	cur.Pattern = strings.TrimSpace(query[last:])
+	stages = append(stages, cur)
+
+	return stages
+}
+
+// marshalFilterPipeline is the opposite of parseFilterPipeline: it returns
+// the query with all the given stages.
+func marshalFilterPipeline(stages []filterStage) string {
+	var sb strings.Builder
+
+	for i, stage := range stages {
+		if i > 0 {
+			sb.WriteString(" | ")
+			if stage.Disabled {
+				sb.WriteString("#")
+			}
+			sb.WriteString(filterStageKeyword)
+			sb.WriteString(" ")
+		}
+
+		sb.WriteString(stage.Pattern)
+	}
+
+	return strings.TrimSpace(sb.String())
+}
+
+// filterPipelineQuery returns the base pattern and the patterns of the stages
+// which should actually be applied (enabled and non-empty), to be used as
+// core.QueryLogsParams.Query and Stages.
+func filterPipelineQuery(query string) (pattern string, stages []string) {
+	parsed := parseFilterPipeline(query)
+
+	for _, stage := range parsed[1:] {
+		if stage.Disabled || stage.Pattern == "" {
+			continue
+		}
+
+		stages = append(stages, stage.Pattern)
+	}
+
+	return parsed[0].Pattern, stages
+}
+
+// filterPipelineAwkPattern returns a single awk pattern which is equivalent to
+// the whole pipeline, for the cases when the stages can't be given to the
+// agent separately.
+func filterPipelineAwkPattern(query string) string {
+	pattern, stages := filterPipelineQuery(query)
+	if len(stages) == 0 {
+		return pattern
+	}
+
+	parts := make([]string, 0, len(stages)+1)
+	if pattern != "" {
+		parts = append(parts, "("+pattern+")")
+	}
+
+	for _, stage := range stages {
+		parts = append(parts, "("+stage+")")
+	}
+
+	return strings.Join(parts, " && ")
+}
+
+// addFilterStage returns the query with one more enabled stage appended.
+func addFilterStage(query, pattern string) string {
+	stages := parseFilterPipeline(query)
+	stages = append(stages, filterStage{Pattern: strings.TrimSpace(pattern)})
+
+	return marshalFilterPipeline(stages)
+}
+
+// andAwkCond returns the awk pattern with one more condition added with
+// "&&". If the pattern has some "||" outside of the parens, it's
+// parenthesized first, so that the condition applies to the whole pattern:
+// e.g. "/a/ || /b/" and "/c/" become "(/a/ || /b/) && /c/", not
+// "/a/ || /b/ && /c/".
+func andAwkCond(pattern, cond string) string {
+	if pattern == "" {
+		return cond
+	}
+
+	if hasTopLevelOr(pattern) {
+		pattern = "(" + pattern + ")"
+	}
+
+	return pattern + " && " + cond
+}
+
+// hasTopLevelOr returns whether the awk pattern has "||" outside of the
+// parens, like "/a/ || /b/" or "(/a/) || (/b/)", but not "(/a/ || /b/) && /c/".
+// The escaped chars, like in /\(foo/, are skipped.
+//
+// NOTE: just like parseFilterPipeline, it doesn't parse the awk syntax, so a
+// regexp like /a||b/ counts too, which only results in redundant parens.
+func hasTopLevelOr(pattern string) bool {
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '|':
+			if depth == 0 && i+1 < len(pattern) && pattern[i+1] == '|' {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// editBasePattern returns the query with the base pattern replaced with
+// edit(base), and all the stages kept as they are. It's for the conditions
+// which are added to and removed from the query by the UI: they go to the base
+// pattern, so it works the same way whether the last stage is enabled or not.
+func editBasePattern(query string, edit func(base string) string) string {
+	stages := parseFilterPipeline(query)
+	stages[0].Pattern = strings.TrimSpace(edit(stages[0].Pattern))
+
+	return marshalFilterPipeline(stages)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilterPipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []filterStage
+	}{
+		{
+			name:  "empty",
+			query: "",
+			want:  []filterStage{{}},
+		},
+		{
+			name:  "no stages",
+			query: "/foo/ || /bar|baz/",
+			want:  []filterStage{{Pattern: "/foo/ || /bar|baz/"}},
+		},
+		{
+			name:  "stages",
+			query: "/foo/ | where !/bar/ | #where /baz/ | where /x/ && /y/",
+			want: []filterStage{
+				{Pattern: "/foo/"},
+				{Pattern: "!/bar/"},
+				{Pattern: "/baz/", Disabled: true},
+				{Pattern: "/x/ && /y/"},
+			},
+		},
+		{
+			name:  "empty base",
+			query: "| where /bar/",
+			want: []filterStage{
+				{Pattern: ""},
+				{Pattern: "/bar/"},
+			},
+		},
+		{
+			name:  "not a stage keyword",
+			query: "/foo/ | whereabouts",
+			want:  []filterStage{{Pattern: "/foo/ | whereabouts"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages := parseFilterPipeline(tt.query)
+			assert.Equal(t, tt.want, stages)
+
+			// Marshalling back should give an equivalent query.
+			assert.Equal(t, stages, parseFilterPipeline(marshalFilterPipeline(stages)))
+		})
+	}
+}
+
+func TestFilterPipelineQuery(t *testing.T) {
+	pattern, stages := filterPipelineQuery("/foo/ | where !/bar/ | #where /baz/ | where ")
+	assert.Equal(t, "/foo/", pattern)
+	assert.Equal(t, []string{"!/bar/"}, stages)
+
+	pattern, stages = filterPipelineQuery("/foo/")
+	assert.Equal(t, "/foo/", pattern)
+	assert.Nil(t, stages)
+
+	assert.Equal(t, "/foo/", filterPipelineAwkPattern("/foo/ | #where /bar/"))
+	assert.Equal(t, "(/foo/ || /x/) && (!/bar/)", filterPipelineAwkPattern("/foo/ || /x/ | where !/bar/"))
+	assert.Equal(t, "(!/bar/)", filterPipelineAwkPattern("| where !/bar/"))
+
+	assert.Equal(t, "/foo/ | where /bar/", addFilterStage("/foo/", "/bar/"))
+	assert.Equal(t, "| where /bar/", addFilterStage("", "/bar/"))
+}
+
+func TestFilterStageCounts(t *testing.T) {
+	stages := parseFilterPipeline("/foo/ | where !/bar/ | #where /baz/ | where /x/")
+
+	assert.Equal(t, []string{"", "", "", ""}, filterStageCounts(stages, nil))
+
+	assert.Equal(
+		t, []string{"100", "40", "-", "3"},
+		filterStageCounts(stages, &core.LogRespTotal{StageCounts: []int{100, 40, 3}}),
+	)
+
+	// The response for some other query.
+	assert.Equal(
+		t, []string{"?", "?", "-", "?"},
+		filterStageCounts(stages, &core.LogRespTotal{NumMsgsTotal: 10}),
+	)
+
+	// Without any applied stages, there are no stage counts, but the total is
+	// the count for the base pattern.
+	assert.Equal(
+		t, []string{"10", "-"},
+		filterStageCounts(parseFilterPipeline("/foo/ | #where /bar/"), &core.LogRespTotal{NumMsgsTotal: 10}),
+	)
+}
+
+func TestAndAwkCond(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"", "/foo/"},
+		{"/bar/", "/bar/ && /foo/"},
+		{"/bar/ && !/baz/", "/bar/ && !/baz/ && /foo/"},
+		{"/bar/ || /baz/", "(/bar/ || /baz/) && /foo/"},
+		{"(/bar/ || /baz/)", "(/bar/ || /baz/) && /foo/"},
+		{"(/bar/) || (/baz/)", "((/bar/) || (/baz/)) && /foo/"},
+		{`(/bar\)/ || /baz/)`, `(/bar\)/ || /baz/) && /foo/`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			assert.Equal(t, tt.want, andAwkCond(tt.pattern, "/foo/"))
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	fpvColIdxEnabled = 0
+	fpvColIdxN       = 1
+	fpvColIdxPattern = 2
+	fpvColIdxCount   = 3
+)
+
+const msgIDAddFilterStage = "add_filter_stage"
+
+// FilterPipelineView shows the stages of the filter pipeline in the current
+// query (see parseFilterPipeline), together with the number of messages left
+// after every stage, and lets the user toggle, add and delete the stages.
+// Every change reruns the query right away.
+type FilterPipelineView struct {
+	mainView *MainView
+
+	tbl   *tview.Table
+	frame *tview.Frame
+}
+
+func NewFilterPipelineView(mainView *MainView) *FilterPipelineView {
+	fpv := &FilterPipelineView{
+		mainView: mainView,
+	}
+
+	fpv.tbl = tview.NewTable()
+	fpv.tbl.SetSelectable(true, false)
+	fpv.tbl.SetFixed(1, 0)
+	fpv.tbl.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		row, _ := fpv.tbl.GetSelection()
+		stageIdx := row - 1
+
+		switch event.Key() {
+		case tcell.KeyEsc:
+			fpv.Hide()
+			return nil
+
+		case tcell.KeyEnter:
+			fpv.toggleStage(stageIdx)
+			return nil
+
+		case tcell.KeyDelete:
+			fpv.deleteStage(stageIdx)
+			return nil
+
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case ' ':
+				fpv.toggleStage(stageIdx)
+				return nil
+
+			case 'd':
+				fpv.deleteStage(stageIdx)
+				return nil
+
+			case 'a':
+				fpv.showAddStage()
+				return nil
+
+			case 'q':
+				fpv.Hide()
+				return nil
+			}
+		}
+
+		return event
+	})
+
+	fpv.frame = tview.NewFrame(fpv.tbl).SetBorders(0, 0, 0, 0, 0, 0)
+	fpv.frame.SetBorder(true).SetBorderPadding(0, 0, 1, 1)
+	fpv.frame.SetTitle("Filter pipeline")
+	fpv.frame.AddText(
+		"Space/Enter: toggle, a: add stage, d: delete stage, Esc: close",
+		false, tview.AlignLeft, tcell.ColorGray,
+	)
+
+	return fpv
+}
+
+func (fpv *FilterPipelineView) Show() {
+	fpv.update()
+
+	fpv.mainView.showModal(
+		pageNameFilterPipeline, fpv.frame,
+		100,
+		15,
+		true,
+	)
+}
+
+func (fpv *FilterPipelineView) Hide() {
+	fpv.mainView.hideModal(pageNameFilterPipeline, true)
+	fpv.mainView.filterPipelineView = nil
+}
+
+// update refills the table from the current query and the last response.
+func (fpv *FilterPipelineView) update() {
+	stages := parseFilterPipeline(fpv.mainView.query)
+	counts := filterStageCounts(stages, fpv.mainView.curLogResp)
+
+	row, _ := fpv.tbl.GetSelection()
+
+	fpv.tbl.Clear()
+
+	fpv.tbl.SetCell(0, fpvColIdxEnabled, newTableCellHeader("On"))
+	fpv.tbl.SetCell(0, fpvColIdxN, newTableCellHeader("#"))
+	fpv.tbl.SetCell(0, fpvColIdxPattern, newTableCellHeader("Stage"))
+	fpv.tbl.SetCell(0, fpvColIdxCount, newTableCellHeader("Matches"))
+
+	for i, stage := range stages {
+		enabled := "[x]"
+		if stage.Disabled {
+			enabled = "[ ]"
+		} else if i == 0 {
+			// The base pattern can't be disabled.
+			enabled = " - "
+		}
+
+		pattern := stage.Pattern
+		if i == 0 && pattern == "" {
+			pattern = "(all messages)"
+		} else if i > 0 {
+			pattern = filterStageKeyword + " " + pattern
+		}
+
+		color := tcell.ColorWhite
+		if stage.Disabled {
+			color = tcell.ColorGray
+		}
+
+		fpv.tbl.SetCell(i+1, fpvColIdxEnabled, tview.NewTableCell(enabled).SetTextColor(color))
+		fpv.tbl.SetCell(i+1, fpvColIdxN, tview.NewTableCell(strconv.Itoa(i)).SetTextColor(color))
+		fpv.tbl.SetCell(
+			i+1, fpvColIdxPattern,
+			tview.NewTableCell(tview.Escape(pattern)).SetTextColor(color).SetExpansion(1),
+		)
+		fpv.tbl.SetCell(
+			i+1, fpvColIdxCount,
+			tview.NewTableCell(counts[i]).SetTextColor(color).SetAlign(tview.AlignRight),
+		)
+	}
+
+	if row < 1 {
+		row = 1
+	}
+	if row > len(stages) {
+		row = len(stages)
+	}
+	fpv.tbl.Select(row, 0)
+}
+
+// applyStages sets the query with the given stages, and reruns it.
+func (fpv *FilterPipelineView) applyStages(stages []filterStage) {
+	fpv.mainView.setQuery(marshalFilterPipeline(stages))
+	fpv.mainView.doQuery(doQueryParams{})
+	fpv.update()
+}
+
+func (fpv *FilterPipelineView) toggleStage(idx int) {
+	stages := parseFilterPipeline(fpv.mainView.query)
+	if idx <= 0 || idx >= len(stages) {
+		fpv.mainView.printMsg("The base pattern can't be disabled", nlMsgLevelErr)
+		return
+	}
+
+	stages[idx].Disabled = !stages[idx].Disabled
+	fpv.applyStages(stages)
+}
+
+func (fpv *FilterPipelineView) deleteStage(idx int) {
+	stages := parseFilterPipeline(fpv.mainView.query)
+	if idx <= 0 || idx >= len(stages) {
+		fpv.mainView.printMsg("The base pattern can't be deleted, edit the query instead", nlMsgLevelErr)
+		return
+	}
+
+	stages = append(stages[:idx], stages[idx+1:]...)
+	fpv.applyStages(stages)
+}
+
+func (fpv *FilterPipelineView) showAddStage() {
+	var msgv *MessageView
+	add := func() {
+		pattern := msgv.GetInputFieldText(0)
+		msgv.Hide()
+
+		if pattern == "" {
+			return
+		}
+
+		fpv.mainView.setQuery(addFilterStage(fpv.mainView.query, pattern))
+		fpv.mainView.doQuery(doQueryParams{})
+		fpv.update()
+	}
+
+	msgv = fpv.mainView.showMessagebox(
+		msgIDAddFilterStage,
+		"Add filter stage",
+		"The awk pattern to narrow down the results further, e.g. /foo/ or !/bar/",
+		&MessageboxParams{
+			InputFields: []MessageViewInputFieldParams{
+				{Label: "Pattern:"},
+			},
+
+			Buttons:       []string{"&Add", "&Cancel"},
+			DefaultButton: "Add",
+			CancelButton:  "Cancel",
+			OnButtonPressed: func(label string, idx int) {
+				switch label {
+				case "Add":
+					add()
+				default:
+					msgv.Hide()
+				}
+			},
+
+			Width: 80,
+		},
+	)
+}
+
+// filterStageCounts returns the text to show in the "Matches" column for
+// every stage, given the response to the query.
+func filterStageCounts(stages []filterStage, resp *core.LogRespTotal) []string {
+	ret := make([]string, len(stages))
+	if resp == nil {
+		return ret
+	}
+
+	// Indices of the stages which were actually applied, in the same order as
+	// resp.StageCounts (after the first item, which is for the base pattern).
+	var applied []int
+	for i, stage := range stages[1:] {
+		if stage.Disabled || stage.Pattern == "" {
+			ret[i+1] = "-"
+			continue
+		}
+
+		applied = append(applied, i+1)
+	}
+
+	if len(applied) == 0 {
+		ret[0] = strconv.Itoa(resp.NumMsgsTotal)
+		return ret
+	}
+
+	if len(resp.StageCounts) != len(applied)+1 {
+		// The response is for some other query; maybe the new one is still in
+		// progress.
+		for _, idx := range append([]int{0}, applied...) {
+			ret[idx] = "?"
+		}
+		return ret
+	}
+
+	ret[0] = strconv.Itoa(resp.StageCounts[0])
+	for i, idx := range applied {
+		ret[idx] = strconv.Itoa(resp.StageCounts[i+1])
+	}
+
+	return ret
+}
+
+// showFilterPipeline shows the FilterPipelineView for the current query.
+func (mv *MainView) showFilterPipeline() {
+	if mv.filterPipelineView != nil {
+		mv.filterPipelineView.Hide()
+	}
+
+	mv.filterPipelineView = NewFilterPipelineView(mv)
+	mv.filterPipelineView.Show()
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// followState is the state of the follow mode (see the "follow" option): the
+// query is repeated periodically, and the new logs are shown as they come.
+// While the cursor is not at the last message though, the logs table is
+// frozen, so that the older logs can be read: the new logs are only counted,
+// until the user goes back to the tail.
+type followState struct {
+	// lastQueryTime is when the last query (follow or not) was sent.
+	lastQueryTime time.Time
+
+	// inFlight is true while the follow query is in progress.
+	inFlight bool
+
+	// pending is the latest follow response which wasn't applied because the
+	// logs table is frozen; nil if there's none.
+	pending *core.LogRespTotal
+
+	// stormPaused is true if the rate of the matching lines exceeded the
+	// stormthreshold option, so the logs table is frozen even if the cursor is
+	// at the tail, until the user jumps back to live.
+	stormPaused bool
+
+	// numNew and numNewMore are what countNewLogs returned for pending.
+	numNew     int
+	numNewMore bool
+
+	// lastSample is the sample taken from the last response, to calculate the
+	// rates when the next one comes; nil if there's none yet.
+	lastSample *followSample
+
+	// rates are the lines-per-second rates calculated from the last two
+	// samples; nil if there aren't two samples yet.
+	rates *followRates
+}
+
+// followSample is what the rates of the incoming lines are calculated from:
+// the per-minute stats from the response to the query sent at the given time.
+type followSample struct {
+	time time.Time
+
+	// matching is the number of matching lines per minute, and total is the
+	// number of all the lines per minute (see core.LogRespTotal.ActivityStats).
+	matching map[int64]int
+	total    map[int64]int
+}
+
+func newFollowSample(t time.Time, resp *core.LogRespTotal) *followSample {
+	matching := make(map[int64]int, len(resp.MinuteStats))
+	for k, v := range resp.MinuteStats {
+		matching[k] = v.NumMsgs
+	}
+
+	return &followSample{
+		time:     t,
+		matching: matching,
+		total:    resp.ActivityStats,
+	}
+}
+
+// followRates are the rates of the incoming lines, per second.
+type followRates struct {
+	total    float64
+	matching float64
+}
+
+// calcFollowRates returns the rates of the lines which came between the two
+// samples. Only the minutes since the prev sample are looked at, so that the
+// beginning of the time range moving forward doesn't affect the rates.
+func calcFollowRates(prev, next *followSample) *followRates {
+	elapsed := next.time.Sub(prev.time).Seconds()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	since := prev.time.Truncate(time.Minute).Unix()
+
+	return &followRates{
+		total:    float64(minuteStatsDelta(prev.total, next.total, since)) / elapsed,
+		matching: float64(minuteStatsDelta(prev.matching, next.matching, since)) / elapsed,
+	}
+}
+
+// minuteStatsDelta returns how many more lines there are in next than in
+// prev, only counting the minutes starting from since.
+func minuteStatsDelta(prev, next map[int64]int, since int64) int {
+	delta := 0
+	for k, v := range next {
+		if k < since {
+			continue
+		}
+
+		if d := v - prev[k]; d > 0 {
+			delta += d
+		}
+	}
+
+	return delta
+}
+
+func (r *followRates) String() string {
+	return fmt.Sprintf("%s/s total, %s/s matching", formatRate(r.total), formatRate(r.matching))
+}
+
+func formatRate(rate float64) string {
+	if rate >= 100 {
+		return fmt.Sprintf("%.0f", rate)
+	}
+
+	return fmt.Sprintf("%.1f", rate)
+}
+
+// countNewLogs returns how many messages in next are newer than the last
+// message in cur. If all the messages in next are new, then more is true,
+// since there might be more new messages which didn't fit in next.
+func countNewLogs(cur, next *core.LogRespTotal) (num int, more bool) {
+	if cur == nil || len(cur.Logs) == 0 {
+		return len(next.Logs), next.NumMsgsTotal > len(next.Logs)
+	}
+
+	lastTime := cur.Logs[len(cur.Logs)-1].Time
+
+	for i := len(next.Logs) - 1; i >= 0; i-- {
+		if !next.Logs[i].Time.After(lastTime) {
+			return num, false
+		}
+
+		num++
+	}
+
+	return num, next.NumMsgsTotal > len(next.Logs)
+}
+
+// formatNumNewLogs returns a string like "5 new lines" or "250+ new lines".
+func formatNumNewLogs(num int, more bool) string {
+	numStr := fmt.Sprintf("%d", num)
+	if more {
+		numStr += "+"
+	}
+
+	if num == 1 && !more {
+		return numStr + " new line"
+	}
+
+	return numStr + " new lines"
+}
+
+// isFollowing returns whether the follow mode is active: it's enabled by the
+// option, and the time range ends at the current time, so there can be new
+// logs at all.
+func (mv *MainView) isFollowing() bool {
+	return mv.params.Options.GetFollow() > 0 && mv.to.IsZero() && mv.ranges == nil
+}
+
+// isAtTail returns whether the cursor is at the last message in the logs
+// table (or there are no messages at all).
+func (mv *MainView) isAtTail() bool {
+	selectedRow, _ := mv.logsTable.GetSelection()
+	return selectedRow >= mv.logsTable.GetRowCount()-1
+}
+
+// followTick is called periodically; if the follow mode is active, it
+// repeats the query when it's time, and applies the pending logs once the
+// cursor is back at the tail.
+func (mv *MainView) followTick() (needDraw bool) {
+	if !mv.isFollowing() {
+		if mv.follow.pending != nil {
+			mv.follow.pending = nil
+			mv.bumpStatusLineRight()
+			needDraw = true
+		}
+
+		return needDraw
+	}
+
+	if mv.follow.pending != nil && mv.isAtTail() && !mv.follow.stormPaused {
+		mv.followJumpToLive()
+		needDraw = true
+	}
+
+	// Only repeat the query if we're idle, and the previous one (whatever it
+	// was) is done already.
+	if mv.curLogResp == nil || mv.follow.inFlight ||
+		mv.curHMState == nil || !mv.curHMState.Connected || mv.curHMState.Busy {
+		return needDraw
+	}
+
+	if time.Since(mv.follow.lastQueryTime) < mv.params.Options.GetFollow() {
+		return needDraw
+	}
+
+	mv.follow.inFlight = true
+
+	mv.bumpTimeRange(false)
+	mv.doQuery(doQueryParams{
+		dontAddHistoryItem: true,
+		follow:             true,
+	})
+
+	return needDraw
+}
+
+// applyFollowLogs is called instead of applyLogs for the responses to the
+// follow queries: if the cursor is at the tail, the logs are applied as
+// usual, otherwise (or if there's a storm of new lines) they're kept pending.
+func (mv *MainView) applyFollowLogs(resp *core.LogRespTotal) {
+	mv.follow.inFlight = false
+	mv.addFollowSample(resp)
+
+	threshold := mv.params.Options.GetStormThreshold()
+	if threshold > 0 && mv.follow.rates != nil &&
+		mv.follow.rates.matching > float64(threshold) && !mv.follow.stormPaused {
+		mv.follow.stormPaused = true
+		mv.printMsg(fmt.Sprintf(
+			"Follow paused: %s/s matching lines exceed the stormthreshold of %d/s; press F to resume",
+			formatRate(mv.follow.rates.matching), threshold,
+		), nlMsgLevelWarn)
+	}
+
+	if mv.follow.stormPaused || !mv.isAtTail() {
+		mv.follow.pending = resp
+		mv.follow.numNew, mv.follow.numNewMore = countNewLogs(mv.curLogResp, resp)
+		mv.bumpStatusLineRight()
+		return
+	}
+
+	mv.follow.pending = nil
+	mv.showLogs(resp)
+}
+
+// followJumpToLive applies the pending logs, if any, and moves the cursor to
+// the last message; it also resumes the follow mode paused due to a storm.
+func (mv *MainView) followJumpToLive() {
+	if mv.follow.stormPaused {
+		// If the storm is still going, it'll be paused again on the next
+		// response.
+		mv.follow.stormPaused = false
+		mv.bumpStatusLineRight()
+	}
+
+	if pending := mv.follow.pending; pending != nil {
+		mv.follow.pending = nil
+		mv.showLogs(pending)
+		return
+	}
+
+	mv.logsTable.Select(mv.logsTable.GetRowCount()-1, 0)
+	mv.logsTable.ScrollToEnd()
+}
+
+// addFollowSample takes the sample from the response to the last query, and
+// updates the rates.
+func (mv *MainView) addFollowSample(resp *core.LogRespTotal) {
+	sample := newFollowSample(mv.follow.lastQueryTime, resp)
+	if mv.follow.lastSample != nil {
+		mv.follow.rates = calcFollowRates(mv.follow.lastSample, sample)
+	}
+
+	mv.follow.lastSample = sample
+	mv.bumpStatusLineLeft()
+}
+
+// maxLStreamRate returns the lstreamratelimit option if the follow mode is
+// active, or zero otherwise.
+func (mv *MainView) maxLStreamRate() int {
+	if !mv.isFollowing() {
+		return 0
+	}
+
+	return mv.params.Options.GetLStreamRateLimit()
+}
+
+// formatThrottled returns a string like "web1 -532, db2 -12" from the map
+// like core.LogRespTotal.Throttled, the most throttled logstreams first.
+func (mv *MainView) formatThrottled(throttled map[string]int) string {
+	names := make([]string, 0, len(throttled))
+	for name := range throttled {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if throttled[names[i]] != throttled[names[j]] {
+			return throttled[names[i]] > throttled[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	var configDisplayNames map[string]string
+	if mv.curHMState != nil {
+		configDisplayNames = mv.curHMState.DisplayNames
+	}
+	displayNames := lstreamDisplayNames(names, configDisplayNames, mv.params.Options.GetStripDomain())
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s -%d", displayNames[name], throttled[name]))
+	}
+
+	return strings.Join(parts, ", ")
+}
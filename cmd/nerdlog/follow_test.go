@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountNewLogs(t *testing.T) {
+	t0 := time.Date(2025, 3, 11, 10, 0, 0, 0, time.UTC)
+	newResp := func(numMsgsTotal int, secs ...int) *core.LogRespTotal {
+		resp := &core.LogRespTotal{NumMsgsTotal: numMsgsTotal}
+		for _, s := range secs {
+			resp.Logs = append(resp.Logs, core.LogMsg{Time: t0.Add(time.Duration(s) * time.Second)})
+		}
+		return resp
+	}
+
+	cur := newResp(10, 1, 2, 3)
+
+	num, more := countNewLogs(cur, newResp(10, 1, 2, 3))
+	assert.Equal(t, 0, num)
+	assert.False(t, more)
+
+	num, more = countNewLogs(cur, newResp(12, 2, 3, 4, 5))
+	assert.Equal(t, 2, num)
+	assert.False(t, more)
+
+	// All the messages are new, and there are more of them than fetched.
+	num, more = countNewLogs(cur, newResp(20, 4, 5, 6))
+	assert.Equal(t, 3, num)
+	assert.True(t, more)
+
+	num, more = countNewLogs(nil, newResp(3, 4, 5, 6))
+	assert.Equal(t, 3, num)
+	assert.False(t, more)
+
+	assert.Equal(t, "1 new line", formatNumNewLogs(1, false))
+	assert.Equal(t, "3+ new lines", formatNumNewLogs(3, true))
+}
+
+func TestCalcFollowRates(t *testing.T) {
+	t0 := time.Date(2025, 3, 11, 10, 0, 0, 0, time.UTC)
+	minute := func(n int) int64 {
+		return t0.Add(time.Duration(n) * time.Minute).Unix()
+	}
+
+	prev := &followSample{
+		time:     t0.Add(2*time.Minute + 50*time.Second),
+		matching: map[int64]int{minute(0): 5, minute(1): 3, minute(2): 1},
+		total:    map[int64]int{minute(0): 50, minute(1): 30, minute(2): 10},
+	}
+
+	// The time range moved forward, so the first minute isn't there anymore,
+	// which shouldn't matter.
+	next := &followSample{
+		time:     t0.Add(3*time.Minute + 10*time.Second),
+		matching: map[int64]int{minute(1): 3, minute(2): 3, minute(3): 2},
+		total:    map[int64]int{minute(1): 30, minute(2): 40, minute(3): 30},
+	}
+
+	rates := calcFollowRates(prev, next)
+	assert.Equal(t, &followRates{total: 3, matching: 0.2}, rates)
+	assert.Equal(t, "3.0/s total, 0.2/s matching", rates.String())
+
+	assert.Nil(t, calcFollowRates(next, next))
+}
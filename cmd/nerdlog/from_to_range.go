@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -83,3 +86,98 @@ func parseAndInferTimeOrDur(timezone *time.Location, layout, s string) (TimeOrDu
 
 	return t, nil
 }
+
+// fromToRangesSeparator separates the ranges in a multi-range time, like
+// "Mar11 09:00 to 09:15, Mar11 13:00 to 13:15".
+const fromToRangesSeparator = ","
+
+// timeOnlyRangeRegex matches the ranges without a date, like "13:00 to 13:15"
+// or "13:00-13:15", which are only allowed in multi-range times.
+var timeOnlyRangeRegex = regexp.MustCompile(`^(\d{1,2}:\d{2})(?:\s*-\s*|\s+to\s+)(\d{1,2}:\d{2})$`)
+
+// ParseFromToRanges parses the time which might consist of several disjoint
+// ranges separated by commas, like "Mar11 09:00 to 09:15, Mar11 13:00 to
+// 13:15". The ranges without a date, like "13:00-13:15", take the date of the
+// previous range, or today's date if it's the first one.
+//
+// If there is just one range, it's the same as ParseFromToRange. Otherwise,
+// the returned ranges are sorted, and every range except the latest one must
+// have the "to".
+func ParseFromToRanges(timezone *time.Location, s string) ([]FromToRange, error) {
+	parts := strings.Split(s, fromToRangesSeparator)
+	if len(parts) == 1 {
+		ftr, err := ParseFromToRange(timezone, s)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return []FromToRange{ftr}, nil
+	}
+
+	now := time.Now()
+	date := now.In(timezone).Format("Jan2")
+
+	ranges := make([]FromToRange, 0, len(parts))
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+
+		if m := timeOnlyRangeRegex.FindStringSubmatch(part); m != nil {
+			part = fmt.Sprintf("%s %s to %s", date, m[1], m[2])
+		}
+
+		ftr, err := ParseFromToRange(timezone, part)
+		if err != nil {
+			return nil, errors.Annotatef(err, "range #%d", i+1)
+		}
+
+		// Just like for the single range, relative durations are only
+		// meaningful when negative.
+		if !ftr.From.IsAbsolute() && ftr.From.Dur > 0 {
+			ftr.From.Dur = -ftr.From.Dur
+		}
+
+		if !ftr.To.IsAbsolute() && ftr.To.Dur > 0 {
+			ftr.To.Dur = -ftr.To.Dur
+		}
+
+		if ftr.From.IsAbsolute() {
+			date = ftr.From.Time.Format("Jan2")
+		}
+
+		ranges = append(ranges, ftr)
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].From.AbsoluteTime(now).Before(ranges[j].From.AbsoluteTime(now))
+	})
+
+	for i, ftr := range ranges {
+		if ftr.To.IsZero() {
+			if i != len(ranges)-1 {
+				return nil, errors.Errorf("range %s: only the latest range can be open-ended", ftr.String())
+			}
+
+			continue
+		}
+
+		if !ftr.From.AbsoluteTime(now).Before(ftr.To.AbsoluteTime(now)) {
+			return nil, errors.Errorf("range %s: the end must be after the beginning", ftr.String())
+		}
+
+		if i+1 < len(ranges) && ranges[i+1].From.AbsoluteTime(now).Before(ftr.To.AbsoluteTime(now)) {
+			return nil, errors.Errorf("ranges %s and %s overlap", ftr.String(), ranges[i+1].String())
+		}
+	}
+
+	return ranges, nil
+}
+
+// FromToRangesString is the opposite of ParseFromToRanges.
+func FromToRangesString(ranges []FromToRange) string {
+	strs := make([]string, 0, len(ranges))
+	for _, ftr := range ranges {
+		strs = append(strs, ftr.String())
+	}
+
+	return strings.Join(strs, fromToRangesSeparator+" ")
+}
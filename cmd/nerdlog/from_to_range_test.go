@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFromToRanges(t *testing.T) {
+	tz := time.UTC
+
+	ranges, err := ParseFromToRanges(tz, "-3h")
+	assert.NoError(t, err)
+	assert.Equal(t, []FromToRange{{From: TimeOrDur{Dur: -3 * time.Hour}}}, ranges)
+
+	// The ranges get sorted, and the ones without a date take the date of the
+	// previous one.
+	ranges, err = ParseFromToRanges(tz, "Mar11 13:00 to 13:15, 09:00-09:15, Mar10 09:00 to 09:15")
+	assert.NoError(t, err)
+	if assert.Len(t, ranges, 3) {
+		assert.Equal(t, "Mar10 09:00 to 09:15, Mar11 09:00 to 09:15, Mar11 13:00 to 13:15", FromToRangesString(ranges))
+	}
+
+	// The result can be parsed back.
+	ranges2, err := ParseFromToRanges(tz, FromToRangesString(ranges))
+	assert.NoError(t, err)
+	assert.Equal(t, ranges, ranges2)
+
+	// Only the latest range can be open-ended.
+	_, err = ParseFromToRanges(tz, "-2h, -1h to -30m")
+	assert.Error(t, err)
+
+	ranges, err = ParseFromToRanges(tz, "-2h to -1h30m, -30m")
+	assert.NoError(t, err)
+	assert.Len(t, ranges, 2)
+
+	_, err = ParseFromToRanges(tz, "Mar11 09:00 to 09:30, Mar11 09:15 to 09:45")
+	assert.Error(t, err)
+
+	_, err = ParseFromToRanges(tz, "Mar11 09:30 to 09:00, Mar11 13:00 to 13:15")
+	assert.Error(t, err)
+
+	_, err = ParseFromToRanges(tz, "Mar11 09:00 to 09:15, foo")
+	assert.Error(t, err)
+}
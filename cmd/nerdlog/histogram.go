@@ -36,6 +36,35 @@ var (
 	}
 )
 
+// HistogramLevel is the worst level of the data in a bin, which affects the
+// color of the bar.
+type HistogramLevel int
+
+const (
+	HistogramLevelNone HistogramLevel = iota
+	HistogramLevelWarn
+	HistogramLevelError
+)
+
+// histogramLevelColors are the tview color tags for every level; the same
+// colors are used for the messages in the logs table.
+var histogramLevelColors = map[HistogramLevel]string{
+	HistogramLevelNone:  "[-]",
+	HistogramLevelWarn:  "[yellow]",
+	HistogramLevelError: "[pink]",
+}
+
+// HistogramGap is a period to be marked on the ruler, like the one when some
+// logstream had no lines at all. The From is inclusive, the To is not, in the
+// same units as the histogram range.
+type HistogramGap struct {
+	From int
+	To   int
+
+	// Label is shown next to the cursor value, if the cursor is within the gap.
+	Label string
+}
+
 type Histogram struct {
 	*tview.Box
 
@@ -49,6 +78,13 @@ type Histogram struct {
 	// bin.
 	data map[int]int
 
+	// levels is a map from the value in beginning of a bin to the worst level
+	// in that bin. Bins which aren't there have HistogramLevelNone.
+	levels map[int]HistogramLevel
+
+	// gaps are marked on the ruler with a dark red background.
+	gaps []HistogramGap
+
 	// getXMarks returns where to put marks on X axis
 	getXMarks func(from, to int, numChars int) []int
 
@@ -65,6 +101,11 @@ type Histogram struct {
 	// a range. The from is inclusive, the to is not.
 	selected func(from, to int)
 
+	// brushed is a handler which is called when the user has selected a range
+	// to merely filter the already loaded logs by (with from and to like in
+	// selected), or, with both from and to being 0, to reset that filter.
+	brushed func(from, to int)
+
 	// curMarks is returned from the last call to getXMarks
 	curMarks []int
 
@@ -128,6 +169,16 @@ func (h *Histogram) SetData(data map[int]int) *Histogram {
 	return h
 }
 
+func (h *Histogram) SetLevels(levels map[int]HistogramLevel) *Histogram {
+	h.levels = levels
+	return h
+}
+
+func (h *Histogram) SetGaps(gaps []HistogramGap) *Histogram {
+	h.gaps = gaps
+	return h
+}
+
 func (h *Histogram) SetXFormatter(xFormat func(v int) string) *Histogram {
 	h.xFormat = xFormat
 
@@ -194,6 +245,9 @@ func (h *Histogram) Draw(screen tcell.Screen) {
 	fldMarginLeft = (width - fldData.effectiveWidthRunes) / 2
 
 	lines := h.fldDataToLines(fldData.dots)
+	for i, line := range lines {
+		lines[i] = colorizeHistogramLine(line, fldData.dotLevels)
+	}
 
 	for lineY, line := range lines {
 		tview.Print(screen, line, x+fldMarginLeft, y+lineY, width-fldMarginLeft, tview.AlignLeft, tcell.ColorLightGray)
@@ -223,6 +277,30 @@ func (h *Histogram) Draw(screen tcell.Screen) {
 	rulerBlank := "[:#656565]" + strings.Repeat(" ", maxOffset) + "[:-]"
 	tview.Print(screen, rulerBlank, x+fldMarginLeft, y+height-1, width-fldMarginLeft, tview.AlignLeft, tcell.ColorWhite)
 
+	// Mark the gaps on the same background; the ruler data printed below keeps
+	// it, since it doesn't set the background color.
+	for _, gap := range h.gaps {
+		gapFrom, gapTo := gap.From, gap.To
+		if gapFrom < h.from {
+			gapFrom = h.from
+		}
+		if gapTo > h.to {
+			gapTo = h.to
+		}
+		if gapFrom >= gapTo {
+			continue
+		}
+
+		gapOffset := h.valToCoord(gapFrom) / 2
+		gapLen := (h.valToCoord(gapTo)+1)/2 - gapOffset
+		if gapLen < 1 {
+			gapLen = 1
+		}
+
+		gapBlank := "[:darkred]" + strings.Repeat(" ", gapLen) + "[:-]"
+		tview.Print(screen, gapBlank, x+fldMarginLeft+gapOffset, y+height-1, width-fldMarginLeft-gapOffset, tview.AlignLeft, tcell.ColorWhite)
+	}
+
 	// Print the ruler under the histogram.
 	h.curMarks = h.getXMarks(h.from, h.to, width-fldMarginLeft)
 
@@ -303,6 +381,11 @@ func (h *Histogram) Draw(screen tcell.Screen) {
 		var valToPrint string
 		if !h.IsSelectionActive() {
 			valToPrint = fmt.Sprintf("(%d)", fldData.cursorVal)
+
+			cursorEnd := h.cursor + h.binSize*h.getDataBinsInChartBar()
+			if labels := h.gapLabels(h.cursor, cursorEnd); len(labels) > 0 {
+				valToPrint += " silent: " + strings.Join(labels, ", ")
+			}
 		} else {
 			valToPrint = fmt.Sprintf("(total %d)", fldData.selectedValsSum)
 		}
@@ -347,6 +430,27 @@ func (h *Histogram) Draw(screen tcell.Screen) {
 	}
 }
 
+// gapLabels returns the unique labels of all the gaps overlapping with the
+// given range (from is inclusive, to is not).
+func (h *Histogram) gapLabels(from, to int) []string {
+	var labels []string
+	seen := map[string]struct{}{}
+	for _, gap := range h.gaps {
+		if gap.From >= to || gap.To <= from {
+			continue
+		}
+
+		if _, ok := seen[gap.Label]; ok {
+			continue
+		}
+
+		seen[gap.Label] = struct{}{}
+		labels = append(labels, gap.Label)
+	}
+
+	return labels
+}
+
 func (h *Histogram) getDataBinsInChartBar() int {
 	if h.fldData == nil {
 		return 1
@@ -435,6 +539,21 @@ func (h *Histogram) InputHandler() func(event *tcell.EventKey, setFocus func(p t
 			}
 		}
 
+		brushApply := func() {
+			if h.brushed == nil {
+				return
+			}
+
+			if h.selectionStart == 0 {
+				h.brushed(0, 0)
+				return
+			}
+
+			from, to := h.GetSelection()
+			h.brushed(from, to)
+			selectionEnd()
+		}
+
 		selectionApplyIfActive := func() {
 			if h.selectionStart != 0 && h.selected != nil {
 				from, to := h.GetSelection()
@@ -470,6 +589,8 @@ func (h *Histogram) InputHandler() func(event *tcell.EventKey, setFocus func(p t
 					selectionToggle()
 				case 'q':
 					selectionEnd()
+				case 'f':
+					brushApply()
 				case 'o':
 					if h.selectionStart > 0 {
 						h.cursor, h.selectionStart = h.selectionStart, h.cursor
@@ -536,6 +657,11 @@ func (h *Histogram) SetSelectedFunc(handler func(from, to int)) *Histogram {
 	return h
 }
 
+func (h *Histogram) SetBrushedFunc(handler func(from, to int)) *Histogram {
+	h.brushed = handler
+	return h
+}
+
 func (h *Histogram) IsSelectionActive() bool {
 	return h.selectionStart != 0
 }
@@ -543,6 +669,9 @@ func (h *Histogram) IsSelectionActive() bool {
 type fieldData struct {
 	dots [][]bool
 
+	// dotLevels contains the level for every X coordinate of dots.
+	dotLevels []HistogramLevel
+
 	dataBinsInChartBar int
 	chartBarWidth      int
 
@@ -597,6 +726,16 @@ func (h *Histogram) genFieldData(width, height int) *fieldData {
 		return val
 	}
 
+	levelAt := func(idx, n int) HistogramLevel {
+		level := HistogramLevelNone
+		for i := 0; i < n; i++ {
+			if l := h.levels[h.from+(idx+i)*h.binSize]; l > level {
+				level = l
+			}
+		}
+		return level
+	}
+
 	isCursorAt := func(idx, n int) bool {
 		for i := 0; i < n; i++ {
 			if h.cursor == h.from+(idx+i)*h.binSize {
@@ -645,6 +784,8 @@ func (h *Histogram) genFieldData(width, height int) *fieldData {
 		dots[y] = make([]bool, width)
 	}
 
+	dotLevels := make([]HistogramLevel, width)
+
 	selScaleDots := make([][]bool, 2)
 	for y := 0; y < 2; y++ {
 		selScaleDots[y] = make([]bool, width)
@@ -667,6 +808,11 @@ func (h *Histogram) genFieldData(width, height int) *fieldData {
 			cursorVal = val
 		}
 
+		level := levelAt(xData, dataBinsInChartBar)
+		for i := 0; i < chartBarWidth; i++ {
+			dotLevels[xChart+i] = level
+		}
+
 		if sel {
 			selectedValsSum += val
 		}
@@ -739,6 +885,7 @@ func (h *Histogram) genFieldData(width, height int) *fieldData {
 
 	return &fieldData{
 		dots:               dots,
+		dotLevels:          dotLevels,
 		dataBinsInChartBar: dataBinsInChartBar,
 		chartBarWidth:      chartBarWidth,
 
@@ -904,6 +1051,36 @@ func (h *Histogram) fldDataToLines(dots [][]bool) []string {
 	return ret
 }
 
+// colorizeHistogramLine takes a line as returned by fldDataToLines, where
+// every rune covers two dots, and adds color tags according to dotLevels. If
+// a rune covers two bars with different levels, the worst one wins.
+func colorizeHistogramLine(line string, dotLevels []HistogramLevel) string {
+	var sb strings.Builder
+
+	curLevel := HistogramLevelNone
+	for i, r := range []rune(line) {
+		level := HistogramLevelNone
+		for _, x := range []int{i * 2, i*2 + 1} {
+			if x < len(dotLevels) && dotLevels[x] > level {
+				level = dotLevels[x]
+			}
+		}
+
+		if level != curLevel {
+			sb.WriteString(histogramLevelColors[level])
+			curLevel = level
+		}
+
+		sb.WriteRune(r)
+	}
+
+	if curLevel != HistogramLevelNone {
+		sb.WriteString(histogramLevelColors[HistogramLevelNone])
+	}
+
+	return sb.String()
+}
+
 func (h *Histogram) valToCoord(v int) int {
 	return (v - h.from) / h.getDataBinsInChartBar() * h.getChartBarWidth() / h.binSize
 }
@@ -226,3 +226,28 @@ func TestGetOptimalScale_Random(t *testing.T) {
 		}
 	}
 }
+
+func TestColorizeHistogramLine(t *testing.T) {
+	none := HistogramLevelNone
+	warn := HistogramLevelWarn
+	errr := HistogramLevelError
+
+	tests := []struct {
+		name      string
+		line      string
+		dotLevels []HistogramLevel
+		expected  string
+	}{
+		{"No levels", "▄█▄", []HistogramLevel{none, none, none, none, none, none}, "▄█▄"},
+		{"Whole line", "▄█", []HistogramLevel{errr, errr, errr, errr}, "[pink]▄█[-]"},
+		{"In the middle", "▄█▄", []HistogramLevel{none, none, warn, warn, none, none}, "▄[yellow]█[-]▄"},
+		{"Worst level wins within a rune", "▄█", []HistogramLevel{warn, errr, none, warn}, "[pink]▄[yellow]█[-]"},
+		{"Levels shorter than line", "▄█", []HistogramLevel{warn, warn}, "[yellow]▄[-]█"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, colorizeHistogramLine(tt.line, tt.dotLevels))
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/gobwas/glob"
+	"github.com/juju/errors"
+	"github.com/rivo/tview"
+	"gopkg.in/yaml.v2"
+)
+
+const msgIDImportSSHHosts = "import_ssh_hosts"
+
+// importProbeSuffix is appended to the host names to get the logstreams to
+// probe the hosts with: if the agent works with journalctl there, then that's
+// what the imported logstream uses.
+const importProbeSuffix = "::journalctl"
+
+// importFallbackLogFile is the log file which the imported logstream uses if
+// journalctl doesn't work on the host.
+const importFallbackLogFile = "/var/log/syslog"
+
+// sshHostsToImport returns the host names matching the glob pattern, except
+// the ones which are in the logstreams config already.
+func sshHostsToImport(
+	hostNames []string, pattern string, existing core.ConfigLogStreams,
+) ([]string, error) {
+	matcher, err := glob.Compile(pattern)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing %q as a glob pattern", pattern)
+	}
+
+	var ret []string
+	for _, name := range hostNames {
+		if _, ok := existing[name]; ok {
+			continue
+		}
+
+		if matcher.Match(name) {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret, nil
+}
+
+// importedLogFiles returns the log files for the imported host based on the
+// result of probing it with journalctl, or ok=false if the host couldn't be
+// connected to at all, so it shouldn't be imported.
+func importedLogFiles(check *lstreamCheck) (logFiles []string, ok bool) {
+	switch {
+	case check.bootstrappedIn != 0:
+		return []string{"journalctl"}, true
+	case check.connectedIn != 0:
+		return []string{importFallbackLogFile}, true
+	}
+
+	return nil, false
+}
+
+// appendLogStreamsConfig appends the given entries to the logstreams config
+// file at path (creating it if needed), keeping the existing contents,
+// comments included, intact.
+func appendLogStreamsConfig(path string, entries core.ConfigLogStreams) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Annotatef(err, "reading config file %s", path)
+	}
+
+	var sb strings.Builder
+	sb.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		sb.WriteString("\n")
+	}
+
+	// Since log_streams is the only key in the config, the new entries can
+	// just go to the end.
+	if findYAMLKeyLine(data, "log_streams") == 0 {
+		sb.WriteString("log_streams:\n")
+	}
+
+	for _, name := range entries.Keys() {
+		fmt.Fprintf(&sb, "  %s:\n", yamlScalar(name))
+		fmt.Fprintf(&sb, "    log_files:\n")
+		for _, logFile := range entries[name].LogFiles {
+			fmt.Fprintf(&sb, "      - %s\n", yamlScalar(logFile))
+		}
+	}
+
+	// Make sure we didn't break anything, e.g. if the existing log_streams
+	// was written in the flow style. The unknown fields are fine though, same
+	// as when loading the config (see LoadLogstreamsConfigFromFile).
+	newData := []byte(sb.String())
+	var cfg ConfigLogStreams
+	if _, err := unmarshalConfigLenient(path, newData, &cfg); err != nil {
+		return errors.Annotatef(err, "can't append to the existing config, please add the entries manually")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := ioutil.WriteFile(path, newData, 0644); err != nil {
+		return errors.Annotatef(err, "writing config file %s", path)
+	}
+
+	return nil
+}
+
+// yamlScalar returns the string as a yaml scalar, quoted if needed.
+func yamlScalar(s string) string {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		// Can't happen with a string.
+		panic(err.Error())
+	}
+
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// importSSHHosts adds the logstreams for the hosts from the ssh config
+// matching the glob pattern to the logstreams config, with the log files
+// detected by probing every host once: journalctl if it works there, or
+// /var/log/syslog otherwise.
+func (app *nerdlogApp) importSSHHosts(pattern string) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		app.printError(errors.Annotatef(err, "getting home dir").Error())
+		return
+	}
+
+	lsmanParams, err := makeLStreamsManagerParams(app.params, app.logstreamsCfg, app.logger)
+	if err != nil {
+		app.printError(err.Error())
+		return
+	}
+
+	hostNames, err := core.SSHConfigHostNames(lsmanParams.SSHConfig)
+	if err != nil {
+		app.printError(err.Error())
+		return
+	}
+
+	names, err := sshHostsToImport(hostNames, pattern, app.logstreamsCfg)
+	if err != nil {
+		app.printError(err.Error())
+		return
+	}
+
+	if len(names) == 0 {
+		app.printError(fmt.Sprintf("No hosts in the ssh config match %q, or they're all in the logstreams config already", pattern))
+		return
+	}
+
+	probeSpecs := make([]string, 0, len(names))
+	for _, name := range names {
+		probeSpecs = append(probeSpecs, name+importProbeSuffix)
+	}
+
+	cfgPath := filepath.Join(homeDir, ".config", "nerdlog", "logstreams.yaml")
+
+	stopCh := make(chan struct{})
+	stop := func() {
+		select {
+		case <-stopCh:
+		default:
+			close(stopCh)
+		}
+	}
+
+	var msgv *MessageView
+	err = app.startLStreamsCheck(strings.Join(probeSpecs, ","), stopCh, func(check *lstreamsCheck, done bool) {
+		text := "Probing the hosts...\n\n" + check.String()
+		if !done {
+			app.tviewApp.QueueUpdateDraw(func() {
+				msgv.SetText(text, true)
+			})
+			return
+		}
+
+		app.tviewApp.QueueUpdateDraw(func() {
+			msgv.SetText(app.finishImportSSHHosts(cfgPath, check), true)
+		})
+	})
+	if err != nil {
+		app.printError(err.Error())
+		return
+	}
+
+	msgv = app.mainView.showMessagebox(
+		msgIDImportSSHHosts, "Import ssh hosts",
+		fmt.Sprintf("Probing %d hosts...", len(names)),
+		&MessageboxParams{
+			Buttons: []string{"Close"},
+			OnButtonPressed: func(label string, idx int) {
+				stop()
+				msgv.Hide()
+			},
+			OnEsc: func() {
+				stop()
+				msgv.Hide()
+			},
+			Width: 100,
+		},
+	)
+}
+
+// finishImportSSHHosts adds the probed hosts to the logstreams config, and
+// returns the text describing the results.
+func (app *nerdlogApp) finishImportSSHHosts(cfgPath string, check *lstreamsCheck) string {
+	entries := core.ConfigLogStreams{}
+	var imported, skipped []string
+
+	names := make([]string, 0, len(check.checks))
+	for probeName := range check.checks {
+		names = append(names, probeName)
+	}
+	sort.Strings(names)
+
+	for _, probeName := range names {
+		name := strings.TrimSuffix(probeName, importProbeSuffix)
+		lsCheck := check.checks[probeName]
+
+		logFiles, ok := importedLogFiles(lsCheck)
+		if !ok {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", tview.Escape(name), tview.Escape(lsCheck.err)))
+			continue
+		}
+
+		entries[name] = core.ConfigLogStream{LogFiles: logFiles}
+
+		line := fmt.Sprintf("%s: %s", tview.Escape(name), logFiles[0])
+		if lsCheck.err != "" {
+			line += " (journalctl: " + tview.Escape(lsCheck.err) + ")"
+		}
+		imported = append(imported, line)
+	}
+
+	var sb strings.Builder
+
+	if len(entries) > 0 {
+		if err := appendLogStreamsConfig(cfgPath, entries); err != nil {
+			return "[red]Failed to import[-]: " + tview.Escape(err.Error())
+		}
+
+		if app.logstreamsCfg == nil {
+			app.logstreamsCfg = core.ConfigLogStreams{}
+		}
+		for name, entry := range entries {
+			app.logstreamsCfg[name] = entry
+		}
+
+		fmt.Fprintf(&sb, "Imported %d logstreams to %s:\n\n", len(imported), cfgPath)
+		sb.WriteString(strings.Join(imported, "\n"))
+		sb.WriteString("\n\nRestart nerdlog for the current connections to use them.")
+	} else {
+		sb.WriteString("Nothing imported.")
+	}
+
+	if len(skipped) > 0 {
+		sb.WriteString("\n\n[red]Skipped the hosts which couldn't be connected to[-]:\n\n")
+		sb.WriteString(strings.Join(skipped, "\n"))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHHostsToImport(t *testing.T) {
+	hostNames := []string{"db-01", "web-01", "web-02", "web-03"}
+	existing := core.ConfigLogStreams{"web-02": {}}
+
+	names, err := sshHostsToImport(hostNames, "web-*", existing)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"web-01", "web-03"}, names)
+
+	names, err = sshHostsToImport(hostNames, "db-01", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db-01"}, names)
+
+	_, err = sshHostsToImport(hostNames, "web-[", nil)
+	assert.Error(t, err)
+}
+
+func TestImportedLogFiles(t *testing.T) {
+	logFiles, ok := importedLogFiles(&lstreamCheck{
+		connectedIn:    time.Second,
+		bootstrappedIn: 2 * time.Second,
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"journalctl"}, logFiles)
+
+	logFiles, ok = importedLogFiles(&lstreamCheck{
+		connectedIn: time.Second,
+		err:         "agent failed: journalctl is not found",
+	})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/var/log/syslog"}, logFiles)
+
+	_, ok = importedLogFiles(&lstreamCheck{err: "connection failed: no route to host"})
+	assert.False(t, ok)
+}
+
+func TestAppendLogStreamsConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nerdlog_import_ssh_hosts_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nerdlog", "logstreams.yaml")
+
+	entries := core.ConfigLogStreams{
+		"web-02": {LogFiles: []string{"/var/log/syslog"}},
+		"web-01": {LogFiles: []string{"journalctl"}},
+	}
+
+	// No config yet
+	require.NoError(t, appendLogStreamsConfig(path, entries))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `log_streams:
+  web-01:
+    log_files:
+      - journalctl
+  web-02:
+    log_files:
+      - /var/log/syslog
+`, string(data))
+
+	// Existing config with comments
+	require.NoError(t, ioutil.WriteFile(path, []byte(`# My logstreams
+log_streams:
+  db-01:
+    port: 1234 # Custom port`), 0644))
+
+	require.NoError(t, appendLogStreamsConfig(path, core.ConfigLogStreams{
+		"web: 03": {LogFiles: []string{"journalctl"}},
+	}))
+
+	cfg, warnings, err := LoadLogstreamsConfigFromFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, core.ConfigLogStreams{
+		"db-01":   {Port: "1234"},
+		"web: 03": {LogFiles: []string{"journalctl"}},
+	}, cfg.LogStreams)
+
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# My logstreams\n")
+	assert.Contains(t, string(data), "# Custom port\n")
+
+	// The unknown fields are only warned about when loading the config, so
+	// they don't prevent appending either.
+	require.NoError(t, ioutil.WriteFile(path, []byte(`log_streams:
+  db-01:
+    prot: 1234
+`), 0644))
+
+	require.NoError(t, appendLogStreamsConfig(path, entries))
+
+	cfg, warnings, err = LoadLogstreamsConfigFromFile(path)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, core.ConfigLogStreams{
+		"db-01":  {},
+		"web-01": {LogFiles: []string{"journalctl"}},
+		"web-02": {LogFiles: []string{"/var/log/syslog"}},
+	}, cfg.LogStreams)
+
+	// Flow style can't be appended to, and the config is left intact
+	flow := `log_streams: {db-01: {port: 1234}}`
+	require.NoError(t, ioutil.WriteFile(path, []byte(flow), 0644))
+
+	assert.Error(t, appendLogStreamsConfig(path, entries))
+
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, flow, string(data))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/rivo/tview"
+)
+
+// ConfigIntegrations is the config of the integrations with the external
+// tools.
+type ConfigIntegrations struct {
+	// Summarize is used by the :summarize command.
+	Summarize *ConfigSummarize `yaml:"summarize"`
+
+	// Issue is used by the :issue command.
+	Issue *ConfigIssue `yaml:"issue"`
+}
+
+type ConfigSummarize struct {
+	// Command is the shell command which gets the log lines on stdin, and
+	// prints the summary to stdout, like "llm -s 'Summarize these logs'".
+	Command string `yaml:"command"`
+}
+
+func LoadIntegrationsConfigFromFile(path string) (*ConfigIntegrations, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading config file %s", path)
+	}
+
+	var cfg ConfigIntegrations
+	if err := unmarshalConfig(path, data, &cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if cfg.Summarize != nil && cfg.Summarize.Command == "" {
+		return nil, errors.Errorf("summarize: command is required")
+	}
+
+	if cfg.Issue != nil {
+		if err := cfg.Issue.validate(); err != nil {
+			return nil, errors.Annotatef(err, "issue")
+		}
+	}
+
+	return &cfg, nil
+}
+
+// runExternalCommand runs the shell command with the given stdin and extra
+// environment variables (like "FOO=bar"), and returns its stdout. If the
+// command fails, the error contains its stderr. Once the ctx is done, the
+// command is killed.
+func runExternalCommand(ctx context.Context, shellCmd, stdin string, env []string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", shellCmd)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Env = append(os.Environ(), env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.Annotatef(err, "%s", msg)
+		}
+
+		return "", errors.Trace(err)
+	}
+
+	return stdout.String(), nil
+}
+
+// summarize pipes the raw lines of the logs shown in the table (or only the
+// last lastN of them, if it's not zero) to the summarize command from the
+// config, and shows its output.
+func (app *nerdlogApp) summarize(lastN int) {
+	if app.integrations == nil || app.integrations.Summarize == nil {
+		app.printError("No summarize command configured in ~/.config/nerdlog/integrations.yaml")
+		return
+	}
+
+	logs := app.mainView.getShownLogs()
+	if lastN > 0 && len(logs) > lastN {
+		logs = logs[len(logs)-lastN:]
+	}
+
+	if len(logs) == 0 {
+		app.printError("No logs to summarize")
+		return
+	}
+
+	lines := make([]string, 0, len(logs))
+	for _, msg := range logs {
+		lines = append(lines, msg.OrigLine)
+	}
+
+	// Same as when copying to the clipboard, the lines and the query leave
+	// nerdlog, so they're redacted and checked for secrets.
+	rules := app.options.GetRedactionRules()
+	input := redact(strings.Join(lines, "\n")+"\n", rules)
+	qf := app.mainView.getQueryFull()
+	query := redact(qf.MarshalShellCmd(), rules)
+
+	shellCmd := app.integrations.Summarize.Command
+
+	app.mainView.confirmCopySecrets(query+"\n"+input, func(text string) {
+		if text != query+"\n"+input {
+			// The user chose to mask the secrets.
+			query, input = maskSecrets(query), maskSecrets(input)
+		}
+
+		env := []string{
+			"NERDLOG_QUERY=" + query,
+		}
+
+		app.runSummarize(shellCmd, input, env, len(logs))
+	})
+}
+
+// runSummarize runs the summarize command with the given input and env, and
+// shows its output.
+func (app *nerdlogApp) runSummarize(shellCmd, input string, env []string, numLines int) {
+	var output string
+	app.runAsyncOp(asyncOpParams{
+		MessageID: "summarizing",
+		Title:     "Summarize",
+		Message:   fmt.Sprintf("Summarizing %d lines...", numLines),
+
+		Run: func(ctx context.Context) error {
+			var err error
+			output, err = runExternalCommand(ctx, shellCmd, input, env)
+			return err
+		},
+
+		OnDone: func(err error) {
+			if err != nil {
+				app.mainView.showMessagebox("err", "Summarize error", tview.Escape(err.Error()), &MessageboxParams{
+					CopyButton: true,
+				})
+				return
+			}
+
+			app.mainView.showMessagebox(
+				"summary", fmt.Sprintf("Summary of %d lines", numLines),
+				tview.Escape(strings.TrimSpace(output)),
+				&MessageboxParams{
+					CopyButton: true,
+					Width:      100,
+					Height:     25,
+				},
+			)
+		},
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/geoip"
+	"github.com/juju/errors"
+	"github.com/rivo/tview"
+)
+
+const msgIDIPInfo = "ip_info"
+
+// maxIPInfoIPs is how many IP addresses from a single log message we look up
+// at most.
+const maxIPInfoIPs = 10
+
+const reverseDNSTimeout = 3 * time.Second
+
+// ipCandidateRegex matches everything which might be an IPv4 or IPv6 address,
+// possibly with a port; the candidates are then checked with net.ParseIP.
+var ipCandidateRegex = regexp.MustCompile(`[0-9A-Fa-f:.]*[:.][0-9A-Fa-f:.]*`)
+
+// findIPs returns all unique IP addresses in the string, in the order of
+// appearance.
+func findIPs(s string) []net.IP {
+	var ret []net.IP
+	seen := map[string]struct{}{}
+
+	for _, candidate := range ipCandidateRegex.FindAllString(s, -1) {
+		candidate = strings.TrimRight(candidate, ".:")
+
+		ip := net.ParseIP(candidate)
+		if ip == nil {
+			// Maybe it's an IPv4 address with a port, like 10.0.0.1:22.
+			if host, _, err := net.SplitHostPort(candidate); err == nil {
+				ip = net.ParseIP(host)
+			}
+		}
+
+		// The unspecified address is rather something like "std::vector".
+		if ip == nil || ip.IsUnspecified() {
+			continue
+		}
+
+		if _, ok := seen[ip.String()]; ok {
+			continue
+		}
+		seen[ip.String()] = struct{}{}
+
+		ret = append(ret, ip)
+	}
+
+	return ret
+}
+
+// findLogMsgIPs returns all unique IP addresses in the message and its
+// context, at most maxIPInfoIPs of them.
+func findLogMsgIPs(msg *core.LogMsg) []net.IP {
+	keys := make([]string, 0, len(msg.Context))
+	for key := range msg.Context {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(msg.Msg)
+	for _, key := range keys {
+		sb.WriteString(" ")
+		sb.WriteString(msg.Context[key])
+	}
+
+	ips := findIPs(sb.String())
+	if len(ips) > maxIPInfoIPs {
+		ips = ips[:maxIPInfoIPs]
+	}
+
+	return ips
+}
+
+// ipEnricher looks up the info about IP addresses: reverse DNS and GeoIP,
+// depending on the options. The GeoIP database is loaded lazily, and
+// reloaded if the geoipdb option changes.
+type ipEnricher struct {
+	options *OptionsShared
+
+	mtx       sync.Mutex
+	geoipPath string
+	geoipDB   *geoip.DB
+}
+
+func newIPEnricher(options *OptionsShared) *ipEnricher {
+	return &ipEnricher{
+		options: options,
+	}
+}
+
+// enabled returns whether any kind of lookups is enabled in the options.
+func (e *ipEnricher) enabled() bool {
+	return e.options.GetReverseDNS() || e.options.GetGeoIPDB() != ""
+}
+
+func (e *ipEnricher) getGeoIPDB() (*geoip.DB, error) {
+	path := e.options.GetGeoIPDB()
+	if path == "" {
+		return nil, nil
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if e.geoipDB != nil && e.geoipPath == path {
+		return e.geoipDB, nil
+	}
+
+	db, err := geoip.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	e.geoipPath = path
+	e.geoipDB = db
+
+	return db, nil
+}
+
+// describe does all the enabled lookups for the given IPs, and returns the
+// text with the results, formatted for tview. It might take a while, so
+// shouldn't be called from the UI loop.
+func (e *ipEnricher) describe(ips []net.IP) string {
+	var sb strings.Builder
+
+	geoipDB, geoipErr := e.getGeoIPDB()
+	if geoipErr != nil {
+		sb.WriteString(fmt.Sprintf("[yellow]Failed to load GeoIP database: %s[-]\n\n", tview.Escape(geoipErr.Error())))
+	}
+
+	for i, ip := range ips {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString(fmt.Sprintf("[::b]%s[-:-:-]\n", ip))
+
+		if e.options.GetReverseDNS() {
+			sb.WriteString(fmt.Sprintf("  rDNS:  %s\n", tview.Escape(reverseDNS(ip))))
+		}
+
+		if geoipDB != nil {
+			sb.WriteString(fmt.Sprintf("  GeoIP: %s\n", tview.Escape(geoIPDescr(geoipDB, ip))))
+		}
+	}
+
+	return sb.String()
+}
+
+func reverseDNS(ip net.IP) string {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.String())
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return "none"
+		}
+
+		return fmt.Sprintf("failed: %s", err.Error())
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	for i := range names {
+		names[i] = strings.TrimSuffix(names[i], ".")
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func geoIPDescr(db *geoip.DB, ip net.IP) string {
+	info, err := db.Lookup(ip)
+	if err != nil {
+		return fmt.Sprintf("failed: %s", err.Error())
+	}
+
+	if info == nil {
+		return "not found"
+	}
+
+	var parts []string
+
+	var location []string
+	if info.City != "" {
+		location = append(location, info.City)
+	}
+	if info.Country != "" {
+		location = append(location, info.Country)
+	}
+	if len(location) > 0 {
+		loc := strings.Join(location, ", ")
+		if info.CountryCode != "" {
+			loc += fmt.Sprintf(" (%s)", info.CountryCode)
+		}
+		parts = append(parts, loc)
+	}
+
+	if info.ASN != 0 {
+		asn := fmt.Sprintf("AS%d", info.ASN)
+		if info.ASNOrg != "" {
+			asn += " " + info.ASNOrg
+		}
+		parts = append(parts, asn)
+	}
+
+	if len(parts) == 0 {
+		return "no details"
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// showIPInfo shows the messagebox with the info about the given IPs; the
+// lookups are done in the background, and the messagebox is updated once
+// they're done.
+func (mv *MainView) showIPInfo(ips []net.IP) {
+	var sb strings.Builder
+	for _, ip := range ips {
+		sb.WriteString(fmt.Sprintf("[::b]%s[-:-:-]\n  looking up...\n", ip))
+	}
+
+	msgv := mv.showMessagebox(msgIDIPInfo, "IP info", sb.String(), &MessageboxParams{
+		CopyButton: true,
+		Width:      80,
+	})
+
+	go func() {
+		text := mv.ipEnricher.describe(ips)
+
+		mv.params.App.QueueUpdateDraw(func() {
+			msgv.SetText(text, true)
+		})
+	}()
+}
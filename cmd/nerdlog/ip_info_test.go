@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		wantIPs []string
+	}{
+		{
+			name:    "sshd",
+			s:       "Failed password for root from 10.0.0.2 port 51234 ssh2",
+			wantIPs: []string{"10.0.0.2"},
+		},
+		{
+			name:    "with port, trailing dot and duplicates",
+			s:       "connection from 10.0.0.2:22 to 192.168.1.1. Retrying 10.0.0.2.",
+			wantIPs: []string{"10.0.0.2", "192.168.1.1"},
+		},
+		{
+			name:    "IPv6",
+			s:       "client [2001:db8::1]:443 and ::1 connected at 12:34:56",
+			wantIPs: []string{"2001:db8::1", "::1"},
+		},
+		{
+			name:    "no IPs",
+			s:       "version 1.2.3 released at 12:00",
+			wantIPs: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ips []string
+			for _, ip := range findIPs(tt.s) {
+				ips = append(ips, ip.String())
+			}
+
+			assert.Equal(t, tt.wantIPs, ips)
+		})
+	}
+}
+
+func TestFindLogMsgIPs(t *testing.T) {
+	msg := &core.LogMsg{
+		Msg: "Accepted publickey for bob from 10.0.0.2 port 51234",
+		Context: map[string]string{
+			"b": "10.0.0.3",
+			"a": "10.0.0.2",
+		},
+	}
+
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")}, findLogMsgIPs(msg))
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/rivo/tview"
+)
+
+const msgIDIssue = "issue"
+
+// ConfigIssue is how the :issue command creates an issue: either by running
+// the Command, or by sending a request to the URL. Exactly one of them must
+// be set.
+type ConfigIssue struct {
+	// Command is the shell command which gets the issue body on stdin, and the
+	// rest of issueData in the environment variables (see issueData.env), like
+	// `gh issue create --title "$NERDLOG_ISSUE_TITLE" --body-file -`. Its
+	// output, like the issue URL, is shown to the user.
+	Command string `yaml:"command"`
+
+	// URL is where the request is sent, like
+	// "https://jira.example.com/rest/api/2/issue". The environment variables
+	// in it, as well as in the Headers, are expanded, so that the tokens don't
+	// have to be in the config.
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+
+	// Body is the template (see text/template) of the request body, executed
+	// with issueData; the json function quotes a string for JSON, like
+	// `{"summary": {{json .Title}}}`.
+	Body string `yaml:"body"`
+
+	bodyTmpl *template.Template
+}
+
+func (c *ConfigIssue) validate() error {
+	if (c.Command == "") == (c.URL == "") {
+		return errors.Errorf("exactly one of command and url is required")
+	}
+
+	if c.URL == "" {
+		return nil
+	}
+
+	if c.Method == "" {
+		c.Method = http.MethodPost
+	}
+
+	tmpl, err := template.New("body").Funcs(template.FuncMap{
+		"json": func(s string) (string, error) {
+			data, err := json.Marshal(s)
+			return string(data), err
+		},
+	}).Parse(c.Body)
+	if err != nil {
+		return errors.Annotatef(err, "parsing body template")
+	}
+
+	c.bodyTmpl = tmpl
+
+	return nil
+}
+
+// issueData is what the issue is pre-filled with.
+type issueData struct {
+	Title string
+
+	// Query is the current query as a nerdlog command, and TimeRange is the
+	// absolute time range of the lines.
+	Query     string
+	TimeRange string
+
+	// Lines are the raw log lines.
+	Lines []string
+}
+
+// Body returns the issue description in markdown.
+func (d *issueData) Body() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Query: `%s`\n", d.Query)
+	fmt.Fprintf(&sb, "Time range: %s\n\n", d.TimeRange)
+
+	sb.WriteString("```\n")
+	for _, line := range d.Lines {
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("```\n")
+
+	return sb.String()
+}
+
+// maskSecrets replaces the secrets found in all the fields with "<secret>",
+// see maskSecrets.
+func (d *issueData) maskSecrets() {
+	d.Title = maskSecrets(d.Title)
+	d.Query = maskSecrets(d.Query)
+	for i, line := range d.Lines {
+		d.Lines[i] = maskSecrets(line)
+	}
+}
+
+// env returns the environment variables for the ConfigIssue.Command.
+func (d *issueData) env() []string {
+	return []string{
+		"NERDLOG_ISSUE_TITLE=" + d.Title,
+		"NERDLOG_QUERY=" + d.Query,
+		"NERDLOG_TIME_RANGE=" + d.TimeRange,
+	}
+}
+
+// createIssue creates the issue as configured, and returns the output of
+// the command, or the response body.
+func createIssue(ctx context.Context, cfg *ConfigIssue, data *issueData) (string, error) {
+	if cfg.Command != "" {
+		output, err := runExternalCommand(ctx, cfg.Command, data.Body(), data.env())
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+
+		return output, nil
+	}
+
+	var body bytes.Buffer
+	if err := cfg.bodyTmpl.Execute(&body, data); err != nil {
+		return "", errors.Annotatef(err, "executing body template")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, os.ExpandEnv(cfg.URL), &body)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Annotatef(err, "reading response")
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", errors.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	return string(respBody), nil
+}
+
+// showCreateIssue asks for the title of the issue pre-filled with the log
+// lines shown in the table (or only the last lastN of them, if it's not
+// zero), the query and the time range, and then creates it.
+func (app *nerdlogApp) showCreateIssue(lastN int) {
+	if app.integrations == nil || app.integrations.Issue == nil {
+		app.printError("No issue creation configured in ~/.config/nerdlog/integrations.yaml")
+		return
+	}
+
+	logs := app.mainView.getShownLogs()
+	if lastN > 0 && len(logs) > lastN {
+		logs = logs[len(logs)-lastN:]
+	}
+
+	if len(logs) == 0 {
+		app.printError("No logs to create an issue with")
+		return
+	}
+
+	rules := app.options.GetRedactionRules()
+	tz := app.options.GetTimezone()
+
+	qf := app.mainView.getQueryFull()
+	data := &issueData{
+		Query: redact(qf.MarshalShellCmd(), rules),
+		TimeRange: fmt.Sprintf(
+			"%s to %s",
+			logs[0].Time.In(tz).Format("2006-01-02 15:04:05 MST"),
+			logs[len(logs)-1].Time.In(tz).Format("2006-01-02 15:04:05 MST"),
+		),
+	}
+
+	// Same as when copying to the clipboard, the lines leave nerdlog, so
+	// they're redacted.
+	for _, msg := range logs {
+		data.Lines = append(data.Lines, redact(msg.OrigLine, rules))
+	}
+
+	var msgv *MessageView
+	create := func() {
+		data.Title = strings.TrimSpace(msgv.GetInputFieldText(0))
+		msgv.Hide()
+
+		cfg := app.integrations.Issue
+
+		// Same as when copying to the clipboard, check for secrets, and only
+		// create the issue once the user decides what to do with them.
+		text := data.Title + "\n" + data.Body()
+		app.mainView.confirmCopySecrets(text, func(confirmed string) {
+			if confirmed != text {
+				// The user chose to mask the secrets.
+				data.maskSecrets()
+			}
+
+			app.runCreateIssue(cfg, data)
+		})
+	}
+
+	msgv = app.mainView.showMessagebox(
+		msgIDIssue,
+		"Create issue",
+		fmt.Sprintf(
+			"The issue will contain %d log lines, the query and the time range (%s).",
+			len(data.Lines), data.TimeRange,
+		),
+		&MessageboxParams{
+			InputFields: []MessageViewInputFieldParams{
+				{
+					Label:      "Title:",
+					Value:      redact(firstLine(logs[len(logs)-1].Msg), rules),
+					Validators: []MessageViewValidator{ValidateNonEmpty()},
+				},
+			},
+
+			Buttons:       []string{"C&reate", "&Cancel"},
+			DefaultButton: "Create",
+			CancelButton:  "Cancel",
+			OnButtonPressed: func(label string, idx int) {
+				switch label {
+				case "Create":
+					create()
+				default:
+					msgv.Hide()
+				}
+			},
+
+			Width: 100,
+		},
+	)
+}
+
+// runCreateIssue creates the issue, and shows the result.
+func (app *nerdlogApp) runCreateIssue(cfg *ConfigIssue, data *issueData) {
+	var output string
+	app.runAsyncOp(asyncOpParams{
+		MessageID: "issue_creating",
+		Title:     "Create issue",
+		Message:   "Creating issue...",
+
+		Run: func(ctx context.Context) error {
+			var err error
+			output, err = createIssue(ctx, cfg, data)
+			return err
+		},
+
+		OnDone: func(err error) {
+			if err != nil {
+				app.mainView.showMessagebox("err", "Issue creation error", tview.Escape(err.Error()), &MessageboxParams{
+					CopyButton: true,
+				})
+				return
+			}
+
+			app.mainView.showMessagebox(
+				"issue_created", "Issue created", tview.Escape(strings.TrimSpace(output)),
+				&MessageboxParams{
+					CopyButton: true,
+				},
+			)
+		},
+	})
+}
+
+// firstLine returns the first line of the string.
+func firstLine(s string) string {
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		return s[:idx]
+	}
+
+	return s
+}
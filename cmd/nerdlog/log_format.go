@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+	"github.com/rivo/tview"
+)
+
+const msgIDLogFormat = "log_format"
+
+// confirmedLogFormat is the log format which the user has confirmed (or
+// changed) for a logstream; it's stored on disk, so that the user isn't asked
+// again until the detected format changes.
+type confirmedLogFormat struct {
+	// Format and TimestampLayout are used instead of the detected ones, see
+	// core.LogFormatOverride.
+	Format          core.LogFormat
+	TimestampLayout string
+
+	// DetectedFormat and DetectedTimestampLayout are the ones which were
+	// detected when the user confirmed the format.
+	DetectedFormat          core.LogFormat
+	DetectedTimestampLayout string
+}
+
+// fileLogFormats is a core.LogFormatOverrides with the confirmed log formats
+// stored as a JSON file. The file is read on every Get, so that the daemon
+// (see daemon.go) picks up the formats confirmed by its clients.
+type fileLogFormats struct {
+	path   string
+	logger *log.Logger
+
+	// mtx serializes the read-modify-write in put.
+	mtx sync.Mutex
+}
+
+var _ core.LogFormatOverrides = &fileLogFormats{}
+
+func newFileLogFormats(path string, logger *log.Logger) *fileLogFormats {
+	return &fileLogFormats{
+		path:   path,
+		logger: logger,
+	}
+}
+
+func logFormatsFilename() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Annotatef(err, "getting cache dir")
+	}
+
+	return filepath.Join(cacheDir, "nerdlog", "log_formats.json"), nil
+}
+
+func (f *fileLogFormats) Get(lstreamName string) (core.LogFormatOverride, bool) {
+	formats, err := f.load()
+	if err != nil {
+		f.logger.Errorf("Failed to load confirmed log formats: %s\n", err.Error())
+		return core.LogFormatOverride{}, false
+	}
+
+	cf, ok := formats[lstreamName]
+	if !ok {
+		return core.LogFormatOverride{}, false
+	}
+
+	return core.LogFormatOverride{
+		Format:          cf.Format,
+		TimestampLayout: cf.TimestampLayout,
+	}, true
+}
+
+// load returns the confirmed log formats, keyed by the logstream name. If the
+// file doesn't exist yet, an empty map is returned.
+func (f *fileLogFormats) load() (map[string]confirmedLogFormat, error) {
+	formats := map[string]confirmedLogFormat{}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return formats, nil
+		}
+
+		return nil, errors.Annotatef(err, "reading %s", f.path)
+	}
+
+	if err := json.Unmarshal(data, &formats); err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", f.path)
+	}
+
+	return formats, nil
+}
+
+// put stores the confirmed log format for the logstream.
+func (f *fileLogFormats) put(lstreamName string, cf confirmedLogFormat) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	formats, err := f.load()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	formats[lstreamName] = cf
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return errors.Annotatef(err, "creating dir for %s", f.path)
+	}
+
+	data, err := json.MarshalIndent(formats, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := os.WriteFile(f.path, data, 0600); err != nil {
+		return errors.Annotatef(err, "writing %s", f.path)
+	}
+
+	return nil
+}
+
+// validateLogFormat rejects the unknown log format names.
+func validateLogFormat() MessageViewValidator {
+	return func(value string) error {
+		_, err := core.ParseLogFormat(value)
+		return err
+	}
+}
+
+// validateTimestampLayout rejects the timestamp layouts which nerdlog can't
+// use, see core.GenerateTimeDescr.
+func validateTimestampLayout() MessageViewValidator {
+	return func(value string) error {
+		_, err := core.GenerateTimeDescr(value)
+		return err
+	}
+}
+
+// handleLogFormatsDetected is called when logstreams are bootstrapped and
+// their log format is detected. For every logstream whose detected format
+// wasn't confirmed by the user before, it asks to confirm it, or to change it;
+// the confirmed format is then used instead of the detected one, see
+// core.LogFormatOverrides.
+func (app *nerdlogApp) handleLogFormatsDetected(detected []*core.LogFormatDetected) {
+	if app.isReadOnly() {
+		// The client in control of the session will confirm.
+		return
+	}
+
+	fname, err := logFormatsFilename()
+	if err != nil {
+		app.printError(fmt.Sprintf("Failed to load confirmed log formats: %s", err.Error()))
+		return
+	}
+
+	logFormats := newFileLogFormats(fname, app.logger)
+
+	confirmed, err := logFormats.load()
+	if err != nil {
+		app.printError(fmt.Sprintf("Failed to load confirmed log formats: %s", err.Error()))
+		return
+	}
+
+	for _, d := range detected {
+		cf, ok := confirmed[d.LStreamName]
+		if ok && cf.DetectedFormat == d.Format && cf.DetectedTimestampLayout == d.TimestampLayout {
+			continue
+		}
+
+		// Whatever is being used now: either the previously confirmed format, or
+		// the detected one.
+		inUse := confirmedLogFormat{Format: d.Format, TimestampLayout: d.TimestampLayout}
+		if ok {
+			inUse = cf
+		}
+
+		app.confirmLogFormat(logFormats, d, inUse)
+	}
+}
+
+// confirmLogFormat shows the messagebox asking to confirm or change the
+// detected log format of a single logstream.
+func (app *nerdlogApp) confirmLogFormat(
+	logFormats *fileLogFormats, d *core.LogFormatDetected, inUse confirmedLogFormat,
+) {
+	var msgv *MessageView
+	msgv = app.mainView.showMessagebox(
+		fmt.Sprintf("%s_%s", msgIDLogFormat, d.LStreamName),
+		"Log format detected",
+		fmt.Sprintf(
+			"Detected log format for [::b]%s[-:-:-]: %s, timestamp layout %q, e.g.:\n\n%s\n\n"+
+				"Confirm it, or change it below. The format defines how the messages are parsed: "+
+				"e.g. for json and logfmt, the fields become the context tags, and the msg field becomes the message. "+
+				"Known formats: syslog, rfc5424, json, logfmt, access_log, cri, plain.",
+			tview.Escape(d.LStreamName), d.Format.Descr(), d.TimestampLayout,
+			tview.Escape(d.ExampleLine),
+		),
+		&MessageboxParams{
+			InputFields: []MessageViewInputFieldParams{
+				{
+					Label:      "Format:",
+					Value:      string(d.Format),
+					Validators: []MessageViewValidator{validateLogFormat()},
+				},
+				{
+					Label:      "Timestamp layout:",
+					Value:      d.TimestampLayout,
+					Validators: []MessageViewValidator{validateTimestampLayout()},
+				},
+			},
+
+			Buttons:       []string{"&Confirm", "&Not now"},
+			DefaultButton: "Confirm",
+			CancelButton:  "Not now",
+			Priority:      ModalPriorityInfo,
+			OnButtonPressed: func(label string, idx int) {
+				format, _ := core.ParseLogFormat(msgv.GetInputFieldText(0))
+				layout := msgv.GetInputFieldText(1)
+				msgv.Hide()
+
+				if label != "Confirm" {
+					// Will ask again next time.
+					return
+				}
+
+				cf := confirmedLogFormat{
+					Format:                  format,
+					TimestampLayout:         layout,
+					DetectedFormat:          d.Format,
+					DetectedTimestampLayout: d.TimestampLayout,
+				}
+
+				if err := logFormats.put(d.LStreamName, cf); err != nil {
+					app.printError(fmt.Sprintf("Failed to save confirmed log format: %s", err.Error()))
+					return
+				}
+
+				if cf.Format != inUse.Format || cf.TimestampLayout != inUse.TimestampLayout {
+					// The format is only applied on bootstrap, so reconnect and repeat
+					// the query to get the logs parsed the new way.
+					app.printMsg(fmt.Sprintf("Log format for %s changed, reconnecting", d.LStreamName))
+					app.mainView.reconnect(true)
+				}
+			},
+
+			Width: 100,
+		},
+	)
+}
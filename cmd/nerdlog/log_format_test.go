@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLogFormats(t *testing.T) {
+	formats := newFileLogFormats(filepath.Join(t.TempDir(), "nerdlog", "log_formats.json"), nil)
+
+	_, ok := formats.Get("myhost")
+	assert.False(t, ok)
+
+	require.NoError(t, formats.put("myhost", confirmedLogFormat{
+		Format:          core.LogFormatPlain,
+		TimestampLayout: "Jan _2 15:04:05",
+		DetectedFormat:  core.LogFormatSyslog,
+	}))
+
+	override, ok := formats.Get("myhost")
+	assert.True(t, ok)
+	assert.Equal(t, core.LogFormatOverride{
+		Format:          core.LogFormatPlain,
+		TimestampLayout: "Jan _2 15:04:05",
+	}, override)
+
+	_, ok = formats.Get("otherhost")
+	assert.False(t, ok)
+}
+
+func TestUILogFormatOverride(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+	h.waitForQueryDone("35 / 35 / 35")
+	h.waitForText("Log format detected")
+	assert.Contains(t, h.screenText(), "traditional syslog")
+
+	// The unknown format can't be confirmed.
+	h.pressKey(tcell.KeyCtrlU)
+	h.typeText("xml")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForText("unknown log format")
+
+	// With the plain format, the syslog envelope isn't parsed, so the hostname
+	// stays in the message.
+	h.pressKey(tcell.KeyCtrlU)
+	h.typeText("plain")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForNoText("Log format detected")
+	h.waitForText("myhost syslog[4163]: <emerg> System health check failed")
+
+	// It's remembered, and not asked again, since the detected format is the
+	// same.
+	fname, err := logFormatsFilename()
+	require.NoError(t, err)
+	data, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Format": "plain"`)
+	assert.Contains(t, string(data), `"DetectedFormat": "syslog"`)
+	assert.NotContains(t, h.screenText(), "Log format detected")
+}
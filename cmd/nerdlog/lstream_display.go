@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+// lstreamDisplayNames returns a map from the given logstream names to how
+// they should be displayed: the display name from the config, if any (see
+// core.LStreamsManagerState.DisplayNames); otherwise, if stripDomain is true,
+// the name without the domain suffix common for all the hosts (so that e.g.
+// "web1.prod.example.com" and "db1.prod.example.com" become just "web1" and
+// "db1"); otherwise the name itself.
+func lstreamDisplayNames(
+	names []string, displayNames map[string]string, stripDomain bool,
+) map[string]string {
+	ret := make(map[string]string, len(names))
+
+	var commonSuffix []string
+	haveHosts := false
+	if stripDomain {
+		for _, name := range names {
+			if _, ok := displayNames[name]; ok {
+				continue
+			}
+
+			_, host, _ := splitLStreamName(name)
+			labels := strings.Split(host, ".")
+			if net.ParseIP(host) != nil || len(labels) < 2 {
+				continue
+			}
+
+			// At least the first label has to stay.
+			labels = labels[1:]
+
+			if !haveHosts {
+				commonSuffix = labels
+				haveHosts = true
+				continue
+			}
+
+			commonSuffix = commonLabelsSuffix(commonSuffix, labels)
+		}
+	}
+
+	suffix := ""
+	if len(commonSuffix) > 0 {
+		suffix = "." + strings.Join(commonSuffix, ".")
+	}
+
+	for _, name := range names {
+		if displayName, ok := displayNames[name]; ok {
+			ret[name] = displayName
+			continue
+		}
+
+		prefix, host, rest := splitLStreamName(name)
+		if suffix != "" && net.ParseIP(host) == nil && strings.HasSuffix(host, suffix) {
+			host = strings.TrimSuffix(host, suffix)
+		}
+
+		ret[name] = prefix + host + rest
+	}
+
+	return ret
+}
+
+// splitLStreamName splits the logstream name like
+// "user@myhost:22:/var/log/syslog" into the prefix with the user
+// ("user@"), the host ("myhost"), and the rest (":22:/var/log/syslog").
+func splitLStreamName(name string) (prefix, host, rest string) {
+	if atIdx := strings.IndexByte(name, '@'); atIdx >= 0 {
+		prefix, name = name[:atIdx+1], name[atIdx+1:]
+	}
+
+	host = name
+	if colonIdx := strings.IndexByte(name, ':'); colonIdx >= 0 {
+		host, rest = name[:colonIdx], name[colonIdx:]
+	}
+
+	return prefix, host, rest
+}
+
+// commonLabelsSuffix returns the longest common suffix of the two slices.
+func commonLabelsSuffix(a, b []string) []string {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+
+	return a[len(a)-n:]
+}
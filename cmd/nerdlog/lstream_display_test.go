@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLStreamDisplayNames(t *testing.T) {
+	names := []string{
+		"web1.prod.example.com",
+		"admin@db1.prod.example.com:2222:/var/log/syslog",
+		"cache1.staging.example.com",
+		"10.0.3.17",
+		"localhost",
+	}
+
+	assert.Equal(t, map[string]string{
+		"web1.prod.example.com":                           "web1.prod",
+		"admin@db1.prod.example.com:2222:/var/log/syslog": "admin@db1.prod:2222:/var/log/syslog",
+		"cache1.staging.example.com":                      "cache1.staging",
+		"10.0.3.17":                                       "ip17",
+		"localhost":                                       "localhost",
+	}, lstreamDisplayNames(names, map[string]string{"10.0.3.17": "ip17"}, true))
+
+	// The display names from the config are used regardless of stripDomain.
+	assert.Equal(t, map[string]string{
+		"web1.prod.example.com": "web1",
+		"db1.prod.example.com":  "db1.prod.example.com",
+	}, lstreamDisplayNames(
+		[]string{"web1.prod.example.com", "db1.prod.example.com"},
+		map[string]string{"web1.prod.example.com": "web1"},
+		false,
+	))
+
+	// A single host is shown without its domain.
+	assert.Equal(t, map[string]string{
+		"web1.prod.example.com": "web1",
+	}, lstreamDisplayNames([]string{"web1.prod.example.com"}, nil, true))
+}
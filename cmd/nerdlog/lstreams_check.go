@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/daemon"
+	"github.com/juju/errors"
+	"github.com/rivo/tview"
+)
+
+// lstreamsCheckTimeout is how long the check of the logstreams is allowed to
+// take, after which the logstreams which aren't done yet are reported as
+// timed out.
+const lstreamsCheckTimeout = 30 * time.Second
+
+const msgIDLStreamsCheck = "lstreams_check"
+
+// lstreamCheck is the result of checking a single logstream: connecting to
+// it, and bootstrapping the agent there (which runs it on the actual logs, to
+// detect the format).
+type lstreamCheck struct {
+	// connectedIn and bootstrappedIn are how long it took since the beginning
+	// of the check; zero if it didn't happen (yet).
+	connectedIn    time.Duration
+	bootstrappedIn time.Duration
+
+	// err is the error, if the check failed.
+	err string
+}
+
+func (c *lstreamCheck) isDone() bool {
+	return c.bootstrappedIn != 0 || c.err != ""
+}
+
+// lstreamsCheck is the state of checking all the logstreams from the given
+// spec, built from the updates of the LStreamsManager created for just that.
+type lstreamsCheck struct {
+	startTime time.Time
+
+	checks map[string]*lstreamCheck
+
+	// noMatching is true if the spec doesn't match any logstreams.
+	noMatching bool
+}
+
+func newLStreamsCheck(startTime time.Time) *lstreamsCheck {
+	return &lstreamsCheck{
+		startTime: startTime,
+		checks:    map[string]*lstreamCheck{},
+	}
+}
+
+func (c *lstreamsCheck) getCheck(name string) *lstreamCheck {
+	check, ok := c.checks[name]
+	if !ok {
+		check = &lstreamCheck{}
+		c.checks[name] = check
+	}
+
+	return check
+}
+
+// handleUpdate updates the check results with the given update from the
+// LStreamsManager which happened at the given time.
+func (c *lstreamsCheck) handleUpdate(upd core.LStreamsManagerUpdate, now time.Time) {
+	elapsed := now.Sub(c.startTime)
+
+	switch {
+	case upd.State != nil:
+		c.noMatching = upd.State.NoMatchingLStreams
+
+		for state, names := range upd.State.LStreamsByState {
+			for name := range names {
+				check := c.getCheck(name)
+				if check.isDone() || check.connectedIn != 0 {
+					continue
+				}
+
+				if state == core.LStreamClientStateConnectedIdle ||
+					state == core.LStreamClientStateConnectedBusy {
+					check.connectedIn = elapsed
+				}
+			}
+		}
+
+		// The connection is retried over and over, but for the check, the
+		// first failure is enough.
+		for name, details := range upd.State.ConnDetailsByLStream {
+			check := c.getCheck(name)
+			if details.Err != "" && !check.isDone() {
+				check.err = "connection failed: " + details.Err
+			}
+		}
+
+	case upd.BootstrapIssue != nil:
+		check := c.getCheck(upd.BootstrapIssue.LStreamName)
+		if upd.BootstrapIssue.Err != "" && !check.isDone() {
+			check.err = "agent failed: " + upd.BootstrapIssue.Err
+		}
+
+	case upd.LogFormatDetected != nil:
+		check := c.getCheck(upd.LogFormatDetected.LStreamName)
+		if !check.isDone() {
+			check.bootstrappedIn = elapsed
+		}
+	}
+}
+
+// isDone returns true if all the logstreams are checked.
+func (c *lstreamsCheck) isDone() bool {
+	if c.noMatching {
+		return true
+	}
+
+	if len(c.checks) == 0 {
+		return false
+	}
+
+	for _, check := range c.checks {
+		if !check.isDone() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// timeout marks all the logstreams which aren't done yet as timed out.
+func (c *lstreamsCheck) timeout() {
+	for _, check := range c.checks {
+		if !check.isDone() {
+			check.err = fmt.Sprintf("timed out after %s", lstreamsCheckTimeout)
+		}
+	}
+}
+
+// String returns the results as text with color tags, one logstream per
+// line.
+func (c *lstreamsCheck) String() string {
+	if c.noMatching {
+		return "No matching logstreams"
+	}
+
+	if len(c.checks) == 0 {
+		return "Resolving logstreams..."
+	}
+
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+
+		check := c.checks[name]
+		sb.WriteString(tview.Escape(name))
+		sb.WriteString(": ")
+
+		switch {
+		case check.err != "":
+			sb.WriteString("[red]FAIL[-]: " + tview.Escape(check.err))
+		case check.bootstrappedIn != 0:
+			fmt.Fprintf(
+				&sb, "[green]OK[-]: connected in %s, agent ran in %s",
+				formatCheckDuration(check.connectedIn),
+				formatCheckDuration(check.bootstrappedIn-check.connectedIn),
+			)
+		case check.connectedIn != 0:
+			fmt.Fprintf(
+				&sb, "connected in %s, running agent...",
+				formatCheckDuration(check.connectedIn),
+			)
+		default:
+			sb.WriteString("connecting...")
+		}
+	}
+
+	return sb.String()
+}
+
+func formatCheckDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// checkLStreams connects to all the logstreams from the given spec, and
+// shows the latency and errors for every logstream as they come.
+func (app *nerdlogApp) checkLStreams(lstreamsSpec string) {
+	stopCh := make(chan struct{})
+	stop := func() {
+		select {
+		case <-stopCh:
+		default:
+			close(stopCh)
+		}
+	}
+
+	var msgv *MessageView
+	err := app.startLStreamsCheck(lstreamsSpec, stopCh, func(check *lstreamsCheck, done bool) {
+		text := check.String()
+		app.tviewApp.QueueUpdateDraw(func() {
+			msgv.SetText(text, true)
+		})
+	})
+	if err != nil {
+		app.mainView.showMessagebox("err", "Error", tview.Escape(err.Error()), nil)
+		return
+	}
+
+	msgv = app.mainView.showMessagebox(
+		msgIDLStreamsCheck, "Logstreams test", newLStreamsCheck(time.Now()).String(), &MessageboxParams{
+			Buttons: []string{"Close"},
+			OnButtonPressed: func(label string, idx int) {
+				stop()
+				msgv.Hide()
+			},
+			OnEsc: func() {
+				stop()
+				msgv.Hide()
+			},
+			Width: 100,
+		},
+	)
+}
+
+// startLStreamsCheck starts checking the logstreams from the given spec in a
+// separate goroutine, using a separate LStreamsManager (so the current
+// connections aren't affected). Every time the results change, onChange is
+// called from that goroutine, with done being true for the last time; it's
+// not called if the check is stopped by closing stopCh, or if the TUI has
+// exited.
+func (app *nerdlogApp) startLStreamsCheck(
+	lstreamsSpec string,
+	stopCh <-chan struct{},
+	onChange func(check *lstreamsCheck, done bool),
+) error {
+	lsmanParams, err := makeLStreamsManagerParams(app.params, app.logstreamsCfg, app.logger)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	// Use a different ClientID, so that the agent files on the hosts don't
+	// conflict with the ones of the main connections.
+	lsmanParams.ClientID += "_check"
+
+	updatesCh := make(chan core.LStreamsManagerUpdate, 128)
+	lsmanParams.UpdatesCh = updatesCh
+
+	lsman := core.NewLStreamsManager(lsmanParams)
+	if err := lsman.SetLStreams(lstreamsSpec); err != nil {
+		closeLStreamsManager(lsman, updatesCh)
+		return errors.Annotatef(err, "logstreams")
+	}
+
+	check := newLStreamsCheck(time.Now())
+
+	go func() {
+		defer app.recoverPanic()
+		defer closeLStreamsManager(lsman, updatesCh)
+
+		timer := time.NewTimer(lstreamsCheckTimeout)
+		defer timer.Stop()
+
+		timedOut := false
+
+		for {
+			select {
+			case upd := <-updatesCh:
+				if upd.DataRequest != nil {
+					if app.tviewApp == nil {
+						return
+					}
+
+					app.tviewApp.QueueUpdateDraw(func() {
+						app.mainView.handleDataRequest(upd.DataRequest)
+					})
+					continue
+				}
+
+				check.handleUpdate(upd, time.Now())
+
+			case <-timer.C:
+				check.timeout()
+				timedOut = true
+
+			case <-stopCh:
+				return
+			}
+
+			done := check.isDone() || timedOut
+
+			// The TUI might have exited already.
+			if app.tviewApp == nil {
+				return
+			}
+
+			onChange(check, done)
+
+			if done {
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// closeLStreamsManager closes the LStreamsManager and waits for it to tear
+// down, discarding the updates it sends meanwhile.
+func closeLStreamsManager(lsman daemon.LStreamsManager, updatesCh <-chan core.LStreamsManagerUpdate) {
+	lsman.Close()
+
+	doneCh := make(chan struct{})
+	go func() {
+		lsman.Wait()
+		close(doneCh)
+	}()
+
+	for {
+		select {
+		case upd := <-updatesCh:
+			if upd.DataRequest != nil {
+				go func(ch chan<- string) {
+					ch <- ""
+				}(upd.DataRequest.ResponseCh)
+			}
+
+		case <-doneCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLStreamsCheck(t *testing.T) {
+	t0 := time.Date(2025, 3, 11, 10, 0, 0, 0, time.UTC)
+	c := newLStreamsCheck(t0)
+
+	assert.False(t, c.isDone())
+	assert.Equal(t, "Resolving logstreams...", c.String())
+
+	state := func(byState map[core.LStreamClientState][]string, connDetails map[string]core.ConnDetails) core.LStreamsManagerUpdate {
+		lstreamsByState := map[core.LStreamClientState]map[string]struct{}{}
+		for state, names := range byState {
+			lstreamsByState[state] = map[string]struct{}{}
+			for _, name := range names {
+				lstreamsByState[state][name] = struct{}{}
+			}
+		}
+
+		return core.LStreamsManagerUpdate{
+			State: &core.LStreamsManagerState{
+				LStreamsByState:      lstreamsByState,
+				ConnDetailsByLStream: connDetails,
+			},
+		}
+	}
+
+	c.handleUpdate(state(map[core.LStreamClientState][]string{
+		core.LStreamClientStateConnecting: {"host1", "host2", "host3"},
+	}, nil), t0)
+	assert.Equal(t, "host1: connecting...\nhost2: connecting...\nhost3: connecting...", c.String())
+
+	c.handleUpdate(state(map[core.LStreamClientState][]string{
+		core.LStreamClientStateConnecting:    {"host3"},
+		core.LStreamClientStateConnectedBusy: {"host1", "host2"},
+	}, map[string]core.ConnDetails{
+		"host3": {Err: "attempt 1: connection refused"},
+	}), t0.Add(500*time.Millisecond))
+
+	c.handleUpdate(core.LStreamsManagerUpdate{
+		LogFormatDetected: &core.LogFormatDetected{LStreamName: "host1"},
+	}, t0.Add(700*time.Millisecond))
+	assert.False(t, c.isDone())
+
+	c.handleUpdate(core.LStreamsManagerUpdate{
+		BootstrapIssue: &core.BootstrapIssue{LStreamName: "host2", Err: "no logs found"},
+	}, t0.Add(800*time.Millisecond))
+	assert.True(t, c.isDone())
+
+	assert.Equal(t, ""+
+		"host1: [green]OK[-]: connected in 500ms, agent ran in 200ms\n"+
+		"host2: [red]FAIL[-]: agent failed: no logs found\n"+
+		"host3: [red]FAIL[-]: connection failed: attempt 1: connection refused",
+		c.String(),
+	)
+
+	// Timeout
+	c = newLStreamsCheck(t0)
+	c.handleUpdate(state(map[core.LStreamClientState][]string{
+		core.LStreamClientStateConnectedBusy: {"host1"},
+	}, nil), t0.Add(time.Second))
+	assert.Equal(t, "host1: connected in 1s, running agent...", c.String())
+
+	c.timeout()
+	assert.True(t, c.isDone())
+	assert.Equal(t, "host1: [red]FAIL[-]: timed out after 30s", c.String())
+
+	c = newLStreamsCheck(t0)
+	c.handleUpdate(core.LStreamsManagerUpdate{
+		State: &core.LStreamsManagerState{NoMatchingLStreams: true},
+	}, t0)
+	assert.True(t, c.isDone())
+	assert.Equal(t, "No matching logstreams", c.String())
+}
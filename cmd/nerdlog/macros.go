@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type macroState int
+
+const (
+	macroStateIdle macroState = iota
+
+	// macroStateWaitRecordRegister means that "q" was pressed, and the next key
+	// is the register to record the macro into.
+	macroStateWaitRecordRegister
+
+	// macroStateWaitReplayRegister means that "@" was pressed, and the next key
+	// is the register to replay the macro from.
+	macroStateWaitReplayRegister
+)
+
+// macroRecorder implements vim-style keyboard macros: "q<register>" starts
+// recording all the key events into the register, the next "q" stops it, and
+// "@<register>" replays the recorded keys; "@@" replays the last replayed
+// macro.
+//
+// All the key events should go through handleEvent before reaching the
+// widgets (so it's meant to be used as the input capture of the root
+// primitive), while the "q" and "@" themselves are only special in some widgets, like
+// the logs table, so those widgets call startStopRecording and startReplay.
+type macroRecorder struct {
+	params macroRecorderParams
+
+	state macroState
+
+	// recordingRegister is the register being recorded into, or 0 if we're not
+	// recording anything.
+	recordingRegister rune
+	recorded          []*tcell.EventKey
+
+	registers    map[rune][]*tcell.EventKey
+	lastReplayed rune
+
+	// replayed contains the events which were queued by replay and not yet
+	// handled, so that we know not to record them again. Like the rest of
+	// macroRecorder, it's only accessed from the UI goroutine.
+	replayed map[*tcell.EventKey]struct{}
+}
+
+type macroRecorderParams struct {
+	// QueueEvents should queue the events to be handled by the application, in
+	// order, as if the keys were actually pressed. It's called from
+	// handleEvent, i.e. from the UI goroutine, so it must not block waiting for
+	// the events to be handled: the macros can easily be longer than the
+	// application's event queue.
+	QueueEvents func(events []*tcell.EventKey)
+
+	// PrintMsg prints a message to the user.
+	PrintMsg func(s string, level nlMsgLevel)
+
+	// OnRecordingChange, if not nil, is called whenever recording starts or
+	// stops.
+	OnRecordingChange func()
+}
+
+func newMacroRecorder(params macroRecorderParams) *macroRecorder {
+	return &macroRecorder{
+		params:    params,
+		registers: map[rune][]*tcell.EventKey{},
+		replayed:  map[*tcell.EventKey]struct{}{},
+	}
+}
+
+func isMacroRegister(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+}
+
+// handleEvent must be called for every key event before it's handled by the
+// widgets; it returns the event to pass further, or nil if the event was
+// consumed.
+func (mr *macroRecorder) handleEvent(event *tcell.EventKey) *tcell.EventKey {
+	_, isReplayed := mr.replayed[event]
+	if isReplayed {
+		delete(mr.replayed, event)
+	}
+
+	switch mr.state {
+	case macroStateWaitRecordRegister:
+		mr.state = macroStateIdle
+
+		if event.Key() != tcell.KeyRune || !isMacroRegister(event.Rune()) {
+			mr.params.PrintMsg("Macro recording cancelled", nlMsgLevelInfo)
+			return nil
+		}
+
+		mr.recordingRegister = event.Rune()
+		mr.recorded = nil
+		mr.params.PrintMsg(
+			fmt.Sprintf("Recording @%c, press q to stop", mr.recordingRegister), nlMsgLevelInfo,
+		)
+		mr.bumpRecording()
+
+		return nil
+
+	case macroStateWaitReplayRegister:
+		mr.state = macroStateIdle
+		mr.record(event, isReplayed)
+
+		if isReplayed {
+			// Replaying macros from macros could easily result in an infinite
+			// loop, so just don't do that.
+			mr.params.PrintMsg("Macros can't replay other macros", nlMsgLevelErr)
+			return nil
+		}
+
+		if event.Key() != tcell.KeyRune {
+			return nil
+		}
+
+		register := event.Rune()
+		if register == '@' {
+			register = mr.lastReplayed
+			if register == 0 {
+				mr.params.PrintMsg("No macro was replayed yet", nlMsgLevelErr)
+				return nil
+			}
+		}
+
+		if !isMacroRegister(register) {
+			mr.params.PrintMsg(fmt.Sprintf("Invalid macro register: %c", register), nlMsgLevelErr)
+			return nil
+		}
+
+		mr.replay(register)
+		return nil
+	}
+
+	mr.record(event, isReplayed)
+
+	return event
+}
+
+func (mr *macroRecorder) record(event *tcell.EventKey, isReplayed bool) {
+	if mr.recordingRegister == 0 || isReplayed {
+		return
+	}
+
+	mr.recorded = append(mr.recorded, event)
+}
+
+// isRecording returns the register being recorded into, or 0 if we're not
+// recording.
+func (mr *macroRecorder) isRecording() rune {
+	return mr.recordingRegister
+}
+
+// startStopRecording should be called when "q" is pressed: if we're not
+// recording, it starts waiting for the register; otherwise it stops recording
+// and saves the macro.
+func (mr *macroRecorder) startStopRecording() {
+	if mr.recordingRegister == 0 {
+		mr.state = macroStateWaitRecordRegister
+		mr.params.PrintMsg("Press a register key (a-z, 0-9) to record the macro into", nlMsgLevelInfo)
+		return
+	}
+
+	// The last recorded event is the "q" which stops the recording, so drop it.
+	recorded := mr.recorded
+	if len(recorded) > 0 {
+		recorded = recorded[:len(recorded)-1]
+	}
+
+	mr.registers[mr.recordingRegister] = recorded
+	mr.params.PrintMsg(
+		fmt.Sprintf("Recorded @%c: %d keys", mr.recordingRegister, len(recorded)), nlMsgLevelInfo,
+	)
+
+	mr.recordingRegister = 0
+	mr.recorded = nil
+	mr.bumpRecording()
+}
+
+// startReplay should be called when "@" is pressed; the next key is the
+// register to replay.
+func (mr *macroRecorder) startReplay() {
+	mr.state = macroStateWaitReplayRegister
+}
+
+func (mr *macroRecorder) replay(register rune) {
+	if register == mr.recordingRegister {
+		mr.params.PrintMsg(fmt.Sprintf("Can't replay @%c while recording it", register), nlMsgLevelErr)
+		return
+	}
+
+	events := mr.registers[register]
+	if len(events) == 0 {
+		mr.params.PrintMsg(fmt.Sprintf("Macro @%c is empty", register), nlMsgLevelErr)
+		return
+	}
+
+	mr.lastReplayed = register
+
+	queued := make([]*tcell.EventKey, 0, len(events))
+	for _, event := range events {
+		// Create a new event every time, so that we can tell it from the ones
+		// the user actually presses.
+		ev := tcell.NewEventKey(event.Key(), event.Rune(), event.Modifiers())
+		mr.replayed[ev] = struct{}{}
+		queued = append(queued, ev)
+	}
+
+	mr.params.QueueEvents(queued)
+}
+
+func (mr *macroRecorder) bumpRecording() {
+	if mr.params.OnRecordingChange != nil {
+		mr.params.OnRecordingChange()
+	}
+}
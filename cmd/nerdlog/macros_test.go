@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// macroTestEnv feeds the keys to the macroRecorder the same way the app does:
+// every event goes through handleEvent first, and then "q" and "@" are
+// handled like in the logs table; all the other keys passed further are
+// collected in handled.
+type macroTestEnv struct {
+	mr      *macroRecorder
+	queue   []*tcell.EventKey
+	handled string
+}
+
+func newMacroTestEnv() *macroTestEnv {
+	env := &macroTestEnv{}
+	env.mr = newMacroRecorder(macroRecorderParams{
+		QueueEvents: func(events []*tcell.EventKey) {
+			env.queue = append(env.queue, events...)
+		},
+		PrintMsg: func(s string, level nlMsgLevel) {},
+	})
+
+	return env
+}
+
+func (env *macroTestEnv) handle(event *tcell.EventKey) {
+	event = env.mr.handleEvent(event)
+	if event == nil {
+		return
+	}
+
+	switch event.Rune() {
+	case 'q':
+		env.mr.startStopRecording()
+	case '@':
+		env.mr.startReplay()
+	default:
+		env.handled += string(event.Rune())
+	}
+}
+
+// press simulates the user pressing the keys, and then handles all the
+// queued events, if any.
+func (env *macroTestEnv) press(keys string) {
+	for _, r := range keys {
+		env.handle(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+	}
+
+	for len(env.queue) > 0 {
+		event := env.queue[0]
+		env.queue = env.queue[1:]
+		env.handle(event)
+	}
+}
+
+func TestMacroRecorder(t *testing.T) {
+	env := newMacroTestEnv()
+
+	env.press("qa")
+	assert.Equal(t, 'a', env.mr.isRecording())
+	assert.Equal(t, "", env.handled)
+
+	env.press("jyn")
+	env.press("q")
+	assert.Equal(t, rune(0), env.mr.isRecording())
+	assert.Equal(t, "jyn", env.handled)
+
+	env.handled = ""
+	env.press("@a")
+	assert.Equal(t, "jyn", env.handled)
+
+	env.handled = ""
+	env.press("@@")
+	assert.Equal(t, "jyn", env.handled)
+
+	// Empty register.
+	env.handled = ""
+	env.press("@b")
+	assert.Equal(t, "", env.handled)
+
+	// Invalid register cancels recording.
+	env.press("q!x")
+	assert.Equal(t, rune(0), env.mr.isRecording())
+	assert.Equal(t, "x", env.handled)
+
+	// Macros recorded while replaying other macros contain the "@a" itself,
+	// not the replayed keys.
+	env.handled = ""
+	env.press("qbx@aq")
+	assert.Equal(t, "xjyn", env.handled)
+
+	env.handled = ""
+	env.press("@b")
+	assert.Equal(t, "x", env.handled)
+}
+
+func TestUIMacroReplayLong(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+
+	// Record a macro which is longer than the event queue of the app: moves
+	// the cursor down a lot, and then changes the query.
+	h.pressKey(tcell.KeyEsc)
+	h.typeText("qa")
+	h.typeText(strings.Repeat("j", 150))
+	h.typeText("i")
+	h.pressKey(tcell.KeyCtrlU)
+	h.typeText("/Firewall/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("1 / 1 / 1")
+	h.pressKey(tcell.KeyEsc)
+	h.typeText("q")
+
+	// Reset the query.
+	h.typeText("i")
+	h.pressKey(tcell.KeyCtrlU)
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("35 / 35 / 35")
+
+	// Replaying the macro gets to the same query in the end.
+	h.pressKey(tcell.KeyEsc)
+	h.typeText("@a")
+	h.waitForQueryDone("1 / 1 / 1")
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/dimonomid/nerdlog/clhistory"
 	"github.com/dimonomid/nerdlog/clipboard"
+	"github.com/dimonomid/nerdlog/daemon"
 	"github.com/dimonomid/nerdlog/log"
 	"github.com/dimonomid/nerdlog/version"
 	"github.com/spf13/pflag"
@@ -40,8 +41,17 @@ func main() {
 		flagLogLevel    = pflag.String("loglevel", "error", "This is NOT about the logs that nerdlog fetches from the remote servers, it's rather about nerdlog's own log. Valid values are: error, warning, info, verbose1, verbose2 or verbose3")
 		flagSSHConfig   = pflag.String("ssh-config", filepath.Join(homeDir, ".ssh", "config"), "ssh config file to use; set to an empty string to disable reading ssh config")
 		flagSSHKeys     = pflag.StringSlice("ssh-key", defaultSSHKeys, "ssh keys to use; only the first existing file will be used")
+		flagAuthHelper  = pflag.String("auth-helper", "", "Shell command printing the ssh key passphrase or password to stdout, instead of asking for it interactively; see the README for the env vars it gets")
+		flagSSHPassword = pflag.Bool("ssh-password-auth", false, "Enable the ssh password and keyboard-interactive auth; NOTE that the host keys are not verified yet, so the password could be sent to an impostor")
 
 		flagNoJournalctlAccessWarn = pflag.Bool("no-journalctl-access-warning", false, "Suppress the warning when journalctl is being used by the user who can't read all system logs")
+
+		flagDaemon        = pflag.Bool("daemon", false, "Run the daemon which keeps connections open between nerdlog runs, instead of the UI; see also --use-daemon")
+		flagUseDaemon     = pflag.Bool("use-daemon", false, "Attach to the running daemon (started with --daemon) instead of connecting to logstreams directly")
+		flagDaemonSocket  = pflag.String("daemon-socket", "", "Path to the daemon unix socket; by default, it's in the user cache dir")
+		flagDaemonSession = pflag.String("daemon-session", daemon.DefaultSessionName, "Name of the daemon session to attach to; every session has its own set of connections")
+
+		flagScheduledQueries = pflag.String("scheduled-queries", filepath.Join(homeDir, ".config", "nerdlog", "scheduled_queries.yaml"), "Config of the queries which the daemon runs on schedule, storing the results locally; ignored without --daemon, and if the file doesn't exist")
 	)
 
 	pflag.Parse()
@@ -51,6 +61,15 @@ func main() {
 		os.Exit(0)
 	}
 
+	daemonSocketPath := *flagDaemonSocket
+	if daemonSocketPath == "" && (*flagDaemon || *flagUseDaemon) {
+		daemonSocketPath, err = daemon.DefaultSocketPath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
 	queryCLHistory, err := clhistory.New(clhistory.CLHistoryParams{
 		Filename: filepath.Join(homeDir, ".nerdlog_query_history"),
 	})
@@ -115,42 +134,51 @@ func main() {
 		fmt.Printf("NOTE: X Clipboard is not available: %s\n", clipboard.InitErr.Error())
 	}
 
-	logLevel := log.Info
-	if *flagLogLevel == "error" {
-		logLevel = log.Error
-	} else if *flagLogLevel == "warning" {
-		logLevel = log.Warning
-	} else if *flagLogLevel == "info" {
-		logLevel = log.Info
-	} else if *flagLogLevel == "verbose1" {
-		logLevel = log.Verbose1
-	} else if *flagLogLevel == "verbose2" {
-		logLevel = log.Verbose2
-	} else if *flagLogLevel == "verbose3" {
-		logLevel = log.Verbose3
-	} else {
-		fmt.Fprintf(os.Stderr, "Invalid --loglevel, try error, warning, info, verbose1, verbose2 or verbose3")
+	logLevel, err := log.ParseLogLevel(*flagLogLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --loglevel: %s\n", err)
 		os.Exit(1)
 	}
 
-	app, err := newNerdlogApp(
-		nerdlogAppParams{
-			initialQueryData: initialQueryData,
-			connectRightAway: connectRightAway,
-			clipboardInitErr: clipboard.InitErr,
-			logLevel:         logLevel,
-			sshConfigPath:    *flagSSHConfig,
-			sshKeys:          *flagSSHKeys,
+	appParams := nerdlogAppParams{
+		initialQueryData: initialQueryData,
+		connectRightAway: connectRightAway,
+		clipboardInitErr: clipboard.InitErr,
+		logLevel:         logLevel,
+		sshConfigPath:    *flagSSHConfig,
+		sshKeys:          *flagSSHKeys,
+		authHelper:       *flagAuthHelper,
 
-			noJournalctlAccessWarn: *flagNoJournalctlAccessWarn,
-		},
-		queryCLHistory,
-	)
+		allowPasswordAuth: *flagSSHPassword,
+
+		noJournalctlAccessWarn: *flagNoJournalctlAccessWarn,
+
+		useDaemon:        *flagUseDaemon,
+		daemonSocketPath: daemonSocketPath,
+		daemonSession:    *flagDaemonSession,
+
+		scheduledQueriesPath: *flagScheduledQueries,
+	}
+
+	if *flagDaemon {
+		if err := runDaemon(appParams); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	app, err := newNerdlogApp(appParams, queryCLHistory)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
+	// Panics in the UI goroutine end up here (tview restores the terminal and
+	// re-panics).
+	defer app.recoverPanic()
+
 	fmt.Println("Starting UI ...")
 	if err := app.runTViewApp(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
@@ -25,6 +25,7 @@ const (
 	pageNameRowDetails      = "row_details"
 	pageNameColumnDetails   = "column_details"
 	pageNameTextView        = "text_view"
+	pageNameFilterPipeline  = "filter_pipeline"
 )
 
 const (
@@ -45,6 +46,10 @@ type MainViewParams struct {
 
 	OnLStreamsChange OnLStreamsChange
 
+	// OnLStreamsCheck is called when the user wants to test the connection to
+	// the logstreams from the given spec, before applying it.
+	OnLStreamsCheck OnLStreamsCheck
+
 	OnDisconnectRequest OnDisconnectRequest
 	OnReconnectRequest  OnReconnectRequest
 
@@ -80,6 +85,9 @@ type MainView struct {
 
 	queryEditView *QueryEditView
 
+	// filterPipelineView is nil if it's not shown.
+	filterPipelineView *FilterPipelineView
+
 	// overlayMsgView is nil if there's no overlay msg.
 	overlayMsgView            *MessageView
 	overlayText               string
@@ -101,6 +109,10 @@ type MainView struct {
 	// from, to represent the selected time range
 	from, to TimeOrDur
 
+	// ranges is only non-nil for multi-range queries (see ParseFromToRanges),
+	// and then from and to cover all of them.
+	ranges []FromToRange
+
 	// query is the effective search query
 	query string
 
@@ -123,6 +135,10 @@ type MainView struct {
 	// trying to find this non-existing future timestamp there.
 	actualToForQuery time.Time
 
+	// actualRanges are the ranges resolved in the same way as actualFrom and
+	// actualToForQuery; only non-nil for multi-range queries.
+	actualRanges []core.TimeRange
+
 	// existingTagNames is a list of all tag names that exist in currently
 	// queried logs (regardless of whether those columns exist in the UI).
 	existingTagNames map[string]struct{}
@@ -146,10 +162,35 @@ type MainView struct {
 	// time range isn't limited)
 	statsFrom, statsTo time.Time
 
+	// rowTxns is a map from the logs table row to the transaction the message
+	// in that row belongs to (see groupTransactions), and expandedTxns contains
+	// the ids of the transactions which are expanded, i.e. all their messages
+	// are shown, not just the first one.
+	rowTxns      map[int]*logTransaction
+	expandedTxns map[string]struct{}
+
+	// colWidths is a map from the column name to its current width in the logs
+	// table, as set by fitColumnWidths.
+	colWidths map[string]int
+
+	follow followState
+
+	// brushFrom and brushTo, if not zero, are the time range to which the
+	// already loaded logs are filtered in the logs table, without querying
+	// anything (see setBrush).
+	brushFrom, brushTo time.Time
+
 	//marketViewsByID map[common.MarketID]*MarketView
 	//marketDescrByID map[common.MarketID]MarketDescr
 
 	modalsFocusStack []modalFocusItem
+
+	// modalQueue makes sure the prioritized messageboxes are shown in order.
+	modalQueue modalQueue
+
+	ipEnricher *ipEnricher
+
+	macros *macroRecorder
 }
 
 type modalFocusItem struct {
@@ -168,6 +209,7 @@ type CmdOpts struct {
 
 type OnLogQueryCallback func(params core.QueryLogsParams)
 type OnLStreamsChange func(lstreamsSpec string) error
+type OnLStreamsCheck func(lstreamsSpec string)
 type OnDisconnectRequest func()
 type OnReconnectRequest func()
 type OnCmdCallback func(cmd string, opts CmdOpts)
@@ -225,6 +267,23 @@ func NewMainView(params *MainViewParams) *MainView {
 		params: *params,
 	}
 
+	mv.ipEnricher = newIPEnricher(mv.params.Options)
+
+	mv.macros = newMacroRecorder(macroRecorderParams{
+		QueueEvents: func(events []*tcell.EventKey) {
+			// The event queue of the app is limited, and it's only drained by the
+			// UI goroutine (which is the one calling us), so feed the events from
+			// a separate goroutine.
+			go func() {
+				for _, event := range events {
+					mv.params.App.QueueEvent(event)
+				}
+			}()
+		},
+		PrintMsg:          mv.printMsg,
+		OnRecordingChange: mv.bumpStatusLineRight,
+	})
+
 	var err error
 	mv.selectQuery, err = ParseSelectQuery(DefaultSelectQuery)
 	if err != nil {
@@ -241,6 +300,9 @@ func NewMainView(params *MainViewParams) *MainView {
 
 	mv.rootPages = tview.NewPages()
 
+	// All the keys go through the macro recorder first.
+	mv.rootPages.SetInputCapture(mv.macros.handleEvent)
+
 	mainFlex := tview.NewFlex().SetDirection(tview.FlexRow)
 
 	mv.queryLabel = tview.NewTextView()
@@ -577,6 +639,22 @@ func NewMainView(params *MainViewParams) *MainView {
 			case 'i', 'a':
 				mv.params.App.SetFocus(mv.queryInput)
 				return nil
+
+			case 'u':
+				mv.params.OnCmd("undo", CmdOpts{Internal: true})
+				return nil
+
+			case 'U':
+				mv.params.OnCmd("redo", CmdOpts{Internal: true})
+				return nil
+
+			case 'q':
+				mv.macros.startStopRecording()
+				return nil
+
+			case '@':
+				mv.macros.startReplay()
+				return nil
 			}
 		}
 
@@ -596,6 +674,14 @@ func NewMainView(params *MainViewParams) *MainView {
 		mv.setTimeRange(fromTime, toTime)
 		mv.doQuery(doQueryParams{})
 	})
+	mv.histogram.SetBrushedFunc(func(from, to int) {
+		if from == 0 && to == 0 {
+			mv.setBrush(time.Time{}, time.Time{})
+			return
+		}
+
+		mv.setBrush(time.Unix(int64(from), 0), time.Unix(int64(to), 0))
+	})
 
 	mainFlex.AddItem(mv.histogram, 6, 0, false)
 
@@ -645,6 +731,46 @@ func NewMainView(params *MainViewParams) *MainView {
 			case 'i', 'a':
 				mv.params.App.SetFocus(mv.queryInput)
 				return nil
+
+			case 'u':
+				mv.params.OnCmd("undo", CmdOpts{Internal: true})
+				return nil
+
+			case 'U':
+				mv.params.OnCmd("redo", CmdOpts{Internal: true})
+				return nil
+
+			case 'q':
+				mv.macros.startStopRecording()
+				return nil
+
+			case '@':
+				mv.macros.startReplay()
+				return nil
+
+			case '+':
+				mv.quickFilterSelected(false)
+				return nil
+
+			case '-':
+				mv.quickFilterSelected(true)
+				return nil
+
+			case 'f':
+				mv.showQuickFilter()
+				return nil
+
+			case 'z':
+				mv.toggleTransaction()
+				return nil
+
+			case 'Z':
+				mv.toggleAllTransactions()
+				return nil
+
+			case 'F':
+				mv.followJumpToLive()
+				return nil
 			}
 		}
 
@@ -663,13 +789,23 @@ func NewMainView(params *MainViewParams) *MainView {
 		}
 	}).SetSelectedFunc(func(row int, column int) {
 		if row == rowIdxLoadOlder {
+			if mv.curLogResp != nil && mv.curLogResp.CountOnly {
+				// There are no logs to load more of.
+				return
+			}
+
 			// Request to load more (older) logs
 
 			// Do the query to core
+			pattern, stages := filterPipelineQuery(mv.query)
 			mv.params.OnLogQuery(core.QueryLogsParams{
-				From:  mv.actualFrom,
-				To:    mv.actualToForQuery,
-				Query: mv.query,
+				From:   mv.actualFrom,
+				To:     mv.actualToForQuery,
+				Query:  pattern,
+				Stages: stages,
+				Ranges: mv.actualRanges,
+
+				MaxLStreamRate: mv.maxLStreamRate(),
 
 				LoadEarlier: true,
 			})
@@ -739,7 +875,7 @@ func NewMainView(params *MainViewParams) *MainView {
 	statusLineFlex.
 		AddItem(mv.statusLineLeft, 0, 1, false).
 		AddItem(nil, 1, 0, false).
-		AddItem(mv.statusLineRight, 30, 0, true)
+		AddItem(mv.statusLineRight, 45, 0, true)
 
 	mainFlex.AddItem(statusLineFlex, 1, 0, false)
 
@@ -928,18 +1064,12 @@ func (mv *MainView) run() {
 }
 
 func (mv *MainView) tick() (needDraw bool) {
-	if mv.overlayMsgView != nil {
-		switch mv.overlaySpinner {
-		case '-':
-			mv.overlaySpinner = '\\'
-		case '\\':
-			mv.overlaySpinner = '|'
-		case '|':
-			mv.overlaySpinner = '/'
-		case '/':
-			mv.overlaySpinner = '-'
-		}
+	if mv.followTick() {
+		needDraw = true
+	}
 
+	if mv.overlayMsgView != nil {
+		mv.overlaySpinner = nextSpinnerFrame(mv.overlaySpinner)
 		mv.bumpOverlay()
 
 		needDraw = true
@@ -974,7 +1104,7 @@ func (mv *MainView) queryInputApplyStyle() {
 func (mv *MainView) applyQueryEditData(data QueryFull, dqp doQueryParams) error {
 	tz := mv.params.Options.GetTimezone()
 
-	ftr, err := ParseFromToRange(tz, data.Time)
+	ranges, err := ParseFromToRanges(tz, data.Time)
 	if err != nil {
 		return errors.Annotatef(err, "time")
 	}
@@ -985,7 +1115,7 @@ func (mv *MainView) applyQueryEditData(data QueryFull, dqp doQueryParams) error
 	}
 
 	mv.setQuery(data.Query)
-	mv.setTimeRange(ftr.From, ftr.To)
+	mv.setTimeRanges(ranges)
 
 	mv.params.Logger.Infof("Applying lstreams: %s", data.LStreams)
 	err = mv.params.OnLStreamsChange(data.LStreams)
@@ -1012,6 +1142,33 @@ func (mv *MainView) applyQueryEditData(data QueryFull, dqp doQueryParams) error
 	return nil
 }
 
+// mirrorQueryEditData is similar to applyQueryEditData, but it only updates
+// the UI, without changing the lstreams or initiating the query. It's used
+// when following another client of the same daemon session.
+func (mv *MainView) mirrorQueryEditData(data QueryFull) error {
+	tz := mv.params.Options.GetTimezone()
+
+	ranges, err := ParseFromToRanges(tz, data.Time)
+	if err != nil {
+		return errors.Annotatef(err, "time")
+	}
+
+	sqp, err := ParseSelectQuery(data.SelectQuery)
+	if err != nil {
+		return errors.Annotatef(err, "select query")
+	}
+
+	mv.setQuery(data.Query)
+	mv.setTimeRanges(ranges)
+	mv.setSelectQuery(sqp)
+	mv.setLStreams(data.LStreams)
+
+	mv.bumpStatusLineLeft()
+	mv.queryInputApplyStyle()
+
+	return nil
+}
+
 func (mv *MainView) GetUIPrimitive() tview.Primitive {
 	return mv.rootPages
 }
@@ -1041,7 +1198,9 @@ func (mv *MainView) applyHMState(lsmanState *core.LStreamsManagerState) {
 		}
 
 		overlayMsg = sb.String()
-	} else if mv.curHMState.Busy {
+	} else if mv.curHMState.Busy && !mv.follow.inFlight {
+		// NOTE: the follow queries are repeated in the background, so no overlay
+		// message for them.
 		var sb strings.Builder
 
 		sb.WriteString("Updating search results...")
@@ -1173,7 +1332,7 @@ func getStatuslineNumStr(icon string, num int, color string) string {
 	return fmt.Sprintf("[%s:-:%s]%s %.2d[-:-:-]", color, mod, icon, num)
 }
 
-func (mv *MainView) updateTableHeader(msgs []core.LogMsg) (colNames []string) {
+func (mv *MainView) updateTableHeader(msgs []core.LogMsg) (colNames []string, colWidths []int) {
 	// - maybe: Iterate all messages, and remove non-existing whitelisted fields
 	// - If IncludeAll is set: build a list of tags which are not specified explicitly,
 	//   and sort them
@@ -1239,6 +1398,7 @@ func (mv *MainView) updateTableHeader(msgs []core.LogMsg) (colNames []string) {
 	}
 
 	colNames = make([]string, 0, len(fields))
+	colWidths = make([]int, 0, len(fields))
 	for i, fld := range fields {
 		displayName := fld.DisplayName
 
@@ -1258,25 +1418,91 @@ func (mv *MainView) updateTableHeader(msgs []core.LogMsg) (colNames []string) {
 		mv.logsTable.SetCell(0, i, cell)
 
 		colNames = append(colNames, fld.Name)
+		colWidths = append(colWidths, fld.Width)
 	}
 
 	mv.logsTable.SetFixed(1, numSticky)
 
-	return colNames
+	return colNames, colWidths
+}
+
+// fitColumnWidths makes every column of the logs table as wide as the longest
+// value in it, or, if manualWidths has a non-zero width for the column, cuts
+// the values off at that width.
+//
+// The table itself only measures the rows which are currently visible, so
+// without that, columns would jump back and forth while scrolling. To avoid
+// that, the header cells are padded to the resulting width.
+func (mv *MainView) fitColumnWidths(colNames []string, manualWidths []int) {
+	mv.colWidths = make(map[string]int, len(colNames))
+
+	numRows := mv.logsTable.GetRowCount()
+	for col, colName := range colNames {
+		headerCell := mv.logsTable.GetCell(0, col)
+
+		width := manualWidths[col]
+		if width > 0 {
+			for row := 0; row < numRows; row++ {
+				if row == rowIdxLoadOlder {
+					continue
+				}
+
+				mv.logsTable.GetCell(row, col).SetMaxWidth(width)
+			}
+		} else {
+			width = tview.TaggedStringWidth(headerCell.Text)
+			for row := rowIdxLoadOlder + 1; row < numRows; row++ {
+				if w := tview.TaggedStringWidth(mv.logsTable.GetCell(row, col).Text); w > width {
+					width = w
+				}
+			}
+		}
+
+		if pad := width - tview.TaggedStringWidth(headerCell.Text); pad > 0 {
+			headerCell.SetText(headerCell.Text + strings.Repeat(" ", pad))
+		}
+
+		mv.colWidths[colName] = width
+	}
 }
 
 func (mv *MainView) applyLogs(resp *core.LogRespTotal) {
+	if mv.follow.inFlight && !resp.LoadedEarlier {
+		// It's a follow query repeated in the background, so the table might
+		// need to stay frozen, and there's no need to report how long it took.
+		mv.applyFollowLogs(resp)
+		return
+	}
+
+	if !resp.LoadedEarlier && mv.isFollowing() {
+		mv.addFollowSample(resp)
+	}
+
+	mv.showLogs(resp)
+
+	mv.printMsg(fmt.Sprintf("Query took: %s", resp.QueryDur.Round(1*time.Millisecond)), nlMsgLevelInfo)
+}
+
+// showLogs updates the logs table and everything around it with the given
+// logs.
+func (mv *MainView) showLogs(resp *core.LogRespTotal) {
 	mv.curLogResp = resp
+	mv.bumpStatusLineLeft()
 
 	oldNumRows := mv.logsTable.GetRowCount()
 	selectedRow, _ := mv.logsTable.GetSelection()
 	offsetRow, offsetCol := mv.logsTable.GetOffset()
 
+	// The transactions are all collapsed for new logs.
+	if !resp.LoadedEarlier {
+		mv.expandedTxns = nil
+	}
+
 	mv.formatLogs()
 
 	if !resp.LoadedEarlier {
 		// Replaced all logs
-		mv.logsTable.Select(len(resp.Logs)+1, 0)
+		mv.logsTable.Select(mv.logsTable.GetRowCount()-1, 0)
 		mv.logsTable.ScrollToEnd()
 		mv.bumpTimeRange(true)
 	} else {
@@ -1286,7 +1512,9 @@ func (mv *MainView) applyLogs(resp *core.LogRespTotal) {
 		mv.logsTable.Select(selectedRow+numNewRows, 0)
 	}
 
-	mv.printMsg(fmt.Sprintf("Query took: %s", resp.QueryDur.Round(1*time.Millisecond)), nlMsgLevelInfo)
+	if mv.filterPipelineView != nil {
+		mv.filterPipelineView.update()
+	}
 }
 
 func (mv *MainView) getLastQueryDebugInfo() string {
@@ -1346,18 +1574,144 @@ func (mv *MainView) showLastQueryDebugInfo() {
 	})
 }
 
+// showFirstLastResp shows the results of the first/last occurrence lookup
+// (initiated by the :firstlast command).
+func (mv *MainView) showFirstLastResp(resp *core.FirstLastRespTotal) {
+	if len(resp.Errs) > 0 && len(resp.PerLStream) == 0 {
+		mv.handleQueryError(combineErrors(resp.Errs))
+		return
+	}
+
+	tz := mv.params.Options.GetTimezone()
+
+	lstreamNames := make([]string, 0, len(resp.PerLStream))
+	for lstreamName := range resp.PerLStream {
+		lstreamNames = append(lstreamNames, lstreamName)
+	}
+	sort.Strings(lstreamNames)
+
+	var earliest, latest time.Time
+	var sb strings.Builder
+
+	for _, lstreamName := range lstreamNames {
+		flr := resp.PerLStream[lstreamName]
+
+		if flr.First == nil || flr.Last == nil {
+			sb.WriteString(fmt.Sprintf("%s: no matches\n", lstreamName))
+			continue
+		}
+
+		sb.WriteString(fmt.Sprintf(
+			"%s: first %s, last %s\n",
+			lstreamName,
+			flr.First.Time.In(tz).Format(logsTableTimeLayout),
+			flr.Last.Time.In(tz).Format(logsTableTimeLayout),
+		))
+
+		if earliest.IsZero() || flr.First.Time.Before(earliest) {
+			earliest = flr.First.Time
+		}
+
+		if latest.IsZero() || flr.Last.Time.After(latest) {
+			latest = flr.Last.Time
+		}
+	}
+
+	for _, err := range resp.Errs {
+		sb.WriteString(fmt.Sprintf("[red]%s[-]\n", tview.Escape(err.Error())))
+	}
+
+	sb.WriteString(fmt.Sprintf("\nLookup took: %s", resp.QueryDur.Round(1*time.Millisecond)))
+
+	msgID := "firstLast"
+	params := &MessageboxParams{
+		BackgroundColor: tcell.ColorDarkBlue,
+		CopyButton:      true,
+	}
+
+	// If anything was found, make it possible to jump right to the time range
+	// covering all the occurrences.
+	if !earliest.IsZero() {
+		params.Buttons = []string{"OK", "Show all"}
+		params.OnButtonPressed = func(label string, idx int) {
+			// TODO: using pageNameMessage here directly is too hacky
+			mv.hideModal(pageNameMessage+msgID, true)
+
+			if label == "Show all" {
+				mv.setTimeRange(
+					TimeOrDur{Time: earliest.Truncate(1 * time.Minute).In(tz)},
+					TimeOrDur{Time: latest.Truncate(1 * time.Minute).Add(1 * time.Minute).In(tz)},
+				)
+				mv.doQuery(doQueryParams{})
+			}
+		}
+	}
+
+	mv.showMessagebox(msgID, "First and last occurrences", sb.String(), params)
+}
+
 func (mv *MainView) formatLogs() {
 	resp := mv.curLogResp
 	if resp == nil {
 		resp = &core.LogRespTotal{}
 	}
 
+	// The table only shows the logs within the brush, if any; the histogram
+	// still shows everything.
+	if !mv.brushFrom.IsZero() {
+		brushed := *resp
+		brushed.Logs = brushLogs(resp.Logs, mv.brushFrom, mv.brushTo)
+		resp = &brushed
+	}
+
 	histogramData := make(map[int]int, len(resp.MinuteStats))
+	histogramLevels := map[int]HistogramLevel{}
 	for k, v := range resp.MinuteStats {
 		histogramData[int(k)] = v.NumMsgs
+
+		switch {
+		case v.NumErrors > 0:
+			histogramLevels[int(k)] = HistogramLevelError
+		case v.NumWarnings > 0:
+			histogramLevels[int(k)] = HistogramLevelWarn
+		}
 	}
 
 	mv.histogram.SetData(histogramData)
+	mv.histogram.SetLevels(histogramLevels)
+
+	// Figure how to display the logstream names.
+	var lstreamNames []string
+	seenLStreams := map[string]struct{}{}
+	for _, msg := range resp.Logs {
+		name := msg.Context["lstream"]
+		if _, ok := seenLStreams[name]; !ok {
+			seenLStreams[name] = struct{}{}
+			lstreamNames = append(lstreamNames, name)
+		}
+	}
+	for _, gap := range resp.Gaps {
+		if _, ok := seenLStreams[gap.LStream]; !ok {
+			seenLStreams[gap.LStream] = struct{}{}
+			lstreamNames = append(lstreamNames, gap.LStream)
+		}
+	}
+
+	var configDisplayNames map[string]string
+	if mv.curHMState != nil {
+		configDisplayNames = mv.curHMState.DisplayNames
+	}
+	lstreamDisplay := lstreamDisplayNames(lstreamNames, configDisplayNames, mv.params.Options.GetStripDomain())
+
+	histogramGaps := make([]HistogramGap, 0, len(resp.Gaps))
+	for _, gap := range resp.Gaps {
+		histogramGaps = append(histogramGaps, HistogramGap{
+			From:  int(gap.From.Unix()),
+			To:    int(gap.To.Unix()),
+			Label: lstreamDisplay[gap.LStream],
+		})
+	}
+	mv.histogram.SetGaps(histogramGaps)
 
 	// TODO: perhaps optimize it, instead of clearing and repopulating whole table
 	mv.logsTable.Clear()
@@ -1374,17 +1728,33 @@ func (mv *MainView) formatLogs() {
 	}
 
 	// Update table header
-	colNames := mv.updateTableHeader(resp.Logs)
-
-	mv.logsTable.SetCell(
-		rowIdxLoadOlder, 0,
-		newTableCellButton("< MOAR ! >"),
-	)
+	colNames, colWidths := mv.updateTableHeader(resp.Logs)
+
+	if resp.CountOnly {
+		mv.logsTable.SetCell(
+			rowIdxLoadOlder, 0,
+			newTableCellLogmsg(fmt.Sprintf(
+				"Count-only mode: %d messages; use :set countonly=false to fetch them", resp.NumMsgsTotal,
+			)).SetTextColor(tcell.ColorYellow),
+		)
+	} else {
+		mv.logsTable.SetCell(
+			rowIdxLoadOlder, 0,
+			newTableCellButton("< MOAR ! >"),
+		)
+	}
 
 	tz := mv.params.Options.GetTimezone()
+	detectSecretsEnabled := mv.params.Options.GetDetectSecrets()
 
-	// Add all available logs
-	for i, rowIdx := 0, 2; i < len(resp.Logs); i, rowIdx = i+1, rowIdx+1 {
+	// Group the messages into transactions, if needed: only the first message
+	// of a collapsed transaction is shown, and the rest of an expanded one are
+	// shown right below the first one.
+	txns := groupTransactions(resp.Logs, mv.params.Options.GetTransactionRules())
+	mv.rowTxns = map[int]*logTransaction{}
+
+	rowIdx := 2
+	addRow := func(i int, msgPrefix, msgSuffix string) {
 		msg := resp.Logs[i]
 
 		// TODO: make the colors configurable
@@ -1405,6 +1775,17 @@ func (mv *MainView) formatLogs() {
 			timeStr = ""
 		}
 
+		// Highlight the whole row if the message looks like it contains secrets.
+		bgColor := tcell.ColorDefault
+		if detectSecretsEnabled && len(detectSecrets(msg.OrigLine)) > 0 {
+			bgColor = tcell.ColorMaroon
+		}
+
+		// For multi-range queries, separate the ranges visually by underlining
+		// the last message of every range.
+		isLastInRange := mv.actualRanges != nil && i+1 < len(resp.Logs) &&
+			timeRangeIdx(mv.actualRanges, msg.Time) != timeRangeIdx(mv.actualRanges, resp.Logs[i+1].Time)
+
 		for i, colName := range colNames {
 			var cell *tview.TableCell
 
@@ -1412,20 +1793,133 @@ func (mv *MainView) formatLogs() {
 			case FieldNameTime:
 				cell = newTableCellLogmsg(timeStr).SetTextColor(tcell.ColorLightBlue)
 			case FieldNameMessage:
-				cell = newTableCellLogmsg(tview.Escape(msg.Msg)).SetTextColor(msgColor)
+				cell = newTableCellLogmsg(tview.Escape(msgPrefix + msg.Msg + msgSuffix)).SetTextColor(msgColor)
+			case "lstream":
+				cell = newTableCellLogmsg(lstreamDisplay[msg.Context[colName]]).SetTextColor(msgColor)
 			default:
 				cell = newTableCellLogmsg(msg.Context[colName]).SetTextColor(msgColor)
 			}
 
+			if bgColor != tcell.ColorDefault {
+				cell.SetBackgroundColor(bgColor)
+			}
+
+			if isLastInRange {
+				cell.SetAttributes(tcell.AttrUnderline)
+			}
+
 			mv.logsTable.SetCell(rowIdx, i, cell)
 		}
 
 		mv.logsTable.GetCell(rowIdx, 0).SetReference(msg)
+
+		if txns[i] != nil {
+			mv.rowTxns[rowIdx] = txns[i]
+		}
+
+		rowIdx++
+	}
+
+	// Add all available logs
+	for i := range resp.Logs {
+		txn := txns[i]
+		if txn == nil {
+			addRow(i, "", "")
+			continue
+		}
+
+		if txn.msgIdxs[0] != i {
+			// It's shown right below the first message, if expanded.
+			continue
+		}
+
+		if _, expanded := mv.expandedTxns[txn.id]; !expanded {
+			addRow(i, "▸ ", " "+txn.summary())
+			continue
+		}
+
+		addRow(i, "▾ ", " "+txn.summary())
+		for _, idx := range txn.msgIdxs[1:] {
+			addRow(idx, "  │ ", "")
+		}
 	}
 
+	mv.fitColumnWidths(colNames, colWidths)
+
 	mv.bumpStatusLineRight()
 }
 
+// toggleTransaction expands or collapses the transaction of the selected
+// message, if any.
+func (mv *MainView) toggleTransaction() {
+	selectedRow, _ := mv.logsTable.GetSelection()
+	txn := mv.rowTxns[selectedRow]
+	if txn == nil {
+		mv.printMsg("The selected message doesn't belong to any transaction", nlMsgLevelErr)
+		return
+	}
+
+	if mv.expandedTxns == nil {
+		mv.expandedTxns = map[string]struct{}{}
+	}
+
+	if _, expanded := mv.expandedTxns[txn.id]; expanded {
+		delete(mv.expandedTxns, txn.id)
+	} else {
+		mv.expandedTxns[txn.id] = struct{}{}
+	}
+
+	mv.formatLogs()
+
+	// Keep the first message of the transaction selected.
+	for row := 0; row < mv.logsTable.GetRowCount(); row++ {
+		if mv.rowTxns[row] == txn {
+			mv.logsTable.Select(row, 0)
+			break
+		}
+	}
+}
+
+// toggleAllTransactions expands all the transactions, or, if all of them are
+// expanded already, collapses them.
+func (mv *MainView) toggleAllTransactions() {
+	var ids []string
+	allExpanded := true
+	for _, txn := range mv.rowTxns {
+		if _, expanded := mv.expandedTxns[txn.id]; !expanded {
+			allExpanded = false
+		}
+		ids = append(ids, txn.id)
+	}
+
+	if len(ids) == 0 {
+		mv.printMsg("No transactions", nlMsgLevelErr)
+		return
+	}
+
+	mv.expandedTxns = map[string]struct{}{}
+	if !allExpanded {
+		for _, id := range ids {
+			mv.expandedTxns[id] = struct{}{}
+		}
+	}
+
+	mv.formatLogs()
+	mv.logsTable.Select(mv.logsTable.GetRowCount()-1, 0)
+}
+
+// timeRangeIdx returns the index of the range which contains t, or -1 if
+// there is none.
+func timeRangeIdx(ranges []core.TimeRange, t time.Time) int {
+	for i, r := range ranges {
+		if !t.Before(r.From) && (r.To.IsZero() || t.Before(r.To)) {
+			return i
+		}
+	}
+
+	return -1
+}
+
 func (mv *MainView) bumpStatusLineLeft() {
 	sb := strings.Builder{}
 
@@ -1453,6 +1947,17 @@ func (mv *MainView) bumpStatusLineLeft() {
 	sb.WriteString(" ")
 	sb.WriteString(getStatuslineNumStr("🖳", numOther, "red"))
 
+	if mv.follow.rates != nil && mv.isFollowing() {
+		sb.WriteString(" | ")
+		sb.WriteString(mv.follow.rates.String())
+	}
+
+	if mv.curLogResp != nil && len(mv.curLogResp.Throttled) > 0 {
+		sb.WriteString(" | [yellow]dropped from shown: ")
+		sb.WriteString(mv.formatThrottled(mv.curLogResp.Throttled))
+		sb.WriteString("[-]")
+	}
+
 	sb.WriteString(" | ")
 	sb.WriteString(mv.lstreamsSpec)
 
@@ -1470,13 +1975,29 @@ func (mv *MainView) bumpStatusLineRight() {
 		selectedRowStr = "-"
 	}
 
+	var prefix string
+	if register := mv.macros.isRecording(); register != 0 {
+		prefix = fmt.Sprintf("[yellow]recording @%c[-] | ", register)
+	}
+
+	if mv.follow.stormPaused {
+		prefix += "[white:red:b]PAUSED[-:-:-] "
+	}
+
+	if mv.follow.pending != nil {
+		prefix += fmt.Sprintf(
+			"[yellow::b]%s[-::-] | ",
+			formatNumNewLogs(mv.follow.numNew, mv.follow.numNewMore),
+		)
+	}
+
 	if mv.curLogResp != nil {
 		mv.statusLineRight.SetText(fmt.Sprintf(
-			"%s / %d / %d",
-			selectedRowStr, len(mv.curLogResp.Logs), mv.curLogResp.NumMsgsTotal,
+			"%s%s / %d / %d",
+			prefix, selectedRowStr, len(mv.curLogResp.Logs), mv.curLogResp.NumMsgsTotal,
 		))
 	} else {
-		mv.statusLineRight.SetText("-")
+		mv.statusLineRight.SetText(prefix + "-")
 	}
 }
 
@@ -1525,13 +2046,24 @@ func (mv *MainView) setSelectQuery(sqp *SelectQueryParsed) {
 }
 
 func (mv *MainView) setTimeRange(from, to TimeOrDur) {
-	if from.IsZero() {
+	mv.setTimeRanges([]FromToRange{{From: from, To: to}})
+}
+
+// setTimeRanges is like setTimeRange, but for possibly multiple disjoint
+// ranges, as returned by ParseFromToRanges.
+func (mv *MainView) setTimeRanges(ranges []FromToRange) {
+	if len(ranges) == 0 || ranges[0].From.IsZero() {
 		// TODO: maybe better error handling
 		panic("from can't be zero")
 	}
 
-	mv.from = from
-	mv.to = to
+	mv.from = ranges[0].From
+	mv.to = ranges[len(ranges)-1].To
+
+	mv.ranges = nil
+	if len(ranges) > 1 {
+		mv.ranges = ranges
+	}
 
 	mv.formatTimeRange()
 }
@@ -1546,7 +2078,14 @@ func (mv *MainView) formatTimeRange() {
 	rangeDur := mv.actualTo.Sub(mv.actualFrom)
 
 	var timeStr string
-	if !mv.to.IsZero() {
+	if mv.ranges != nil {
+		for i := range mv.ranges {
+			mv.ranges[i].From = mv.ranges[i].From.In(tz)
+			mv.ranges[i].To = mv.ranges[i].To.In(tz)
+		}
+
+		timeStr = fmt.Sprintf("%s (%d ranges)", FromToRangesString(mv.ranges), len(mv.ranges))
+	} else if !mv.to.IsZero() {
 		timeStr = fmt.Sprintf("%s to %s (%s)", mv.from.Format(inputTimeLayout), mv.to.Format(inputTimeLayout), formatDuration(rangeDur))
 	} else if mv.from.IsAbsolute() {
 		timeStr = fmt.Sprintf("%s to now (%s)", mv.from.Format(inputTimeLayout), formatDuration(rangeDur))
@@ -1554,6 +2093,13 @@ func (mv *MainView) formatTimeRange() {
 		timeStr = fmt.Sprintf("last %s", TimeOrDur{Dur: -mv.from.Dur})
 	}
 
+	if !mv.brushFrom.IsZero() {
+		timeStr += fmt.Sprintf(
+			", shown %s to %s",
+			mv.brushFrom.In(tz).Format(inputTimeLayout), mv.brushTo.In(tz).Format(inputTimeLayout),
+		)
+	}
+
 	mv.timeLabel.SetText(timeStr)
 	mv.topFlex.ResizeItem(mv.timeLabel, len(timeStr), 0)
 }
@@ -1602,6 +2148,22 @@ func (mv *MainView) bumpTimeRange(updateHistogramRange bool) {
 		}
 	}
 
+	mv.actualRanges = nil
+	if mv.ranges != nil {
+		now := time.Now()
+		for _, ftr := range mv.ranges {
+			tr := core.TimeRange{
+				From: truncateCeil(ftr.From.AbsoluteTime(now), 1*time.Minute),
+			}
+
+			if !ftr.To.IsZero() {
+				tr.To = truncateCeil(ftr.To.AbsoluteTime(now), 1*time.Minute)
+			}
+
+			mv.actualRanges = append(mv.actualRanges, tr)
+		}
+	}
+
 	// Also update the histogram
 	if updateHistogramRange {
 		mv.histogram.SetRange(int(mv.actualFrom.Unix()), int(mv.actualTo.Unix()))
@@ -1637,16 +2199,64 @@ type doQueryParams struct {
 	// rebuild it from scratch (no-op for journalctl logstreams, because there's
 	// no nerdlog-maintained index for journalctl).
 	refreshIndex bool
+
+	// If maxNumLines is not zero, it overrides the maxnumlines option for this
+	// query.
+	maxNumLines int
+
+	// If ignoreTransferBudget is true, the transferbudget option is ignored for
+	// this query.
+	ignoreTransferBudget bool
+
+	// If follow is true, it's the same query repeated in the follow mode (see
+	// followTick).
+	follow bool
 }
 
 func (mv *MainView) doQuery(params doQueryParams) {
+	maxTransferBytes := 0
+	if !params.ignoreTransferBudget {
+		maxTransferBytes = mv.params.Options.GetTransferBudget()
+	}
+
+	if !params.follow {
+		// Whatever the follow mode was waiting for, it's not relevant anymore.
+		mv.follow.inFlight = false
+		mv.follow.pending = nil
+		mv.follow.lastSample = nil
+		mv.follow.rates = nil
+		mv.follow.stormPaused = false
+
+		// The brush only applies to the logs already loaded.
+		if !mv.brushFrom.IsZero() {
+			mv.brushFrom = time.Time{}
+			mv.brushTo = time.Time{}
+			mv.formatTimeRange()
+		}
+	}
+
+	mv.follow.lastQueryTime = time.Now()
+
+	pattern, stages := filterPipelineQuery(mv.query)
 	mv.params.OnLogQuery(core.QueryLogsParams{
-		From:  mv.actualFrom,
-		To:    mv.actualToForQuery,
-		Query: mv.query,
+		From:   mv.actualFrom,
+		To:     mv.actualToForQuery,
+		Query:  pattern,
+		Stages: stages,
+		Ranges: mv.actualRanges,
+
+		MaxNumLines:      params.maxNumLines,
+		MaxTransferBytes: maxTransferBytes,
+		LevelStats:       mv.params.Options.GetHistogramLevels(),
+		CacheTTL:         mv.params.Options.GetQueryCache(),
+		CountOnly:        mv.params.Options.GetCountOnly(),
+		GapThreshold:     mv.params.Options.GetGapThreshold(),
+		ActivityStats:    mv.isFollowing(),
+		MaxLStreamRate:   mv.maxLStreamRate(),
 
 		DontAddHistoryItem: params.dontAddHistoryItem,
 		RefreshIndex:       params.refreshIndex,
+		Follow:             params.follow,
 	})
 }
 
@@ -1670,10 +2280,18 @@ func formatDuration(dur time.Duration) string {
 }
 
 type MessageboxParams struct {
+	// Buttons can have mnemonics, and DefaultButton / CancelButton specify the
+	// buttons pressed on Enter / Esc; see MessageViewParams for details.
 	Buttons         []string
 	OnButtonPressed func(label string, idx int)
+	DefaultButton   string
+	CancelButton    string
 	OnEsc           func()
 
+	// Priority defines whether the messagebox is shown right away, or queued
+	// until the more important ones are hidden; see modalQueue.
+	Priority ModalPriority
+
 	// If CopyButton is true, then one more button will be added: "Copy", and when
 	// clicked, the messagebox text will be copied to clipboard.
 	//
@@ -1734,9 +2352,10 @@ func (mv *MainView) showMessagebox(
 		oldHandler := params.OnButtonPressed
 		params.OnButtonPressed = func(label string, idx int) {
 			if label == "Copy" {
-				clipboard.WriteText([]byte(msgv.GetText(true)))
-				msgv.SetButtonLabel(idx, "Copied", SetButtonLabelOpts{
-					RevertOnBlur: true,
+				mv.copyToClipboard(msgv.GetText(true), func(copied string) {
+					msgv.SetButtonLabel(idx, "Copied", SetButtonLabelOpts{
+						RevertOnBlur: true,
+					})
 				})
 				return
 			}
@@ -1761,6 +2380,8 @@ func (mv *MainView) showMessagebox(
 		OnInputFieldPressed: params.OnInputFieldPressed,
 		Buttons:             params.Buttons,
 		OnButtonPressed:     params.OnButtonPressed,
+		DefaultButton:       params.DefaultButton,
+		CancelButton:        params.CancelButton,
 		OnEsc:               params.OnEsc,
 
 		Width:  params.Width,
@@ -1768,7 +2389,8 @@ func (mv *MainView) showMessagebox(
 
 		Align: params.Align,
 
-		NoFocus: params.NoFocus,
+		NoFocus:  params.NoFocus,
+		Priority: params.Priority,
 
 		BackgroundColor: params.BackgroundColor,
 	})
@@ -1839,6 +2461,11 @@ func (mv *MainView) showModal(pageName string, primitive tview.Primitive, width,
 }
 
 func (mv *MainView) hideModal(pageName string, focusAfterPageRemoval bool) {
+	// If it's a messagebox still waiting in the queue, just drop it from there.
+	if mv.modalQueue.unqueue(pageName) {
+		return
+	}
+
 	prevFocused := mv.params.App.GetFocus()
 
 	mv.rootPages.RemovePage(pageName)
@@ -1850,6 +2477,11 @@ func (mv *MainView) hideModal(pageName string, focusAfterPageRemoval bool) {
 		// unchanged, we have to set it back manually.
 		mv.params.App.SetFocus(prevFocused)
 	}
+
+	// Now the next messagebox from the queue might be shown.
+	if next := mv.modalQueue.hidden(pageName); next != nil {
+		next.show()
+	}
 }
 
 func (mv *MainView) resizeModal(pageName string, width, height int) {
@@ -1890,9 +2522,13 @@ func (mv *MainView) focusAfterPageRemoval(pageName string) {
 }
 
 func (mv *MainView) getQueryFull() QueryFull {
-	ftr := FromToRange{mv.from, mv.to}
+	timeStr := FromToRangesString([]FromToRange{{mv.from, mv.to}})
+	if mv.ranges != nil {
+		timeStr = FromToRangesString(mv.ranges)
+	}
+
 	return QueryFull{
-		Time:        ftr.String(),
+		Time:        timeStr,
 		Query:       mv.query,
 		LStreams:    mv.lstreamsSpec,
 		SelectQuery: mv.selectQuery.Marshal(),
@@ -1939,6 +2575,14 @@ func (mv *MainView) disconnect() {
 
 // handleQueryError shows the right messagebox based on the error cause.
 func (mv *MainView) handleQueryError(err error) {
+	if mv.follow.inFlight {
+		// Don't bombard the user with dialogs every time the follow query is
+		// repeated.
+		mv.follow.inFlight = false
+		mv.printMsg(fmt.Sprintf("Follow query error: %s", err), nlMsgLevelErr)
+		return
+	}
+
 	if errors.Cause(err) == core.ErrBusyWithAnotherQuery ||
 		errors.Cause(err) == core.ErrNotYetConnected {
 		// In this particular error ("busy with another query"), show a dialog
@@ -1982,6 +2626,7 @@ func (mv *MainView) handleQueryError(err error) {
 						//mv.reconnect(true)
 					}
 				},
+				Priority: ModalPriorityError,
 
 				BackgroundColor: tcell.ColorDarkRed,
 			},
@@ -1991,6 +2636,7 @@ func (mv *MainView) handleQueryError(err error) {
 		mv.showMessagebox("err", "Log query error", err.Error(), &MessageboxParams{
 			BackgroundColor: tcell.ColorDarkRed,
 			CopyButton:      true,
+			Priority:        ModalPriorityError,
 		})
 	}
 }
@@ -2000,6 +2646,7 @@ func (mv *MainView) handleBootstrapError(err error) {
 	mv.showMessagebox("err", "Bootstrap error", err.Error(), &MessageboxParams{
 		BackgroundColor: tcell.ColorDarkRed,
 		CopyButton:      true,
+		Priority:        ModalPriorityError,
 	})
 }
 
@@ -2007,6 +2654,7 @@ func (mv *MainView) handleBootstrapWarning(err error) {
 	mv.showMessagebox("err", "Bootstrap warning", err.Error(), &MessageboxParams{
 		BackgroundColor: tcell.ColorDarkOrchid,
 		CopyButton:      true,
+		Priority:        ModalPriorityError,
 	})
 }
 
@@ -2038,6 +2686,7 @@ func (mv *MainView) handleDataRequest(dataReq *core.ShellConnDataRequest) {
 			dataReq.ResponseCh <- ""
 			mv.hideModal(pageNameMessage+msgID, true)
 		},
+		Priority:        ModalPriorityInput,
 		BackgroundColor: tcell.ColorDarkGreen,
 		CopyButton:      true,
 	})
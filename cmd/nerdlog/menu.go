@@ -30,6 +30,12 @@ var mainMenu = []menuItem{
 			mv.params.OnCmd("refresh!", CmdOpts{Internal: true})
 		},
 	},
+	{
+		Title: "Filter pipeline      :pipeline  ",
+		Handler: func(mv *MainView) {
+			mv.params.OnCmd("pipeline", CmdOpts{Internal: true})
+		},
+	},
 	{
 		Title: "Copy query command   :xclip     ",
 		Handler: func(mv *MainView) {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"strings"
+	"unicode"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -24,9 +25,22 @@ type MessageViewParams struct {
 	// (in which case, nothing else will run).
 	OnInputFieldPressed func(label string, idx int, value string, event *tcell.EventKey) *tcell.EventKey
 
+	// Buttons are the button labels. A "&" before a letter or digit makes it
+	// the mnemonic of the button: it's underlined, and pressing it presses the
+	// button (when an input field is focused, it needs Alt). Use "&&" for a
+	// literal "&". The labels given to OnButtonPressed don't have the "&"s.
 	Buttons         []string
 	OnButtonPressed func(label string, idx int)
 
+	// DefaultButton is the label (without the "&") of the button which is
+	// pressed on Enter when no other button is focused; unless there are input
+	// fields, it's also the button focused initially.
+	DefaultButton string
+
+	// CancelButton is the label (without the "&") of the button which is
+	// pressed on Esc; if it's set, OnEsc is not called.
+	CancelButton string
+
 	OnEsc func()
 
 	// Width and Height are 40 and 10 by default
@@ -37,12 +51,25 @@ type MessageViewParams struct {
 
 	NoFocus bool
 
+	// Priority is ModalPriorityNone by default, which means the messagebox is
+	// shown right away; otherwise it might be queued, see modalQueue.
+	Priority ModalPriority
+
 	BackgroundColor tcell.Color
 }
 
 type MessageViewInputFieldParams struct {
 	Label      string
 	IsPassword bool
+
+	// Value is the initial text of the field.
+	Value string
+
+	// Validators check the value when the user tries to submit it, i.e. presses
+	// Enter on any input field, or any button other than the CancelButton. If
+	// any of them fails, the error is shown under the field, and the submission
+	// is blocked: neither OnInputFieldPressed nor OnButtonPressed is called.
+	Validators []MessageViewValidator
 }
 
 type MessageView struct {
@@ -58,6 +85,15 @@ type MessageView struct {
 	buttons     []*tview.Button
 	focusers    []tview.Primitive
 
+	// fieldErrViews are the views for the validation errors under the input
+	// fields; nil for the fields without validators.
+	fieldErrViews []*tview.TextView
+
+	// buttonLabels and mnemonics are parsed from params.Buttons; see
+	// parseButtonLabel. The mnemonic is 0 if the button doesn't have one.
+	buttonLabels []string
+	mnemonics    []rune
+
 	// onButtonBlurRevert is needed to support the use case when we need to
 	// change the button's label until it loses its focus. We use it for e.g.
 	// "Copy" -> "Copied" button.
@@ -76,50 +112,103 @@ type onButtonBlurRevert struct {
 	oldLabel string
 }
 
-// getMaxLineLength returns the length of the longest line in the given string.
-func getMaxLineLength(s string) int {
-	maxLen := 0
-	start := 0
-
-	for i, c := range s {
-		if c == '\n' {
-			lineLen := i - start
-			if lineLen > maxLen {
-				maxLen = lineLen
+// parseButtonLabel parses the button label with the optional mnemonic (see
+// MessageViewParams.Buttons), and returns the label without the "&"s, the
+// label to render with the mnemonic underlined, and the lowercased mnemonic
+// (or 0 if there's none).
+func parseButtonLabel(label string) (plain, rendered string, mnemonic rune) {
+	var plainSB, renderedSB strings.Builder
+
+	runes := []rune(label)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if r == '&' && i+1 < len(runes) {
+			next := runes[i+1]
+
+			switch {
+			case next == '&':
+				i++
+
+			case mnemonic == 0 && (unicode.IsLetter(next) || unicode.IsDigit(next)):
+				i++
+				mnemonic = unicode.ToLower(next)
+				plainSB.WriteRune(next)
+				renderedSB.WriteString("[::u]")
+				renderedSB.WriteRune(next)
+				renderedSB.WriteString("[::-]")
+				continue
 			}
-			start = i + 1
 		}
+
+		plainSB.WriteRune(r)
+		renderedSB.WriteRune(r)
 	}
 
-	// Handle the last line if it doesn't end with a newline
-	if len(s)-start > maxLen {
-		maxLen = len(s) - start
+	return plainSB.String(), renderedSB.String(), mnemonic
+}
+
+// getMaxLineLength returns the width of the longest line in the given string,
+// as it will be rendered on the MessageView: color tags like "[red]" take no
+// space, escaped brackets like "[red[]" are rendered as "[red]", tabs are
+// expanded, and wide characters take 2 cells.
+func getMaxLineLength(s string) int {
+	maxLen := 0
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.ReplaceAll(line, "\t", strings.Repeat(" ", tview.TabSize))
+		if lineLen := tview.TaggedStringWidth(line); lineLen > maxLen {
+			maxLen = lineLen
+		}
 	}
 
 	return maxLen
 }
 
 // getNumLines returns the number of lines that are needed to draw the given
-// text.
+// text on the MessageView with the given width.
+//
+// Instead of trying to predict how the text will be wrapped (which gets
+// tricky with the color tags, tabs, wide characters etc), it lays the text
+// out on the same kind of TextView which MessageView uses, so the result
+// always matches the actual rendering.
 func getNumLines(s string, screenWidth int) int {
 	if screenWidth <= 0 {
 		return 0
 	}
 
-	s = strings.TrimSpace(s)
-	lines := strings.Split(s, "\n")
-	numLines := 0
-	for _, line := range lines {
-		// Divide line length by screen width and round up
-		lineLen := len(line)
-		curNumLines := (lineLen + screenWidth - 1) / screenWidth
-		if curNumLines == 0 {
-			curNumLines = 1
-		}
+	// Even an empty text takes one line.
+	if strings.TrimSpace(s) == "" {
+		return 1
+	}
 
-		numLines += curNumLines
+	// Draw the TextView on a screen which is only 1 line high, scrolled to the
+	// end: then the scroll offset is the number of lines minus 1.
+	screen := tcell.NewSimulationScreen("UTF-8")
+	if err := screen.Init(); err != nil {
+		return 1
 	}
-	return numLines
+	defer screen.Fini()
+	screen.SetSize(screenWidth, 1)
+
+	textView := newMessageTextView(s)
+	textView.SetRect(0, 0, screenWidth, 1)
+	textView.ScrollToEnd()
+	textView.Draw(screen)
+
+	row, _ := textView.GetScrollOffset()
+
+	return row + 1
+}
+
+// newMessageTextView creates the TextView for the MessageView's message;
+// getNumLines uses it too, so that the sizing is done for the same rendering.
+func newMessageTextView(text string) *tview.TextView {
+	textView := tview.NewTextView()
+	textView.SetDynamicColors(true)
+	textView.SetText(strings.TrimSpace(text))
+
+	return textView
 }
 
 // GetOptimalMessageViewSize returns the optimal width and height for a
@@ -157,10 +246,8 @@ func NewMessageView(
 
 	msgv.msgboxFlex = tview.NewFlex().SetDirection(tview.FlexRow)
 
-	msgv.textView = tview.NewTextView()
-	msgv.textView.SetText(strings.TrimSpace(params.Message))
+	msgv.textView = newMessageTextView(params.Message)
 	msgv.textView.SetTextAlign(msgv.params.Align)
-	msgv.textView.SetDynamicColors(true)
 
 	if msgv.params.BackgroundColor != tcell.ColorDefault {
 		msgv.textView.SetBackgroundColor(msgv.params.BackgroundColor)
@@ -192,13 +279,32 @@ func NewMessageView(
 		if fieldParams.IsPassword {
 			field.SetMaskCharacter('*')
 		}
-		field.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-			// Handle Esc key
-			switch event.Key() {
-			case tcell.KeyEsc:
-				if params.OnEsc != nil {
-					params.OnEsc()
+		field.SetText(fieldParams.Value)
+
+		// Validation errors, if needed
+		var errView *tview.TextView
+		if len(fieldParams.Validators) > 0 {
+			errView = tview.NewTextView()
+			errView.SetTextColor(tcell.ColorRed)
+			if msgv.params.BackgroundColor != tcell.ColorDefault {
+				errView.SetBackgroundColor(msgv.params.BackgroundColor)
+			}
+			msgv.msgboxFlex.AddItem(errView, 1, 0, false)
+
+			// Once the error is shown, keep it up to date while the user is fixing
+			// the value.
+			field.SetChangedFunc(func(text string) {
+				if errView.GetText(false) != "" {
+					msgv.validateInputField(fieldIdx)
 				}
+			})
+		}
+		msgv.fieldErrViews = append(msgv.fieldErrViews, errView)
+		field.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			// Handle Esc and the mnemonics
+			event = msgv.handleButtonKeys(event, false)
+			if event == nil {
+				return nil
 			}
 
 			// Handle Tab and Shift+Tab
@@ -207,14 +313,29 @@ func NewMessageView(
 				return nil
 			}
 
-			// Call user-specified event handler
-			event = msgv.params.OnInputFieldPressed(
-				fieldParams.Label, fieldIdx, field.GetText(), event,
-			)
-			if event == nil {
+			// Enter submits the values, so they need to be valid.
+			if event.Key() == tcell.KeyEnter && !msgv.ValidateInputFields() {
 				return nil
 			}
 
+			// Call user-specified event handler
+			if msgv.params.OnInputFieldPressed != nil {
+				event = msgv.params.OnInputFieldPressed(
+					fieldParams.Label, fieldIdx, field.GetText(), event,
+				)
+				if event == nil {
+					return nil
+				}
+			}
+
+			// Unless handled by the user, Enter presses the default button.
+			if event.Key() == tcell.KeyEnter {
+				if idx := msgv.buttonIdx(msgv.params.DefaultButton); idx >= 0 {
+					msgv.pressButton(idx)
+					return nil
+				}
+			}
+
 			return event
 		})
 	}
@@ -226,22 +347,36 @@ func NewMessageView(
 	// (there's also a spacer at the right, added later)
 	msgv.buttonsFlex.AddItem(nil, 0, 1, false)
 
+	for _, label := range params.Buttons {
+		plain, _, mnemonic := parseButtonLabel(label)
+		msgv.buttonLabels = append(msgv.buttonLabels, plain)
+		msgv.mnemonics = append(msgv.mnemonics, mnemonic)
+	}
+
+	// Unless there are input fields, the default button (or the first one) is
+	// focused initially.
+	focusedBtnIdx := -1
+	if len(params.InputFields) == 0 {
+		focusedBtnIdx = 0
+		if idx := msgv.buttonIdx(params.DefaultButton); idx >= 0 {
+			focusedBtnIdx = idx
+		}
+	}
+
 	for i := 0; i < len(params.Buttons); i++ {
-		btnLabel := params.Buttons[i]
+		btnLabel, renderedLabel, _ := parseButtonLabel(params.Buttons[i])
 		btnIdx := i
-		btn := tview.NewButton(btnLabel).SetSelectedFunc(func() {
-			params.OnButtonPressed(btnLabel, btnIdx)
+		btn := tview.NewButton(renderedLabel).SetSelectedFunc(func() {
+			msgv.pressButton(btnIdx)
 		})
 		msgv.buttons = append(msgv.buttons, btn)
 		msgv.focusers = append(msgv.focusers, btn)
 		tabHandler := msgv.getGenericTabHandler(btn)
 		btn.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-			// Handle Esc key
-			switch event.Key() {
-			case tcell.KeyEsc:
-				if params.OnEsc != nil {
-					params.OnEsc()
-				}
+			// Handle Esc and the mnemonics
+			event = msgv.handleButtonKeys(event, true)
+			if event == nil {
+				return nil
 			}
 
 			event = tabHandler(event)
@@ -267,12 +402,11 @@ func NewMessageView(
 		}
 
 		// Add the button itself: spacing of 2 chars at each side, and min 10 chars total.
-		// Focus the first one.
-		buttonSize := len(btnLabel) + 2*2
+		buttonSize := tview.TaggedStringWidth(btnLabel) + 2*2
 		if buttonSize < 10 {
 			buttonSize = 10
 		}
-		msgv.buttonsFlex.AddItem(btn, buttonSize, 0, i == 0 && len(params.InputFields) == 0)
+		msgv.buttonsFlex.AddItem(btn, buttonSize, 0, i == focusedBtnIdx)
 	}
 
 	// Add a spacer at the right of the buttons, to make them centered
@@ -292,17 +426,34 @@ func NewMessageView(
 	return msgv
 }
 
+// Show shows the messagebox, unless it has to wait in the queue for the ones
+// with the same or higher priority to be hidden first; see modalQueue.
 func (msgv *MessageView) Show() {
+	if !msgv.mainView.modalQueue.add(msgv) {
+		return
+	}
+
+	msgv.show()
+}
+
+// show shows the messagebox right away.
+func (msgv *MessageView) show() {
 	msgv.mainView.showModal(
-		pageNameMessage+msgv.params.MessageID, msgv.frame,
-		msgv.params.Width,
-		msgv.params.Height,
+		msgv.pageName(), msgv.frame,
+		msgv.curWidth,
+		msgv.curHeight,
 		!msgv.params.NoFocus,
 	)
 }
 
+// Hide hides the messagebox, or drops it from the queue if it's not shown
+// yet.
 func (msgv *MessageView) Hide() {
-	msgv.mainView.hideModal(pageNameMessage+msgv.params.MessageID, !msgv.params.NoFocus)
+	msgv.mainView.hideModal(msgv.pageName(), !msgv.params.NoFocus)
+}
+
+func (msgv *MessageView) pageName() string {
+	return pageNameMessage + msgv.params.MessageID
 }
 
 // SetText updates the text on the messagebox, and if resizeIfNeeded is true
@@ -326,7 +477,7 @@ func (msgv *MessageView) SetText(text string, resizeIfNeeded bool) {
 
 		if needResize {
 			msgv.mainView.resizeModal(
-				pageNameMessage+msgv.params.MessageID,
+				msgv.pageName(),
 				msgv.curWidth,
 				msgv.curHeight,
 			)
@@ -339,6 +490,13 @@ func (msgv *MessageView) GetText(stripAllTags bool) string {
 	return msgv.textView.GetText(stripAllTags)
 }
 
+// GetInputFieldText returns the current text of the input field with the
+// given index. No check is done for whether the given index is valid, so if
+// not, it will panic.
+func (msgv *MessageView) GetInputFieldText(index int) string {
+	return msgv.inputFields[index].GetText()
+}
+
 // SetButtonLabelOpts contains extra options for SetButtonLabel.
 type SetButtonLabelOpts struct {
 	// If RevertOnBlur is true, then once the button loses its focus,
@@ -359,6 +517,109 @@ func (msgv *MessageView) SetButtonLabel(index int, label string, opts SetButtonL
 	msgv.buttons[index].SetLabel(label)
 }
 
+// buttonIdx returns the index of the button with the given label (without the
+// "&"), or -1 if there's no such button.
+func (msgv *MessageView) buttonIdx(label string) int {
+	if label == "" {
+		return -1
+	}
+
+	for i, l := range msgv.buttonLabels {
+		if l == label {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// pressButton calls OnButtonPressed for the button with the given index,
+// unless the input fields are invalid (which only matters for the buttons
+// other than the cancel one).
+func (msgv *MessageView) pressButton(idx int) {
+	if idx != msgv.buttonIdx(msgv.params.CancelButton) && !msgv.ValidateInputFields() {
+		return
+	}
+
+	msgv.params.OnButtonPressed(msgv.buttonLabels[idx], idx)
+}
+
+// ValidateInputFields runs the validators of all the input fields, shows the
+// errors under the invalid ones (and hides them for the valid ones), and
+// focuses the first invalid field. Returns whether all the fields are valid.
+func (msgv *MessageView) ValidateInputFields() bool {
+	firstInvalid := -1
+	for i := range msgv.inputFields {
+		if !msgv.validateInputField(i) && firstInvalid < 0 {
+			firstInvalid = i
+		}
+	}
+
+	if firstInvalid < 0 {
+		return true
+	}
+
+	if !msgv.params.NoFocus {
+		msgv.params.App.SetFocus(msgv.inputFields[firstInvalid])
+	}
+
+	return false
+}
+
+// validateInputField runs the validators of the input field with the given
+// index, and shows the first error (if any) under it.
+func (msgv *MessageView) validateInputField(idx int) bool {
+	errView := msgv.fieldErrViews[idx]
+	if errView == nil {
+		return true
+	}
+
+	value := msgv.inputFields[idx].GetText()
+	for _, validator := range msgv.params.InputFields[idx].Validators {
+		if err := validator(value); err != nil {
+			errView.SetText(err.Error())
+			return false
+		}
+	}
+
+	errView.SetText("")
+	return true
+}
+
+// handleButtonKeys handles the keys which press the buttons regardless of the
+// focus: Esc for the cancel button (or just calls OnEsc), and the mnemonics.
+// If onButton is false, the focus is on an input field, so the mnemonics need
+// Alt. Returns nil if the key is handled.
+func (msgv *MessageView) handleButtonKeys(event *tcell.EventKey, onButton bool) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEsc:
+		if idx := msgv.buttonIdx(msgv.params.CancelButton); idx >= 0 {
+			msgv.pressButton(idx)
+			return nil
+		}
+
+		if msgv.params.OnEsc != nil {
+			msgv.params.OnEsc()
+		}
+
+	case tcell.KeyRune:
+		mod := event.Modifiers()
+		if mod != tcell.ModAlt && (!onButton || mod != tcell.ModNone) {
+			return event
+		}
+
+		r := unicode.ToLower(event.Rune())
+		for i, mnemonic := range msgv.mnemonics {
+			if mnemonic != 0 && mnemonic == r {
+				msgv.pressButton(i)
+				return nil
+			}
+		}
+	}
+
+	return event
+}
+
 // getOptimalSize returns optimal width and height for the message box with
 // its input fields etc.
 func (msgv *MessageView) getOptimalSize(text string) (int, int) {
@@ -377,6 +638,11 @@ func (msgv *MessageView) getOptimalSize(text string) (int, int) {
 		if field.Label != "" {
 			inputFieldsHeight++
 		}
+
+		// And one more for the validation errors.
+		if len(field.Validators) > 0 {
+			inputFieldsHeight++
+		}
 	}
 
 	// extraWidth covers padding and border
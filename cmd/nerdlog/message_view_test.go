@@ -97,6 +97,42 @@ asdflasdf`,
 			expectedWidth:  29,
 			expectedHeight: 7,
 		},
+		{
+			name:           "Color tags take no space",
+			screenWidth:    14,
+			extraWidth:     2,
+			extraHeight:    1,
+			text:           "[red]hello[-] world",
+			expectedWidth:  len("hello world") + 2,
+			expectedHeight: 1 + 1,
+		},
+		{
+			name:           "Escaped brackets are rendered as is",
+			screenWidth:    80,
+			extraWidth:     4,
+			extraHeight:    1,
+			text:           "[yellow]Warning:[-] use [red[] for red\nok",
+			expectedWidth:  len("Warning: use [red] for red") + 4,
+			expectedHeight: 1 + 2,
+		},
+		{
+			name:           "Tabs are expanded",
+			screenWidth:    8,
+			extraWidth:     2,
+			extraHeight:    1,
+			text:           "ab\tcd",
+			expectedWidth:  8,
+			expectedHeight: 1 + 2, // "ab    cd" is 8 chars on 6-width screen
+		},
+		{
+			name:           "Wide characters",
+			screenWidth:    12,
+			extraWidth:     2,
+			extraHeight:    1,
+			text:           "日本語のテキスト",
+			expectedWidth:  12,    // 16 cells, limited by the screen
+			expectedHeight: 1 + 2, // 16 cells on 10-width screen
+		},
 	}
 
 	for _, tt := range tests {
@@ -107,3 +143,29 @@ asdflasdf`,
 		})
 	}
 }
+
+func TestParseButtonLabel(t *testing.T) {
+	tests := []struct {
+		label            string
+		expectedPlain    string
+		expectedRendered string
+		expectedMnemonic rune
+	}{
+		{"OK", "OK", "OK", 0},
+		{"&Cancel", "Cancel", "[::u]C[::-]ancel", 'c'},
+		{"Copy &anyway", "Copy anyway", "Copy [::u]a[::-]nyway", 'a'},
+		{"&Fetch &all", "Fetch &all", "[::u]F[::-]etch &all", 'f'},
+		{"Reconnect & Retry", "Reconnect & Retry", "Reconnect & Retry", 0},
+		{"Save && &Quit", "Save & Quit", "Save & [::u]Q[::-]uit", 'q'},
+		{"Trailing &", "Trailing &", "Trailing &", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			plain, rendered, mnemonic := parseButtonLabel(tt.label)
+			assert.Equal(t, tt.expectedPlain, plain)
+			assert.Equal(t, tt.expectedRendered, rendered)
+			assert.Equal(t, tt.expectedMnemonic, mnemonic)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// MessageViewValidator checks the value of a MessageView input field, and
+// returns an error if it's invalid; the error is shown under the field. Any
+// custom func can be used, and a few common ones are below.
+type MessageViewValidator func(value string) error
+
+// ValidateNonEmpty rejects the empty values, as well as the ones with only
+// whitespace.
+func ValidateNonEmpty() MessageViewValidator {
+	return func(value string) error {
+		if strings.TrimSpace(value) == "" {
+			return errors.New("can't be empty")
+		}
+
+		return nil
+	}
+}
+
+// ValidateRegexp rejects the values which don't match the regexp; descr says
+// what's expected, like "host:port".
+func ValidateRegexp(re *regexp.Regexp, descr string) MessageViewValidator {
+	return func(value string) error {
+		if !re.MatchString(value) {
+			return errors.Errorf("must be %s", descr)
+		}
+
+		return nil
+	}
+}
+
+// ValidateInt rejects the values which aren't integers from min to max
+// inclusive.
+func ValidateInt(min, max int) MessageViewValidator {
+	return func(value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("must be a number")
+		}
+
+		if n < min || n > max {
+			return errors.Errorf("must be from %d to %d", min, max)
+		}
+
+		return nil
+	}
+}
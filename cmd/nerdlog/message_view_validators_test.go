@@ -0,0 +1,47 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageViewValidators(t *testing.T) {
+	tests := []struct {
+		name        string
+		validator   MessageViewValidator
+		value       string
+		expectedErr string
+	}{
+		{"non-empty ok", ValidateNonEmpty(), "foo", ""},
+		{"non-empty empty", ValidateNonEmpty(), "", "can't be empty"},
+		{"non-empty whitespace", ValidateNonEmpty(), "  \t", "can't be empty"},
+
+		{"regexp ok", ValidateRegexp(regexp.MustCompile(`^\w+:\d+$`), "host:port"), "myhost:22", ""},
+		{"regexp mismatch", ValidateRegexp(regexp.MustCompile(`^\w+:\d+$`), "host:port"), "myhost", "must be host:port"},
+
+		{"int ok", ValidateInt(1, 65535), "22", ""},
+		{"int ok with spaces", ValidateInt(1, 65535), " 22 ", ""},
+		{"int min", ValidateInt(1, 65535), "1", ""},
+		{"int max", ValidateInt(1, 65535), "65535", ""},
+		{"int too small", ValidateInt(1, 65535), "0", "must be from 1 to 65535"},
+		{"int too big", ValidateInt(1, 65535), "65536", "must be from 1 to 65535"},
+		{"int not a number", ValidateInt(1, 65535), "22a", "must be a number"},
+		{"int empty", ValidateInt(1, 65535), "", "must be a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validator(tt.value)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			if assert.Error(t, err) {
+				assert.Equal(t, tt.expectedErr, err.Error())
+			}
+		})
+	}
+}
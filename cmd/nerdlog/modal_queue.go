@@ -0,0 +1,119 @@
+package main
+
+// ModalPriority is the priority of a messagebox; see modalQueue.
+type ModalPriority int
+
+const (
+	// ModalPriorityNone is the default: the messagebox is shown right away, on
+	// top of everything else. It's for the dialogs opened by the user.
+	ModalPriorityNone ModalPriority = iota
+
+	// ModalPriorityInfo is for the notifications, like the detected log formats.
+	ModalPriorityInfo
+
+	// ModalPriorityError is for the errors and warnings.
+	ModalPriorityError
+
+	// ModalPriorityInput is for the data requests (like passwords), since the
+	// connection is blocked until the user responds.
+	ModalPriorityInput
+)
+
+// modalQueue keeps track of the prioritized messageboxes (the ones with the
+// priority other than ModalPriorityNone), so that they don't pile up in
+// arbitrary order when a few of them come at once (e.g. when a few hosts fail
+// at the same time).
+//
+// A prioritized messagebox is only shown right away if its priority is higher
+// than that of the ones being shown already; otherwise it waits in the queue
+// until those are hidden. The queued ones are shown one by one, in the order
+// of their priority, and then in the order they came in; so every Esc hides
+// the messagebox on top, and shows the next one.
+type modalQueue struct {
+	// shown are the prioritized messageboxes being shown, in the order they were
+	// shown; so their priorities are increasing, and the last one is on top.
+	shown []*MessageView
+
+	// queued are the messageboxes waiting to be shown.
+	queued []*MessageView
+}
+
+// add returns whether the messagebox can be shown right away; if not, it's
+// queued.
+func (q *modalQueue) add(msgv *MessageView) bool {
+	if msgv.params.Priority == ModalPriorityNone {
+		return true
+	}
+
+	if !q.canShow(msgv) {
+		q.queued = append(q.queued, msgv)
+		return false
+	}
+
+	q.shown = append(q.shown, msgv)
+	return true
+}
+
+// unqueue drops the messagebox with the given page name from the queue,
+// unless it's shown; returns whether it was dropped.
+func (q *modalQueue) unqueue(pageName string) bool {
+	if findModal(q.shown, pageName) >= 0 {
+		return false
+	}
+
+	idx := findModal(q.queued, pageName)
+	if idx < 0 {
+		return false
+	}
+
+	q.queued = append(q.queued[:idx], q.queued[idx+1:]...)
+	return true
+}
+
+// hidden is called when the modal with the given page name is hidden, and
+// returns the queued messagebox which should be shown now, if any.
+func (q *modalQueue) hidden(pageName string) *MessageView {
+	idx := findModal(q.shown, pageName)
+	if idx < 0 {
+		return nil
+	}
+
+	q.shown = append(q.shown[:idx], q.shown[idx+1:]...)
+
+	// Find the queued messagebox with the highest priority (and the earliest
+	// among the ones with the same priority).
+	nextIdx := -1
+	for i, msgv := range q.queued {
+		if nextIdx < 0 || msgv.params.Priority > q.queued[nextIdx].params.Priority {
+			nextIdx = i
+		}
+	}
+
+	if nextIdx < 0 || !q.canShow(q.queued[nextIdx]) {
+		return nil
+	}
+
+	next := q.queued[nextIdx]
+	q.queued = append(q.queued[:nextIdx], q.queued[nextIdx+1:]...)
+	q.shown = append(q.shown, next)
+
+	return next
+}
+
+// canShow returns whether the messagebox has higher priority than all the
+// ones being shown.
+func (q *modalQueue) canShow(msgv *MessageView) bool {
+	return len(q.shown) == 0 || msgv.params.Priority > q.shown[len(q.shown)-1].params.Priority
+}
+
+// findModal returns the index of the messagebox with the given page name, or
+// -1 if there's none.
+func findModal(msgvs []*MessageView, pageName string) int {
+	for i, msgv := range msgvs {
+		if msgv.pageName() == pageName {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestQueuedMsgv(id string, priority ModalPriority) *MessageView {
+	return &MessageView{
+		params: MessageViewParams{
+			MessageID: id,
+			Priority:  priority,
+		},
+	}
+}
+
+func modalIDs(msgvs []*MessageView) []string {
+	ret := make([]string, 0, len(msgvs))
+	for _, msgv := range msgvs {
+		ret = append(ret, msgv.params.MessageID)
+	}
+
+	return ret
+}
+
+func TestModalQueue(t *testing.T) {
+	var q modalQueue
+
+	// The non-prioritized ones are always shown, and not tracked.
+	assert.True(t, q.add(newTestQueuedMsgv("user", ModalPriorityNone)))
+	assert.Nil(t, q.hidden(pageNameMessage+"user"))
+
+	// A few errors at once: only the first one is shown, the rest are queued.
+	assert.True(t, q.add(newTestQueuedMsgv("err1", ModalPriorityError)))
+	assert.False(t, q.add(newTestQueuedMsgv("err2", ModalPriorityError)))
+	assert.False(t, q.add(newTestQueuedMsgv("info", ModalPriorityInfo)))
+	assert.False(t, q.add(newTestQueuedMsgv("err3", ModalPriorityError)))
+
+	// The higher priority one is shown on top right away.
+	assert.True(t, q.add(newTestQueuedMsgv("input", ModalPriorityInput)))
+	assert.Equal(t, []string{"err1", "input"}, modalIDs(q.shown))
+
+	// The non-prioritized ones on top don't affect anything.
+	assert.True(t, q.add(newTestQueuedMsgv("user", ModalPriorityNone)))
+	assert.Equal(t, []string{"err1", "input"}, modalIDs(q.shown))
+
+	// Hiding the one on top doesn't show anything else, since err1 is still
+	// shown.
+	assert.Nil(t, q.hidden(pageNameMessage+"input"))
+
+	// The queued one can be dropped before it's shown.
+	assert.True(t, q.unqueue(pageNameMessage+"err3"))
+	assert.False(t, q.unqueue(pageNameMessage+"err3"))
+	assert.False(t, q.unqueue(pageNameMessage+"err1"))
+
+	// Once err1 is hidden, the rest are shown one by one, higher priority first.
+	next := q.hidden(pageNameMessage + "err1")
+	if assert.NotNil(t, next) {
+		assert.Equal(t, "err2", next.params.MessageID)
+	}
+
+	next = q.hidden(pageNameMessage + "err2")
+	if assert.NotNil(t, next) {
+		assert.Equal(t, "info", next.params.MessageID)
+	}
+
+	assert.Nil(t, q.hidden(pageNameMessage+"info"))
+	assert.Empty(t, q.shown)
+	assert.Empty(t, q.queued)
+}
+
+func TestModalQueueSameID(t *testing.T) {
+	var q modalQueue
+
+	// The same messagebox ID is used for different errors: they're shown one
+	// after another, instead of replacing each other.
+	err1 := newTestQueuedMsgv("err", ModalPriorityError)
+	err2 := newTestQueuedMsgv("err", ModalPriorityError)
+	assert.True(t, q.add(err1))
+	assert.False(t, q.add(err2))
+
+	// Hiding by the page name hides the shown one, not the queued one.
+	assert.False(t, q.unqueue(pageNameMessage+"err"))
+	assert.Equal(t, err2, q.hidden(pageNameMessage+"err"))
+	assert.Nil(t, q.hidden(pageNameMessage+"err"))
+}
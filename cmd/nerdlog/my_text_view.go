@@ -1,7 +1,6 @@
 package main
 
 import (
-	"github.com/dimonomid/nerdlog/clipboard"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
@@ -123,9 +122,12 @@ func NewMyTextView(
 	rdv.copyToClipboardBtn.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyEnter:
-			// TODO: check if clipboard is actually available
-			clipboard.WriteText([]byte(rdv.params.Text))
-			rdv.copyToClipboardBtn.SetLabel("Copied!")
+			err := rdv.mainView.copyToClipboard(rdv.params.Text, func(copied string) {
+				rdv.copyToClipboardBtn.SetLabel("Copied!")
+			})
+			if err != nil {
+				rdv.copyToClipboardBtn.SetLabel("No clipboard")
+			}
 			return nil
 		}
 
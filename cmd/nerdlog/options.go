@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,6 +18,84 @@ type Options struct {
 	// most. Initially it's set to 250.
 	MaxNumLines int
 
+	// TransferBudget, if not zero, is how many bytes of log lines a single
+	// query may fetch from all logstreams together; if a query would exceed
+	// it, the user is asked what to do. Initially it's zero (no budget).
+	TransferBudget int
+
+	// HistogramLevels, if true, makes the histogram bars colored by the worst
+	// level of the messages in them: errors are pink, warnings are yellow.
+	// Initially it's true.
+	HistogramLevels bool
+
+	// QueryCache, if not zero, is for how long the hosts cache the query
+	// results, so that re-running the identical query doesn't scan the logs
+	// again. Initially it's 0, i.e. caching is disabled, since the cached
+	// results contain the raw logs and are kept on the hosts.
+	QueryCache time.Duration
+
+	// CountOnly, if true, makes the queries only fetch the timeline histogram
+	// and the total number of messages, but no messages at all. Initially it's
+	// false.
+	CountOnly bool
+
+	// GapThreshold, if not zero, makes the timeline histogram mark the periods
+	// of at least that long when some logstream had no lines at all (not just
+	// no matching ones). Initially it's 5 minutes.
+	GapThreshold time.Duration
+
+	// Follow, if not zero, is how often the query is repeated to show the new
+	// logs as they come, when the time range ends at the current time.
+	// Initially it's zero (no follow mode).
+	Follow time.Duration
+
+	// StormThreshold, if not zero, is the rate of the matching lines per
+	// second, above which the follow mode pauses, so the new logs don't scroll
+	// by too fast to read. Initially it's 200.
+	StormThreshold int
+
+	// LStreamRateLimit, if not zero, is how many messages per second every
+	// logstream can have at most in the follow mode; the rest are dropped.
+	// Initially it's zero (no limit).
+	LStreamRateLimit int
+
+	// ReverseDNS, if true, makes the IP info in the row details include the
+	// reverse DNS lookups. Initially it's false.
+	ReverseDNS bool
+
+	// GeoIPDB is the path to the local MaxMind DB file (like
+	// GeoLite2-City.mmdb) to get the IP info in the row details from. Empty
+	// means no GeoIP lookups.
+	GeoIPDB string
+
+	// Redact contains the names of the redaction rules to apply to everything
+	// copied to the clipboard; see RedactionRule. Initially it's empty.
+	Redact []string
+
+	// DetectSecrets, if true, makes the messages which look like they contain
+	// secrets (like AWS keys or private keys) highlighted, and asks for
+	// confirmation before copying them. Initially it's true.
+	DetectSecrets bool
+
+	// StripDomain, if true, makes the logstream names shown without the domain
+	// suffix common for all the hosts, unless they have the display names
+	// configured. Initially it's false.
+	StripDomain bool
+
+	// CustomRedactionRules are the redaction rules from the config, in
+	// addition to the built-in ones. It's not an option per se: it's only set
+	// once on startup.
+	CustomRedactionRules []RedactionRule
+
+	// Transactions contains the names of the transaction rules to group the
+	// messages by; see TransactionRule. Initially it's all the rules from the
+	// config.
+	Transactions []string
+
+	// TransactionRules are the transaction rules from the config. It's not an
+	// option per se: it's only set once on startup.
+	TransactionRules []TransactionRule
+
 	// EphemeralKeyProvider specifies which ephemeral key provider to use.
 	// Valid values: "mock", "opkssh", or empty string to disable.
 	EphemeralKeyProvider string
@@ -45,6 +125,98 @@ func (o *OptionsShared) GetMaxNumLines() int {
 	return o.options.MaxNumLines
 }
 
+func (o *OptionsShared) GetTransferBudget() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.TransferBudget
+}
+
+func (o *OptionsShared) GetHistogramLevels() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.HistogramLevels
+}
+
+func (o *OptionsShared) GetQueryCache() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.QueryCache
+}
+
+func (o *OptionsShared) GetCountOnly() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.CountOnly
+}
+
+func (o *OptionsShared) GetGapThreshold() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.GapThreshold
+}
+
+func (o *OptionsShared) GetFollow() time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.Follow
+}
+
+func (o *OptionsShared) GetStormThreshold() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.StormThreshold
+}
+
+func (o *OptionsShared) GetLStreamRateLimit() int {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.LStreamRateLimit
+}
+
+func (o *OptionsShared) GetReverseDNS() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.ReverseDNS
+}
+
+func (o *OptionsShared) GetGeoIPDB() string {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.GeoIPDB
+}
+
+func (o *OptionsShared) GetDetectSecrets() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.DetectSecrets
+}
+
+func (o *OptionsShared) GetStripDomain() bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.options.StripDomain
+}
+
+// GetRedactionRules returns the rules enabled by the Redact option.
+func (o *OptionsShared) GetRedactionRules() []RedactionRule {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	// The names are validated when the option is set, so it can't fail.
+	rules, _ := findRedactionRules(o.options.Redact, o.options.CustomRedactionRules)
+	return rules
+}
+
+// GetTransactionRules returns the rules enabled by the Transactions option.
+func (o *OptionsShared) GetTransactionRules() []TransactionRule {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	// The names are validated when the option is set, so it can't fail.
+	rules, _ := findTransactionRules(o.options.Transactions, o.options.TransactionRules)
+	return rules
+}
+
 func (o *OptionsShared) GetEphemeralKeyProvider() string {
 	o.mtx.Lock()
 	defer o.mtx.Unlock()
@@ -110,6 +282,255 @@ var AllOptions = map[string]*OptionMeta{
 	"numlines": {
 		AliasOf: "maxnumlines",
 	}, // }}}
+	"transferbudget": { // {{{
+		Get: func(o *Options) string {
+			return formatByteSize(o.TransferBudget)
+		},
+		Set: func(o *Options, value string) error {
+			budget, err := parseByteSize(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.TransferBudget = budget
+			return nil
+		},
+		Help: "How many bytes of logs one query may fetch before asking for confirmation, like 10M; 0 means no limit",
+	}, // }}}
+	"histogramlevels": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.HistogramLevels)
+		},
+		Set: func(o *Options, value string) error {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.HistogramLevels = v
+			return nil
+		},
+		Help: "Whether to color the histogram bars by the worst level of the messages in them (errors and warnings); takes effect on the next query",
+	}, // }}}
+	"querycache": { // {{{
+		Get: func(o *Options) string {
+			return o.QueryCache.String()
+		},
+		Set: func(o *Options, value string) error {
+			v, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if v < 0 {
+				return errors.Errorf("query cache TTL can't be negative")
+			}
+
+			o.QueryCache = v
+			return nil
+		},
+		Help: "For how long the hosts cache the query results, like 1m; 0 disables caching",
+	}, // }}}
+	"countonly": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.CountOnly)
+		},
+		Set: func(o *Options, value string) error {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.CountOnly = v
+			return nil
+		},
+		Help: "Whether to only fetch the timeline histogram and the number of messages, without the messages themselves; takes effect on the next query",
+	}, // }}}
+	"gapthreshold": { // {{{
+		Get: func(o *Options) string {
+			return o.GapThreshold.String()
+		},
+		Set: func(o *Options, value string) error {
+			v, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if v < 0 {
+				return errors.Errorf("gap threshold can't be negative")
+			}
+
+			o.GapThreshold = v
+			return nil
+		},
+		Help: "How long a logstream should have no lines at all for the period to be marked on the timeline histogram, like 5m; 0 disables it",
+	}, // }}}
+	"follow": { // {{{
+		Get: func(o *Options) string {
+			return o.Follow.String()
+		},
+		Set: func(o *Options, value string) error {
+			v, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if v < 0 {
+				return errors.Errorf("follow interval can't be negative")
+			}
+
+			o.Follow = v
+			return nil
+		},
+		Help: "How often to repeat the query to show the new logs as they come, like 5s; only when the time range ends at the current time; 0 disables it",
+	}, // }}}
+	"stormthreshold": { // {{{
+		Get: func(o *Options) string {
+			return strconv.Itoa(o.StormThreshold)
+		},
+		Set: func(o *Options, value string) error {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if v < 0 {
+				return errors.Errorf("storm threshold can't be negative")
+			}
+
+			o.StormThreshold = v
+			return nil
+		},
+		Help: "The rate of the matching lines per second above which the follow mode pauses; 0 disables it",
+	}, // }}}
+	"lstreamratelimit": { // {{{
+		Get: func(o *Options) string {
+			return strconv.Itoa(o.LStreamRateLimit)
+		},
+		Set: func(o *Options, value string) error {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			if v < 0 {
+				return errors.Errorf("logstream rate limit can't be negative")
+			}
+
+			o.LStreamRateLimit = v
+			return nil
+		},
+		Help: "How many messages per second every logstream can have at most in the follow mode, so that a chatty one doesn't drown out the others; 0 means no limit",
+	}, // }}}
+	"rdns": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.ReverseDNS)
+		},
+		Set: func(o *Options, value string) error {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.ReverseDNS = v
+			return nil
+		},
+		Help: "Whether to do reverse DNS lookups of the IP addresses in the row details",
+	}, // }}}
+	"geoipdb": { // {{{
+		Get: func(o *Options) string {
+			return o.GeoIPDB
+		},
+		Set: func(o *Options, value string) error {
+			if value != "" {
+				if _, err := os.Stat(value); err != nil {
+					return errors.Trace(err)
+				}
+			}
+
+			o.GeoIPDB = value
+			return nil
+		},
+		Help: "Path to the local MaxMind DB file (like GeoLite2-City.mmdb) for GeoIP lookups of the IP addresses in the row details; empty to disable",
+	}, // }}}
+	"redact": { // {{{
+		Get: func(o *Options) string {
+			return strings.Join(o.Redact, ",")
+		},
+		Set: func(o *Options, value string) error {
+			var names []string
+			for _, name := range strings.Split(value, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" || name == "none" {
+					continue
+				}
+
+				names = append(names, name)
+			}
+
+			if _, err := findRedactionRules(names, o.CustomRedactionRules); err != nil {
+				return errors.Trace(err)
+			}
+
+			o.Redact = names
+			return nil
+		},
+		Help: "Comma-separated redaction rules to apply to everything copied to the clipboard, like emails,ips,tokens,jwts; empty to disable",
+	}, // }}}
+	"transactions": { // {{{
+		Get: func(o *Options) string {
+			return strings.Join(o.Transactions, ",")
+		},
+		Set: func(o *Options, value string) error {
+			var names []string
+			for _, name := range strings.Split(value, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" || name == "none" {
+					continue
+				}
+
+				names = append(names, name)
+			}
+
+			if _, err := findTransactionRules(names, o.TransactionRules); err != nil {
+				return errors.Trace(err)
+			}
+
+			o.Transactions = names
+			return nil
+		},
+		Help: "Comma-separated transaction rules from the config to group the messages by; empty to disable",
+	}, // }}}
+	"detectsecrets": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.DetectSecrets)
+		},
+		Set: func(o *Options, value string) error {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.DetectSecrets = v
+			return nil
+		},
+		Help: "Whether to highlight the messages which look like they contain secrets, and ask before copying them",
+	}, // }}}
+	"stripdomain": { // {{{
+		Get: func(o *Options) string {
+			return strconv.FormatBool(o.StripDomain)
+		},
+		Set: func(o *Options, value string) error {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return errors.Trace(err)
+			}
+
+			o.StripDomain = v
+			return nil
+		},
+		Help: "Whether to show the logstream names without the domain suffix common for all the hosts; takes effect on the next query",
+	}, // }}}
 	"ephemeralkeyprovider": {
 		Get: func(o *Options) string {
 			return o.EphemeralKeyProvider
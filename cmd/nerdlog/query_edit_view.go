@@ -48,11 +48,12 @@ type QueryEditView struct {
 	backBtn *tview.Button
 	fwdBtn  *tview.Button
 
-	timeFlex      *tview.Flex
-	timeInput     *tview.InputField
-	timezoneLabel *tview.TextView
-	lstreamsInput *tview.InputField
-	queryInput    *tview.InputField
+	timeFlex        *tview.Flex
+	timeInput       *tview.InputField
+	timezoneLabel   *tview.TextView
+	lstreamsInput   *tview.InputField
+	lstreamsTestBtn *tview.Button
+	queryInput      *tview.InputField
 
 	selectQueryInput   *tview.InputField
 	selectQueryEditBtn *tview.Button
@@ -168,9 +169,18 @@ func NewQueryEditView(
 	qev.flex.AddItem(lstreamsLabel, 2, 0, false)
 
 	qev.lstreamsInput = tview.NewInputField()
-	qev.flex.AddItem(qev.lstreamsInput, 1, 0, false)
 	focusers = append(focusers, qev.lstreamsInput)
 
+	qev.lstreamsTestBtn = tview.NewButton("Test")
+	focusers = append(focusers, qev.lstreamsTestBtn)
+
+	lstreamsFlex := tview.NewFlex().SetDirection(tview.FlexColumn)
+	lstreamsFlex.
+		AddItem(qev.lstreamsInput, 0, 1, false).
+		AddItem(nil, 1, 0, false).
+		AddItem(qev.lstreamsTestBtn, 6, 0, false)
+	qev.flex.AddItem(lstreamsFlex, 1, 0, false)
+
 	qev.flex.AddItem(nil, 1, 0, false)
 
 	queryLabel := tview.NewTextView()
@@ -297,6 +307,21 @@ func NewQueryEditView(
 		return event
 	})
 
+	qev.lstreamsTestBtn.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter:
+			qev.mainView.params.OnLStreamsCheck(qev.lstreamsInput.GetText())
+			return nil
+		}
+
+		event = qev.genericInputHandler(event, getGenericTabHandler(qev.lstreamsTestBtn), nil, nil)
+		if event == nil {
+			return nil
+		}
+
+		return event
+	})
+
 	qev.queryInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		event = qev.genericInputHandler(
 			event,
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/blhistory"
+	"github.com/juju/errors"
+)
+
+// navigateQueryHistory goes back (undo) or forward (redo) in the browser-like
+// history of queries, and tells the user what has changed.
+func (app *nerdlogApp) navigateQueryHistory(back bool) {
+	prev := app.lastQueryFull
+
+	var item *blhistory.Item
+	var verb string
+	if back {
+		item = app.queryBLHistory.Prev()
+		verb = "Undo"
+	} else {
+		item = app.queryBLHistory.Next()
+		verb = "Redo"
+	}
+
+	if item == nil {
+		app.printError("No more history items")
+		return
+	}
+
+	// Errors here shouldn't happen really provided a sane history.
+	var qf QueryFull
+	if err := qf.UnmarshalShellCmd(item.Str); err != nil {
+		app.printError(errors.Annotatef(err, "parsing").Error())
+		return
+	}
+
+	if err := app.mainView.applyQueryEditData(qf, doQueryParams{
+		dontAddHistoryItem: true,
+	}); err != nil {
+		app.printError(errors.Annotatef(err, "applying").Error())
+		return
+	}
+
+	items, idx := app.queryBLHistory.Items()
+	app.printMsg(fmt.Sprintf(
+		"%s (%d/%d): %s", verb, idx+1, len(items), describeQueryFullChange(prev, qf),
+	))
+}
+
+// describeQueryFullChange returns a short human-readable description of what
+// is different in the query "to" as compared to "from", like
+// "time -1h → -3h, query /foo/ → (none)".
+func describeQueryFullChange(from, to QueryFull) string {
+	var changes []string
+
+	describe := func(name, fromVal, toVal string) {
+		if fromVal == toVal {
+			return
+		}
+
+		if fromVal == "" {
+			fromVal = "(none)"
+		}
+		if toVal == "" {
+			toVal = "(none)"
+		}
+
+		changes = append(changes, fmt.Sprintf("%s %s → %s", name, fromVal, toVal))
+	}
+
+	describe("logstreams", from.LStreams, to.LStreams)
+	describe("time", from.Time, to.Time)
+	describe("query", from.Query, to.Query)
+
+	if from.SelectQuery != to.SelectQuery {
+		changes = append(changes, "columns changed")
+	}
+
+	if len(changes) == 0 {
+		return "no changes"
+	}
+
+	return strings.Join(changes, ", ")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeQueryFullChange(t *testing.T) {
+	base := QueryFull{
+		LStreams: "myhost",
+		Time:     "-1h",
+		Query:    "/foo/",
+	}
+
+	assert.Equal(t, "no changes", describeQueryFullChange(base, base))
+
+	to := base
+	to.Time = "-3h"
+	to.Query = ""
+	assert.Equal(t, "time -1h → -3h, query /foo/ → (none)", describeQueryFullChange(base, to))
+
+	to = base
+	to.LStreams = "myhost, otherhost"
+	to.SelectQuery = "time STICKY, message"
+	assert.Equal(
+		t, "logstreams myhost → myhost, otherhost, columns changed",
+		describeQueryFullChange(base, to),
+	)
+}
+
+func TestUINavigateQueryHistory(t *testing.T) {
+	h := newUIHarness(t, uiHarnessParams{})
+	h.waitForQueryDone("35 / 35 / 35")
+	h.confirmLogFormat()
+
+	h.typeText("/Firewall/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("1 / 1 / 1")
+
+	h.pressKey(tcell.KeyCtrlU)
+	h.typeText("/nosuchthing/")
+	h.pressKey(tcell.KeyEnter)
+	h.waitForQueryDone("- / 0 / 0")
+
+	runCmd := func(cmd string) {
+		h.pressKey(tcell.KeyEsc)
+		h.typeText(":" + cmd)
+		h.pressKey(tcell.KeyEnter)
+	}
+
+	// Two undos in a row get all the way back to the initial query.
+	runCmd("undo")
+	h.waitForQueryDone("1 / 1 / 1")
+
+	runCmd("undo")
+	h.waitForQueryDone("35 / 35 / 35")
+
+	// Nothing to undo anymore.
+	runCmd("undo")
+	h.waitForText("No more history items")
+	h.pressKey(tcell.KeyEsc)
+
+	// And redo goes forward one step at a time.
+	runCmd("redo")
+	h.waitForQueryDone("1 / 1 / 1")
+}
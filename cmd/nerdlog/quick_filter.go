@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/rivo/tview"
+)
+
+const msgIDQuickFilter = "quick_filter"
+
+// lineTemplateVarRegex matches the parts of a log message which are likely
+// to vary between lines produced by the same code: numbers, IP addresses,
+// ports, hex ids, UUIDs, etc.
+var lineTemplateVarRegex = regexp.MustCompile(`[-.:0-9A-Fa-f]*[0-9][-.:0-9A-Fa-f]*`)
+
+// lineTemplateVarPattern is what the variable parts of a message are replaced
+// with in the template pattern.
+const lineTemplateVarPattern = `[-.:0-9A-Fa-f]+`
+
+// lineTemplatePattern returns a regexp (to be used between slashes in the awk
+// query) which matches lines "like this one": the constant parts of the
+// message are kept as is, and the variable parts are replaced with wildcards.
+//
+// E.g. for the message "Accepted publickey for bob from 10.0.0.2 port 51234",
+// the pattern is "Accepted publickey for bob from [-.:0-9A-Fa-f]+ port [-.:0-9A-Fa-f]+".
+func lineTemplatePattern(msg string) string {
+	var sb strings.Builder
+
+	last := 0
+	for _, loc := range lineTemplateVarRegex.FindAllStringIndex(msg, -1) {
+		sb.WriteString(awkRegexEscape(msg[last:loc[0]]))
+		sb.WriteString(lineTemplateVarPattern)
+		last = loc[1]
+	}
+	sb.WriteString(awkRegexEscape(msg[last:]))
+
+	return sb.String()
+}
+
+// awkRegexEscape escapes all the regexp metacharacters in s, as well as the
+// slash, so that the result can be used between slashes in the awk query and
+// match s literally.
+//
+// Unlike awkEscape, it only escapes the chars which have special meaning,
+// since in gawk some other escapes (like \< and \>) are operators.
+func awkRegexEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\^$.|?*+()[]{}/`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+// quickFilterQuery returns the query with one more condition added to its
+// base pattern (see editBasePattern): either /pattern/, or !/pattern/ if
+// exclude is true.
+func quickFilterQuery(query, pattern string, exclude bool) string {
+	part := fmt.Sprintf("/%s/", pattern)
+	if exclude {
+		part = "!" + part
+	}
+
+	return editBasePattern(query, func(base string) string {
+		return andAwkCond(base, part)
+	})
+}
+
+// getSelectedLogMsg returns the log message on the currently selected row of
+// the logs table, or nil if there's no message there (e.g. the "load more"
+// row is selected).
+func (mv *MainView) getSelectedLogMsg() *core.LogMsg {
+	row, _ := mv.logsTable.GetSelection()
+	cell := mv.logsTable.GetCell(row, 0)
+	if cell == nil {
+		return nil
+	}
+
+	msg, ok := cell.GetReference().(core.LogMsg)
+	if !ok {
+		return nil
+	}
+
+	return &msg
+}
+
+// applyQuickFilter adds the pattern to the current query, either as a filter
+// or as an exclusion, and reruns the query.
+func (mv *MainView) applyQuickFilter(pattern string, exclude bool) {
+	if pattern == "" {
+		mv.printMsg("Quick filter pattern is empty", nlMsgLevelErr)
+		return
+	}
+
+	mv.setQuery(quickFilterQuery(mv.query, pattern, exclude))
+	mv.doQuery(doQueryParams{})
+}
+
+// quickFilterSelected filters to (or excludes, if exclude is true) the lines
+// which look like the selected one.
+func (mv *MainView) quickFilterSelected(exclude bool) {
+	msg := mv.getSelectedLogMsg()
+	if msg == nil || msg.Msg == "" {
+		mv.printMsg("No log message selected", nlMsgLevelErr)
+		return
+	}
+
+	mv.applyQuickFilter(lineTemplatePattern(msg.Msg), exclude)
+}
+
+// showQuickFilter shows the dialog where the user can edit the template
+// pattern for the selected line (e.g. leave only some substring of it), and
+// then either filter to, or exclude, the lines matching it.
+func (mv *MainView) showQuickFilter() {
+	msg := mv.getSelectedLogMsg()
+	if msg == nil || msg.Msg == "" {
+		mv.printMsg("No log message selected", nlMsgLevelErr)
+		return
+	}
+
+	var msgv *MessageView
+	apply := func(exclude bool) {
+		pattern := msgv.GetInputFieldText(0)
+		msgv.Hide()
+		mv.applyQuickFilter(pattern, exclude)
+	}
+
+	msgv = mv.showMessagebox(
+		msgIDQuickFilter,
+		"Quick filter",
+		fmt.Sprintf(
+			"Selected message:\n\n%s\n\nThe pattern below matches lines like this one; edit it if needed (e.g. to keep only some substring), and then filter to, or exclude, the matching lines.",
+			tview.Escape(msg.Msg),
+		),
+		&MessageboxParams{
+			InputFields: []MessageViewInputFieldParams{
+				{
+					Label:      "Pattern (regexp):",
+					Value:      lineTemplatePattern(msg.Msg),
+					Validators: []MessageViewValidator{ValidateNonEmpty()},
+				},
+			},
+
+			Buttons:       []string{"&Filter", "&Exclude", "&Cancel"},
+			DefaultButton: "Filter",
+			CancelButton:  "Cancel",
+			OnButtonPressed: func(label string, idx int) {
+				switch label {
+				case "Filter":
+					apply(false)
+				case "Exclude":
+					apply(true)
+				default:
+					msgv.Hide()
+				}
+			},
+
+			Width: 100,
+		},
+	)
+}
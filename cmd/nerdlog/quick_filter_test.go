@@ -0,0 +1,98 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineTemplatePattern(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         string
+		wantPattern string
+		wantMatch   []string
+		wantNoMatch []string
+	}{
+		{
+			name:        "numbers and IP",
+			msg:         "Accepted publickey for bob from 10.0.0.2 port 51234",
+			wantPattern: "Accepted publickey for bob from [-.:0-9A-Fa-f]+ port [-.:0-9A-Fa-f]+",
+			wantMatch: []string{
+				"Accepted publickey for bob from 192.168.1.10 port 22",
+			},
+			wantNoMatch: []string{
+				"Accepted publickey for alice from 192.168.1.10 port 22",
+			},
+		},
+		{
+			name:        "regexp metachars and slashes",
+			msg:         "GET /api/v1/users?id=42 (took 3.5ms) [ok]",
+			wantPattern: `GET \/api\/v[-.:0-9A-Fa-f]+\/users\?id=[-.:0-9A-Fa-f]+ \(took [-.:0-9A-Fa-f]+ms\) \[ok\]`,
+			wantMatch: []string{
+				"GET /api/v2/users?id=1337 (took 12ms) [ok]",
+			},
+			wantNoMatch: []string{
+				"GET /api/v2/users?id=1337 (took 12ms) [failed]",
+			},
+		},
+		{
+			name:        "uuid",
+			msg:         "job 550e8400-e29b-41d4-a716-446655440000 done",
+			wantPattern: "job [-.:0-9A-Fa-f]+ done",
+			wantMatch: []string{
+				"job 123e4567-e89b-12d3-a456-426614174000 done",
+			},
+		},
+		{
+			name:        "no variable parts",
+			msg:         "Started Session of user root.",
+			wantPattern: `Started Session of user root\.`,
+			wantNoMatch: []string{
+				"Started Session of user rootX",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := lineTemplatePattern(tt.msg)
+			assert.Equal(t, tt.wantPattern, pattern)
+
+			// Slashes are escaped only for awk; Go regexps don't need it.
+			re := regexp.MustCompile(regexp.MustCompile(`\\/`).ReplaceAllString(pattern, "/"))
+
+			assert.True(t, re.MatchString(tt.msg), "should match the original message")
+			for _, s := range tt.wantMatch {
+				assert.True(t, re.MatchString(s), "should match %q", s)
+			}
+			for _, s := range tt.wantNoMatch {
+				assert.False(t, re.MatchString(s), "should not match %q", s)
+			}
+		})
+	}
+}
+
+func TestQuickFilterQuery(t *testing.T) {
+	assert.Equal(t, "/foo/", quickFilterQuery("", "foo", false))
+	assert.Equal(t, "!/foo/", quickFilterQuery("  ", "foo", true))
+	assert.Equal(t, "/bar/ && /foo/", quickFilterQuery("/bar/", "foo", false))
+	assert.Equal(t, "/bar/ && !/foo/", quickFilterQuery("/bar/", "foo", true))
+
+	// The pattern with || is parenthesized, so the condition applies to all of
+	// it.
+	assert.Equal(t, "(/bar/ || /baz/) && /foo/", quickFilterQuery("/bar/ || /baz/", "foo", false))
+	assert.Equal(
+		t, "(/bar/ || /baz/) && /qux/ && !/foo/",
+		quickFilterQuery("(/bar/ || /baz/) && /qux/", "foo", true),
+	)
+
+	// The condition goes to the base pattern, even if the last stage is
+	// disabled.
+	assert.Equal(
+		t, "/bar/ && /foo/ | #where /baz/",
+		quickFilterQuery("/bar/ | #where /baz/", "foo", false),
+	)
+	assert.Equal(t, "/foo/ | where /baz/", quickFilterQuery("| where /baz/", "foo", false))
+}
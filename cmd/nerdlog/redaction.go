@@ -0,0 +1,208 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dimonomid/nerdlog/clipboard"
+	"github.com/juju/errors"
+)
+
+// RedactionRule replaces every match of Regex with Replacement (which can
+// refer to the submatches, like "${1}", see regexp.Regexp.ReplaceAllString).
+type RedactionRule struct {
+	Name        string
+	Regex       *regexp.Regexp
+	Replacement string
+
+	// If replaceFunc is not nil, it's used instead of Replacement; it's only
+	// used by the built-in rules which need more than a regex.
+	replaceFunc func(match string) string
+}
+
+func (rule *RedactionRule) apply(s string) string {
+	if rule.replaceFunc != nil {
+		return rule.Regex.ReplaceAllStringFunc(s, rule.replaceFunc)
+	}
+
+	return rule.Regex.ReplaceAllString(s, rule.Replacement)
+}
+
+// builtinRedactionRules are always available in the "redact" option, in
+// addition to the custom ones from the config.
+var builtinRedactionRules = []RedactionRule{
+	{
+		Name:        "emails",
+		Regex:       regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "<email>",
+	},
+	{
+		Name:  "ips",
+		Regex: ipCandidateRegex,
+		replaceFunc: func(match string) string {
+			// Same as in findIPs, but here the port (if any) is redacted too.
+			candidate := strings.TrimRight(match, ".:")
+			suffix := match[len(candidate):]
+
+			if ip := net.ParseIP(candidate); ip != nil && !ip.IsUnspecified() {
+				return "<ip>" + suffix
+			}
+
+			if host, _, err := net.SplitHostPort(candidate); err == nil && net.ParseIP(host) != nil {
+				return "<ip>" + suffix
+			}
+
+			return match
+		},
+	},
+	{
+		Name: "tokens",
+		Regex: regexp.MustCompile(
+			`(?i)\b(bearer|token|api[_-]?key|secret|password|passwd|pwd)(\s*[:=]\s*|\s+)("?)[^\s"',;&]+`,
+		),
+		Replacement: "${1}${2}${3}<redacted>",
+	},
+	{
+		Name:        "jwts",
+		Regex:       regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		Replacement: "<jwt>",
+	},
+}
+
+// ConfigRedactionRules is the config with the custom redaction rules, which
+// can then be enabled with the "redact" option like the built-in ones.
+type ConfigRedactionRules struct {
+	RedactionRules []ConfigRedactionRule `yaml:"redaction_rules"`
+}
+
+type ConfigRedactionRule struct {
+	Name        string `yaml:"name"`
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+}
+
+func LoadRedactionRulesConfigFromFile(path string) ([]RedactionRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading config file %s", path)
+	}
+
+	var cfg ConfigRedactionRules
+	if err := unmarshalConfig(path, data, &cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	ret := make([]RedactionRule, 0, len(cfg.RedactionRules))
+	for i, cr := range cfg.RedactionRules {
+		if cr.Name == "" || strings.ContainsAny(cr.Name, ", ") {
+			return nil, errors.Errorf("redaction rule #%d: invalid name %q", i+1, cr.Name)
+		}
+
+		for _, builtin := range builtinRedactionRules {
+			if builtin.Name == cr.Name {
+				return nil, errors.Errorf("%s: the name is taken by a built-in redaction rule", cr.Name)
+			}
+		}
+
+		re, err := regexp.Compile(cr.Regex)
+		if err != nil {
+			return nil, errors.Annotatef(err, "%s: compiling regex", cr.Name)
+		}
+
+		replacement := cr.Replacement
+		if replacement == "" {
+			replacement = "<redacted>"
+		}
+
+		ret = append(ret, RedactionRule{
+			Name:        cr.Name,
+			Regex:       re,
+			Replacement: replacement,
+		})
+	}
+
+	return ret, nil
+}
+
+// findRedactionRules returns the rules with the given names, looking in the
+// custom rules first and then in the built-in ones.
+func findRedactionRules(names []string, custom []RedactionRule) ([]RedactionRule, error) {
+	ret := make([]RedactionRule, 0, len(names))
+
+	for _, name := range names {
+		found := false
+		for _, rules := range [][]RedactionRule{custom, builtinRedactionRules} {
+			for _, rule := range rules {
+				if rule.Name == name {
+					ret = append(ret, rule)
+					found = true
+					break
+				}
+			}
+
+			if found {
+				break
+			}
+		}
+
+		if !found {
+			return nil, errors.Errorf(
+				"unknown redaction rule %q; available ones: %s",
+				name, strings.Join(redactionRuleNames(custom), ", "),
+			)
+		}
+	}
+
+	return ret, nil
+}
+
+func redactionRuleNames(custom []RedactionRule) []string {
+	var names []string
+	for _, rule := range builtinRedactionRules {
+		names = append(names, rule.Name)
+	}
+	for _, rule := range custom {
+		names = append(names, rule.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// redact applies all the given rules to the string, one after another.
+func redact(s string, rules []RedactionRule) string {
+	for i := range rules {
+		s = rules[i].apply(s)
+	}
+
+	return s
+}
+
+// copyToClipboard copies the text to the clipboard, after redacting it as
+// per the "redact" option, and checking for secrets (see
+// confirmCopySecrets); so the actual copying might happen later, or not at
+// all if the user cancels it. Once copied, onCopied (if not nil) is called
+// with the text which was copied.
+//
+// An error is only returned if there is no clipboard.
+func (mv *MainView) copyToClipboard(text string, onCopied func(copied string)) error {
+	if clipboard.InitErr != nil {
+		return errors.Annotatef(clipboard.InitErr, "clipboard is not available")
+	}
+
+	text = redact(text, mv.params.Options.GetRedactionRules())
+
+	mv.confirmCopySecrets(text, func(text string) {
+		clipboard.WriteText([]byte(text))
+
+		if onCopied != nil {
+			onCopied(text)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// valueTokenRegex matches tokens in the field values which the user can
+// navigate between in the row details view. Dots, colons, slashes etc are
+// not separators, so that things like IP addresses, paths and URLs end up
+// being a single token.
+var valueTokenRegex = regexp.MustCompile(`[^\s,;"'()\[\]{}<>=|]+`)
+
+// findValueTokens returns the [start, end) byte offsets of all tokens in the
+// value. Trailing dots and colons are not considered part of the token, so
+// that e.g. "failed: 10.0.0.1." gives "failed" and "10.0.0.1".
+func findValueTokens(val string) [][2]int {
+	var ret [][2]int
+	for _, loc := range valueTokenRegex.FindAllStringIndex(val, -1) {
+		start, end := loc[0], loc[1]
+		for end > start && strings.IndexByte(".:", val[end-1]) >= 0 {
+			end--
+		}
+
+		if end > start {
+			ret = append(ret, [2]int{start, end})
+		}
+	}
+
+	return ret
+}
+
+// highlightValueToken returns the value escaped for tview, with the given
+// token highlighted.
+func highlightValueToken(val string, token [2]int) string {
+	return tview.Escape(val[:token[0]]) +
+		"[black:yellow]" + tview.Escape(val[token[0]:token[1]]) + "[-:-]" +
+		tview.Escape(val[token[1]:])
+}
+
+// toggleAwkRegexFilter adds the condition /re/ (or !/re/ if exclude is true)
+// to the base pattern of the query (see editBasePattern), or removes it if
+// it's already there. If the opposite condition for the same regexp is
+// present, it's removed.
+func toggleAwkRegexFilter(query, re string, exclude bool) string {
+	return editBasePattern(query, func(base string) string {
+		return toggleAwkRegexCond(base, re, exclude)
+	})
+}
+
+// toggleAwkRegexCond is toggleAwkRegexFilter for a plain awk pattern, without
+// the filter stages.
+func toggleAwkRegexCond(query, re string, exclude bool) string {
+	include := "/" + re + "/"
+	excl := "!" + include
+
+	hasExcl := strings.Contains(query, excl)
+	if hasExcl {
+		query = addToOrRemoveFromAwkQuery(query, excl)
+	}
+
+	// Now that there's no exclusion, the include part can be checked and
+	// removed without touching the "!/re/".
+	hasIncl := strings.Contains(query, include)
+
+	if !exclude {
+		return addToOrRemoveFromAwkQuery(query, include)
+	}
+
+	if hasExcl {
+		// It was excluded, so removing it was the toggle.
+		return query
+	}
+
+	if hasIncl {
+		query = addToOrRemoveFromAwkQuery(query, include)
+	}
+
+	return addToOrRemoveFromAwkQuery(query, excl)
+}
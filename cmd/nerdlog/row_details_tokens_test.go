@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindValueTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		val        string
+		wantTokens []string
+	}{
+		{
+			name:       "ip and port",
+			val:        "Failed password for root from 10.0.0.2 port 51234 ssh2",
+			wantTokens: []string{"Failed", "password", "for", "root", "from", "10.0.0.2", "port", "51234", "ssh2"},
+		},
+		{
+			name:       "trailing punctuation and brackets",
+			val:        `sshd[123]: connection from "bob@example.com" (path=/var/log/syslog).`,
+			wantTokens: []string{"sshd", "123", "connection", "from", "bob@example.com", "path", "/var/log/syslog"},
+		},
+		{
+			name:       "empty",
+			val:        "",
+			wantTokens: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokens []string
+			for _, tok := range findValueTokens(tt.val) {
+				tokens = append(tokens, tt.val[tok[0]:tok[1]])
+			}
+
+			assert.Equal(t, tt.wantTokens, tokens)
+		})
+	}
+}
+
+func TestHighlightValueToken(t *testing.T) {
+	assert.Equal(
+		t,
+		"from [black:yellow]10.0.0.2[-:-] [foo[]",
+		highlightValueToken("from 10.0.0.2 [foo]", [2]int{5, 13}),
+	)
+}
+
+func TestToggleAwkRegexFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		exclude bool
+		want    string
+	}{
+		{"add to empty", "", false, "/foo/"},
+		{"add", "/bar/", false, "/bar/ && /foo/"},
+		{"remove", "/bar/ && /foo/", false, "/bar/"},
+		{"exclude", "/bar/", true, "/bar/ && !/foo/"},
+		{"remove exclusion", "/bar/ && !/foo/", true, "/bar/"},
+		{"exclusion to inclusion", "/bar/ && !/foo/", false, "/bar/ && /foo/"},
+		{"inclusion to exclusion", "/foo/ && /bar/", true, "/bar/ && !/foo/"},
+		{"add with disabled stage", "/bar/ | #where /baz/", false, "/bar/ && /foo/ | #where /baz/"},
+		{"remove with stage", "/bar/ && /foo/ | where /baz/", false, "/bar/ | where /baz/"},
+		{"add to ||", "/bar/ || /baz/", false, "(/bar/ || /baz/) && /foo/"},
+		{"exclude from ||", "/bar/ || /baz/", true, "(/bar/ || /baz/) && !/foo/"},
+		{"remove from ||", "(/bar/ || /baz/) && /foo/", false, "(/bar/ || /baz/)"},
+		{"add to parenthesized ||", "(/bar/ || /baz/)", false, "(/bar/ || /baz/) && /foo/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, toggleAwkRegexFilter(tt.query, "foo", tt.exclude))
+		})
+	}
+}
@@ -57,9 +57,16 @@ type RowDetailsView struct {
 	okBtn       *tview.Button
 	cancelBtn   *tview.Button
 	showOrigBtn *tview.Button
+	ipInfoBtn   *tview.Button
 	frame       *tview.Frame
 
 	affinity map[string]*rowDetailsFieldAffinity
+
+	// tokenRow and tokenIdx are the table row and the index of the selected
+	// token in its value (as returned by findValueTokens). If no token is
+	// selected, tokenIdx is -1.
+	tokenRow int
+	tokenIdx int
 }
 
 func NewRowDetailsView(
@@ -70,6 +77,8 @@ func NewRowDetailsView(
 		mainView:    mainView,
 		allNamesSet: map[string]struct{}{},
 		affinity:    map[string]*rowDetailsFieldAffinity{},
+
+		tokenIdx: -1,
 	}
 
 	var focusers []tview.Primitive
@@ -122,6 +131,13 @@ func NewRowDetailsView(
 	rdv.tbl.SetBlurFunc(func() {
 		rdv.tbl.SetSelectable(false, false)
 	})
+	rdv.tbl.SetSelectionChangedFunc(func(row, column int) {
+		// Token selection only makes sense within the row.
+		if rdv.tokenIdx >= 0 && row != rdv.tokenRow {
+			rdv.tokenIdx = -1
+			rdv.updateUI()
+		}
+	})
 	rdv.tbl.SetListStyles(menuUnselected, menuSelected)
 
 	if rdvEnableHeader {
@@ -395,6 +411,38 @@ func NewRowDetailsView(
 			cev.Show(SelectQueryField{})
 		}
 
+		// resizeColumn makes the selected column wider (if delta is positive) or
+		// narrower (if negative); if delta is 0, the column is fit to the content
+		// again.
+		resizeColumn := func(delta int) {
+			nRow, _ := rdv.tbl.GetSelection()
+			rCtx := rdv.tbl.GetCell(nRow, 0).GetReference().(rowDetailsViewCellCtx)
+			if rCtx.fieldIdx < 0 {
+				rdv.mainView.printMsg("Only explicit columns can be resized", nlMsgLevelErr)
+				return
+			}
+
+			field := &rdv.sq.Fields[rCtx.fieldIdx]
+			if delta == 0 {
+				field.Width = 0
+			} else {
+				width := field.Width
+				if width == 0 {
+					width = rdv.mainView.colWidths[field.Name]
+				}
+
+				width += delta
+				if width < 1 {
+					width = 1
+				}
+
+				field.Width = width
+			}
+
+			rdv.updateUI()
+			moveCursorAt(rCtx.field.Name)
+		}
+
 		toggleIncludeAll := func() {
 			rdv.sq.IncludeAll = !rdv.sq.IncludeAll
 			rdv.updateUI()
@@ -402,11 +450,82 @@ func NewRowDetailsView(
 
 		getToggleFilterByValue := func(awkExpr string) func() {
 			return func() {
-				rdv.queryFull.Query = addToOrRemoveFromAwkQuery(rdv.queryFull.Query, awkExpr)
+				rdv.queryFull.Query = editBasePattern(rdv.queryFull.Query, func(base string) string {
+					return addToOrRemoveFromAwkQuery(base, awkExpr)
+				})
 				rdv.updateUI()
 			}
 		}
 
+		// moveToken selects the next (if delta is 1) or previous (if -1) token
+		// in the value of the selected field.
+		moveToken := func(delta int) {
+			nRow, _ := rdv.tbl.GetSelection()
+			rCtx := rdv.tbl.GetCell(nRow, 0).GetReference().(rowDetailsViewCellCtx)
+
+			tokens := findValueTokens(rCtx.val)
+			if len(tokens) == 0 {
+				return
+			}
+
+			switch {
+			case rdv.tokenIdx < 0 || rdv.tokenRow != nRow:
+				rdv.tokenRow = nRow
+				if delta > 0 {
+					rdv.tokenIdx = 0
+				} else {
+					rdv.tokenIdx = len(tokens) - 1
+				}
+			case rdv.tokenIdx+delta >= 0 && rdv.tokenIdx+delta < len(tokens):
+				rdv.tokenIdx += delta
+			}
+
+			rdv.updateUI()
+		}
+
+		// getSelectedToken returns the selected token, or an empty string if
+		// there's none.
+		getSelectedToken := func() string {
+			nRow, _ := rdv.tbl.GetSelection()
+			if rdv.tokenIdx < 0 || rdv.tokenRow != nRow {
+				return ""
+			}
+
+			rCtx := rdv.tbl.GetCell(nRow, 0).GetReference().(rowDetailsViewCellCtx)
+			tokens := findValueTokens(rCtx.val)
+			if rdv.tokenIdx >= len(tokens) {
+				return ""
+			}
+
+			return rCtx.val[tokens[rdv.tokenIdx][0]:tokens[rdv.tokenIdx][1]]
+		}
+
+		toggleFilterByToken := func(exclude bool) {
+			token := getSelectedToken()
+			if token == "" {
+				return
+			}
+
+			rdv.queryFull.Query = toggleAwkRegexFilter(
+				rdv.queryFull.Query, awkRegexEscape(token), exclude,
+			)
+			rdv.updateUI()
+		}
+
+		copyToken := func() {
+			token := getSelectedToken()
+			if token == "" {
+				return
+			}
+
+			err := rdv.mainView.copyToClipboard(token, func(copied string) {
+				rdv.mainView.printMsg(fmt.Sprintf("Copied to clipboard: %s", copied), nlMsgLevelInfo)
+			})
+			if err != nil {
+				rdv.mainView.showMessagebox("err", "Error", err.Error(), nil)
+			}
+		}
+
 	ks:
 		switch event.Key() {
 		case tcell.KeyEnter:
@@ -503,6 +622,32 @@ func NewRowDetailsView(
 				toggle()
 
 				return nil
+
+			case 'w':
+				moveToken(1)
+				return nil
+			case 'b':
+				moveToken(-1)
+				return nil
+			case 'y':
+				copyToken()
+				return nil
+			case '+':
+				toggleFilterByToken(false)
+				return nil
+			case '-':
+				toggleFilterByToken(true)
+				return nil
+			case '<':
+				resizeColumn(-1)
+				return nil
+			case '>':
+				resizeColumn(1)
+				return nil
+			case '=':
+				resizeColumn(0)
+				return nil
+
 			default:
 				break ks
 			}
@@ -575,6 +720,25 @@ func NewRowDetailsView(
 			return event
 		})
 		focusers = append(focusers, rdv.showOrigBtn)
+
+		if ips := findLogMsgIPs(params.Msg); len(ips) > 0 && mainView.ipEnricher.enabled() {
+			rdv.ipInfoBtn = tview.NewButton("IP info")
+			rdv.ipInfoBtn.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+				switch event.Key() {
+				case tcell.KeyEnter:
+					rdv.mainView.showIPInfo(ips)
+					return nil
+				}
+
+				event = rdv.genericInputHandler(event, getGenericTabHandler(rdv.ipInfoBtn), nil, nil)
+				if event == nil {
+					return nil
+				}
+
+				return event
+			})
+			focusers = append(focusers, rdv.ipInfoBtn)
+		}
 	}
 
 	bottomFlex := tview.NewFlex().SetDirection(tview.FlexColumn)
@@ -587,8 +751,15 @@ func NewRowDetailsView(
 	if rdv.showOrigBtn != nil {
 		bottomFlex.
 			AddItem(rdv.showOrigBtn, 15, 0, false).
-			AddItem(nil, 0, 1, false)
+			AddItem(nil, 1, 0, false)
+	}
+
+	if rdv.ipInfoBtn != nil {
+		bottomFlex.AddItem(rdv.ipInfoBtn, 9, 0, false)
 	}
+
+	bottomFlex.AddItem(nil, 0, 1, false)
+
 	rdv.flex.AddItem(bottomFlex, 1, 0, false)
 
 	rdv.frame = tview.NewFrame(rdv.flex).SetBorders(0, 0, 0, 0, 0, 0)
@@ -748,6 +919,9 @@ func (rdv *RowDetailsView) updateUI() {
 		if name.field.DisplayName != name.field.Name {
 			nameStr += fmt.Sprintf(" [lightgray::i](%s)[-::-]", name.field.DisplayName)
 		}
+		if name.field.Width > 0 {
+			nameStr += fmt.Sprintf(" [gray::i]width %d[-::-]", name.field.Width)
+		}
 
 		nameCell := newTableCellLogmsg(nameStr).SetAttributes(tcell.AttrBold)
 		if name.idx >= 0 {
@@ -758,10 +932,23 @@ func (rdv *RowDetailsView) updateUI() {
 		rdv.tbl.SetCell(nRow, rdvColIdxName, nameCell)
 
 		valStr := tview.Escape(val)
+		if rdv.tokenIdx >= 0 && rdv.tokenRow == nRow {
+			if tokens := findValueTokens(val); rdv.tokenIdx < len(tokens) {
+				valStr = highlightValueToken(val, tokens[rdv.tokenIdx])
+			}
+		}
 		if filteredByValue {
 			valStr = "🔍 " + valStr
 		}
 
+		// Translate the unix timestamps, if any, since they're unreadable
+		// otherwise; the time field is formatted already.
+		if name.field.Name != FieldNameTime {
+			if ann := epochsAnnotation(val, rdv.mainView.params.Options.GetTimezone()); ann != "" {
+				valStr += " [gray::i](" + tview.Escape(ann) + ")[-::-]"
+			}
+		}
+
 		valueCell = newTableCellLogmsg(valStr)
 		rdv.tbl.SetCell(nRow, rdvColIdxValue, valueCell)
 
@@ -867,14 +1054,7 @@ func awkEscape(s string) string {
 func addToOrRemoveFromAwkQuery(query string, part string) string {
 	if !strings.Contains(query, part) {
 		// Need to add
-		if query == "" {
-			query = part
-		} else {
-			// TODO: it won't work if we have some ||, to handle it correctly we'd
-			// have to parse the awk expression, but for now I'm just ignoring the
-			// issue.
-			query += " && " + part
-		}
+		query = andAwkCond(query, part)
 	} else {
 		// Need to remove
 		if strings.Contains(query, part+" && ") {
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/daemon"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+)
+
+// ConfigScheduledQueries is the config of the queries which the daemon runs
+// on schedule, appending the results to local files, so that it's possible
+// to track some trends without a full monitoring stack.
+type ConfigScheduledQueries struct {
+	ScheduledQueries []ConfigScheduledQuery `yaml:"scheduled_queries"`
+}
+
+type ConfigScheduledQuery struct {
+	// Name is used in the logs and in the default Store path, so it can only
+	// contain letters, digits, "_", "-" and ".".
+	Name string `yaml:"name"`
+
+	// Schedule is a cron-like schedule, like "*/5 * * * *", "@hourly" or
+	// "@every 10m"; see parseCronSchedule.
+	Schedule string `yaml:"schedule"`
+
+	// LStreams, Time and Query are the same as in the UI; Time is relative to
+	// the moment the query runs, like "-5m", and the query might have filter
+	// stages, like "/foo/ | where /bar/".
+	LStreams string `yaml:"lstreams"`
+	Time     string `yaml:"time"`
+	Query    string `yaml:"query"`
+
+	// NumLines, if not zero, is how many of the latest messages to store
+	// together with the counts; by default, only the counts are fetched and
+	// stored.
+	NumLines int `yaml:"num_lines"`
+
+	// Store is the path to the file to append the results to, as JSON lines;
+	// by default it's ~/.local/share/nerdlog/scheduled_queries/<name>.jsonl.
+	Store string `yaml:"store"`
+}
+
+var scheduledQueryNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// scheduledQueryTimeout is how long a scheduled query can take; if there's no
+// response by then, the query is recorded as failed, and the logstreams are
+// reconnected.
+const scheduledQueryTimeout = 10 * time.Minute
+
+func LoadScheduledQueriesConfigFromFile(path string) (*ConfigScheduledQueries, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading config file %s", path)
+	}
+
+	var cfg ConfigScheduledQueries
+	if err := unmarshalConfig(path, data, &cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	names := map[string]struct{}{}
+	for i, sq := range cfg.ScheduledQueries {
+		if !scheduledQueryNameRegex.MatchString(sq.Name) {
+			return nil, errors.Errorf("scheduled query #%d: invalid name %q", i+1, sq.Name)
+		}
+
+		if _, ok := names[sq.Name]; ok {
+			return nil, errors.Errorf("%s: duplicate scheduled query name", sq.Name)
+		}
+		names[sq.Name] = struct{}{}
+
+		cs, err := parseCronSchedule(sq.Schedule)
+		if err != nil {
+			return nil, errors.Annotatef(err, "%s: parsing schedule %q", sq.Name, sq.Schedule)
+		}
+
+		if cs.next(time.Now()).IsZero() {
+			return nil, errors.Errorf("%s: schedule %q never fires", sq.Name, sq.Schedule)
+		}
+
+		if sq.LStreams == "" {
+			return nil, errors.Errorf("%s: lstreams can't be empty", sq.Name)
+		}
+
+		if _, err := ParseFromToRange(time.Local, sq.Time); err != nil {
+			return nil, errors.Annotatef(err, "%s: parsing time %q", sq.Name, sq.Time)
+		}
+
+		if sq.NumLines < 0 {
+			return nil, errors.Errorf("%s: num_lines can't be negative", sq.Name)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// scheduledQueryRecord is what gets appended to the store file, as a single
+// JSON line, every time a scheduled query runs.
+type scheduledQueryRecord struct {
+	// Time is when the query was scheduled to run.
+	Time time.Time `json:"time"`
+
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	NumMsgs     int   `json:"num_msgs"`
+	StageCounts []int `json:"stage_counts,omitempty"`
+
+	// Logs are only stored if ConfigScheduledQuery.NumLines is not zero.
+	Logs []scheduledQueryRecordMsg `json:"logs,omitempty"`
+
+	// Errs is not empty if the query failed or was skipped (e.g. if the
+	// logstreams weren't connected); the counts are meaningless then.
+	Errs []string `json:"errs,omitempty"`
+
+	QueryDurMs int64 `json:"query_dur_ms,omitempty"`
+}
+
+type scheduledQueryRecordMsg struct {
+	Time    time.Time `json:"time"`
+	LStream string    `json:"lstream"`
+	Msg     string    `json:"msg"`
+}
+
+// scheduledQueryRunner runs a single scheduled query, using its own
+// LStreamsManager (so the scheduled queries don't interfere with each other
+// or with the interactive sessions).
+type scheduledQueryRunner struct {
+	sq       ConfigScheduledQuery
+	schedule *cronSchedule
+	store    string
+
+	lsman     daemon.LStreamsManager
+	updatesCh chan core.LStreamsManagerUpdate
+
+	logger *log.Logger
+
+	// curState is the last state received from lsman, or nil if there was
+	// none yet.
+	curState *core.LStreamsManagerState
+
+	// pending is the record for the query in progress, or nil if there's
+	// none; it gets completed and stored once the response comes, or once
+	// pendingTimer fires (see expirePending).
+	pending      *scheduledQueryRecord
+	pendingTimer *time.Timer
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newScheduledQueryRunner(
+	sq ConfigScheduledQuery,
+	homeDir string,
+	newLStreamsManager func(updatesCh chan<- core.LStreamsManagerUpdate, lstreams string) daemon.LStreamsManager,
+	logger *log.Logger,
+) (*scheduledQueryRunner, error) {
+	schedule, err := parseCronSchedule(sq.Schedule)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing schedule")
+	}
+
+	store := sq.Store
+	if store == "" {
+		store = filepath.Join(homeDir, ".local", "share", "nerdlog", "scheduled_queries", sq.Name+".jsonl")
+	}
+
+	updatesCh := make(chan core.LStreamsManagerUpdate, 128)
+
+	return &scheduledQueryRunner{
+		sq:       sq,
+		schedule: schedule,
+		store:    store,
+
+		lsman:     newLStreamsManager(updatesCh, sq.LStreams),
+		updatesCh: updatesCh,
+
+		logger: logger.WithNamespaceAppended(sq.Name),
+		stopCh: make(chan struct{}),
+	}, nil
+}
+
+// start runs the scheduling loop in a separate goroutine, until stop is
+// called.
+func (r *scheduledQueryRunner) start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+// stop stops the scheduling loop, and closes the LStreamsManager.
+func (r *scheduledQueryRunner) stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+
+	if r.pendingTimer != nil {
+		r.pendingTimer.Stop()
+	}
+
+	// The scheduling loop doesn't read the updates anymore, so keep draining
+	// them until the LStreamsManager is done, otherwise it might block.
+	closeLStreamsManager(r.lsman, r.updatesCh)
+}
+
+func (r *scheduledQueryRunner) run() {
+	defer r.wg.Done()
+
+	r.logger.Infof("Scheduled %q, storing results to %s", r.sq.Schedule, r.store)
+
+	for {
+		now := time.Now()
+		next := r.schedule.next(now)
+		if next.IsZero() {
+			r.logger.Errorf("The schedule %q never fires anymore", r.sq.Schedule)
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+
+	loop:
+		for {
+			select {
+			case upd := <-r.updatesCh:
+				r.handleUpdate(upd)
+
+			case <-timer.C:
+				r.runQuery(next)
+				break loop
+
+			case <-r.pendingTimeoutCh():
+				r.expirePending()
+
+			case <-r.stopCh:
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
+
+func (r *scheduledQueryRunner) handleUpdate(upd core.LStreamsManagerUpdate) {
+	switch {
+	case upd.State != nil:
+		r.curState = upd.State
+
+	case upd.LogResp != nil:
+		if r.pending == nil {
+			return
+		}
+
+		rec := r.takePending()
+		r.completeRecord(rec, upd.LogResp)
+		r.storeRecord(rec)
+
+	case upd.BootstrapIssue != nil:
+		r.logger.Errorf("Bootstrap issue on %s: %s", upd.BootstrapIssue.LStreamName, upd.BootstrapIssue.Err)
+
+	case upd.DataRequest != nil:
+		// There's nobody to ask, so just respond with nothing and let the
+		// connection fail; the keys need to be set up so that no passphrases or
+		// passwords are needed.
+		r.logger.Errorf("Can't respond to data request: %s", upd.DataRequest.Message)
+		go func(ch chan<- string) {
+			ch <- ""
+		}(upd.DataRequest.ResponseCh)
+	}
+}
+
+// runQuery starts the query which is scheduled at the given time; if it can't
+// be started, the record with the error is stored right away.
+func (r *scheduledQueryRunner) runQuery(scheduledAt time.Time) {
+	rec := &scheduledQueryRecord{
+		Time: scheduledAt,
+	}
+
+	if r.pending != nil {
+		rec.Errs = append(rec.Errs, "the previous query is still in progress")
+		r.storeRecord(rec)
+		return
+	}
+
+	if r.curState == nil || !r.curState.Connected {
+		rec.Errs = append(rec.Errs, "not connected to all logstreams")
+		r.storeRecord(rec)
+		return
+	}
+
+	// The time was validated when loading the config, so it can't fail here.
+	ftr, _ := ParseFromToRange(time.Local, r.sq.Time)
+
+	rec.From = ftr.From.AbsoluteTime(scheduledAt)
+	rec.To = scheduledAt
+	if !ftr.To.IsZero() {
+		rec.To = ftr.To.AbsoluteTime(scheduledAt)
+	}
+
+	pattern, stages := filterPipelineQuery(r.sq.Query)
+
+	r.pending = rec
+	r.pendingTimer = time.NewTimer(scheduledQueryTimeout)
+	r.lsman.QueryLogs(core.QueryLogsParams{
+		From:   rec.From,
+		To:     rec.To,
+		Query:  pattern,
+		Stages: stages,
+
+		MaxNumLines: r.sq.NumLines,
+		CountOnly:   r.sq.NumLines == 0,
+	})
+}
+
+// pendingTimeoutCh returns the channel which fires when the pending query
+// times out, or nil if there's no pending query.
+func (r *scheduledQueryRunner) pendingTimeoutCh() <-chan time.Time {
+	if r.pendingTimer == nil {
+		return nil
+	}
+
+	return r.pendingTimer.C
+}
+
+// takePending returns the pending record, and forgets it.
+func (r *scheduledQueryRunner) takePending() *scheduledQueryRecord {
+	rec := r.pending
+	r.pending = nil
+
+	if r.pendingTimer != nil {
+		r.pendingTimer.Stop()
+		r.pendingTimer = nil
+	}
+
+	return rec
+}
+
+// expirePending stores the pending record as failed, since the response
+// didn't come in time. The logstreams are reconnected, so that the
+// LStreamsManager forgets the query (and the late response, if any, doesn't
+// get mistaken for the response to the next query), and the hosts which got
+// stuck are connected to again.
+func (r *scheduledQueryRunner) expirePending() {
+	rec := r.takePending()
+	if rec == nil {
+		return
+	}
+
+	rec.Errs = append(rec.Errs, fmt.Sprintf("no response in %s", scheduledQueryTimeout))
+	r.storeRecord(rec)
+
+	r.lsman.Reconnect()
+}
+
+func (r *scheduledQueryRunner) completeRecord(rec *scheduledQueryRecord, resp *core.LogRespTotal) {
+	for _, err := range resp.Errs {
+		rec.Errs = append(rec.Errs, err.Error())
+	}
+
+	rec.NumMsgs = resp.NumMsgsTotal
+	rec.StageCounts = resp.StageCounts
+	rec.QueryDurMs = resp.QueryDur.Milliseconds()
+
+	logs := resp.Logs
+	if len(logs) > r.sq.NumLines {
+		logs = logs[len(logs)-r.sq.NumLines:]
+	}
+
+	for _, msg := range logs {
+		rec.Logs = append(rec.Logs, scheduledQueryRecordMsg{
+			Time:    msg.Time,
+			LStream: msg.Context["lstream"],
+			Msg:     msg.Msg,
+		})
+	}
+}
+
+func (r *scheduledQueryRunner) storeRecord(rec *scheduledQueryRecord) {
+	if len(rec.Errs) > 0 {
+		r.logger.Errorf("Query scheduled at %s failed: %v", rec.Time, rec.Errs)
+	} else {
+		r.logger.Infof("Query scheduled at %s: %d messages", rec.Time, rec.NumMsgs)
+	}
+
+	if err := appendScheduledQueryRecord(r.store, rec); err != nil {
+		r.logger.Errorf("Failed to store the result: %s", err)
+	}
+}
+
+func appendScheduledQueryRecord(path string, rec *scheduledQueryRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Annotatef(err, "creating dir for %s", path)
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Annotatef(err, "opening %s", path)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return errors.Annotatef(err, "writing to %s", path)
+	}
+
+	return nil
+}
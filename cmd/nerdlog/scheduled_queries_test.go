@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/daemon"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeScheduledLStreamsManager struct {
+	daemon.LStreamsManager
+
+	updatesCh chan<- core.LStreamsManagerUpdate
+
+	lstreams      string
+	queries       []core.QueryLogsParams
+	numReconnects int
+
+	closedCh chan struct{}
+}
+
+func (m *fakeScheduledLStreamsManager) QueryLogs(params core.QueryLogsParams) {
+	m.queries = append(m.queries, params)
+}
+
+func (m *fakeScheduledLStreamsManager) Reconnect() {
+	m.numReconnects++
+}
+
+// Close sends more state updates than the updatesCh can hold, like the real
+// LStreamsManager might while disconnecting; Wait returns once they're all
+// sent.
+func (m *fakeScheduledLStreamsManager) Close() {
+	m.closedCh = make(chan struct{})
+
+	go func() {
+		for i := 0; i < 1000; i++ {
+			m.updatesCh <- core.LStreamsManagerUpdate{State: &core.LStreamsManagerState{}}
+		}
+		close(m.closedCh)
+	}()
+}
+
+func (m *fakeScheduledLStreamsManager) Wait() {
+	<-m.closedCh
+}
+
+func TestScheduledQueryRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nerdlog_scheduled_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := filepath.Join(dir, "errors.jsonl")
+
+	lsman := &fakeScheduledLStreamsManager{}
+	r, err := newScheduledQueryRunner(
+		ConfigScheduledQuery{
+			Name:     "errors",
+			Schedule: "*/5 * * * *",
+			LStreams: "myhost-*",
+			Time:     "-5m",
+			Query:    "/error/ | where !/timeout/",
+			Store:    store,
+		},
+		dir,
+		func(updatesCh chan<- core.LStreamsManagerUpdate, lstreams string) daemon.LStreamsManager {
+			lsman.lstreams = lstreams
+			return lsman
+		},
+		log.NewLogger(log.Error),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "myhost-*", lsman.lstreams)
+
+	t1 := time.Date(2025, 3, 12, 10, 5, 0, 0, time.UTC)
+	t2 := time.Date(2025, 3, 12, 10, 10, 0, 0, time.UTC)
+	t3 := time.Date(2025, 3, 12, 10, 15, 0, 0, time.UTC)
+
+	// Not connected yet, so the query is skipped.
+	r.runQuery(t1)
+	assert.Empty(t, lsman.queries)
+
+	r.handleUpdate(core.LStreamsManagerUpdate{
+		State: &core.LStreamsManagerState{Connected: true},
+	})
+
+	r.runQuery(t2)
+	require.Len(t, lsman.queries, 1)
+	assert.Equal(t, core.QueryLogsParams{
+		From:      t2.Add(-5 * time.Minute),
+		To:        t2,
+		Query:     "/error/",
+		Stages:    []string{"!/timeout/"},
+		CountOnly: true,
+	}, lsman.queries[0])
+
+	// The previous query is still in progress, so this one is skipped.
+	r.runQuery(t3)
+	assert.Len(t, lsman.queries, 1)
+
+	r.handleUpdate(core.LStreamsManagerUpdate{
+		LogResp: &core.LogRespTotal{
+			NumMsgsTotal: 10,
+			StageCounts:  []int{10, 7},
+			QueryDur:     1500 * time.Millisecond,
+		},
+	})
+
+	r.handleUpdate(core.LStreamsManagerUpdate{
+		LogResp: &core.LogRespTotal{
+			Errs: []error{errors.Errorf("unexpected response")},
+		},
+	})
+
+	data, err := ioutil.ReadFile(store)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+
+	var recs []scheduledQueryRecord
+	for _, line := range lines {
+		var rec scheduledQueryRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		recs = append(recs, rec)
+	}
+
+	assert.Equal(t, t1, recs[0].Time.UTC())
+	assert.Equal(t, []string{"not connected to all logstreams"}, recs[0].Errs)
+
+	assert.Equal(t, t3, recs[1].Time.UTC())
+	assert.Equal(t, []string{"the previous query is still in progress"}, recs[1].Errs)
+
+	assert.Equal(t, t2, recs[2].Time.UTC())
+	assert.Empty(t, recs[2].Errs)
+	assert.Equal(t, 10, recs[2].NumMsgs)
+	assert.Equal(t, []int{10, 7}, recs[2].StageCounts)
+	assert.Equal(t, int64(1500), recs[2].QueryDurMs)
+}
+
+func TestScheduledQueryRunnerTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nerdlog_scheduled_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := filepath.Join(dir, "errors.jsonl")
+
+	lsman := &fakeScheduledLStreamsManager{}
+	r, err := newScheduledQueryRunner(
+		ConfigScheduledQuery{
+			Name:     "errors",
+			Schedule: "*/5 * * * *",
+			LStreams: "myhost-*",
+			Time:     "-5m",
+			Query:    "/error/",
+			Store:    store,
+		},
+		dir,
+		func(updatesCh chan<- core.LStreamsManagerUpdate, lstreams string) daemon.LStreamsManager {
+			lsman.updatesCh = updatesCh
+			return lsman
+		},
+		log.NewLogger(log.Error),
+	)
+	require.NoError(t, err)
+
+	r.handleUpdate(core.LStreamsManagerUpdate{
+		State: &core.LStreamsManagerState{Connected: true},
+	})
+
+	t1 := time.Date(2025, 3, 12, 10, 5, 0, 0, time.UTC)
+	t2 := time.Date(2025, 3, 12, 10, 10, 0, 0, time.UTC)
+
+	// The response never comes, so the query expires, and the logstreams get
+	// reconnected.
+	r.runQuery(t1)
+	require.NotNil(t, r.pendingTimeoutCh())
+	r.expirePending()
+	assert.Nil(t, r.pendingTimeoutCh())
+	assert.Equal(t, 1, lsman.numReconnects)
+
+	// And the next query isn't skipped.
+	r.runQuery(t2)
+	assert.Len(t, lsman.queries, 2)
+
+	data, err := ioutil.ReadFile(store)
+	require.NoError(t, err)
+
+	var rec scheduledQueryRecord
+	require.NoError(t, json.Unmarshal(data, &rec))
+	assert.Equal(t, t1, rec.Time.UTC())
+	assert.Equal(t, []string{"no response in 10m0s"}, rec.Errs)
+
+	// Stopping doesn't get stuck even though the LStreamsManager sends more
+	// updates while closing.
+	r.start()
+
+	stoppedCh := make(chan struct{})
+	go func() {
+		r.stop()
+		close(stoppedCh)
+	}()
+
+	select {
+	case <-stoppedCh:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("stop got stuck")
+	}
+}
+
+func TestLoadScheduledQueriesConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nerdlog_scheduled_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			yaml: `
+scheduled_queries:
+  - name: errors
+    schedule: "*/5 * * * *"
+    lstreams: "myhost-*"
+    time: "-5m"
+    query: "/error/"
+  - name: daily_logins
+    schedule: "@daily"
+    lstreams: "myhost-*"
+    time: "-24h"
+    query: "/Accepted publickey/"
+    num_lines: 10
+`,
+		},
+		{
+			name: "invalid schedule",
+			yaml: `
+scheduled_queries:
+  - name: errors
+    schedule: "*/5 * * *"
+    lstreams: "myhost-*"
+    time: "-5m"
+`,
+			wantErr: "errors: parsing schedule",
+		},
+		{
+			name: "duplicate name",
+			yaml: `
+scheduled_queries:
+  - name: errors
+    schedule: "@hourly"
+    lstreams: "myhost-*"
+    time: "-1h"
+  - name: errors
+    schedule: "@daily"
+    lstreams: "myhost-*"
+    time: "-1h"
+`,
+			wantErr: "duplicate",
+		},
+		{
+			name: "invalid name",
+			yaml: `
+scheduled_queries:
+  - name: "../errors"
+    schedule: "@hourly"
+    lstreams: "myhost-*"
+    time: "-1h"
+`,
+			wantErr: "invalid name",
+		},
+		{
+			name: "unknown field",
+			yaml: `
+scheduled_queries:
+  - name: errors
+    schedule: "@hourly"
+    lstreams: "myhost-*"
+    time: "-1h"
+    interval: 5m
+`,
+			wantErr: "interval",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "scheduled_queries.yaml")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tt.yaml), 0600))
+
+			cfg, err := LoadScheduledQueriesConfigFromFile(path)
+			if tt.wantErr != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.wantErr)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, cfg.ScheduledQueries, 2)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const msgIDCopySecrets = "copy_secrets"
+
+// secretDetector is a regex matching some obvious kind of secret, which
+// hopefully doesn't have many false positives.
+type secretDetector struct {
+	kind  string
+	regex *regexp.Regexp
+}
+
+var secretDetectors = []secretDetector{
+	{
+		kind:  "AWS access key",
+		regex: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	},
+	{
+		kind:  "AWS secret key",
+		regex: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key\W{1,4}[A-Za-z0-9/+]{40}\b`),
+	},
+	{
+		kind:  "bearer token",
+		regex: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{16,}=*`),
+	},
+	{
+		kind:  "private key",
+		regex: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----`),
+	},
+	{
+		kind:  "GitHub token",
+		regex: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	},
+	{
+		kind:  "Slack token",
+		regex: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	},
+}
+
+// detectSecrets returns the kinds of secrets found in the string, in the
+// order of secretDetectors; nil if there are none.
+func detectSecrets(s string) []string {
+	var kinds []string
+	for _, d := range secretDetectors {
+		if d.regex.MatchString(s) {
+			kinds = append(kinds, d.kind)
+		}
+	}
+
+	return kinds
+}
+
+// maskSecrets replaces all the secrets found in the string with "<secret>".
+func maskSecrets(s string) string {
+	for _, d := range secretDetectors {
+		s = d.regex.ReplaceAllString(s, "<secret>")
+	}
+
+	return s
+}
+
+// confirmCopySecrets checks whether the text which is about to leave nerdlog
+// (be copied to the clipboard, or sent to an external command or service)
+// contains any secrets, and if so, asks the user what to do; onConfirmed is
+// then called with the text to use (either the same or with the secrets
+// masked). If there are no secrets, onConfirmed is called right away, and if
+// the user cancels, it's not called at all.
+func (mv *MainView) confirmCopySecrets(text string, onConfirmed func(text string)) {
+	if !mv.params.Options.GetDetectSecrets() {
+		onConfirmed(text)
+		return
+	}
+
+	kinds := detectSecrets(text)
+	if len(kinds) == 0 {
+		onConfirmed(text)
+		return
+	}
+
+	var msgv *MessageView
+	msgv = mv.showMessagebox(
+		msgIDCopySecrets,
+		"Secrets detected",
+		fmt.Sprintf(
+			"The text which is about to leave nerdlog looks like it contains secrets: %s.\n\nUse it anyway?",
+			strings.Join(kinds, ", "),
+		),
+		&MessageboxParams{
+			Buttons:      []string{"&Mask secrets", "Use &anyway", "&Cancel"},
+			CancelButton: "Cancel",
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+
+				switch label {
+				case "Mask secrets":
+					onConfirmed(maskSecrets(text))
+				case "Use anyway":
+					onConfirmed(text)
+				}
+			},
+			Width: 70,
+		},
+	)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/juju/errors"
@@ -39,6 +40,10 @@ type SelectQueryField struct {
 
 	// If Sticky is true, the column will always be visible.
 	Sticky bool
+
+	// Width, if not zero, is the width of the column; longer values are cut
+	// off. If zero, the column is as wide as the longest value in it.
+	Width int
 }
 
 func ParseSelectQuery(sq SelectQuery) (*SelectQueryParsed, error) {
@@ -78,6 +83,7 @@ func ParseSelectQuery(sq SelectQuery) (*SelectQueryParsed, error) {
 		const (
 			stateRoot = iota
 			stateWaitDisplayName
+			stateWaitWidth
 		)
 
 		state := stateRoot
@@ -99,6 +105,13 @@ func ParseSelectQuery(sq SelectQuery) (*SelectQueryParsed, error) {
 
 					field.Sticky = true
 					continue
+				case "width":
+					if field.Width != 0 {
+						return nil, errors.Errorf("syntax error for field %s: more than a single 'WIDTH'", field.Name)
+					}
+
+					state = stateWaitWidth
+					continue
 				default:
 					return nil, errors.Errorf("syntax error for field %s", field.Name)
 				}
@@ -106,6 +119,15 @@ func ParseSelectQuery(sq SelectQuery) (*SelectQueryParsed, error) {
 			case stateWaitDisplayName:
 				field.DisplayName = token
 				state = stateRoot
+
+			case stateWaitWidth:
+				width, err := strconv.Atoi(token)
+				if err != nil || width <= 0 {
+					return nil, errors.Errorf("invalid width for field %s: %q", field.Name, token)
+				}
+
+				field.Width = width
+				state = stateRoot
 			}
 		}
 
@@ -142,6 +164,10 @@ func (sqp *SelectQueryParsed) Marshal() SelectQuery {
 			v += " STICKY"
 		}
 
+		if fld.Width > 0 {
+			v += " WIDTH " + strconv.Itoa(fld.Width)
+		}
+
 		add(i, v)
 		n = i
 	}
@@ -148,6 +148,33 @@ func TestSelectQuery(t *testing.T) {
 			},
 		}, // }}}
 
+		testCase{descr: "column widths", // {{{
+			str:            "time STICKY, message, lstream as host width 12, *",
+			strRemarshaled: "time STICKY, message, lstream AS host WIDTH 12, *",
+			wantParsed: &SelectQueryParsed{
+				Fields: []SelectQueryField{
+					SelectQueryField{
+						Name:        "time",
+						DisplayName: "time",
+						Sticky:      true,
+					},
+					SelectQueryField{
+						Name:        "message",
+						DisplayName: "message",
+					},
+					SelectQueryField{
+						Name:        "lstream",
+						DisplayName: "host",
+						Width:       12,
+					},
+				},
+				IncludeAll: true,
+			},
+		}, // }}}
+		testCase{descr: "invalid width: error", // {{{
+			str:     "time STICKY, message, lstream WIDTH 0",
+			wantErr: `invalid width for field lstream: "0"`,
+		}, // }}}
 		testCase{descr: "wildcard as a non-last item: error", // {{{
 			str:     "time STICKY, message, lstream, level_name AS lvl, *, redacted_id_int AS ds",
 			wantErr: "wildcard can only be the last item",
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// TransactionRule groups the log messages into transactions: a transaction
+// starts with a message matching Begin, ends with a message matching End,
+// and contains all the messages with the same key in between (from the same
+// logstream).
+type TransactionRule struct {
+	Name  string
+	Begin *regexp.Regexp
+	End   *regexp.Regexp
+
+	// Key, if not nil, extracts the transaction key from a message: the first
+	// submatch, or the whole match if there are no submatches. Messages
+	// without the key don't belong to any transaction. If Key is nil, there
+	// can only be one transaction at a time in every logstream, and it contains
+	// all the messages between Begin and End.
+	Key *regexp.Regexp
+}
+
+func (rule *TransactionRule) key(msg string) (string, bool) {
+	if rule.Key == nil {
+		return "", true
+	}
+
+	m := rule.Key.FindStringSubmatch(msg)
+	if m == nil {
+		return "", false
+	}
+
+	if len(m) > 1 {
+		return m[1], true
+	}
+
+	return m[0], true
+}
+
+// ConfigTransactionRules is the config with the transaction rules, which can
+// then be enabled with the "transactions" option.
+type ConfigTransactionRules struct {
+	TransactionRules []ConfigTransactionRule `yaml:"transaction_rules"`
+}
+
+type ConfigTransactionRule struct {
+	Name  string `yaml:"name"`
+	Begin string `yaml:"begin"`
+	End   string `yaml:"end"`
+	Key   string `yaml:"key"`
+}
+
+func LoadTransactionRulesConfigFromFile(path string) ([]TransactionRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading config file %s", path)
+	}
+
+	var cfg ConfigTransactionRules
+	if err := unmarshalConfig(path, data, &cfg); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	ret := make([]TransactionRule, 0, len(cfg.TransactionRules))
+	for i, cr := range cfg.TransactionRules {
+		if cr.Name == "" || strings.ContainsAny(cr.Name, ", ") {
+			return nil, errors.Errorf("transaction rule #%d: invalid name %q", i+1, cr.Name)
+		}
+
+		if cr.Begin == "" || cr.End == "" {
+			return nil, errors.Errorf("%s: both begin and end are required", cr.Name)
+		}
+
+		rule := TransactionRule{
+			Name: cr.Name,
+		}
+
+		if rule.Begin, err = regexp.Compile(cr.Begin); err != nil {
+			return nil, errors.Annotatef(err, "%s: compiling begin", cr.Name)
+		}
+
+		if rule.End, err = regexp.Compile(cr.End); err != nil {
+			return nil, errors.Annotatef(err, "%s: compiling end", cr.Name)
+		}
+
+		if cr.Key != "" {
+			if rule.Key, err = regexp.Compile(cr.Key); err != nil {
+				return nil, errors.Annotatef(err, "%s: compiling key", cr.Name)
+			}
+		}
+
+		ret = append(ret, rule)
+	}
+
+	return ret, nil
+}
+
+// findTransactionRules returns the rules with the given names.
+func findTransactionRules(names []string, rules []TransactionRule) ([]TransactionRule, error) {
+	ret := make([]TransactionRule, 0, len(names))
+
+	for _, name := range names {
+		found := false
+		for _, rule := range rules {
+			if rule.Name == name {
+				ret = append(ret, rule)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, errors.Errorf(
+				"unknown transaction rule %q; available ones (from the config): %s",
+				name, strings.Join(transactionRuleNames(rules), ", "),
+			)
+		}
+	}
+
+	return ret, nil
+}
+
+func transactionRuleNames(rules []TransactionRule) []string {
+	names := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// logTransaction is a group of messages found by a TransactionRule.
+type logTransaction struct {
+	// id uniquely identifies the transaction among the current logs, so it
+	// can be remembered whether it's expanded.
+	id string
+
+	// msgIdxs are the indices of the messages in the logs, in order; the first
+	// one is the beginning of the transaction.
+	msgIdxs []int
+
+	// complete is true if the end of the transaction was found.
+	complete bool
+
+	// dur is the time between the first and the last messages.
+	dur time.Duration
+}
+
+func (txn *logTransaction) summary() string {
+	numLines := fmt.Sprintf("%d lines", len(txn.msgIdxs))
+	if len(txn.msgIdxs) == 1 {
+		numLines = "1 line"
+	}
+
+	if !txn.complete {
+		return fmt.Sprintf("[%s, no end]", numLines)
+	}
+
+	return fmt.Sprintf("[%s, %s]", numLines, txn.dur)
+}
+
+// groupTransactions finds the transactions in the logs, which must be sorted
+// by time. The returned slice has an item for every message: the transaction
+// it belongs to, or nil. Messages of different logstreams never belong to
+// the same transaction.
+func groupTransactions(logs []core.LogMsg, rules []TransactionRule) []*logTransaction {
+	ret := make([]*logTransaction, len(logs))
+	if len(rules) == 0 {
+		return ret
+	}
+
+	// open is a map from the rule name, logstream and key to the transaction
+	// which has begun but hasn't ended yet.
+	open := map[string]*logTransaction{}
+
+	for i, msg := range logs {
+		for ri := range rules {
+			rule := &rules[ri]
+
+			key, ok := rule.key(msg.Msg)
+			if !ok {
+				continue
+			}
+
+			openKey := strings.Join([]string{rule.Name, msg.Context["lstream"], key}, "\x00")
+			txn := open[openKey]
+
+			if rule.Begin.MatchString(msg.Msg) {
+				// If the previous one with the same key hasn't ended, it stays
+				// incomplete, and the new one begins.
+				txn = &logTransaction{
+					id: fmt.Sprintf("%s\x00%d", openKey, msg.Time.UnixNano()),
+				}
+				open[openKey] = txn
+			}
+
+			if txn == nil {
+				continue
+			}
+
+			txn.msgIdxs = append(txn.msgIdxs, i)
+			txn.dur = msg.Time.Sub(logs[txn.msgIdxs[0]].Time)
+			ret[i] = txn
+
+			if len(txn.msgIdxs) > 1 && rule.End.MatchString(msg.Msg) {
+				txn.complete = true
+				delete(open, openKey)
+			}
+
+			// A message can only belong to a single transaction.
+			break
+		}
+	}
+
+	return ret
+}
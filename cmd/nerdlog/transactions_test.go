@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupTransactions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nerdlog_transactions_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "transaction_rules.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+transaction_rules:
+  - name: http
+    begin: 'request started'
+    end: 'request finished'
+    key: 'req=([0-9a-f]+)'
+`), 0600))
+
+	rules, err := LoadTransactionRulesConfigFromFile(path)
+	require.NoError(t, err)
+
+	t0 := time.Date(2025, 3, 11, 10, 0, 0, 0, time.UTC)
+	newMsg := func(secs int, lstream, msg string) core.LogMsg {
+		return core.LogMsg{
+			Time:    t0.Add(time.Duration(secs) * time.Second),
+			Msg:     msg,
+			Context: map[string]string{"lstream": lstream},
+		}
+	}
+
+	logs := []core.LogMsg{
+		newMsg(0, "host1", "req=a1 request started"),
+		newMsg(1, "host1", "req=b2 request started"),
+		newMsg(1, "host1", "unrelated"),
+		newMsg(2, "host2", "req=a1 querying db"),
+		newMsg(3, "host1", "req=a1 querying db"),
+		newMsg(5, "host1", "req=a1 request finished"),
+		newMsg(6, "host1", "req=b2 still going"),
+	}
+
+	txns := groupTransactions(logs, rules)
+	require.Len(t, txns, len(logs))
+
+	// Different keys and different logstreams are different transactions.
+	a1, b2 := txns[0], txns[1]
+	assert.Equal(t, []int{0, 4, 5}, a1.msgIdxs)
+	assert.Equal(t, "[3 lines, 5s]", a1.summary())
+	assert.Equal(t, []int{1, 6}, b2.msgIdxs)
+	assert.Equal(t, "[2 lines, no end]", b2.summary())
+
+	assert.Nil(t, txns[2])
+	assert.Nil(t, txns[3])
+
+	assert.Len(t, groupTransactions(logs, nil), len(logs))
+
+	_, err = findTransactionRules([]string{"foo"}, rules)
+	assert.EqualError(t, err, `unknown transaction rule "foo"; available ones (from the config): http`)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+transaction_rules:
+  - name: http
+    begin: 'request started'
+`), 0600))
+
+	_, err = LoadTransactionRulesConfigFromFile(path)
+	assert.Error(t, err)
+}
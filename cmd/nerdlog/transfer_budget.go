@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dimonomid/nerdlog/core"
+)
+
+const msgIDTransferBudget = "transfer_budget"
+
+// handleTransferBudgetExceeded is called when the last query would have
+// fetched more logs than the transferbudget option allows, so only the
+// histogram was fetched. It asks the user whether to fetch the logs anyway,
+// fetch only a sample which fits in the budget, or narrow down the query.
+func (app *nerdlogApp) handleTransferBudgetExceeded(resp *core.LogRespTotal) {
+	if app.isReadOnly() {
+		// The client in control of the session will decide what to do.
+		return
+	}
+
+	qp := app.lastQueryParams
+
+	// Assuming the lines are more or less of the same size, figure how many of
+	// them would fit in the budget.
+	sampleNumLines := 1
+	if resp.TransferBytes > 0 {
+		sampleNumLines = int(int64(qp.MaxNumLines) * int64(qp.MaxTransferBytes) / int64(resp.TransferBytes))
+	}
+	if sampleNumLines < 1 {
+		sampleNumLines = 1
+	}
+
+	text := fmt.Sprintf(
+		"The logs for this query would take about %s, which exceeds the transfer budget of %s (see :set transferbudget), so only the timeline histogram was fetched.\n\n"+
+			"Fetch: fetch the logs anyway (up to %d messages per logstream)\n"+
+			"Sample: fetch only the latest %d messages per logstream, to fit in the budget\n"+
+			"Narrow: edit the query to narrow down the time range or the pattern",
+		formatByteSize(resp.TransferBytes), formatByteSize(qp.MaxTransferBytes),
+		qp.MaxNumLines, sampleNumLines,
+	)
+
+	var msgv *MessageView
+	msgv = app.mainView.showMessagebox(
+		msgIDTransferBudget,
+		"Transfer budget exceeded",
+		text,
+		&MessageboxParams{
+			Buttons:      []string{"&Fetch", "&Sample", "&Narrow", "&Cancel"},
+			CancelButton: "Cancel",
+			OnButtonPressed: func(label string, idx int) {
+				msgv.Hide()
+
+				switch label {
+				case "Fetch":
+					app.mainView.doQuery(doQueryParams{
+						dontAddHistoryItem:   true,
+						maxNumLines:          qp.MaxNumLines,
+						ignoreTransferBudget: true,
+					})
+				case "Sample":
+					app.mainView.doQuery(doQueryParams{
+						dontAddHistoryItem:   true,
+						maxNumLines:          sampleNumLines,
+						ignoreTransferBudget: true,
+					})
+				case "Narrow":
+					app.mainView.openQueryEditView()
+				}
+			},
+
+			Width: 80,
+		},
+	)
+}
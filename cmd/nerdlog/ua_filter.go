@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// accessLogUAFieldPrefix is the awk regexp which matches the Combined Log
+// Format line up to the beginning of the user agent: the end of the request
+// line, status, size, referer, and the opening quote of the user agent. So
+// the tokens are only looked for in the user agent, and not e.g. in the
+// request path.
+const accessLogUAFieldPrefix = `" [0-9]+ [^ ]+ "[^"]*" "[^"]*`
+
+// userAgentClassesFilterPattern returns the awk pattern which matches the
+// access log lines with the user agents of any of the given classes (or,
+// if exclude is true, all the other lines), as classified by
+// core.ClassifyUserAgent.
+func userAgentClassesFilterPattern(classes []core.UserAgentClass, exclude bool) string {
+	parts := make([]string, 0, len(classes))
+	for _, class := range classes {
+		tokens, preceding := core.UserAgentClassTokens(class)
+
+		part := uaTokensAwkRegex(tokens)
+		if len(preceding) > 0 {
+			part = "(" + part + " && !" + uaTokensAwkRegex(preceding) + ")"
+		}
+
+		parts = append(parts, part)
+	}
+
+	pattern := strings.Join(parts, " || ")
+	if len(parts) > 1 || exclude {
+		pattern = "(" + pattern + ")"
+	}
+
+	if exclude {
+		pattern = "!" + pattern
+	}
+
+	return pattern
+}
+
+func uaTokensAwkRegex(tokens []string) string {
+	escaped := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		escaped = append(escaped, awkRegexEscape(token))
+	}
+
+	return "/" + accessLogUAFieldPrefix + "(" + strings.Join(escaped, "|") + ")/"
+}
+
+// parseUserAgentClasses parses the comma-separated classes, like
+// "bot,monitor"; if it starts with "!", then exclude is true.
+func parseUserAgentClasses(s string) (classes []core.UserAgentClass, exclude bool, err error) {
+	if strings.HasPrefix(s, "!") {
+		exclude = true
+		s = s[1:]
+	}
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, class := range core.AllUserAgentClasses {
+			if string(class) == name {
+				classes = append(classes, class)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, false, errors.Errorf(
+				"unknown user agent class %q; available ones: %s",
+				name, userAgentClassNames(),
+			)
+		}
+	}
+
+	if len(classes) == 0 {
+		return nil, false, errors.Errorf("no user agent classes given; available ones: %s", userAgentClassNames())
+	}
+
+	return classes, exclude, nil
+}
+
+func userAgentClassNames() string {
+	names := make([]string, 0, len(core.AllUserAgentClasses))
+	for _, class := range core.AllUserAgentClasses {
+		names = append(names, string(class))
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserAgentClassesFilterPattern(t *testing.T) {
+	monitor := uaTokensAwkRegex([]string{"kube-probe/"})
+	assert.True(t, strings.HasPrefix(userAgentClassesFilterPattern([]core.UserAgentClass{core.UserAgentClassMonitor}, false), "/"))
+
+	pattern := userAgentClassesFilterPattern(
+		[]core.UserAgentClass{core.UserAgentClassMonitor, core.UserAgentClassBot}, true,
+	)
+	assert.True(t, strings.HasPrefix(pattern, "!(/"), pattern)
+	assert.Contains(t, pattern, " || (/")
+	assert.Contains(t, pattern, " && !/")
+
+	// The regexps are simple enough to be checked with Go regexp too.
+	re := regexp.MustCompile(strings.Trim(monitor, "/"))
+
+	assert.True(t, re.MatchString(
+		`10.0.0.1 - - [05/Mar/2025:10:07:46 +0000] "GET /healthz HTTP/1.1" 200 2 "-" "kube-probe/1.29"`,
+	))
+	assert.False(t, re.MatchString(
+		`10.0.0.1 - - [05/Mar/2025:10:07:46 +0000] "GET /kube-probe/ HTTP/1.1" 200 2 "-" "curl/8.5.0"`,
+	))
+}
+
+func TestParseUserAgentClasses(t *testing.T) {
+	classes, exclude, err := parseUserAgentClasses("bot, monitor")
+	assert.NoError(t, err)
+	assert.False(t, exclude)
+	assert.Equal(t, []core.UserAgentClass{core.UserAgentClassBot, core.UserAgentClassMonitor}, classes)
+
+	classes, exclude, err = parseUserAgentClasses("!tool")
+	assert.NoError(t, err)
+	assert.True(t, exclude)
+	assert.Equal(t, []core.UserAgentClass{core.UserAgentClassTool}, classes)
+
+	_, _, err = parseUserAgentClasses("robots")
+	assert.Error(t, err)
+
+	_, _, err = parseUserAgentClasses("!")
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// AuthKind is the kind of the credentials requested by AuthRequest.
+type AuthKind string
+
+const (
+	// AuthKindPassphrase is the passphrase to decrypt the private ssh key.
+	AuthKindPassphrase AuthKind = "passphrase"
+
+	// AuthKindPassword is the password for the ssh password auth; only
+	// requested if ShellTransportSSHParams.AllowPasswordAuth is set, and same
+	// for AuthKindKeyboardInteractive.
+	AuthKindPassword AuthKind = "password"
+
+	// AuthKindKeyboardInteractive is the answer to the question asked by the
+	// ssh server in the keyboard-interactive auth (like a one-time code).
+	AuthKindKeyboardInteractive AuthKind = "keyboard-interactive"
+)
+
+// AuthRequest describes the credentials needed to connect to a host.
+type AuthRequest struct {
+	Kind AuthKind
+
+	// User and Addr (like "myhost.com:22") specify the host being connected
+	// to; they're empty for AuthKindPassphrase, since the key is shared
+	// between all the hosts.
+	User string
+	Addr string
+
+	// KeyPath is the path to the private key; only set for
+	// AuthKindPassphrase.
+	KeyPath string
+
+	// Prompt is the human-readable prompt; for AuthKindKeyboardInteractive,
+	// it's the question asked by the server.
+	Prompt string
+
+	// Echo is only used for AuthKindKeyboardInteractive: if it's false, the
+	// answer is a secret which shouldn't be shown while typing.
+	Echo bool
+}
+
+// AuthCallback supplies the credentials programmatically, so that nerdlog core
+// can be embedded in other tools which aren't limited to the interactive
+// prompts (ShellConnDataRequest).
+//
+// The callback is called from the connection goroutines, possibly
+// concurrently. If it returns ErrAuthNotHandled, the credentials are requested
+// from the user with ShellConnDataRequest as usual; any other error fails the
+// auth.
+type AuthCallback func(req AuthRequest) (string, error)
+
+// ErrAuthNotHandled is returned by AuthCallback if it doesn't have the
+// requested credentials.
+var ErrAuthNotHandled = errors.New("auth request not handled")
+
+// NewAuthHelperCallback returns the AuthCallback which runs the given shell
+// command (the "auth helper") to get the credentials, like
+// "pass show ssh/$NERDLOG_AUTH_KIND". The request is passed to the command in
+// the env vars NERDLOG_AUTH_KIND, NERDLOG_AUTH_USER, NERDLOG_AUTH_ADDR,
+// NERDLOG_AUTH_KEY_PATH and NERDLOG_AUTH_PROMPT, and the command should print
+// the credentials to stdout; if it prints nothing, the request is considered
+// not handled.
+func NewAuthHelperCallback(command string) AuthCallback {
+	return func(req AuthRequest) (string, error) {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(
+			os.Environ(),
+			"NERDLOG_AUTH_KIND="+string(req.Kind),
+			"NERDLOG_AUTH_USER="+req.User,
+			"NERDLOG_AUTH_ADDR="+req.Addr,
+			"NERDLOG_AUTH_KEY_PATH="+req.KeyPath,
+			"NERDLOG_AUTH_PROMPT="+req.Prompt,
+		)
+
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", errors.Annotatef(err, "running auth helper: %s", msg)
+			}
+
+			return "", errors.Annotatef(err, "running auth helper")
+		}
+
+		// Only the trailing newline is dropped: the spaces might be a part of
+		// the password.
+		data := strings.TrimSuffix(stdout.String(), "\n")
+		data = strings.TrimSuffix(data, "\r")
+		if data == "" {
+			return "", ErrAuthNotHandled
+		}
+
+		return data, nil
+	}
+}
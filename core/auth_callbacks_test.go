@@ -0,0 +1,77 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthHelperCallback(t *testing.T) {
+	cb := NewAuthHelperCallback(`echo "$NERDLOG_AUTH_KIND $NERDLOG_AUTH_USER@$NERDLOG_AUTH_ADDR $NERDLOG_AUTH_PROMPT"`)
+	data, err := cb(AuthRequest{
+		Kind:   AuthKindPassword,
+		User:   "user",
+		Addr:   "myhost:22",
+		Prompt: "Password?",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "password user@myhost:22 Password?", data)
+
+	// Only the trailing newline is trimmed.
+	cb = NewAuthHelperCallback(`printf ' secret \n'`)
+	data, err = cb(AuthRequest{Kind: AuthKindPassphrase, KeyPath: "/tmp/key"})
+	require.NoError(t, err)
+	assert.Equal(t, " secret ", data)
+
+	cb = NewAuthHelperCallback(`true`)
+	_, err = cb(AuthRequest{Kind: AuthKindPassphrase})
+	assert.Equal(t, ErrAuthNotHandled, errors.Cause(err))
+
+	cb = NewAuthHelperCallback(`echo "no such secret" >&2; exit 1`)
+	_, err = cb(AuthRequest{Kind: AuthKindPassphrase})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such secret")
+}
+
+func TestShellTransportSSHGetAuthData(t *testing.T) {
+	req := AuthRequest{Kind: AuthKindPassword, User: "user", Addr: "myhost:22"}
+
+	// The callback handles the request, so there's no data request.
+	st := NewShellTransportSSH(ShellTransportSSHParams{
+		AuthCallback: func(req AuthRequest) (string, error) {
+			return "secret-for-" + req.User, nil
+		},
+	})
+	resCh := make(chan ShellConnUpdate, 1)
+	data, err := st.getAuthData(resCh, req, "Title", "Message")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-for-user", data)
+	assert.Len(t, resCh, 0)
+
+	// The callback doesn't handle the request, so the data is requested from
+	// the user.
+	st = NewShellTransportSSH(ShellTransportSSHParams{
+		AuthCallback: func(req AuthRequest) (string, error) {
+			return "", ErrAuthNotHandled
+		},
+	})
+	go func() {
+		upd := <-resCh
+		assert.Equal(t, "Title", upd.DataRequest.Title)
+		upd.DataRequest.ResponseCh <- "typed"
+	}()
+	data, err = st.getAuthData(resCh, req, "Title", "Message")
+	require.NoError(t, err)
+	assert.Equal(t, "typed", data)
+
+	// The callback fails, so does the auth.
+	st = NewShellTransportSSH(ShellTransportSSHParams{
+		AuthCallback: func(req AuthRequest) (string, error) {
+			return "", errors.New("vault is sealed")
+		},
+	})
+	_, err = st.getAuthData(resCh, req, "Title", "Message")
+	assert.Error(t, err)
+}
@@ -1,6 +1,11 @@
 package core
 
-import "sort"
+import (
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+)
 
 type ConfigLogStreams map[string]ConfigLogStream
 
@@ -50,6 +55,31 @@ type ConfigLogStreamOptions struct {
 	// custom env vars for tests, like: "export TZ=America/New_York", but
 	// might be useful outside of tests as well.
 	ShellInit []string `yaml:"shell_init"`
+
+	// NativeScan only matters for localhost: if true, the log files are
+	// scanned natively by nerdlog itself instead of running the agent script in
+	// a local shell. It's always the case on Windows, but can be useful on
+	// other systems too, e.g. if gawk isn't installed locally. See
+	// ShellTransportNative for details.
+	NativeScan bool `yaml:"native_scan"`
+
+	// Nice, if non-zero, makes the agent script run under "nice -n <Nice>", so
+	// that heavy queries don't starve the production workloads on the host.
+	Nice int `yaml:"nice"`
+
+	// IONice, if non-empty, makes the agent script run under "ionice" (only
+	// available on Linux) with the given scheduling class: "idle",
+	// "best-effort", or "best-effort:<level>" where level is from 0 to 7.
+	IONice string `yaml:"ionice"`
+
+	// Timeout, if non-empty, is a duration like "5m": the agent script is run
+	// under "timeout", so the queries taking longer than that are killed.
+	Timeout string `yaml:"timeout"`
+
+	// DisplayName, if non-empty, is shown in the UI instead of the logstream
+	// name, like "web1" instead of "web1.prod.example.com"; it doesn't affect
+	// anything else.
+	DisplayName string `yaml:"display_name"`
 }
 
 func (lss ConfigLogStreams) Keys() []string {
@@ -63,6 +93,24 @@ func (lss ConfigLogStreams) Keys() []string {
 	return keys
 }
 
+// ParseTimeout parses the Timeout; if it's empty, returns zero.
+func (opts ConfigLogStreamOptions) ParseTimeout() (time.Duration, error) {
+	if opts.Timeout == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(opts.Timeout)
+	if err != nil {
+		return 0, errors.Annotatef(err, "invalid timeout")
+	}
+
+	if timeout <= 0 {
+		return 0, errors.Errorf("invalid timeout %q: must be positive", opts.Timeout)
+	}
+
+	return timeout, nil
+}
+
 // EffectiveSudoMode returns the SudoMode considering all fields that can
 // affect it: Sudo and SudoMode.
 func (opts ConfigLogStreamOptions) EffectiveSudoMode() SudoMode {
@@ -26,10 +26,78 @@ type QueryLogsParams struct {
 	// this browser-like history back and forth)
 	DontAddHistoryItem bool
 
+	// If Follow is true, it's the same query repeated in the follow mode, just
+	// to get the new logs; such queries aren't added to any history.
+	Follow bool
+
 	// If RefreshIndex is true, we'll drop the index file for all logstreams, and
 	// rebuild it from scratch (no-op for journalctl logstreams, because there's
 	// no nerdlog-maintained index for journalctl).
 	RefreshIndex bool
+
+	// MaxTransferBytes, if not zero, is the budget for the log lines fetched by
+	// this query from all logstreams together. It's split evenly among the
+	// logstreams, and if any of them would exceed its share, no logs are
+	// fetched (only the histogram), and the response has
+	// TransferBudgetExceeded set.
+	MaxTransferBytes int
+
+	// If LevelStats is true, MinuteStats in the response will also have
+	// NumErrors and NumWarnings populated. It makes the query somewhat slower,
+	// since the agent has to guess the level of every matching line.
+	LevelStats bool
+
+	// CacheTTL, if not zero, makes the agent cache the result of the query on
+	// the host for that long (only for log files, not journalctl), so that
+	// re-running the identical query doesn't scan the logs again.
+	CacheTTL time.Duration
+
+	// Stages, if not empty, are the extra awk patterns which narrow down the
+	// Query one after another, and the response then has the number of
+	// messages left after the Query and after every stage in StageCounts.
+	Stages []string
+
+	// If CountOnly is true, the agent only returns MinuteStats (and StageCounts
+	// if needed), but no log lines at all; MaxNumLines is ignored then. Useful
+	// to quickly check how many messages there are over a large time range,
+	// without transferring any message bodies.
+	CountOnly bool
+
+	// Ranges, if not empty, are the disjoint time windows to look at, like
+	// "09:00 to 09:15" and "13:00 to 13:15" (From and To should then cover all
+	// of them): the messages outside of all the Ranges are ignored, as if they
+	// didn't exist. All of them are still scanned in a single agent invocation.
+	Ranges []TimeRange
+
+	// GapThreshold, if not zero, makes the agent also count all the lines in
+	// every minute, regardless of the Query, and then the response has Gaps:
+	// the periods of at least that long when a logstream had no lines at all.
+	GapThreshold time.Duration
+
+	// If ActivityStats is true, the agent also counts all the lines in every
+	// minute, regardless of the Query, and the response then has ActivityStats.
+	// GapThreshold implies that as well.
+	ActivityStats bool
+
+	// MaxLStreamRate, if not zero, is how many messages per second every
+	// logstream can have at most in the response: the rest are dropped and
+	// counted in LogRespTotal.Throttled, so that an extremely chatty logstream
+	// can't drown out the others.
+	MaxLStreamRate int
+
+	// If Streaming is true, the response only contains the logs which weren't
+	// returned by the previous responses to the same query (continued with
+	// LoadEarlier), and the returned logs are forgotten, so that all the logs in
+	// the time range can be loaded page by page without keeping them all in
+	// memory; MaxLStreamRate is ignored then. See Session.StreamLogs.
+	Streaming bool
+}
+
+// TimeRange is a time window; the To is exclusive, and can be zero for the
+// latest window, meaning "until now".
+type TimeRange struct {
+	From time.Time
+	To   time.Time
 }
 
 // LogResp is a log response from a single logstream
@@ -44,6 +112,27 @@ type LogResp struct {
 	// included in MinuteStats). This number is usually larger than len(Logs).
 	NumMsgsTotal int
 
+	// TransferBytes is how many bytes the log lines took, as printed by the
+	// nerdlog_agent.sh; or, if TransferBudgetExceeded is true, how many bytes
+	// they would take.
+	TransferBytes int
+
+	// TransferBudgetExceeded is true if the logs would exceed the
+	// MaxTransferBytes share of this logstream, and thus weren't fetched.
+	TransferBudgetExceeded bool
+
+	// StageCounts is only populated if QueryLogsParams.Stages were given: the
+	// first item is the number of messages in the time range matching the
+	// Query, and every next one is the number of messages left after the
+	// corresponding stage.
+	StageCounts []int
+
+	// ActivityStats is only populated if QueryLogsParams.GapThreshold or
+	// ActivityStats was given: it's a map from the unix timestamp (in seconds) to the number of
+	// all the lines in the minute starting at this timestamp, regardless of the
+	// Query.
+	ActivityStats map[int64]int
+
 	// DebugInfo contains info collected during this particular query.
 	DebugInfo LogstreamDebugInfo
 }
@@ -74,6 +163,40 @@ type LogRespTotal struct {
 
 	Errs []error
 
+	// TransferBytes is the total number of bytes taken by the log lines from
+	// all logstreams; if TransferBudgetExceeded is true, it's the estimate of
+	// how many bytes they would take.
+	TransferBytes int
+
+	// TransferBudgetExceeded is true if the logs would exceed the
+	// QueryLogsParams.MaxTransferBytes, so only the MinuteStats were fetched,
+	// and Logs are empty.
+	TransferBudgetExceeded bool
+
+	// StageCounts is the same as in LogResp, but summed across all the
+	// logstreams.
+	StageCounts []int
+
+	// CountOnly is true if the query was made with
+	// QueryLogsParams.CountOnly, so Logs are empty.
+	CountOnly bool
+
+	// Gaps are only populated if QueryLogsParams.GapThreshold was given: the
+	// periods within the time range when some logstream had no lines at all
+	// (not just no matching ones), ordered by the logstream name and time.
+	Gaps []TimeGap
+
+	// ActivityStats is the same as in LogResp, but summed across all the
+	// logstreams.
+	ActivityStats map[int64]int
+
+	// Throttled is only populated if QueryLogsParams.MaxLStreamRate was given:
+	// it's a map from the logstream name to the number of its messages
+	// dropped from Logs because of that rate. NOTE that it only counts the
+	// drops among the messages which would otherwise be in Logs, not among all
+	// the messages in the time range, so it's not the real volume.
+	Throttled map[string]int
+
 	// DebugInfo is a map from the logstream name to the corresponding debug info
 	// collected during this particular query.
 	DebugInfo map[string]LogstreamDebugInfo
@@ -82,8 +205,54 @@ type LogRespTotal struct {
 	QueryDur time.Duration
 }
 
+// TimeGap is a period when a logstream had no lines at all.
+type TimeGap struct {
+	LStream string
+
+	// From is inclusive, To is exclusive; both are at minute boundaries.
+	From time.Time
+	To   time.Time
+}
+
+// FindFirstLastParams are the params for LStreamsManager.FindFirstLast.
+type FindFirstLastParams struct {
+	// From and To are optional; if zero, all available logs are searched,
+	// including older rotated log files (not only the last two which are used
+	// by regular queries).
+	From time.Time
+	To   time.Time
+
+	Query string
+}
+
+// FirstLastResp is a response from a single logstream to the first/last
+// occurrence lookup.
+type FirstLastResp struct {
+	// First and Last are the earliest and the latest messages matching the
+	// query. Both are nil if nothing matched.
+	First *LogMsg
+	Last  *LogMsg
+}
+
+// FirstLastRespTotal is a first/last occurrence response from a
+// LStreamsManager, collected from multiple FirstLastResp's.
+type FirstLastRespTotal struct {
+	// PerLStream is a map from the logstream name to its response.
+	PerLStream map[string]FirstLastResp
+
+	Errs []error
+
+	// QueryDur shows how long the lookup took.
+	QueryDur time.Duration
+}
+
 type MinuteStatsItem struct {
 	NumMsgs int
+
+	// NumErrors and NumWarnings are how many of the NumMsgs look like errors
+	// and warnings. Only populated if QueryLogsParams.LevelStats was set.
+	NumErrors   int
+	NumWarnings int
 }
 
 type LogMsg struct {
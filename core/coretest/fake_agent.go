@@ -0,0 +1,130 @@
+// Package coretest provides the fakes for testing the code built on top of
+// the core package: ShellTransportFake with FakeAgent serve the synthetic logs
+// in-process, without any real hosts.
+package coretest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// FakeAgent is the canned agent for ShellTransportFake: it serves the
+// synthetic log files given in the params, and the queries can be delayed or
+// made to fail, so that the query, merge and error handling logic can be
+// integration-tested deterministically, without any real hosts.
+//
+// Under the hood, the log files are written to a dir and scanned by the
+// native agent (see core.RunNativeAgent), so the output is the same as from the
+// real one. It's safe for concurrent use: the delays and failures can be
+// changed at any time.
+type FakeAgent struct {
+	params FakeAgentParams
+
+	// files maps the log file names, as given in the logstream config, to the
+	// actual files in params.Dir.
+	files map[string]string
+
+	mtx        sync.Mutex
+	queryDelay time.Duration
+	queryErr   string
+	numQueries int
+}
+
+type FakeAgentParams struct {
+	// Dir is where the log files are written to; normally it's t.TempDir().
+	Dir string
+
+	// LogFiles maps the log file names, as given in the logstream config (like
+	// "/var/log/syslog"), to their contents.
+	LogFiles map[string]string
+}
+
+// NewFakeAgent writes the log files and creates the agent.
+func NewFakeAgent(params FakeAgentParams) (*FakeAgent, error) {
+	names := make([]string, 0, len(params.LogFiles))
+	for name := range params.LogFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make(map[string]string, len(names))
+	for i, name := range names {
+		fname := filepath.Join(params.Dir, fmt.Sprintf("%d_%s", i, filepath.Base(name)))
+		if err := ioutil.WriteFile(fname, []byte(params.LogFiles[name]), 0644); err != nil {
+			return nil, errors.Annotatef(err, "writing fake log file %s", name)
+		}
+
+		files[name] = fname
+	}
+
+	return &FakeAgent{
+		params: params,
+		files:  files,
+	}, nil
+}
+
+// SetQueryDelay makes every query take at least the given time before
+// producing any output.
+func (fa *FakeAgent) SetQueryDelay(delay time.Duration) {
+	fa.mtx.Lock()
+	defer fa.mtx.Unlock()
+
+	fa.queryDelay = delay
+}
+
+// SetQueryErr makes every query fail with the given error message (after the
+// delay, if any); an empty message makes the queries succeed again.
+func (fa *FakeAgent) SetQueryErr(msg string) {
+	fa.mtx.Lock()
+	defer fa.mtx.Unlock()
+
+	fa.queryErr = msg
+}
+
+// NumQueries returns how many queries the agent has received so far, including
+// the failed ones.
+func (fa *FakeAgent) NumQueries() int {
+	fa.mtx.Lock()
+	defer fa.mtx.Unlock()
+
+	return fa.numQueries
+}
+
+// run is the core.NativeAgentFunc for the core.ShellConnNative.
+func (fa *FakeAgent) run(args []string, env map[string]string, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "query" {
+		fa.mtx.Lock()
+		fa.numQueries++
+		delay, errMsg := fa.queryDelay, fa.queryErr
+		fa.mtx.Unlock()
+
+		time.Sleep(delay)
+
+		if errMsg != "" {
+			fmt.Fprintf(stderr, "error:%s\n", errMsg)
+			fmt.Fprintf(stdout, "exit_code:1\n")
+			return 1
+		}
+	}
+
+	// Replace the log file names with the actual files we've written.
+	mapped := make([]string, len(args))
+	for i, arg := range args {
+		mapped[i] = arg
+		if i > 0 && (args[i-1] == "--logfile-last" || args[i-1] == "--logfile-prev") {
+			if fname, ok := fa.files[arg]; ok {
+				mapped[i] = fname
+			}
+		}
+	}
+
+	return core.RunNativeAgent(mapped, env, stdout, stderr)
+}
@@ -0,0 +1,78 @@
+package coretest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/log"
+)
+
+// ShellTransportFake is an in-process implementation of core.ShellTransport
+// for tests: like core.ShellTransportNative, it runs the commands which
+// core.LStreamClient gives to it in-process, but the agent is the FakeAgent
+// serving the synthetic logs; and the connection can be delayed or made to
+// fail. Use it with core.LStreamsManagerParams.ShellTransportFactory (or the
+// same field of core.SessionParams).
+type ShellTransportFake struct {
+	params ShellTransportFakeParams
+
+	mtx        sync.Mutex
+	connectErr error
+}
+
+type ShellTransportFakeParams struct {
+	// Agent serves the logs. Multiple transports can share the same agent.
+	Agent *FakeAgent
+
+	// ConnectDelay is how long it takes to connect.
+	ConnectDelay time.Duration
+
+	// ConnectErr, if non-nil, makes the connection fail after the delay; see
+	// also SetConnectErr.
+	ConnectErr error
+
+	Logger *log.Logger
+}
+
+// NewShellTransportFake creates a new ShellTransportFake.
+func NewShellTransportFake(params ShellTransportFakeParams) *ShellTransportFake {
+	return &ShellTransportFake{
+		params:     params,
+		connectErr: params.ConnectErr,
+	}
+}
+
+// SetConnectErr makes the next connection attempts fail with the given error,
+// or succeed if it's nil. The existing connection isn't affected.
+func (s *ShellTransportFake) SetConnectErr(err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.connectErr = err
+}
+
+// Connect "connects" to the fake shell after the ConnectDelay, and sends the
+// result to the provided channel.
+func (s *ShellTransportFake) Connect(resCh chan<- core.ShellConnUpdate) {
+	go func() {
+		time.Sleep(s.params.ConnectDelay)
+
+		s.mtx.Lock()
+		connectErr := s.connectErr
+		s.mtx.Unlock()
+
+		if connectErr != nil {
+			resCh <- core.ShellConnUpdate{
+				Result: &core.ShellConnResult{Err: connectErr},
+			}
+			return
+		}
+
+		resCh <- core.ShellConnUpdate{
+			Result: &core.ShellConnResult{
+				Conn: core.NewShellConnNative(s.params.Logger, s.params.Agent.run),
+			},
+		}
+	}()
+}
@@ -0,0 +1,178 @@
+package coretest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/clock"
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSyslog returns the syslog lines with the given messages, the first one
+// at Mar 10 10:00:00 plus the offset, and then every 2 minutes.
+func fakeSyslog(host string, offset time.Duration, msgs ...string) string {
+	t := time.Date(2025, time.March, 10, 10, 0, 0, 0, time.UTC).Add(offset)
+
+	var sb strings.Builder
+	for i, msg := range msgs {
+		fmt.Fprintf(&sb, "%s %s app[%d]: %s\n", t.Format("Jan _2 15:04:05"), host, 100+i, msg)
+		t = t.Add(2 * time.Minute)
+	}
+
+	return sb.String()
+}
+
+// fakeTestHosts is the fake setup of a few logstreams for the tests.
+type fakeTestHosts struct {
+	agents     map[string]*FakeAgent
+	transports map[string]*ShellTransportFake
+}
+
+// newFakeTestHosts creates the logstreams "a" and "b", both served by the
+// fake agents: "a" has messages a1..a3 at 10:00, 10:02 and 10:04, and "b" has
+// b1, b2 at 10:01 and 10:03.
+func newFakeTestHosts(t *testing.T) *fakeTestHosts {
+	hosts := &fakeTestHosts{
+		agents:     map[string]*FakeAgent{},
+		transports: map[string]*ShellTransportFake{},
+	}
+
+	logs := map[string]string{
+		"a": fakeSyslog("a", 0, "a1", "a2", "a3"),
+		"b": fakeSyslog("b", time.Minute, "b1", "b2"),
+	}
+
+	for name, data := range logs {
+		agent, err := NewFakeAgent(FakeAgentParams{
+			Dir:      t.TempDir(),
+			LogFiles: map[string]string{"/var/log/syslog": data},
+		})
+		require.NoError(t, err)
+
+		hosts.agents[name] = agent
+		hosts.transports[name] = NewShellTransportFake(ShellTransportFakeParams{
+			Agent:        agent,
+			ConnectDelay: 10 * time.Millisecond,
+		})
+	}
+
+	return hosts
+}
+
+// newFakeTestSession creates the session with the logstreams "a" and "b",
+// see newFakeTestHosts.
+func newFakeTestSession(t *testing.T, hosts *fakeTestHosts) *core.Session {
+	sess, err := core.NewSession(core.SessionParams{
+		LStreams: "a,b",
+		ConfigLogStreams: core.ConfigLogStreams{
+			"a": {Hostname: "localhost", LogFiles: []string{"/var/log/syslog"}},
+			"b": {Hostname: "localhost", LogFiles: []string{"/var/log/syslog"}},
+		},
+		ClientID: "fake_test",
+		ShellTransportFactory: func(ls core.LogStream) core.ShellTransport {
+			return hosts.transports[ls.Name]
+		},
+		Clock: clock.New(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(sess.Close)
+
+	return sess
+}
+
+func fakeTestMsgs(logs []core.LogMsg) []string {
+	ret := make([]string, 0, len(logs))
+	for _, msg := range logs {
+		ret = append(ret, msg.Msg)
+	}
+
+	return ret
+}
+
+func TestShellTransportFakeMerge(t *testing.T) {
+	sess := newFakeTestSession(t, newFakeTestHosts(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	resp, err := sess.QueryLogs(ctx, core.QueryLogsParams{MaxNumLines: 100})
+	require.NoError(t, err)
+	require.Empty(t, resp.Errs)
+	assert.Equal(t, 5, resp.NumMsgsTotal)
+	assert.Equal(t, []string{"a1", "b1", "a2", "b2", "a3"}, fakeTestMsgs(resp.Logs))
+
+	// With 2 messages from every logstream, "a" only covers the logs since
+	// 10:02, so the merged logs can't go earlier than that.
+	resp, err = sess.QueryLogs(ctx, core.QueryLogsParams{MaxNumLines: 2})
+	require.NoError(t, err)
+	require.Empty(t, resp.Errs)
+	assert.Equal(t, 5, resp.NumMsgsTotal)
+	assert.Equal(t, []string{"a2", "b2", "a3"}, fakeTestMsgs(resp.Logs))
+}
+
+func TestShellTransportFakeQueryFailures(t *testing.T) {
+	hosts := newFakeTestHosts(t)
+	sess := newFakeTestSession(t, hosts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The error from one logstream fails the whole query.
+	hosts.agents["b"].SetQueryErr("disk on fire")
+
+	resp, err := sess.QueryLogs(ctx, core.QueryLogsParams{MaxNumLines: 100})
+	require.NoError(t, err)
+	require.Len(t, resp.Errs, 1)
+	assert.Contains(t, resp.Errs[0].Error(), "disk on fire")
+
+	hosts.agents["b"].SetQueryErr("")
+
+	// A slow logstream delays the whole query.
+	hosts.agents["a"].SetQueryDelay(500 * time.Millisecond)
+
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+
+	_, err = sess.QueryLogs(shortCtx, core.QueryLogsParams{MaxNumLines: 100})
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+
+	numQueries := hosts.agents["a"].NumQueries()
+	hosts.agents["a"].SetQueryDelay(0)
+
+	resp, err = sess.QueryLogs(ctx, core.QueryLogsParams{MaxNumLines: 100})
+	require.NoError(t, err)
+	require.Empty(t, resp.Errs)
+	assert.Equal(t, []string{"a1", "b1", "a2", "b2", "a3"}, fakeTestMsgs(resp.Logs))
+	assert.Equal(t, numQueries+1, hosts.agents["a"].NumQueries())
+}
+
+func TestShellTransportFakeConnectErr(t *testing.T) {
+	hosts := newFakeTestHosts(t)
+	hosts.transports["b"].SetConnectErr(errors.New("no route to host"))
+	sess := newFakeTestSession(t, hosts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	shortCtx, shortCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer shortCancel()
+
+	err := sess.WaitConnected(shortCtx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b: ")
+
+	// The broken connection is retried until it works.
+	hosts.transports["b"].SetConnectErr(nil)
+	require.NoError(t, sess.WaitConnected(ctx))
+
+	resp, err := sess.QueryLogs(ctx, core.QueryLogsParams{MaxNumLines: 100})
+	require.NoError(t, err)
+	require.Empty(t, resp.Errs)
+	assert.Equal(t, 5, resp.NumMsgsTotal)
+}
@@ -0,0 +1,22 @@
+// Package core is the nerdlog engine without the TUI: it connects to the
+// logstreams (via ssh, or locally), bootstraps the agent script there, runs the
+// queries on all of them in parallel, and merges the results. It can be
+// imported by other Go tools to run nerdlog-style distributed log queries.
+//
+// The simplest way to use it is Session: create it with NewSession, then call
+// QueryLogs as many times as needed (or StreamLogs, to go through all the
+// matching logs page by page), and Close it in the end; see the example.
+// For more control, like following the connection progress or running the
+// queries without blocking, use LStreamsManager directly: it delivers
+// everything as LStreamsManagerUpdate-s to the channel given in its params.
+//
+// The API is not stable yet: only Session with SessionParams, and the config
+// types mirroring ~/.config/nerdlog/logstreams.yaml (ConfigLogStreams and the
+// related ones), are meant to stay backwards compatible. Everything else,
+// including LStreamsManager with its updates and state, and the query model
+// (QueryLogsParams, LogRespTotal, LogMsg and LogMsgStream), might still change
+// between the minor versions.
+//
+// For the tests of the code built on top of this package, see the coretest
+// package: it has the fake transport serving synthetic logs in-process.
+package core
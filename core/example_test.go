@@ -0,0 +1,57 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dimonomid/clock"
+	"github.com/dimonomid/nerdlog/core"
+)
+
+// This example runs a query on a logstream without any UI: here it's a local
+// log file scanned natively, but it could just as well be a bunch of remote
+// hosts, like "web-*".
+func ExampleSession() {
+	sess, err := core.NewSession(core.SessionParams{
+		LStreams: "tiny",
+		ConfigLogStreams: core.ConfigLogStreams{
+			"tiny": {
+				Hostname: "localhost",
+				LogFiles: []string{
+					"core_testdata/input_logfiles/tiny/syslog",
+					"core_testdata/input_logfiles/tiny/syslog.1",
+				},
+				Options: core.ConfigLogStreamOptions{NativeScan: true},
+			},
+		},
+		ClientID: "example",
+		Clock:    clock.New(),
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer sess.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	resp, err := sess.QueryLogs(ctx, core.QueryLogsParams{
+		MaxNumLines: 10,
+		Query:       "/Firewall/",
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	fmt.Println("Total:", resp.NumMsgsTotal)
+	for _, msg := range resp.Logs {
+		fmt.Println(msg.Time.Format("Jan 02 15:04:05"), msg.Context["program"], msg.Msg)
+	}
+
+	// Output:
+	// Total: 1
+	// Mar 10 09:05:07 cron <emerg> Firewall rule deleted
+}
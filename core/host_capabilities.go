@@ -0,0 +1,164 @@
+package core
+
+import (
+	"strings"
+	"time"
+)
+
+// HostCapabilities describes which tools are available on the host, as
+// probed during the bootstrap (see capabilitiesProbeScript).
+//
+// Only Gzip affects how the queries are run (see LStreamClient.useGzip); the
+// rest is informational, for troubleshooting. E.g. the agent script needs GNU
+// awk anyway, and without it the bootstrap fails with an error saying so.
+type HostCapabilities struct {
+	Journalctl bool
+	Gzip       bool
+	Ripgrep    bool
+
+	// Awk is the flavor of the awk available on the host: "gnu" (either as
+	// gawk or awk), "mawk", "bsd", or "other".
+	Awk string
+
+	// Sudo is true if the user can run "sudo -n" without a password. It's only
+	// probed for the logstreams which use sudo (see SudoMode), so for the
+	// others it's always false.
+	Sudo bool
+
+	// ProbedAt is when the capabilities were probed.
+	ProbedAt time.Time
+}
+
+// String returns the capabilities like "journalctl, gzip, awk=gnu".
+func (c HostCapabilities) String() string {
+	var parts []string
+
+	if c.Journalctl {
+		parts = append(parts, "journalctl")
+	}
+
+	if c.Gzip {
+		parts = append(parts, "gzip")
+	}
+
+	if c.Ripgrep {
+		parts = append(parts, "rg")
+	}
+
+	if c.Awk != "" {
+		parts = append(parts, "awk="+c.Awk)
+	}
+
+	if c.Sudo {
+		parts = append(parts, "sudo")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// CapabilitiesCache stores the HostCapabilities, so that the hosts aren't
+// probed on every connection (see capabilitiesCacheTTL). It must be safe for
+// concurrent use.
+type CapabilitiesCache interface {
+	// Get returns the cached capabilities of the host with the given key (see
+	// LogStream.CapabilitiesKey), if any.
+	Get(hostKey string) (HostCapabilities, bool)
+
+	// Put stores the capabilities of the host with the given key.
+	Put(hostKey string, caps HostCapabilities)
+}
+
+// capabilitiesPrefix is how the line printed by capabilitiesProbeScript
+// starts.
+const capabilitiesPrefix = "capabilities:"
+
+// capabilitiesCacheTTL is how long the cached capabilities are used for,
+// after which the host is probed again.
+const capabilitiesCacheTTL = 24 * time.Hour
+
+// getCachedCapabilities returns the capabilities of the host from the cache,
+// or nil if there are none, or they're older than capabilitiesCacheTTL.
+func getCachedCapabilities(cache CapabilitiesCache, hostKey string, now time.Time) *HostCapabilities {
+	caps, ok := cache.Get(hostKey)
+	if !ok || now.Sub(caps.ProbedAt) > capabilitiesCacheTTL {
+		return nil
+	}
+
+	return &caps
+}
+
+// capabilitiesProbeScript returns the script which prints the capabilities
+// of the host as a single line like "capabilities:journalctl,gzip,awk=gnu";
+// see parseHostCapabilities. Sudo is only checked if probeSudo is true, so
+// that the hosts which don't need it don't get "sudo" in their auth logs on
+// every connection.
+func capabilitiesProbeScript(probeSudo bool) string {
+	var sb strings.Builder
+
+	sb.WriteString(`  caps=""
+  for c in journalctl gzip rg; do command -v "$c" > /dev/null 2>&1 && caps="$caps,$c"; done
+  awk_version="$( (gawk --version || awk --version || awk -W version) 2>/dev/null | head -n 1)"
+  case "$awk_version" in
+    *"GNU Awk"*) caps="$caps,awk=gnu" ;;
+    *mawk*) caps="$caps,awk=mawk" ;;
+    "awk version"*) caps="$caps,awk=bsd" ;;
+    *) caps="$caps,awk=other" ;;
+  esac
+`)
+
+	if probeSudo {
+		sb.WriteString(`  sudo -n true > /dev/null 2>&1 && caps="$caps,sudo"
+`)
+	}
+
+	sb.WriteString(`  echo "` + capabilitiesPrefix + `${caps#,}"
+`)
+
+	return sb.String()
+}
+
+// parseHostCapabilities parses the output of capabilitiesProbeScript, without
+// the prefix; the unknown items are ignored.
+func parseHostCapabilities(s string, probedAt time.Time) HostCapabilities {
+	caps := HostCapabilities{ProbedAt: probedAt}
+
+	for _, item := range strings.Split(s, ",") {
+		switch {
+		case item == "journalctl":
+			caps.Journalctl = true
+		case item == "gzip":
+			caps.Gzip = true
+		case item == "rg":
+			caps.Ripgrep = true
+		case item == "sudo":
+			caps.Sudo = true
+		case strings.HasPrefix(item, "awk="):
+			caps.Awk = strings.TrimPrefix(item, "awk=")
+		}
+	}
+
+	return caps
+}
+
+// HostKey returns the key identifying the host (and the user) which the
+// logstream is on.
+func (ls LogStream) HostKey() string {
+	if ls.Transport.SSH != nil {
+		return ls.Transport.SSH.Host.Key()
+	}
+
+	return "localhost"
+}
+
+// CapabilitiesKey returns the key of the logstream's host capabilities in the
+// CapabilitiesCache: it's the HostKey, plus the "+sudo" suffix if the
+// logstream uses sudo, since only then Sudo is probed (see
+// capabilitiesProbeScript); so the logstreams on the same host with and
+// without sudo don't overwrite each other's capabilities.
+func (ls LogStream) CapabilitiesKey() string {
+	if ls.Options.SudoMode == SudoModeFull {
+		return ls.HostKey() + "+sudo"
+	}
+
+	return ls.HostKey()
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHostCapabilities(t *testing.T) {
+	probedAt := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    HostCapabilities
+		wantStr string
+	}{
+		{
+			name:  "everything",
+			input: "journalctl,gzip,rg,awk=gnu,sudo",
+			want: HostCapabilities{
+				Journalctl: true,
+				Gzip:       true,
+				Ripgrep:    true,
+				Awk:        "gnu",
+				Sudo:       true,
+				ProbedAt:   probedAt,
+			},
+			wantStr: "journalctl, gzip, rg, awk=gnu, sudo",
+		},
+		{
+			name:  "bsd awk only, unknown items ignored",
+			input: "awk=bsd,whatever",
+			want: HostCapabilities{
+				Awk:      "bsd",
+				ProbedAt: probedAt,
+			},
+			wantStr: "awk=bsd",
+		},
+		{
+			name:    "nothing",
+			input:   "",
+			want:    HostCapabilities{ProbedAt: probedAt},
+			wantStr: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseHostCapabilities(tt.input, probedAt)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantStr, got.String())
+		})
+	}
+}
+
+// mapCapabilitiesCache is the in-memory CapabilitiesCache for tests.
+type mapCapabilitiesCache map[string]HostCapabilities
+
+func (c mapCapabilitiesCache) Get(hostKey string) (HostCapabilities, bool) {
+	caps, ok := c[hostKey]
+	return caps, ok
+}
+
+func (c mapCapabilitiesCache) Put(hostKey string, caps HostCapabilities) {
+	c[hostKey] = caps
+}
+
+func TestGetCachedCapabilities(t *testing.T) {
+	now := time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	cache := mapCapabilitiesCache{
+		"fresh": {Gzip: true, ProbedAt: now.Add(-time.Hour)},
+		"stale": {Gzip: true, ProbedAt: now.Add(-capabilitiesCacheTTL - time.Minute)},
+	}
+
+	if caps := getCachedCapabilities(cache, "fresh", now); assert.NotNil(t, caps) {
+		assert.True(t, caps.Gzip)
+	}
+
+	assert.Nil(t, getCachedCapabilities(cache, "stale", now))
+	assert.Nil(t, getCachedCapabilities(cache, "missing", now))
+}
+
+func TestCapabilitiesProbeScript(t *testing.T) {
+	assert.False(t, strings.Contains(capabilitiesProbeScript(false), "sudo"))
+	assert.True(t, strings.Contains(capabilitiesProbeScript(true), "sudo -n true"))
+}
+
+func TestCapabilitiesKey(t *testing.T) {
+	ls := LogStream{
+		Transport: ConfigLogStreamShellTransport{
+			Localhost: &ConfigLogStreamShellTransportLocalhost{},
+		},
+	}
+	assert.Equal(t, "localhost", ls.CapabilitiesKey())
+
+	// Sudo is only probed with sudo, so the capabilities are cached
+	// separately.
+	ls.Options.SudoMode = SudoModeFull
+	assert.Equal(t, "localhost+sudo", ls.CapabilitiesKey())
+}
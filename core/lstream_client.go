@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -83,6 +84,14 @@ type LStreamClient struct {
 	exampleLogLines []string
 	timeFormat      *TimeFormatDescr
 
+	// logFormat is the log format, either detected or overridden (see
+	// LogFormatOverrides); it selects how the message envelopes are parsed.
+	logFormat LogFormat
+
+	// capabilities are the capabilities of the host, either cached or probed
+	// during the bootstrap; nil if unknown.
+	capabilities *HostCapabilities
+
 	numConnAttempts int
 
 	state     LStreamClientState
@@ -165,6 +174,20 @@ type BootstrapDetails struct {
 	WarnJournalctlNoAdminAccess bool
 }
 
+// LogFormatDetected describes the log format detected during bootstrap, so
+// that the user could confirm or override it (see LogFormatOverrides).
+type LogFormatDetected struct {
+	// LStreamName is populated by the LStreamsManager; LStreamClient leaves it
+	// empty, since its updates have the name anyway.
+	LStreamName string
+
+	Format          LogFormat
+	TimestampLayout string
+
+	// ExampleLine is one of the log lines the format was detected from.
+	ExampleLine string
+}
+
 func (c *connCtx) getStdoutLinesCh() chan string {
 	if c == nil {
 		return nil
@@ -189,9 +212,11 @@ type LStreamClientUpdate struct {
 
 	State *LStreamClientUpdateState
 
-	ConnDetails      *ConnDetails
-	BootstrapDetails *BootstrapDetails
-	BusyStage        *BusyStage
+	ConnDetails       *ConnDetails
+	BootstrapDetails  *BootstrapDetails
+	LogFormatDetected *LogFormatDetected
+	BusyStage         *BusyStage
+	Capabilities      *HostCapabilities
 
 	DataRequest *ShellConnDataRequest
 
@@ -222,6 +247,24 @@ type LStreamClientParams struct {
 
 	UpdatesCh chan<- *LStreamClientUpdate
 
+	// CapabilitiesCache is optional; if set, the host capabilities are only
+	// probed if they aren't in the cache yet.
+	CapabilitiesCache CapabilitiesCache
+
+	// LogFormatOverrides is optional; if set, and it has the override for this
+	// logstream, it's used instead of the detected log format.
+	LogFormatOverrides LogFormatOverrides
+
+	// AuthCallback is optional, see ShellTransportSSHParams.AuthCallback.
+	AuthCallback AuthCallback
+
+	// AllowPasswordAuth, see ShellTransportSSHParams.AllowPasswordAuth.
+	AllowPasswordAuth bool
+
+	// ShellTransportFactory is optional; if set, it creates the transport
+	// instead of the default one for the logstream.
+	ShellTransportFactory ShellTransportFactory
+
 	Clock clock.Clock
 }
 
@@ -229,7 +272,9 @@ type LStreamClientParams struct {
 // config. The config must be valid (e.g. it should contain exactly one item),
 // otherwise createTransport panics.
 func createTransport(
-	config ConfigLogStreamShellTransport, sshKeys []string, logger *log.Logger,
+	config ConfigLogStreamShellTransport, opts LogStreamOptions,
+	sshKeys []string, authCallback AuthCallback, allowPasswordAuth bool,
+	logger *log.Logger,
 ) ShellTransport {
 	var transport ShellTransport
 
@@ -243,6 +288,9 @@ func createTransport(
 			ConnDetails: *config.SSH,
 
 			Logger: logger,
+
+			AuthCallback:      authCallback,
+			AllowPasswordAuth: allowPasswordAuth,
 		})
 	}
 
@@ -251,9 +299,17 @@ func createTransport(
 			panic("transport config is ambiguous")
 		}
 
-		transport = NewShellTransportLocal(ShellTransportLocalParams{
-			Logger: logger,
-		})
+		// There is no POSIX shell on Windows, so scan the files natively there;
+		// on other systems, only if requested.
+		if opts.NativeScan || runtime.GOOS == "windows" {
+			transport = NewShellTransportNative(ShellTransportNativeParams{
+				Logger: logger,
+			})
+		} else {
+			transport = NewShellTransportLocal(ShellTransportLocalParams{
+				Logger: logger,
+			})
+		}
 	}
 
 	if transport == nil {
@@ -274,7 +330,15 @@ func NewLStreamClient(params LStreamClientParams) *LStreamClient {
 		fmt.Sprintf("LSClient_%s", params.LogStream.Name),
 	)
 
-	transport := createTransport(params.LogStream.Transport, params.SSHKeys, params.Logger)
+	var transport ShellTransport
+	if params.ShellTransportFactory != nil {
+		transport = params.ShellTransportFactory(params.LogStream)
+	} else {
+		transport = createTransport(
+			params.LogStream.Transport, params.LogStream.Options, params.SSHKeys,
+			params.AuthCallback, params.AllowPasswordAuth, params.Logger,
+		)
+	}
 
 	lsc := &LStreamClient{
 		params: params,
@@ -291,6 +355,12 @@ func NewLStreamClient(params LStreamClientParams) *LStreamClient {
 		disconnectedBeforeTeardownCh: make(chan struct{}),
 	}
 
+	if params.CapabilitiesCache != nil {
+		lsc.capabilities = getCachedCapabilities(
+			params.CapabilitiesCache, params.LogStream.CapabilitiesKey(), params.Clock.Now(),
+		)
+	}
+
 	//debugFile, _ := os.Create("/tmp/lsclient_debug.log")
 	//lsc.debugFile = debugFile
 
@@ -530,6 +600,14 @@ func (lsc *LStreamClient) run() {
 						lsc.params.Logger.Verbose1f("Got example log line: %s\n", exampleLogLine)
 
 						lsc.exampleLogLines = append(lsc.exampleLogLines, exampleLogLine)
+					} else if strings.HasPrefix(line, capabilitiesPrefix) {
+						caps := parseHostCapabilities(
+							strings.TrimPrefix(line, capabilitiesPrefix), lsc.params.Clock.Now(),
+						)
+						lsc.params.Logger.Verbose1f("Got host capabilities: %s\n", caps)
+
+						lsc.capabilities = &caps
+						cmdCtx.bootstrapCtx.probedCapabilities = true
 					} else if line == "bootstrap ok" {
 						cmdCtx.bootstrapCtx.receivedSuccess = true
 					} else if line == "bootstrap failed" {
@@ -570,10 +648,56 @@ func (lsc *LStreamClient) run() {
 							continue
 						}
 
-						resp.MinuteStats[t.Unix()] = MinuteStatsItem{
+						item := MinuteStatsItem{
 							NumMsgs: n,
 						}
 
+						// With --level-stats, there are also numbers of errors and
+						// warnings.
+						if len(parts) >= 4 {
+							item.NumErrors, err = strconv.Atoi(parts[2])
+							if err != nil {
+								cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing mstats"))
+								continue
+							}
+
+							item.NumWarnings, err = strconv.Atoi(parts[3])
+							if err != nil {
+								cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing mstats"))
+								continue
+							}
+						}
+
+						resp.MinuteStats[t.Unix()] = item
+
+					case strings.HasPrefix(line, "a:"):
+						parts := strings.Split(strings.TrimPrefix(line, "a:"), ",")
+						if len(parts) != 2 {
+							err := errors.Errorf("malformed activity stats %q: expected 2 parts", line)
+							cmdCtx.errs = append(cmdCtx.errs, err)
+							continue
+						}
+
+						t, err := time.ParseInLocation(lsc.timeFormat.MinuteKeyLayout, parts[0], lsc.location)
+						if err != nil {
+							cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing activity stats"))
+							continue
+						}
+
+						t = InferYear(lsc.params.Clock.Now(), t)
+						t = t.UTC()
+
+						n, err := strconv.Atoi(parts[1])
+						if err != nil {
+							cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing activity stats"))
+							continue
+						}
+
+						if resp.ActivityStats == nil {
+							resp.ActivityStats = map[int64]int{}
+						}
+						resp.ActivityStats[t.Unix()] += n
+
 					case strings.HasPrefix(line, "logfile:"):
 						msg := strings.TrimPrefix(line, "logfile:")
 						idx := strings.IndexRune(msg, ':')
@@ -661,15 +785,76 @@ func (lsc *LStreamClient) run() {
 						}
 
 						resp.Logs = append(resp.Logs, logMsg)
+						resp.TransferBytes += len(line) + 1
 
 						respCtx.lastTime = logMsg.Time
 
+					case strings.HasPrefix(line, "transfer_exceeded:"):
+						n, err := strconv.Atoi(strings.TrimPrefix(line, "transfer_exceeded:"))
+						if err != nil {
+							cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing transfer estimate"))
+							continue
+						}
+
+						resp.TransferBudgetExceeded = true
+						resp.TransferBytes = n
+
+					case strings.HasPrefix(line, "stage_counts:"):
+						strs := strings.Split(strings.TrimPrefix(line, "stage_counts:"), ",")
+						counts := make([]int, 0, len(strs))
+						for _, str := range strs {
+							n, err := strconv.Atoi(str)
+							if err != nil {
+								cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing stage counts"))
+								break
+							}
+							counts = append(counts, n)
+						}
+
+						if len(counts) == len(strs) {
+							resp.StageCounts = counts
+						}
+
 						// NOTE: the "p:" lines (process-related) are in stderr and thus
 						// are handled below. Why they are in stderr, see comments there.
 					default:
 						cmdCtx.unhandledStdout = append(cmdCtx.unhandledStdout, line)
 					}
 
+				case cmdCtx.cmd.firstLast != nil:
+					resp := cmdCtx.firstLastCtx.Resp
+
+					var dst **LogMsg
+					var msg string
+
+					switch {
+					case strings.HasPrefix(line, "first:"):
+						dst = &resp.First
+						msg = strings.TrimPrefix(line, "first:")
+					case strings.HasPrefix(line, "last:"):
+						dst = &resp.Last
+						msg = strings.TrimPrefix(line, "last:")
+					default:
+						cmdCtx.unhandledStdout = append(cmdCtx.unhandledStdout, line)
+						continue
+					}
+
+					logMsg := LogMsg{
+						Msg: msg,
+						Context: map[string]string{
+							"lstream": lsc.params.LogStream.Name,
+						},
+
+						OrigLine: msg,
+					}
+
+					if err := lsc.parseLine(&logMsg); err != nil {
+						cmdCtx.errs = append(cmdCtx.errs, errors.Annotatef(err, "parsing log msg %q", line))
+						continue
+					}
+
+					*dst = &logMsg
+
 				default:
 					panic("invalid cmdCtx.cmd: no subcontext")
 				}
@@ -723,7 +908,7 @@ func (lsc *LStreamClient) run() {
 					}
 				case cmdCtx.cmd.ping != nil:
 					cmdCtx.unhandledStderr = append(cmdCtx.unhandledStderr, line)
-				case cmdCtx.cmd.queryLogs != nil:
+				case cmdCtx.cmd.queryLogs != nil, cmdCtx.cmd.firstLast != nil:
 					switch {
 					case strings.HasPrefix(line, "p:"):
 						// "p:" means process
@@ -971,12 +1156,36 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 	lsc.curCmdCtx = cmdCtx
 	lsc.nextCmdIdx++
 
+	// The connections without a real shell get the commands as they are,
+	// instead of the shell scripts; see nativeConn.
+	nc, isNative := lsc.conn.conn.(nativeConn)
+
 	switch {
 	case cmdCtx.cmd.bootstrap != nil:
 		lsc.params.Logger.Verbose3f("Starting command: bootstrap %+v", cmdCtx.cmd.bootstrap)
 
 		cmdCtx.bootstrapCtx = &lstreamCmdCtxBootstrap{}
 
+		inv := &agentInvocation{
+			env: lsc.getTimeEnvVars(),
+			args: []string{
+				"logstream_info",
+				"--logfile-last", lsc.params.LogStream.LogFileLast(),
+			},
+
+			// If requested, run the whole thing with "sudo -n".
+			sudo: lsc.params.LogStream.Options.SudoMode == SudoModeFull,
+		}
+
+		if logFilePrev, ok := lsc.params.LogStream.LogFilePrev(); ok {
+			inv.args = append(inv.args, "--logfile-prev", logFilePrev)
+		}
+
+		if isNative {
+			nc.runCmd(nativeCmd{idx: cmdCtx.idx, bootstrap: inv})
+			break
+		}
+
 		stdinBuf := lsc.conn.conn.Stdin()
 
 		stdinBuf.Write([]byte("echo reset_output\n"))
@@ -999,29 +1208,16 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 		stdinBuf.Write([]byte("  cat <<- 'EOF' > " + lsc.getLStreamNerdlogAgentPath() + "\n" + nerdlogAgentSh + "EOF\n"))
 		stdinBuf.Write([]byte("  if [[ $? != 0 ]]; then echo 'bootstrap failed'; exit 1; fi\n"))
 
-		var parts []string
-
-		// If requested, run the whole thing with "sudo -n".
-		if lsc.params.LogStream.Options.SudoMode == SudoModeFull {
-			parts = append(parts, "sudo", "-n")
-		}
-
-		parts = append(parts, lsc.getTimeEnvVars()...)
-
-		parts = append(
-			parts,
-			"bash", shellQuote(lsc.getLStreamNerdlogAgentPath()),
-			"logstream_info",
-			"--logfile-last", shellQuote(lsc.params.LogStream.LogFileLast()),
-		)
+		stdinBuf.Write([]byte(inv.shellCmd(lsc.getLStreamNerdlogAgentPath()) + "\n"))
+		stdinBuf.Write([]byte("  if [[ $? != 0 ]]; then echo 'bootstrap failed'; exit 1; fi\n"))
 
-		if logFilePrev, ok := lsc.params.LogStream.LogFilePrev(); ok {
-			parts = append(parts, "--logfile-prev", shellQuote(logFilePrev))
+		// Probe the host capabilities, unless we know them already.
+		if lsc.capabilities == nil {
+			stdinBuf.Write([]byte(capabilitiesProbeScript(
+				lsc.params.LogStream.Options.SudoMode == SudoModeFull,
+			)))
 		}
 
-		stdinBuf.Write([]byte(strings.Join(parts, " ") + "\n"))
-		stdinBuf.Write([]byte("  if [[ $? != 0 ]]; then echo 'bootstrap failed'; exit 1; fi\n"))
-
 		stdinBuf.Write([]byte("  echo 'bootstrap ok'\n"))
 		stdinBuf.Write([]byte(")\n"))
 		stdinBuf.Write([]byte("echo exit_code:$?\n"))
@@ -1030,6 +1226,11 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 		lsc.params.Logger.Verbose3f("Starting command: ping %+v", cmdCtx.cmd.ping)
 		cmdCtx.pingCtx = &lstreamCmdCtxPing{}
 
+		if isNative {
+			nc.runCmd(nativeCmd{idx: cmdCtx.idx, ping: true})
+			break
+		}
+
 		cmd := "whoami\n"
 		stdinBuf := lsc.conn.conn.Stdin()
 		stdinBuf.Write([]byte(cmd))
@@ -1043,77 +1244,97 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 			},
 		}
 
-		var parts []string
-
-		if useGzip {
-			parts = append(parts, "echo", gzipStartMarker, ";")
+		inv := &agentInvocation{
+			env:      lsc.getTimeEnvVars(),
+			sudo:     lsc.params.LogStream.Options.SudoMode == SudoModeFull,
+			wrappers: resourceGuardArgs(lsc.params.LogStream.Options),
+			gzip:     lsc.useGzip(),
 		}
 
-		// If requested, run the whole thing with "sudo -n".
-		if lsc.params.LogStream.Options.SudoMode == SudoModeFull {
-			parts = append(parts, "sudo", "-n")
-		}
-
-		parts = append(parts, lsc.getTimeEnvVars()...)
-
-		parts = append(
-			parts,
-			"bash", shellQuote(lsc.getLStreamNerdlogAgentPath()),
+		inv.args = append(
+			inv.args,
 			"query",
-			"--index-file", shellQuote(lsc.getLStreamIndexFilePath()),
-			"--max-num-lines", shellQuote(strconv.Itoa(cmdCtx.cmd.queryLogs.maxNumLines)),
-			"--logfile-last", shellQuote(lsc.params.LogStream.LogFileLast()),
+			"--index-file", lsc.getLStreamIndexFilePath(),
+			"--max-num-lines", strconv.Itoa(cmdCtx.cmd.queryLogs.maxNumLines),
+			"--logfile-last", lsc.params.LogStream.LogFileLast(),
 		)
 
 		if logFilePrev, ok := lsc.params.LogStream.LogFilePrev(); ok {
-			parts = append(parts, "--logfile-prev", shellQuote(logFilePrev))
+			inv.args = append(inv.args, "--logfile-prev", logFilePrev)
 		}
 
 		if !cmdCtx.cmd.queryLogs.from.IsZero() {
-			parts = append(parts, "--from", shellQuote(cmdCtx.cmd.queryLogs.from.In(lsc.location).Format(queryLogsArgsTimeLayout)))
+			inv.args = append(inv.args, "--from", cmdCtx.cmd.queryLogs.from.In(lsc.location).Format(queryLogsArgsTimeLayout))
 		}
 
 		if !cmdCtx.cmd.queryLogs.to.IsZero() {
-			parts = append(parts, "--to", shellQuote(cmdCtx.cmd.queryLogs.to.In(lsc.location).Format(queryLogsArgsTimeLayout)))
+			inv.args = append(inv.args, "--to", cmdCtx.cmd.queryLogs.to.In(lsc.location).Format(queryLogsArgsTimeLayout))
 		}
 
 		if cmdCtx.cmd.queryLogs.linesUntil > 0 {
-			parts = append(parts, "--lines-until", shellQuote(strconv.Itoa(cmdCtx.cmd.queryLogs.linesUntil)))
+			inv.args = append(inv.args, "--lines-until", strconv.Itoa(cmdCtx.cmd.queryLogs.linesUntil))
 		}
 
 		if tu := cmdCtx.cmd.queryLogs.timestampUntil; tu != nil {
 			nextWholeSecondTime := roundUpToNextSecond(tu.time)
 
-			parts = append(parts,
+			inv.args = append(inv.args,
 				"--timestamp-until-seconds",
-				shellQuote(
-					nextWholeSecondTime.In(lsc.location).Format(queryLogsTimestampUntilSecondsTimeLayout),
-				),
+				nextWholeSecondTime.In(lsc.location).Format(queryLogsTimestampUntilSecondsTimeLayout),
 
 				"--timestamp-until-precise",
-				shellQuote(
-					tu.time.In(lsc.location).Format(queryLogsTimestampUntilPreciseTimeLayout),
-				),
+				tu.time.In(lsc.location).Format(queryLogsTimestampUntilPreciseTimeLayout),
 
-				"--skip-n-latest", shellQuote(strconv.Itoa(tu.numMsgs)),
+				"--skip-n-latest", strconv.Itoa(tu.numMsgs),
 			)
 		}
 
 		if cmdCtx.cmd.queryLogs.refreshIndex {
-			parts = append(parts, "--refresh-index")
+			inv.args = append(inv.args, "--refresh-index")
 		}
 
-		parts = append(parts, agentQueryTimeFormatArgs(&lsc.timeFormat.AWKExpr)...)
+		if cmdCtx.cmd.queryLogs.maxTransferBytes > 0 {
+			inv.args = append(inv.args, "--max-transfer-bytes", strconv.Itoa(cmdCtx.cmd.queryLogs.maxTransferBytes))
+		}
+
+		if cmdCtx.cmd.queryLogs.levelStats {
+			inv.args = append(inv.args, "--level-stats")
+		}
+
+		if cmdCtx.cmd.queryLogs.activityStats {
+			inv.args = append(inv.args, "--activity-stats")
+		}
+
+		if secs := int(cmdCtx.cmd.queryLogs.cacheTTL.Seconds()); secs > 0 {
+			inv.args = append(inv.args, "--cache-ttl", strconv.Itoa(secs))
+		}
+
+		inv.args = append(inv.args, agentQueryTimeFormatArgs(&lsc.timeFormat.AWKExpr)...)
+
+		for _, stage := range cmdCtx.cmd.queryLogs.stages {
+			inv.args = append(inv.args, "--stage", stage)
+		}
+
+		for _, r := range cmdCtx.cmd.queryLogs.ranges {
+			rangeStr := r.From.In(lsc.location).Format(queryLogsArgsTimeLayout) + ","
+			if !r.To.IsZero() {
+				rangeStr += r.To.In(lsc.location).Format(queryLogsArgsTimeLayout)
+			}
+
+			inv.args = append(inv.args, "--range", rangeStr)
+		}
 
 		if cmdCtx.cmd.queryLogs.query != "" {
-			parts = append(parts, shellQuote(cmdCtx.cmd.queryLogs.query))
+			inv.args = append(inv.args, cmdCtx.cmd.queryLogs.query)
 		}
 
-		if useGzip {
-			parts = append(parts, "|", "gzip", ";", "echo", gzipEndMarker)
+		if isNative {
+			lsc.params.Logger.Verbose2f("Executing query command(%s): %q", lsc.params.LogStream.Name, inv.args)
+			nc.runCmd(nativeCmd{idx: cmdCtx.idx, agent: inv})
+			break
 		}
 
-		cmd := strings.Join(parts, " ") + "\n"
+		cmd := inv.shellCmd(lsc.getLStreamNerdlogAgentPath()) + "\n"
 		lsc.params.Logger.Verbose2f("Executing query command(%s): %s", lsc.params.LogStream.Name, cmd)
 
 		lsc.conn.conn.Stdin().Write([]byte(cmd))
@@ -1125,13 +1346,67 @@ func (lsc *LStreamClient) startCmd(cmd lstreamCmd) {
 		// Instead, the agent script itself has a trap which prints this line for
 		// us.
 
+	case cmdCtx.cmd.firstLast != nil:
+		lsc.params.Logger.Verbose3f("Starting command: firstLast %+v", cmdCtx.cmd.firstLast)
+		cmdCtx.firstLastCtx = &lstreamCmdCtxFirstLast{
+			Resp: &FirstLastResp{},
+		}
+
+		// The output is tiny (just two lines at most), so no gzipping here.
+		inv := &agentInvocation{
+			env:      lsc.getTimeEnvVars(),
+			sudo:     lsc.params.LogStream.Options.SudoMode == SudoModeFull,
+			wrappers: resourceGuardArgs(lsc.params.LogStream.Options),
+		}
+
+		inv.args = append(
+			inv.args,
+			"first_last",
+			"--logfile-last", lsc.params.LogStream.LogFileLast(),
+		)
+
+		if logFilePrev, ok := lsc.params.LogStream.LogFilePrev(); ok {
+			inv.args = append(inv.args, "--logfile-prev", logFilePrev)
+		}
+
+		if !cmdCtx.cmd.firstLast.from.IsZero() {
+			inv.args = append(inv.args, "--from", cmdCtx.cmd.firstLast.from.In(lsc.location).Format(queryLogsArgsTimeLayout))
+		}
+
+		if !cmdCtx.cmd.firstLast.to.IsZero() {
+			inv.args = append(inv.args, "--to", cmdCtx.cmd.firstLast.to.In(lsc.location).Format(queryLogsArgsTimeLayout))
+		}
+
+		inv.args = append(inv.args, agentQueryTimeFormatArgs(&lsc.timeFormat.AWKExpr)...)
+
+		if cmdCtx.cmd.firstLast.query != "" {
+			inv.args = append(inv.args, cmdCtx.cmd.firstLast.query)
+		}
+
+		if isNative {
+			lsc.params.Logger.Verbose2f("Executing first/last command(%s): %q", lsc.params.LogStream.Name, inv.args)
+			nc.runCmd(nativeCmd{idx: cmdCtx.idx, agent: inv})
+			break
+		}
+
+		cmd := inv.shellCmd(lsc.getLStreamNerdlogAgentPath()) + "\n"
+		lsc.params.Logger.Verbose2f("Executing first/last command(%s): %s", lsc.params.LogStream.Name, cmd)
+
+		lsc.conn.conn.Stdin().Write([]byte(cmd))
+
+		// NOTE: same as for queryLogs, the "exit_code:" is printed by the agent
+		// script itself.
+
 	default:
 		panic(fmt.Sprintf("invalid command %+v", cmdCtx.cmd))
 	}
 
-	stdinBuf := lsc.conn.conn.Stdin()
-	stdinBuf.Write([]byte(fmt.Sprintf("echo 'command_done:%d'\n", cmdCtx.idx)))
-	stdinBuf.Write([]byte(fmt.Sprintf("echo 'command_done:%d' 1>&2\n", cmdCtx.idx)))
+	// The native connections print the command_done markers themselves.
+	if !isNative {
+		stdinBuf := lsc.conn.conn.Stdin()
+		stdinBuf.Write([]byte(fmt.Sprintf("echo 'command_done:%d'\n", cmdCtx.idx)))
+		stdinBuf.Write([]byte(fmt.Sprintf("echo 'command_done:%d' 1>&2\n", cmdCtx.idx)))
+	}
 
 	lsc.changeState(LStreamClientStateConnectedBusy)
 }
@@ -1153,6 +1428,12 @@ func (lsc *LStreamClient) getTimeEnvVars() []string {
 	}
 }
 
+// useGzip returns whether the query output should be gzipped: it is, unless
+// the host is known to have no gzip.
+func (lsc *LStreamClient) useGzip() bool {
+	return useGzip && (lsc.capabilities == nil || lsc.capabilities.Gzip)
+}
+
 func roundUpToNextSecond(t time.Time) time.Time {
 	if t.Nanosecond() == 0 {
 		return t
@@ -1277,6 +1558,12 @@ func (lsc *LStreamClient) handleCommandResultsIfDone(cmdCtx *lstreamCmdCtx) {
 
 	// Command is done.
 
+	// Errors are going to be returned to the caller anyway, but having them in
+	// the internal log too helps when debugging.
+	for _, err := range cmdCtx.errs {
+		lsc.params.Logger.Warnf("Command %d: %s", cmdCtx.idx, err.Error())
+	}
+
 	switch {
 	case cmdCtx.cmd.bootstrap != nil:
 		if cmdCtx.bootstrapCtx.receivedSuccess && len(cmdCtx.errs) == 0 {
@@ -1292,18 +1579,67 @@ func (lsc *LStreamClient) handleCommandResultsIfDone(cmdCtx *lstreamCmdCtx) {
 				})
 			}
 
+			if lsc.capabilities != nil {
+				if cmdCtx.bootstrapCtx.probedCapabilities && lsc.params.CapabilitiesCache != nil {
+					lsc.params.CapabilitiesCache.Put(lsc.params.LogStream.CapabilitiesKey(), *lsc.capabilities)
+				}
+
+				caps := *lsc.capabilities
+				lsc.sendUpdate(&LStreamClientUpdate{
+					Capabilities: &caps,
+				})
+			}
+
 			// Let's now try to autodetect the envelope log format.
+			logFormat := DetectLogFormat(lsc.exampleLogLines)
 			timeFormat, err := GetTimeFormatDescrFromLogLines(lsc.exampleLogLines)
 			if err != nil {
-				cmdCtx.errs = append(cmdCtx.errs, err)
+				if logFormat != LogFormatUnknown && DetectTimeLayout(lsc.exampleLogLines[0]) == "" {
+					err = errors.Errorf(
+						"%s (the logs look like %s, which is not supported: every line must start with a timestamp)",
+						err, logFormat.Descr(),
+					)
+				}
 			} else {
-				// All good
 				lsc.params.Logger.Infof(
-					"Detected time format based on %d log lines: %q",
-					len(lsc.exampleLogLines),
+					"Detected log format %q and time format %q based on %d log lines",
+					logFormat,
 					timeFormat.TimestampLayout,
+					len(lsc.exampleLogLines),
+				)
+
+				// Let the user confirm it, or override it.
+				lsc.sendUpdate(&LStreamClientUpdate{
+					LogFormatDetected: &LogFormatDetected{
+						Format:          logFormat,
+						TimestampLayout: timeFormat.TimestampLayout,
+						ExampleLine:     lsc.exampleLogLines[0],
+					},
+				})
+			}
+
+			if override := lsc.getLogFormatOverride(); override != nil {
+				lsc.params.Logger.Infof(
+					"Using the log format %q and time format %q overridden by the user",
+					override.Format, override.TimestampLayout,
 				)
+
+				logFormat = override.Format
+				if override.TimestampLayout != "" {
+					timeFormat, err = GenerateTimeDescr(override.TimestampLayout)
+					if err != nil {
+						err = errors.Annotatef(err, "overridden timestamp layout %q", override.TimestampLayout)
+					}
+				}
+			}
+
+			if err != nil {
+				cmdCtx.errs = append(cmdCtx.errs, err)
+			} else {
+				// All good
+				lsc.logFormat = logFormat
 				lsc.timeFormat = timeFormat
+
 				lsc.changeState(LStreamClientStateConnectedIdle)
 				return
 			}
@@ -1343,6 +1679,10 @@ func (lsc *LStreamClient) handleCommandResultsIfDone(cmdCtx *lstreamCmdCtx) {
 		lsc.sendCmdResp(resp, summaryCmdError(cmdCtx))
 		lsc.changeState(LStreamClientStateConnectedIdle)
 
+	case cmdCtx.cmd.firstLast != nil:
+		lsc.sendCmdResp(cmdCtx.firstLastCtx.Resp, summaryCmdError(cmdCtx))
+		lsc.changeState(LStreamClientStateConnectedIdle)
+
 	default:
 		panic(fmt.Sprintf("unhandled cmd %+v", cmdCtx.cmd))
 	}
@@ -1412,10 +1752,14 @@ func (lsc *LStreamClient) parseLine(logMsg *LogMsg) error {
 
 	// TODO: offload envelope parsing to Lua (and make it usable from
 	// the user Lua scripts as well).
-	if err := lsc.parseLogMsgEnvelopeDefault(logMsg); err != nil {
+	if err := lsc.parseLogMsgEnvelope(logMsg); err != nil {
 		return errors.Annotatef(err, "parsing envelope")
 	}
 
+	// If the payload is an HTTP access log line (e.g. nginx logging to
+	// syslog), also get the request fields and classify the client.
+	parseAccessLogMsg(logMsg.Msg, logMsg.Context)
+
 	// TODO: offload the custom parsing to Lua
 	if err := lsc.parseLogMsgLevelDefault(logMsg); err != nil {
 		return errors.Annotatef(err, "custom parsing")
@@ -1430,16 +1774,7 @@ func (lsc *LStreamClient) parseLogMsgTimestamp(logMsg *LogMsg) error {
 	msg := logMsg.Msg
 
 	timeLayout := lsc.timeFormat.TimestampLayout
-	timestampLen := len(timeLayout)
-
-	// If the layout ends with the offset like "Z07" or "Z07:00", but the
-	// actual timestamp string is in UTC and it ends with just "Z", we then
-	// need to remove that extra
-	zIdx := strings.Index(timeLayout, "Z07")
-	if zIdx >= 0 && len(msg) >= zIdx && msg[zIdx] == 'Z' {
-		// We have a Z in the timestamp, so there should be no offset after it.
-		timestampLen = zIdx + 1
-	}
+	timestampLen := timestampLenInLine(timeLayout, msg)
 
 	if len(msg) < timestampLen {
 		return errors.Errorf("line %q is too short to have a timestamp", msg)
@@ -1481,7 +1816,52 @@ func (lsc *LStreamClient) parseLogMsgTimestamp(logMsg *LogMsg) error {
 	// Parsed the time successfully; update it in the LogMsg, and also remove the
 	// leading timestamp from the message.
 	logMsg.Time = t
-	logMsg.Msg = strings.TrimSpace(msg[len(timeLayout):])
+	logMsg.Msg = strings.TrimSpace(msg[timestampLen:])
+
+	return nil
+}
+
+// getLogFormatOverride returns the LogFormatOverride for this logstream, or
+// nil if there's none.
+func (lsc *LStreamClient) getLogFormatOverride() *LogFormatOverride {
+	if lsc.params.LogFormatOverrides == nil {
+		return nil
+	}
+
+	override, ok := lsc.params.LogFormatOverrides.Get(lsc.params.LogStream.Name)
+	if !ok {
+		return nil
+	}
+
+	return &override
+}
+
+// parseLogMsgEnvelope takes the LogMsg where the time was already stripped
+// from the Msg, and parses the rest according to the log format: e.g. for
+// JSON, the fields go to the Context, and the Msg becomes just the message
+// field. If the Msg doesn't have the structure of the format, it's left
+// as is.
+//
+// For the unknown format, see parseLogMsgEnvelopeDefault; for the plain text
+// and the access logs (which are parsed later, see parseAccessLogMsg), it's a
+// no-op.
+func (lsc *LStreamClient) parseLogMsgEnvelope(logMsg *LogMsg) error {
+	switch lsc.logFormat {
+	case LogFormatSyslog:
+		parseSyslogEnvelope(logMsg)
+	case LogFormatRFC5424:
+		parseRFC5424LogMsg(logMsg)
+	case LogFormatJSON:
+		parseJSONEnvelope(logMsg)
+	case LogFormatLogfmt:
+		parseLogfmtEnvelope(logMsg)
+	case LogFormatCRI:
+		parseCRIEnvelope(logMsg)
+	case LogFormatPlain, LogFormatAccessLog:
+		// Nothing to parse here.
+	default:
+		return lsc.parseLogMsgEnvelopeDefault(logMsg)
+	}
 
 	return nil
 }
@@ -1495,14 +1875,28 @@ func (lsc *LStreamClient) parseLogMsgTimestamp(logMsg *LogMsg) error {
 // program and pid from it, populates them in the Context, and updates the
 // message to contain the rest of the payload.
 //
-// If the Msg doesn't have this structure, parseLogMsgEnvelopeDefault is a
+// Otherwise, if the Msg looks like an RFC 5424 message (with the timestamp
+// stripped as well), it also populates the msgid and all the structured data
+// in the Context; see rfc5424Envelope.setContext.
+//
+// If the Msg doesn't have either structure, parseLogMsgEnvelopeDefault is a
 // no-op.
 func (lsc *LStreamClient) parseLogMsgEnvelopeDefault(logMsg *LogMsg) error {
+	if !parseSyslogEnvelope(logMsg) {
+		// If the message doesn't match any known pattern either, it's a no-op.
+		parseRFC5424LogMsg(logMsg)
+	}
+
+	return nil
+}
+
+// parseSyslogEnvelope parses the traditional syslog message with the time
+// already stripped, see parseLogMsgEnvelopeDefault. Returns false if the Msg
+// doesn't look like that.
+func parseSyslogEnvelope(logMsg *LogMsg) bool {
 	matches := syslogRegex.FindStringSubmatch(logMsg.Msg)
 	if len(matches) == 0 {
-		// Message doesn't match syslog pattern, no-op
-		// TODO: we might want to support more formats
-		return nil
+		return false
 	}
 
 	// Extract fields from regex match
@@ -1516,13 +1910,32 @@ func (lsc *LStreamClient) parseLogMsgEnvelopeDefault(logMsg *LogMsg) error {
 	logMsg.Context["pid"] = pid
 
 	logMsg.Msg = rest
-	return nil
+	return true
+}
+
+// parseRFC5424LogMsg parses the RFC 5424 message with the time already
+// stripped, see rfc5424Envelope. Returns false if the Msg doesn't look like
+// that.
+func parseRFC5424LogMsg(logMsg *LogMsg) bool {
+	env, err := parseRFC5424Envelope(logMsg.Msg)
+	if err != nil {
+		return false
+	}
+
+	env.setContext(logMsg.Context)
+	logMsg.Msg = env.Msg
+	return true
 }
 
 // parseLogMsgLevelDefault tries to guess what the level of the message could
 // be, based on commonly used patterns in the message like "error", "info",
 // "[E]", "[I]" etc.
 func (lsc *LStreamClient) parseLogMsgLevelDefault(logMsg *LogMsg) error {
+	if logMsg.Level != LogLevelUnknown {
+		// Already known from the envelope, e.g. the "level" field of JSON logs.
+		return nil
+	}
+
 	msg := strings.ToLower(logMsg.Msg)
 
 	switch {
@@ -1654,10 +2067,10 @@ func shellQuote(s string) string {
 
 func agentQueryTimeFormatArgs(awkExpr *TimeFormatAWKExpr) []string {
 	return []string{
-		"--awktime-month", shellQuote(awkExpr.Month),
-		"--awktime-year", shellQuote(awkExpr.Year),
-		"--awktime-day", shellQuote(awkExpr.Day),
-		"--awktime-hhmm", shellQuote(awkExpr.HHMM),
-		"--awktime-minute-key", shellQuote(awkExpr.MinuteKey),
+		"--awktime-month", awkExpr.Month,
+		"--awktime-year", awkExpr.Year,
+		"--awktime-day", awkExpr.Day,
+		"--awktime-hhmm", awkExpr.HHMM,
+		"--awktime-minute-key", awkExpr.MinuteKey,
 	}
 }
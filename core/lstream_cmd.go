@@ -1,6 +1,10 @@
 package core
 
-import "time"
+import (
+	"regexp"
+	"strings"
+	"time"
+)
 
 type lstreamCmd struct {
 	// respCh must be either nil, or 1-buffered and it'll receive exactly one
@@ -12,6 +16,7 @@ type lstreamCmd struct {
 	bootstrap *lstreamCmdBootstrap
 	ping      *lstreamCmdPing
 	queryLogs *lstreamCmdQueryLogs
+	firstLast *lstreamCmdFirstLast
 }
 
 type lstreamCmdCtx struct {
@@ -22,6 +27,7 @@ type lstreamCmdCtx struct {
 	bootstrapCtx *lstreamCmdCtxBootstrap
 	pingCtx      *lstreamCmdCtxPing
 	queryLogsCtx *lstreamCmdCtxQueryLogs
+	firstLastCtx *lstreamCmdCtxFirstLast
 
 	// Initially, stdoutDoneIdx and stderrDoneIdx are set to false. Once we
 	// receive the "command_done" marker from either stdout or stderr, we set the
@@ -60,6 +66,10 @@ type lstreamCmdCtxBootstrap struct {
 	receivedSuccess bool
 	receivedFailure bool
 
+	// probedCapabilities is true if the host capabilities were probed during
+	// this bootstrap (as opposed to being cached).
+	probedCapabilities bool
+
 	// warnJournalctlNoAdminAccess is set to true if journalctl is used and the
 	// user doesn't have access to all the system logs. It's a separate bool
 	// instead of a generic warning message to make it possible to suppress it
@@ -94,6 +104,32 @@ type lstreamCmdQueryLogs struct {
 	// scratch (no-op for journalctl logstreams, because there's no
 	// nerdlog-maintained index for journalctl).
 	refreshIndex bool
+
+	// If maxTransferBytes is not zero, it'll be passed to nerdlog_agent.sh as
+	// --max-transfer-bytes: if the log lines would take more than that, they
+	// won't be returned, and only the estimate will be.
+	maxTransferBytes int
+
+	// If levelStats is true, --level-stats will be passed to nerdlog_agent.sh,
+	// so that the mstats also contain the number of errors and warnings.
+	levelStats bool
+
+	// If cacheTTL is not zero, it'll be passed to nerdlog_agent.sh as
+	// --cache-ttl (in seconds), so that the result is cached on the host.
+	cacheTTL time.Duration
+
+	// stages are passed to nerdlog_agent.sh as --stage, to narrow down the query
+	// and to get the counts after every stage.
+	stages []string
+
+	// ranges are passed to nerdlog_agent.sh as --range, to only look at the
+	// messages within those windows.
+	ranges []TimeRange
+
+	// If activityStats is true, --activity-stats will be passed to
+	// nerdlog_agent.sh, so that it also prints the number of all the lines in
+	// every minute.
+	activityStats bool
 }
 
 type lstreamCmdCtxQueryLogs struct {
@@ -107,3 +143,78 @@ type logfileWithStartingLinenumber struct {
 	filename       string
 	fromLinenumber int
 }
+
+type lstreamCmdFirstLast struct {
+	// from and to are optional; if zero, all available logs are searched,
+	// including older rotated log files.
+	from time.Time
+	to   time.Time
+
+	query string
+}
+
+type lstreamCmdCtxFirstLast struct {
+	Resp *FirstLastResp
+}
+
+// agentInvocation is a single run of the agent script, which is what the
+// bootstrap, queryLogs and firstLast commands boil down to. For the real
+// shells, it's turned into a command line by shellCmd; the connections
+// without a real shell (see nativeConn) get it as is, so they don't need to
+// parse any shell.
+type agentInvocation struct {
+	// env are the extra env vars like "CUR_YEAR=2025", see getTimeEnvVars.
+	env []string
+
+	// args are the agent args, starting with the agent command like "query".
+	// They are not shell-quoted.
+	args []string
+
+	// sudo is whether the agent should be run with "sudo -n".
+	sudo bool
+
+	// wrappers are the resource guard wrappers like "nice -n 10", see
+	// resourceGuardArgs.
+	wrappers []string
+
+	// gzip is whether the output should be gzipped, and enclosed between the
+	// gzipStartMarker and gzipEndMarker.
+	gzip bool
+}
+
+// shellCmd returns the shell command line which runs the agent at the given
+// path, without the trailing newline.
+func (inv *agentInvocation) shellCmd(agentPath string) string {
+	var parts []string
+
+	if inv.gzip {
+		parts = append(parts, "echo", gzipStartMarker, ";")
+	}
+
+	if inv.sudo {
+		parts = append(parts, "sudo", "-n")
+	}
+
+	parts = append(parts, inv.env...)
+	parts = append(parts, inv.wrappers...)
+	parts = append(parts, "bash", shellQuote(agentPath))
+
+	for _, arg := range inv.args {
+		if shellSafeArgRegex.MatchString(arg) {
+			parts = append(parts, arg)
+		} else {
+			parts = append(parts, shellQuote(arg))
+		}
+	}
+
+	if inv.gzip {
+		parts = append(parts, "|", "gzip", ";", "echo", gzipEndMarker)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// shellSafeArgRegex matches the agent args which don't need quoting, like
+// "query" or "--level-stats"; it's only to keep the command lines readable in
+// the logs.
+var shellSafeArgRegex = regexp.MustCompile(`^[-a-z_]+$`)
@@ -32,6 +32,9 @@ type LStreamsManager struct {
 	// lscBusyStages only contains items for lstreams which are in the
 	// LStreamClientStateConnectedBusy state.
 	lscBusyStages map[string]BusyStage
+	// lscCapabilities contains the host capabilities for the lstreams which
+	// have bootstrapped at least once.
+	lscCapabilities map[string]HostCapabilities
 
 	// lscPendingTeardown contains info about LStreamClient-s that are being torn
 	// down. NOTE that when a LStreamClient starts tearing down, its key changes
@@ -55,6 +58,7 @@ type LStreamsManager struct {
 	torndownCh chan struct{}
 
 	curQueryLogsCtx *manQueryLogsCtx
+	curFirstLastCtx *manFirstLastCtx
 
 	curLogs manLogsCtx
 }
@@ -85,6 +89,23 @@ type LStreamsManagerParams struct {
 
 	UpdatesCh chan<- LStreamsManagerUpdate
 
+	// CapabilitiesCache is optional, see LStreamClientParams.CapabilitiesCache.
+	CapabilitiesCache CapabilitiesCache
+
+	// LogFormatOverrides is optional, see LStreamClientParams.LogFormatOverrides.
+	LogFormatOverrides LogFormatOverrides
+
+	// AuthCallback is optional; if set, it's used to supply the credentials
+	// programmatically, see ShellTransportSSHParams.AuthCallback.
+	AuthCallback AuthCallback
+
+	// AllowPasswordAuth, see ShellTransportSSHParams.AllowPasswordAuth.
+	AllowPasswordAuth bool
+
+	// ShellTransportFactory is optional; if set, it creates the transports for
+	// all the logstreams, e.g. coretest.ShellTransportFake in tests.
+	ShellTransportFactory ShellTransportFactory
+
 	Clock clock.Clock
 }
 
@@ -104,6 +125,7 @@ func NewLStreamsManager(params LStreamsManagerParams) *LStreamsManager {
 		lscStates:          map[string]LStreamClientState{},
 		lscConnDetails:     map[string]ConnDetails{},
 		lscBusyStages:      map[string]BusyStage{},
+		lscCapabilities:    map[string]HostCapabilities{},
 		lscPendingTeardown: map[string]int{},
 
 		lstreamUpdatesCh: make(chan *LStreamClientUpdate, 1024),
@@ -166,6 +188,7 @@ func (lsman *LStreamsManager) updateHAs() {
 		delete(lsman.lscStates, key)
 		delete(lsman.lscConnDetails, key)
 		delete(lsman.lscBusyStages, key)
+		delete(lsman.lscCapabilities, key)
 
 		keyNew := fmt.Sprintf("OLD_%s_%s", lsman.randomString(4), key)
 		lsman.lscPendingTeardown[keyNew] += 1
@@ -186,7 +209,14 @@ func (lsman *LStreamsManager) updateHAs() {
 			Logger:    lsman.params.Logger,
 			ClientID:  lsman.params.ClientID, //fmt.Sprintf("%s-%d", lsman.params.ClientID, rand.Int()),
 			UpdatesCh: lsman.lstreamUpdatesCh,
-			Clock:     lsman.params.Clock,
+
+			CapabilitiesCache:     lsman.params.CapabilitiesCache,
+			LogFormatOverrides:    lsman.params.LogFormatOverrides,
+			AuthCallback:          lsman.params.AuthCallback,
+			AllowPasswordAuth:     lsman.params.AllowPasswordAuth,
+			ShellTransportFactory: lsman.params.ShellTransportFactory,
+
+			Clock: lsman.params.Clock,
 		})
 		lsman.lscs[key] = lsc
 		lsman.lscStates[key] = LStreamClientStateDisconnected
@@ -253,9 +283,22 @@ func (lsman *LStreamsManager) run() {
 					},
 				}
 				lsman.params.UpdatesCh <- upd
+			} else if upd.LogFormatDetected != nil {
+				lsman.params.Logger.Verbose1f("LogFormatDetected for %s: %+v", upd.Name, *upd.LogFormatDetected)
+
+				detected := *upd.LogFormatDetected
+				detected.LStreamName = upd.Name
+				lsman.params.UpdatesCh <- LStreamsManagerUpdate{
+					LogFormatDetected: &detected,
+				}
 			} else if upd.BusyStage != nil {
 				lsman.lscBusyStages[upd.Name] = *upd.BusyStage
 				lsman.sendStateUpdate()
+			} else if upd.Capabilities != nil {
+				if _, ok := lsman.lscStates[upd.Name]; ok {
+					lsman.lscCapabilities[upd.Name] = *upd.Capabilities
+					lsman.sendStateUpdate()
+				}
 			} else if upd.DataRequest != nil {
 				lsman.params.UpdatesCh <- LStreamsManagerUpdate{
 					DataRequest: upd.DataRequest,
@@ -328,17 +371,25 @@ func (lsman *LStreamsManager) run() {
 					continue
 				}
 
-				if lsman.curQueryLogsCtx != nil {
+				if lsman.isBusy() {
 					lsman.sendLogRespUpdate(&LogRespTotal{
 						Errs: []error{ErrBusyWithAnotherQuery},
 					})
 					continue
 				}
 
-				if req.queryLogs.MaxNumLines == 0 {
+				if req.queryLogs.MaxNumLines == 0 && !req.queryLogs.CountOnly {
 					panic("req.queryLogs.MaxNumLines is zero")
 				}
 
+				if req.queryLogs.CountOnly && req.queryLogs.LoadEarlier {
+					// There's nothing to load: no logs were fetched in the first place.
+					lsman.sendLogRespUpdate(&LogRespTotal{
+						Errs: []error{errors.Errorf("can't load earlier logs in count-only mode")},
+					})
+					continue
+				}
+
 				lsman.curQueryLogsCtx = &manQueryLogsCtx{
 					req:       req.queryLogs,
 					startTime: lsman.params.Clock.Now(),
@@ -349,9 +400,35 @@ func (lsman *LStreamsManager) run() {
 				// sendStateUpdate must be done after setting curQueryLogsCtx.
 				lsman.sendStateUpdate()
 
+				// Split the transfer budget among the logstreams.
+				maxTransferBytes := 0
+				if req.queryLogs.MaxTransferBytes > 0 {
+					maxTransferBytes = req.queryLogs.MaxTransferBytes / len(lsman.lscs)
+					if maxTransferBytes == 0 {
+						maxTransferBytes = 1
+					}
+				}
+
+				// In count-only mode, we just ask the agent for zero lines, so it only
+				// returns the stats.
+				maxNumLines := req.queryLogs.MaxNumLines
+				if req.queryLogs.CountOnly {
+					maxNumLines = 0
+				}
+
 				for lstreamName, lsc := range lsman.lscs {
 					cmdQueryLogs := lstreamCmdQueryLogs{
-						maxNumLines: req.queryLogs.MaxNumLines,
+						maxNumLines:      maxNumLines,
+						maxTransferBytes: maxTransferBytes,
+						levelStats:       req.queryLogs.LevelStats,
+						cacheTTL:         req.queryLogs.CacheTTL,
+						stages:           req.queryLogs.Stages,
+						ranges:           req.queryLogs.Ranges,
+
+						// The gaps are only found for the whole time range, so no need
+						// to count anything when loading more of the same logs.
+						activityStats: (req.queryLogs.GapThreshold > 0 || req.queryLogs.ActivityStats) &&
+							!req.queryLogs.LoadEarlier,
 
 						from:  req.queryLogs.From,
 						to:    req.queryLogs.To,
@@ -394,11 +471,54 @@ func (lsman *LStreamsManager) run() {
 					})
 				}
 
+			case req.findFirstLast != nil:
+				if len(lsman.lscs) == 0 {
+					lsman.sendFirstLastRespUpdate(&FirstLastRespTotal{
+						Errs: []error{errors.Errorf("no matching lstreams to get logs from")},
+					})
+					continue
+				}
+
+				if lsman.numNotConnected > 0 {
+					lsman.sendFirstLastRespUpdate(&FirstLastRespTotal{
+						Errs: []error{ErrNotYetConnected},
+					})
+					continue
+				}
+
+				if lsman.isBusy() {
+					lsman.sendFirstLastRespUpdate(&FirstLastRespTotal{
+						Errs: []error{ErrBusyWithAnotherQuery},
+					})
+					continue
+				}
+
+				lsman.curFirstLastCtx = &manFirstLastCtx{
+					req:       req.findFirstLast,
+					startTime: lsman.params.Clock.Now(),
+					resps:     make(map[string]*FirstLastResp, len(lsman.lscs)),
+					errs:      map[string]error{},
+				}
+
+				// sendStateUpdate must be done after setting curFirstLastCtx.
+				lsman.sendStateUpdate()
+
+				for _, lsc := range lsman.lscs {
+					lsc.EnqueueCmd(lstreamCmd{
+						respCh: lsman.respCh,
+						firstLast: &lstreamCmdFirstLast{
+							from:  req.findFirstLast.From,
+							to:    req.findFirstLast.To,
+							query: req.findFirstLast.Query,
+						},
+					})
+				}
+
 			case req.updLStreams != nil:
 				r := req.updLStreams
 				lsman.params.Logger.Infof("LStreams manager: update logstreams spec: %s", r.logStreamsSpec)
 
-				if lsman.curQueryLogsCtx != nil {
+				if lsman.isBusy() {
 					r.resCh <- ErrBusyWithAnotherQuery
 					continue
 				}
@@ -423,10 +543,7 @@ func (lsman *LStreamsManager) run() {
 
 			case req.reconnect:
 				lsman.params.Logger.Infof("Reconnect command")
-				if lsman.curQueryLogsCtx != nil {
-					lsman.params.Logger.Infof("Forgetting the in-progress query")
-					lsman.curQueryLogsCtx = nil
-				}
+				lsman.forgetInProgressQueries()
 				for _, lsc := range lsman.lscs {
 					lsc.Reconnect()
 				}
@@ -439,10 +556,7 @@ func (lsman *LStreamsManager) run() {
 
 			case req.disconnect:
 				lsman.params.Logger.Infof("Disconnect command")
-				if lsman.curQueryLogsCtx != nil {
-					lsman.params.Logger.Infof("Forgetting the in-progress query")
-					lsman.curQueryLogsCtx = nil
-				}
+				lsman.forgetInProgressQueries()
 				lsman.setLStreams("")
 
 				lsman.updateHAs()
@@ -489,6 +603,34 @@ func (lsman *LStreamsManager) run() {
 					panic(fmt.Sprintf("unexpected resp type %T", v))
 				}
 
+			case lsman.curFirstLastCtx != nil:
+				if resp.err != nil {
+					lsman.params.Logger.Errorf("Got an error response from %v: %s", resp.hostname, resp.err)
+					lsman.curFirstLastCtx.errs[resp.hostname] = resp.err
+				}
+
+				switch v := resp.resp.(type) {
+				case *FirstLastResp:
+					lsman.curFirstLastCtx.resps[resp.hostname] = v
+
+					if len(lsman.curFirstLastCtx.resps) == len(lsman.lscs) {
+						lsman.params.Logger.Verbose1f(
+							"Got first/last from %v, this was the last one, lookup is completed",
+							resp.hostname,
+						)
+
+						lsman.mergeFirstLastRespsAndSend()
+
+						lsman.curFirstLastCtx = nil
+
+						// sendStateUpdate must be done after setting curFirstLastCtx.
+						lsman.sendStateUpdate()
+					}
+
+				default:
+					panic(fmt.Sprintf("unexpected resp type %T", v))
+				}
+
 			default:
 				lsman.params.Logger.Errorf("Dropping update from %s on the floor", resp.hostname)
 			}
@@ -570,11 +712,12 @@ func (lsman *LStreamsManager) Wait() {
 type lstreamsManagerReq struct {
 	// Exactly one field must be non-nil
 
-	queryLogs   *QueryLogsParams
-	updLStreams *lstreamsManagerReqUpdLStreams
-	ping        bool
-	reconnect   bool
-	disconnect  bool
+	queryLogs     *QueryLogsParams
+	findFirstLast *FindFirstLastParams
+	updLStreams   *lstreamsManagerReqUpdLStreams
+	ping          bool
+	reconnect     bool
+	disconnect    bool
 }
 
 type lstreamsManagerReqUpdLStreams struct {
@@ -589,6 +732,16 @@ func (lsman *LStreamsManager) QueryLogs(params QueryLogsParams) {
 	}
 }
 
+// FindFirstLast initiates the lookup of the first and the last log messages
+// matching the query, for every logstream. The result will be delivered as an
+// update with the FirstLastResp field set.
+func (lsman *LStreamsManager) FindFirstLast(params FindFirstLastParams) {
+	lsman.params.Logger.Verbose1f("FindFirstLast: %+v", params)
+	lsman.reqCh <- lstreamsManagerReq{
+		findFirstLast: &params,
+	}
+}
+
 func (lsman *LStreamsManager) SetLStreams(logStreamsSpec string) error {
 	resCh := make(chan error, 1)
 
@@ -631,9 +784,25 @@ type manQueryLogsCtx struct {
 	errs  map[string]error
 }
 
+type manFirstLastCtx struct {
+	req *FindFirstLastParams
+
+	startTime time.Time
+
+	// resps is a map from logstream name to its response.
+	resps map[string]*FirstLastResp
+	errs  map[string]error
+}
+
 type manLogsCtx struct {
 	minuteStats  map[int64]MinuteStatsItem
 	numMsgsTotal int
+	stageCounts  []int
+	gaps         []TimeGap
+
+	// activityStats is only populated if QueryLogsParams.ActivityStats or
+	// GapThreshold was given; see LogRespTotal.ActivityStats.
+	activityStats map[int64]int
 
 	perNode map[string]*manLogsNodeCtx
 }
@@ -641,15 +810,22 @@ type manLogsCtx struct {
 type manLogsNodeCtx struct {
 	logs          []LogMsg
 	isMaxNumLines bool
+
+	// pending is only used with QueryLogsParams.Streaming: it contains the logs
+	// which weren't returned yet, while logs only contains the earliest ones,
+	// needed for LoadEarlier.
+	pending []LogMsg
 }
 
 type LStreamsManagerUpdate struct {
 	// Exactly one of the fields below must be non-nil
 
-	State   *LStreamsManagerState
-	LogResp *LogRespTotal
+	State         *LStreamsManagerState
+	LogResp       *LogRespTotal
+	FirstLastResp *FirstLastRespTotal
 
-	BootstrapIssue *BootstrapIssue
+	BootstrapIssue    *BootstrapIssue
+	LogFormatDetected *LogFormatDetected
 
 	DataRequest *ShellConnDataRequest
 }
@@ -675,8 +851,16 @@ type LStreamsManagerState struct {
 	ConnDetailsByLStream map[string]ConnDetails
 	BusyStageByLStream   map[string]BusyStage
 
+	// CapabilitiesByLStream contains the host capabilities for the lstreams
+	// which have bootstrapped at least once.
+	CapabilitiesByLStream map[string]HostCapabilities
+
 	// TearingDown contains logstream names whic are in the process of teardown.
 	TearingDown []string
+
+	// DisplayNames is a map from the logstream name to its display name, for
+	// the logstreams which have it configured.
+	DisplayNames map[string]string
 }
 
 type BootstrapIssue struct {
@@ -727,6 +911,11 @@ func (lsman *LStreamsManager) sendStateUpdate() {
 		busyStagesCopy[k] = v
 	}
 
+	capabilitiesCopy := make(map[string]HostCapabilities, len(lsman.lscCapabilities))
+	for k, v := range lsman.lscCapabilities {
+		capabilitiesCopy[k] = v
+	}
+
 	tearingDown := make([]string, 0, len(lsman.lscPendingTeardown))
 	for k, num := range lsman.lscPendingTeardown {
 		for i := 0; i < num; i++ {
@@ -735,6 +924,13 @@ func (lsman *LStreamsManager) sendStateUpdate() {
 	}
 	sort.Strings(tearingDown)
 
+	displayNames := map[string]string{}
+	for name, ls := range lsman.parsedLogStreams {
+		if ls.Options.DisplayName != "" {
+			displayNames[name] = ls.Options.DisplayName
+		}
+	}
+
 	upd := LStreamsManagerUpdate{
 		State: &LStreamsManagerState{
 			NumLStreams:          len(lsman.lscs),
@@ -742,10 +938,13 @@ func (lsman *LStreamsManager) sendStateUpdate() {
 			NumConnected:         numConnected,
 			NoMatchingLStreams:   lsman.numNotConnected == 0 && numConnected == 0,
 			Connected:            lsman.numNotConnected == 0 && numConnected > 0,
-			Busy:                 lsman.curQueryLogsCtx != nil,
+			Busy:                 lsman.isBusy(),
 			ConnDetailsByLStream: connDetailsCopy,
 			BusyStageByLStream:   busyStagesCopy,
-			TearingDown:          tearingDown,
+
+			CapabilitiesByLStream: capabilitiesCopy,
+			TearingDown:           tearingDown,
+			DisplayNames:          displayNames,
 		},
 	}
 
@@ -762,6 +961,56 @@ func (lsman *LStreamsManager) sendLogRespUpdate(resp *LogRespTotal) {
 	}
 }
 
+func (lsman *LStreamsManager) sendFirstLastRespUpdate(resp *FirstLastRespTotal) {
+	if lsman.curFirstLastCtx != nil {
+		resp.QueryDur = time.Since(lsman.curFirstLastCtx.startTime)
+	}
+
+	lsman.params.UpdatesCh <- LStreamsManagerUpdate{
+		FirstLastResp: resp,
+	}
+}
+
+// isBusy returns true if there is any query in progress (either a regular
+// logs query, or a first/last occurrence lookup).
+func (lsman *LStreamsManager) isBusy() bool {
+	return lsman.curQueryLogsCtx != nil || lsman.curFirstLastCtx != nil
+}
+
+// forgetInProgressQueries drops whatever queries are in progress; the
+// responses to them, if any, will be dropped on the floor.
+func (lsman *LStreamsManager) forgetInProgressQueries() {
+	if lsman.isBusy() {
+		lsman.params.Logger.Infof("Forgetting the in-progress query")
+		lsman.curQueryLogsCtx = nil
+		lsman.curFirstLastCtx = nil
+	}
+}
+
+func (lsman *LStreamsManager) mergeFirstLastRespsAndSend() {
+	ret := &FirstLastRespTotal{
+		PerLStream: make(map[string]FirstLastResp, len(lsman.curFirstLastCtx.resps)),
+	}
+
+	for lstreamName, err := range lsman.curFirstLastCtx.errs {
+		ret.Errs = append(ret.Errs, errors.Annotatef(err, "%s", lstreamName))
+	}
+
+	sort.Slice(ret.Errs, func(i, j int) bool {
+		return ret.Errs[i].Error() < ret.Errs[j].Error()
+	})
+
+	for lstreamName, resp := range lsman.curFirstLastCtx.resps {
+		if _, ok := lsman.curFirstLastCtx.errs[lstreamName]; ok {
+			continue
+		}
+
+		ret.PerLStream[lstreamName] = *resp
+	}
+
+	lsman.sendFirstLastRespUpdate(ret)
+}
+
 func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 	resps := lsman.curQueryLogsCtx.resps
 	errs := lsman.curQueryLogsCtx.errs
@@ -783,32 +1032,98 @@ func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 		return
 	}
 
+	// If any of the logstreams would exceed its share of the transfer budget,
+	// we drop the logs from all of them (since having logs only from some
+	// logstreams would be misleading), and only keep the stats.
+	transferBytes := 0
+	transferBudgetExceeded := false
+	for _, resp := range resps {
+		transferBytes += resp.TransferBytes
+		if resp.TransferBudgetExceeded {
+			transferBudgetExceeded = true
+		}
+	}
+
 	// If we're not adding to already existing logs, reset w/e we've had already,
 	// and calculate minuteStats from the resps.
 	if !lsman.curQueryLogsCtx.req.LoadEarlier {
+		req := lsman.curQueryLogsCtx.req
+
 		lsman.curLogs = manLogsCtx{
 			minuteStats: map[int64]MinuteStatsItem{},
 			perNode:     map[string]*manLogsNodeCtx{},
 		}
 
+		// If the time range is until now, the current minute is not over yet,
+		// so it doesn't count.
+		gapsTo := req.To
+		if gapsTo.IsZero() {
+			gapsTo = lsman.params.Clock.Now().Truncate(time.Minute)
+		}
+
 		for nodeName, resp := range resps {
 			for k, v := range resp.MinuteStats {
+				prev := lsman.curLogs.minuteStats[k]
 				lsman.curLogs.minuteStats[k] = MinuteStatsItem{
-					NumMsgs: lsman.curLogs.minuteStats[k].NumMsgs + v.NumMsgs,
+					NumMsgs:     prev.NumMsgs + v.NumMsgs,
+					NumErrors:   prev.NumErrors + v.NumErrors,
+					NumWarnings: prev.NumWarnings + v.NumWarnings,
 				}
 
 				lsman.curLogs.numMsgsTotal += v.NumMsgs
 			}
 
+			lsman.curLogs.stageCounts = addStageCounts(lsman.curLogs.stageCounts, resp.StageCounts)
+
+			for k, v := range resp.ActivityStats {
+				if lsman.curLogs.activityStats == nil {
+					lsman.curLogs.activityStats = map[int64]int{}
+				}
+
+				lsman.curLogs.activityStats[k] += v
+			}
+
+			if req.GapThreshold > 0 {
+				lsman.curLogs.gaps = append(
+					lsman.curLogs.gaps,
+					findTimeGaps(nodeName, resp.ActivityStats, req.From, gapsTo, req.GapThreshold)...,
+				)
+			}
+
+			if transferBudgetExceeded {
+				lsman.curLogs.perNode[nodeName] = &manLogsNodeCtx{}
+				continue
+			}
+
 			lsman.curLogs.perNode[nodeName] = &manLogsNodeCtx{
 				logs:          resp.Logs,
-				isMaxNumLines: len(resp.Logs) == lsman.curQueryLogsCtx.req.MaxNumLines,
+				isMaxNumLines: !req.CountOnly && len(resp.Logs) == req.MaxNumLines,
+			}
+
+			if req.Streaming {
+				lsman.curLogs.perNode[nodeName].pending = resp.Logs
 			}
 		}
-	} else {
+
+		sort.Slice(lsman.curLogs.gaps, func(i, j int) bool {
+			a, b := lsman.curLogs.gaps[i], lsman.curLogs.gaps[j]
+			if a.LStream != b.LStream {
+				return a.LStream < b.LStream
+			}
+
+			return a.From.Before(b.From)
+		})
+	} else if !transferBudgetExceeded {
 		// Add to existing logs
 		for nodeName, resp := range resps {
 			pn := lsman.curLogs.perNode[nodeName]
+
+			if lsman.curQueryLogsCtx.req.Streaming {
+				pending := make([]LogMsg, 0, len(resp.Logs)+len(pn.pending))
+				pending = append(pending, resp.Logs...)
+				pn.pending = append(pending, pn.pending...)
+			}
+
 			pn.logs = append(resp.Logs, pn.logs...)
 			pn.isMaxNumLines = len(resp.Logs) == lsman.curQueryLogsCtx.req.MaxNumLines
 		}
@@ -823,17 +1138,49 @@ func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 	ret := &LogRespTotal{
 		MinuteStats:   lsman.curLogs.minuteStats,
 		NumMsgsTotal:  lsman.curLogs.numMsgsTotal,
+		StageCounts:   lsman.curLogs.stageCounts,
+		Gaps:          lsman.curLogs.gaps,
+		ActivityStats: lsman.curLogs.activityStats,
+		CountOnly:     lsman.curQueryLogsCtx.req.CountOnly,
 		LoadedEarlier: lsman.curQueryLogsCtx.req.LoadEarlier,
 		DebugInfo:     debugInfo,
+
+		TransferBytes:          transferBytes,
+		TransferBudgetExceeded: transferBudgetExceeded,
 	}
 
 	var logsCoveredSince time.Time
 
-	for _, pn := range lsman.curLogs.perNode {
-		ret.Logs = append(ret.Logs, pn.logs...)
+	streaming := lsman.curQueryLogsCtx.req.Streaming
+
+	maxLStreamRate := lsman.curQueryLogsCtx.req.MaxLStreamRate
+	if streaming {
+		maxLStreamRate = 0
+	}
+
+	for nodeName, pn := range lsman.curLogs.perNode {
+		logs := pn.logs
+		if streaming {
+			logs = pn.pending
+		}
+
+		if maxLStreamRate > 0 {
+			var numDropped int
+			logs, numDropped = throttleLogs(logs, maxLStreamRate)
+			if numDropped > 0 {
+				if ret.Throttled == nil {
+					ret.Throttled = map[string]int{}
+				}
+
+				ret.Throttled[nodeName] = numDropped
+			}
+		}
+
+		ret.Logs = append(ret.Logs, logs...)
 
 		// If the timespan covered by logs from this logstream is shorter than what
-		// we've seen before, remember it.
+		// we've seen before, remember it. The throttled logstreams count too:
+		// before that timespan, we don't have their logs at all, throttled or not.
 		if pn.isMaxNumLines && logsCoveredSince.Before(pn.logs[0].Time) {
 			logsCoveredSince = pn.logs[0].Time
 		}
@@ -855,6 +1202,24 @@ func (lsman *LStreamsManager) mergeLogRespsAndSend() {
 	})
 	ret.Logs = ret.Logs[coveredSinceIdx:]
 
+	if streaming {
+		// Forget everything we're returning now, except the earliest logs of every
+		// logstream, which are needed to load the earlier ones.
+		for _, pn := range lsman.curLogs.perNode {
+			var pending []LogMsg
+			for _, msg := range pn.pending {
+				if msg.Time.Before(logsCoveredSince) {
+					pending = append(pending, msg)
+				}
+			}
+			pn.pending = pending
+
+			if earliest := getEarliestTimeAndNumMsgs(pn.logs); earliest != nil {
+				pn.logs = pn.logs[:earliest.numMsgs]
+			}
+		}
+	}
+
 	lsman.sendLogRespUpdate(ret)
 }
 
@@ -868,3 +1233,88 @@ func (lsman *LStreamsManager) randomString(length int) string {
 	}
 	return string(prefix)
 }
+
+// throttleLogs leaves at most maxPerSec messages in every second of the
+// logs, which must be sorted by time, and returns them together with the
+// number of the dropped ones.
+func throttleLogs(logs []LogMsg, maxPerSec int) ([]LogMsg, int) {
+	ret := make([]LogMsg, 0, len(logs))
+	numDropped := 0
+
+	var curSec int64
+	numInSec := 0
+	for _, msg := range logs {
+		if sec := msg.Time.Unix(); sec != curSec {
+			curSec = sec
+			numInSec = 0
+		}
+
+		if numInSec >= maxPerSec {
+			numDropped++
+			continue
+		}
+
+		ret = append(ret, msg)
+		numInSec++
+	}
+
+	return ret, numDropped
+}
+
+// addStageCounts adds the stage counts from b to a (which might be shorter,
+// e.g. empty), and returns the result.
+func addStageCounts(a, b []int) []int {
+	for i, n := range b {
+		if i >= len(a) {
+			a = append(a, 0)
+		}
+		a[i] += n
+	}
+
+	return a
+}
+
+// findTimeGaps returns the periods of at least threshold long within [from,
+// to) when the given logstream had no lines at all, according to the
+// activity stats (a map from the unix timestamp of a minute to the number of
+// lines in it).
+func findTimeGaps(
+	lstreamName string, activity map[int64]int, from, to time.Time, threshold time.Duration,
+) []TimeGap {
+	if from.IsZero() || !from.Before(to) {
+		return nil
+	}
+
+	// The minute which contains from counts as a whole.
+	from = from.Truncate(time.Minute)
+
+	var ret []TimeGap
+	var gapFrom time.Time
+
+	addGap := func(gapTo time.Time) {
+		if !gapFrom.IsZero() && gapTo.Sub(gapFrom) >= threshold {
+			ret = append(ret, TimeGap{
+				LStream: lstreamName,
+				From:    gapFrom,
+				To:      gapTo,
+			})
+		}
+
+		gapFrom = time.Time{}
+	}
+
+	for t := from; t.Before(to); t = t.Add(time.Minute) {
+		if activity[t.Unix()] > 0 {
+			addGap(t)
+			continue
+		}
+
+		if gapFrom.IsZero() {
+			gapFrom = t
+		}
+	}
+
+	addGap(to)
+
+	return ret
+}
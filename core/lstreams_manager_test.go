@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindTimeGaps(t *testing.T) {
+	from := time.Date(2025, 3, 11, 23, 0, 30, 0, time.UTC)
+	to := time.Date(2025, 3, 11, 23, 20, 0, 0, time.UTC)
+	minute := func(m int) time.Time {
+		return time.Date(2025, 3, 11, 23, m, 0, 0, time.UTC)
+	}
+
+	activity := map[int64]int{
+		minute(1).Unix():  3,
+		minute(2).Unix():  1,
+		minute(8).Unix():  5,
+		minute(10).Unix(): 2,
+	}
+
+	// The silence in the very beginning is too short, the one between 23:08
+	// and 23:10 too, and the one at the end lasts until the end of the range.
+	assert.Equal(t, []TimeGap{
+		{LStream: "host1", From: minute(3), To: minute(8)},
+		{LStream: "host1", From: minute(11), To: minute(20)},
+	}, findTimeGaps("host1", activity, from, to, 3*time.Minute))
+
+	// No activity at all is a single gap over the whole range.
+	assert.Equal(t, []TimeGap{
+		{LStream: "host1", From: minute(0), To: minute(20)},
+	}, findTimeGaps("host1", nil, from, to, 3*time.Minute))
+
+	assert.Nil(t, findTimeGaps("host1", nil, time.Time{}, to, 3*time.Minute))
+}
+
+func TestThrottleLogs(t *testing.T) {
+	t0 := time.Date(2025, 3, 11, 23, 0, 0, 0, time.UTC)
+	newMsg := func(millis int) LogMsg {
+		return LogMsg{Time: t0.Add(time.Duration(millis) * time.Millisecond)}
+	}
+
+	logs := []LogMsg{
+		newMsg(0), newMsg(100), newMsg(200), newMsg(300),
+		newMsg(1500),
+		newMsg(2000), newMsg(2999), newMsg(2999),
+	}
+
+	throttled, numDropped := throttleLogs(logs, 2)
+	assert.Equal(t, []LogMsg{
+		newMsg(0), newMsg(100),
+		newMsg(1500),
+		newMsg(2000), newMsg(2999),
+	}, throttled)
+	assert.Equal(t, 3, numDropped)
+
+	throttled, numDropped = throttleLogs(logs, 10)
+	assert.Equal(t, logs, throttled)
+	assert.Equal(t, 0, numDropped)
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/dimonomid/nerdlog/shellescape"
 	"github.com/dimonomid/ssh_config"
@@ -80,6 +81,21 @@ type LogStreamOptions struct {
 	// custom env vars for tests, like: "export TZ=America/New_York", but
 	// might be useful outside of tests as well.
 	ShellInit []string
+
+	// NativeScan means that for localhost, the log files are scanned natively
+	// instead of running the agent script in a local shell.
+	NativeScan bool
+
+	// Nice, IONice and Timeout limit the resources which the agent script can
+	// use on the host; see ConfigLogStreamOptions for details. Zero values
+	// mean no limits.
+	Nice    int
+	IONice  string
+	Timeout time.Duration
+
+	// DisplayName is shown in the UI instead of the logstream name, if
+	// non-empty.
+	DisplayName string
 }
 
 // SudoMode can be used to configure nerdlog to read log files with "sudo -n".
@@ -486,6 +502,35 @@ func expandFromLogStreamsConfig(
 				lsCopy.options.ShellInit = matchedItem.Options.ShellInit
 			}
 
+			if !lsCopy.options.NativeScan {
+				lsCopy.options.NativeScan = matchedItem.Options.NativeScan
+			}
+
+			if lsCopy.options.Nice == 0 {
+				lsCopy.options.Nice = matchedItem.Options.Nice
+			}
+
+			if lsCopy.options.IONice == "" {
+				if err := ValidateIONice(matchedItem.Options.IONice); err != nil {
+					return nil, errors.Annotatef(err, "logstream %s", matchedItem.Key)
+				}
+
+				lsCopy.options.IONice = matchedItem.Options.IONice
+			}
+
+			if lsCopy.options.Timeout == 0 {
+				timeout, err := matchedItem.Options.ParseTimeout()
+				if err != nil {
+					return nil, errors.Annotatef(err, "logstream %s", matchedItem.Key)
+				}
+
+				lsCopy.options.Timeout = timeout
+			}
+
+			if lsCopy.options.DisplayName == "" {
+				lsCopy.options.DisplayName = matchedItem.Options.DisplayName
+			}
+
 			if len(lsCopy.logFiles) == 0 {
 				lsCopy.logFiles = matchedItem.LogFiles
 			}
@@ -577,6 +622,18 @@ func portFromAddr(addr string) (string, error) {
 	return parts[1], nil
 }
 
+// SSHConfigHostNames returns the sorted names of the hosts from the ssh
+// config which can be used as logstreams, i.e. the ones which the globs in the
+// logstream specs are matched against.
+func SSHConfigHostNames(sshConfig *ssh_config.Config) ([]string, error) {
+	lsConfig, err := sshConfigToLSConfig(sshConfig)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return lsConfig.Keys(), nil
+}
+
 func sshConfigToLSConfig(sshConfig *ssh_config.Config) (ConfigLogStreams, error) {
 	if sshConfig == nil {
 		return nil, nil
@@ -5,6 +5,7 @@ import (
 	_ "embed"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/dimonomid/ssh_config"
 	"github.com/stretchr/testify/assert"
@@ -85,6 +86,14 @@ var testConfigLogStreams1 = ConfigLogStreams(map[string]ConfigLogStream{
 			},
 		},
 	},
+
+	"my-local-native": ConfigLogStream{
+		Hostname: "localhost",
+		LogFiles: []string{"/var/log/app.log"},
+		Options: ConfigLogStreamOptions{
+			NativeScan: true,
+		},
+	},
 })
 
 type resolverTestCase struct {
@@ -1378,3 +1387,194 @@ func TestLStreamsResolverShellInit(t *testing.T) {
 		})
 	}
 }
+
+func TestLStreamsResolverNativeScan(t *testing.T) {
+	tests := []resolverTestCase{
+		{
+			name:   "localhost with native scan",
+			osUser: "osuser",
+
+			configLogStreams: testConfigLogStreams1,
+			sshConfig:        testSSHConfig1,
+
+			input: "my-local-native",
+
+			wantStreams: map[string]LogStream{
+				"my-local-native": {
+					Name: "my-local-native",
+					Transport: ConfigLogStreamShellTransport{
+						Localhost: &ConfigLogStreamShellTransportLocalhost{},
+					},
+					LogFiles: []string{"/var/log/app.log", "auto"},
+					Options: LogStreamOptions{
+						NativeScan: true,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runResolverTestCase(t, tt)
+		})
+	}
+}
+
+func TestLStreamsResolverResourceGuard(t *testing.T) {
+	tests := []resolverTestCase{
+		{
+			name:   "nice, ionice and timeout",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"myhost": {
+					Options: ConfigLogStreamOptions{
+						Nice:    10,
+						IONice:  "best-effort:7",
+						Timeout: "5m",
+					},
+				},
+			}),
+
+			input: "myhost",
+
+			wantStreams: map[string]LogStream{
+				"myhost": {
+					Name: "myhost",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "myhost:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+					Options: LogStreamOptions{
+						Nice:    10,
+						IONice:  "best-effort:7",
+						Timeout: 5 * time.Minute,
+					},
+				},
+			},
+		},
+		{
+			name:   "invalid ionice",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"myhost": {
+					Options: ConfigLogStreamOptions{
+						IONice: "realtime",
+					},
+				},
+			}),
+
+			input: "myhost",
+
+			wantErr: `parsing entry #1 (myhost): expanding from nerdlog config: logstream myhost: invalid ionice "realtime": valid values are idle, best-effort, best-effort:<level>`,
+		},
+		{
+			name:   "invalid timeout",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"myhost": {
+					Options: ConfigLogStreamOptions{
+						Timeout: "-1s",
+					},
+				},
+			}),
+
+			input: "myhost",
+
+			wantErr: `parsing entry #1 (myhost): expanding from nerdlog config: logstream myhost: invalid timeout "-1s": must be positive`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runResolverTestCase(t, tt)
+		})
+	}
+}
+
+func TestLStreamsResolverDisplayName(t *testing.T) {
+	tests := []resolverTestCase{
+		{
+			name:   "display names of glob-matched hosts",
+			osUser: "osuser",
+
+			configLogStreams: ConfigLogStreams(map[string]ConfigLogStream{
+				"web1.prod.example.com": {
+					Options: ConfigLogStreamOptions{
+						DisplayName: "web1",
+					},
+				},
+				"web2.prod.example.com": {},
+			}),
+
+			input: "web*",
+
+			wantStreams: map[string]LogStream{
+				"web1.prod.example.com": {
+					Name: "web1.prod.example.com",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "web1.prod.example.com:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+					Options: LogStreamOptions{
+						DisplayName: "web1",
+					},
+				},
+				"web2.prod.example.com": {
+					Name: "web2.prod.example.com",
+					Transport: ConfigLogStreamShellTransport{
+						SSH: &ConfigLogStreamShellTransportSSH{
+							Host: ConfigHost{
+								Addr: "web2.prod.example.com:22",
+								User: "osuser",
+							},
+						},
+					},
+					LogFiles: []string{"auto", "auto"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runResolverTestCase(t, tt)
+		})
+	}
+}
+
+func TestSSHConfigHostNames(t *testing.T) {
+	names, err := SSHConfigHostNames(testSSHConfig1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"baz-01",
+		"baz-02",
+		"foo-01",
+		"foo-02",
+		"host-bar-from-nerdlog-config-01.com",
+		"host-bar-from-nerdlog-config-02.com",
+		"sshbar-01",
+		"sshbar-02",
+		"sshfoo-01",
+		"sshfoo-02",
+		"sshnoport-01",
+		"sshrealhost.com",
+	}, names)
+
+	names, err = SSHConfigHostNames(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
@@ -0,0 +1,1081 @@
+package core
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// The same stage numbers as in nerdlog_agent.sh.
+const (
+	nativeAgentStageQuerying = 3
+	nativeAgentStageDone     = 4
+)
+
+// nativeAgentEmptyFilename is the name reported for the prev logfile when it
+// doesn't exist; it mimics the dummy empty file which nerdlog_agent.sh creates
+// in this case, so that the output is identical.
+const nativeAgentEmptyFilename = "/tmp/nerdlog-empty-file"
+
+// nativeAgentArgs are the parsed arguments of the agent, with the same meaning
+// as in nerdlog_agent.sh.
+type nativeAgentArgs struct {
+	command string
+	pattern string
+	stages  []string
+
+	logfileLast string
+	logfilePrev string
+
+	from string
+	to   string
+
+	// ranges are the --range windows within from and to, see
+	// nativeTimeRange.
+	ranges []nativeTimeRange
+
+	linesUntil       int
+	maxNumLines      int
+	maxTransferBytes int
+
+	levelStats    bool
+	activityStats bool
+
+	awktime TimeFormatAWKExpr
+}
+
+// NativeAgentFunc is the signature of RunNativeAgent; ShellConnNative can
+// run some other agent with the same signature instead, like the
+// coretest.FakeAgent.
+type NativeAgentFunc func(args []string, env map[string]string, stdout, stderr io.Writer) int
+
+// RunNativeAgent is a Go implementation of nerdlog_agent.sh for plain log
+// files, used when there is no POSIX shell and gawk (e.g. on Windows). It
+// takes the same arguments, and produces the same output (apart from debug
+// messages and progress), so LStreamClient doesn't need to know which one it
+// talks to. Returns the exit code, which is also printed as "exit_code:N",
+// like the script's EXIT trap does.
+//
+// Limitations: journalctl is not supported, and the pattern can only be a
+// subset of awk (see compileNativePattern). Since the native agent is always
+// scanning the files from scratch, there is no index either; the results are
+// the same though, just slower on large files.
+func RunNativeAgent(args []string, env map[string]string, stdout, stderr io.Writer) int {
+	code := runNativeAgentCmd(args, env, stdout, stderr)
+	fmt.Fprintf(stdout, "exit_code:%d\n", code)
+	return code
+}
+
+func runNativeAgentCmd(args []string, env map[string]string, stdout, stderr io.Writer) int {
+	parsed, err := parseNativeAgentArgs(args)
+	if err != nil {
+		fmt.Fprintf(stderr, "error:%s\n", err.Error())
+		return 1
+	}
+
+	na, err := newNativeAgent(parsed, env, stdout, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "error:%s\n", err.Error())
+		return 1
+	}
+
+	switch parsed.command {
+	case "logstream_info":
+		err = na.logstreamInfo()
+	case "query":
+		err = na.query()
+	case "first_last":
+		err = na.firstLast()
+	case "":
+		err = errors.Errorf("command is required")
+	default:
+		err = errors.Errorf("invalid command %s", parsed.command)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "error:%s\n", err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func parseNativeAgentArgs(args []string) (*nativeAgentArgs, error) {
+	ret := &nativeAgentArgs{
+		logfileLast: "auto",
+		logfilePrev: "auto",
+		maxNumLines: 100,
+
+		// The defaults are the same as in nerdlog_agent.sh
+		awktime: TimeFormatAWKExpr{
+			Month:     `monthByName[substr($0, 1, 3)]`,
+			Year:      `yearByMonth[month]`,
+			Day:       `(substr($0, 5, 1) == " ") ? "0" substr($0, 6, 1) : substr($0, 5, 2)`,
+			HHMM:      `substr($0, 8, 5)`,
+			MinuteKey: `substr($0, 1, 12)`,
+		},
+	}
+
+	strFlags := map[string]*string{
+		"--logfile-last":       &ret.logfileLast,
+		"--logfile-prev":       &ret.logfilePrev,
+		"-f":                   &ret.from,
+		"--from":               &ret.from,
+		"-t":                   &ret.to,
+		"--to":                 &ret.to,
+		"--awktime-month":      &ret.awktime.Month,
+		"--awktime-year":       &ret.awktime.Year,
+		"--awktime-day":        &ret.awktime.Day,
+		"--awktime-hhmm":       &ret.awktime.HHMM,
+		"--awktime-minute-key": &ret.awktime.MinuteKey,
+	}
+
+	intFlags := map[string]*int{
+		"-u":                   &ret.linesUntil,
+		"--lines-until":        &ret.linesUntil,
+		"-l":                   &ret.maxNumLines,
+		"--max-num-lines":      &ret.maxNumLines,
+		"--max-transfer-bytes": &ret.maxTransferBytes,
+	}
+
+	// Flags which only make sense for the script: the index, binary search and
+	// caching settings, and the journalctl pagination.
+	ignoredFlags := map[string]struct{}{
+		"-c":                        {},
+		"--index-file":              {},
+		"--bsearch-min-size":        {},
+		"--cache-ttl":               {},
+		"--timestamp-until-seconds": {},
+		"--timestamp-until-precise": {},
+		"--skip-n-latest":           {},
+	}
+
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--refresh-index" {
+			continue
+		}
+
+		if arg == "--level-stats" {
+			ret.levelStats = true
+			continue
+		}
+
+		if arg == "--activity-stats" {
+			ret.activityStats = true
+			continue
+		}
+
+		if arg == "--stage" {
+			if i+1 >= len(args) {
+				return nil, errors.Errorf("%s requires a value", arg)
+			}
+			ret.stages = append(ret.stages, args[i+1])
+			i++
+			continue
+		}
+
+		if arg == "--range" {
+			if i+1 >= len(args) {
+				return nil, errors.Errorf("%s requires a value", arg)
+			}
+
+			r, err := parseNativeTimeRange(args[i+1])
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+
+			ret.ranges = append(ret.ranges, r)
+			i++
+			continue
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return nil, errors.Errorf("%s requires a value", arg)
+		}
+		val := args[i+1]
+		i++
+
+		if p, ok := strFlags[arg]; ok {
+			*p = val
+		} else if p, ok := intFlags[arg]; ok {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return nil, errors.Errorf("invalid value for %s: %q", arg, val)
+			}
+			*p = n
+		} else if _, ok := ignoredFlags[arg]; !ok {
+			return nil, errors.Errorf("unknown option %s", arg)
+		}
+	}
+
+	if len(positional) > 0 {
+		ret.command = positional[0]
+	}
+
+	if len(positional) > 1 {
+		ret.pattern = positional[1]
+	}
+
+	return ret, nil
+}
+
+// nativeTimeRange is a single --range window, with both ends in the same
+// format as --from and --to; the end is exclusive, and can be empty.
+type nativeTimeRange struct {
+	from string
+	to   string
+}
+
+func parseNativeTimeRange(s string) (nativeTimeRange, error) {
+	idx := strings.Index(s, ",")
+	if idx < 0 {
+		return nativeTimeRange{}, errors.Errorf("invalid --range %s, expected from,to", s)
+	}
+
+	return nativeTimeRange{from: s[:idx], to: s[idx+1:]}, nil
+}
+
+func nativeTimeRangesContain(ranges []nativeTimeRange, timestr string) bool {
+	for _, r := range ranges {
+		if timestr >= r.from && (r.to == "" || timestr < r.to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type nativeAgent struct {
+	args *nativeAgentArgs
+	env  map[string]string
+
+	stdout io.Writer
+	stderr io.Writer
+
+	// prevMissing is true if the prev logfile doesn't exist; it's then treated
+	// as an empty file.
+	prevMissing bool
+
+	tp      *nativeTimeParser
+	pattern nativePattern
+	stages  []nativePattern
+}
+
+func newNativeAgent(
+	args *nativeAgentArgs, env map[string]string, stdout, stderr io.Writer,
+) (*nativeAgent, error) {
+	na := &nativeAgent{
+		args:   args,
+		env:    env,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	if args.logfileLast == "auto" {
+		switch {
+		case fileExists("/var/log/messages"):
+			args.logfileLast = "/var/log/messages"
+		case fileExists("/var/log/syslog"):
+			args.logfileLast = "/var/log/syslog"
+		default:
+			return nil, errors.Errorf("failed to autodetect log file: neither /var/log/messages nor /var/log/syslog log files are present (and journalctl is not supported by the native agent). Specify the log file manually")
+		}
+	}
+
+	if args.logfileLast == "journalctl" {
+		return nil, errors.Errorf("journalctl is not supported by the native agent, specify the log file instead")
+	}
+
+	if args.logfilePrev == "auto" {
+		args.logfilePrev = args.logfileLast + ".1"
+	}
+
+	if !fileExists(args.logfilePrev) {
+		fmt.Fprintf(stderr, "debug:prev logfile %s doesn't exist, treating it as empty\n", args.logfilePrev)
+		args.logfilePrev = nativeAgentEmptyFilename
+		na.prevMissing = true
+	}
+
+	curYear, curMonth, err := nativeAgentCurYearMonth(env)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	na.tp, err = newNativeTimeParser(&args.awktime, curYear, curMonth)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	na.pattern, err = compileNativePattern(args.pattern)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unsupported pattern %q", args.pattern)
+	}
+
+	for _, stage := range args.stages {
+		sp, err := compileNativePattern(stage)
+		if err != nil {
+			return nil, errors.Annotatef(err, "unsupported stage pattern %q", stage)
+		}
+
+		na.stages = append(na.stages, sp)
+	}
+
+	return na, nil
+}
+
+func (na *nativeAgent) logstreamInfo() error {
+	if tz := detectNativeTimezone(na.env); tz != "" {
+		fmt.Fprintf(na.stdout, "host_timezone:%s\n", tz)
+	} else {
+		fmt.Fprintf(na.stdout, "warn:failed to detect host timezone\n")
+	}
+
+	fnames := []string{na.args.logfileLast}
+	if !na.prevMissing {
+		fnames = append(fnames, na.args.logfilePrev)
+	}
+
+	for _, fname := range fnames {
+		if !fileExists(fname) {
+			return errors.Errorf("%s does not exist", fname)
+		}
+
+		var first, last string
+		numLines := 0
+		if err := scanNativeLogfile(fname, func(line string) bool {
+			if numLines == 0 {
+				first = line
+			}
+			last = line
+			numLines++
+			return true
+		}); err != nil {
+			return errors.Errorf("%s exists but is not readable, check your permissions", fname)
+		}
+
+		// Print a bunch of example log lines, so that the client can autodetect
+		// the format.
+		if numLines > 0 {
+			fmt.Fprintf(na.stdout, "example_log_line:%s\n", last)
+			fmt.Fprintf(na.stdout, "example_log_line:%s\n", first)
+		}
+	}
+
+	return nil
+}
+
+type nativeAgentLine struct {
+	nr   int
+	line string
+}
+
+func (na *nativeAgent) query() error {
+	args := na.args
+
+	fmt.Fprintf(na.stderr, "p:stage:%d:querying logs\n", nativeAgentStageQuerying)
+
+	fnames := []string{args.logfilePrev, args.logfileLast}
+	if na.prevMissing {
+		fnames[0] = ""
+	}
+
+	totalBytes := int64(0)
+	for _, fname := range fnames {
+		if fname == "" {
+			continue
+		}
+
+		fi, err := os.Stat(fname)
+		if err != nil {
+			return errors.Annotatef(err, "getting size of %s", fname)
+		}
+		totalBytes += fi.Size()
+	}
+
+	var (
+		// nr is the line number in the two logfiles concatenated, just like NR
+		// in the script.
+		nr           int
+		prevlogLines int
+		numBytes     int64
+		lastPercent  int
+
+		// The from/to boundaries are found in the same way as the script does
+		// it using the index: only the lines where hh:mm changes (and doesn't
+		// decrease) count, and the range starts at the first such line not
+		// earlier than --from, and ends before the first such line not earlier
+		// than --to.
+		started      = args.from == ""
+		stopped      bool
+		outsideRange bool
+		isFirstEntry = true
+		lastTimestr  string
+		lastHHMM     string
+
+		numFilteredOut int
+		stageCounts    = make([]int, len(na.stages)+1)
+		prevMinKey     string
+		stats          = map[string]int{}
+		errStats       = map[string]int{}
+		warnStats      = map[string]int{}
+		activity       = map[string]int{}
+		lastLines      []nativeAgentLine
+	)
+
+	for i, fname := range fnames {
+		if fname == "" {
+			continue
+		}
+
+		isPrev := i == 0
+
+		err := scanNativeLogfile(fname, func(line string) bool {
+			nr++
+			if isPrev {
+				prevlogLines++
+			}
+
+			numBytes += int64(len(line)) + 1
+			if nr%100 == 0 && totalBytes > 0 {
+				// Only report with 5% increments, like the script does.
+				curPercent := int(numBytes * 20 / totalBytes)
+				if curPercent != lastPercent {
+					fmt.Fprintf(na.stderr, "p:p:%d\n", curPercent*5)
+					lastPercent = curPercent
+				}
+			}
+
+			if stopped {
+				// We still need to count all the lines in the prev logfile, but
+				// the latest one doesn't need to be read any further.
+				return isPrev
+			}
+
+			if args.from != "" || args.to != "" {
+				hhmm := na.tp.hhmm(line, "")
+				if hhmm != lastHHMM {
+					timestr := na.tp.timestr(line)
+					if timestr >= lastTimestr {
+						isFirst := isFirstEntry
+						isFirstEntry = false
+						lastTimestr = timestr
+						lastHHMM = hhmm
+
+						if !started && timestr >= args.from {
+							started = true
+						}
+
+						if args.to != "" && timestr >= args.to {
+							if isFirst && timestr > args.to {
+								outsideRange = true
+							}
+
+							stopped = true
+							return isPrev
+						}
+					}
+				}
+			}
+
+			if !started {
+				return true
+			}
+
+			if args.activityStats {
+				activity[na.tp.minuteKey(line, "")]++
+			}
+
+			if len(args.ranges) > 0 && !nativeTimeRangesContain(args.ranges, na.tp.timestr(line)) {
+				return true
+			}
+
+			if na.pattern != nil && !na.pattern.match(line) {
+				numFilteredOut++
+				return true
+			}
+
+			stageCounts[0]++
+			for i, sp := range na.stages {
+				if sp != nil && !sp.match(line) {
+					numFilteredOut++
+					return true
+				}
+				stageCounts[i+1]++
+			}
+
+			// Account for decreased timestamps, in the same way as the script.
+			minKey := na.tp.minuteKey(line, "")
+			if minKey < prevMinKey {
+				minKey = prevMinKey
+			} else {
+				prevMinKey = minKey
+			}
+
+			stats[minKey]++
+
+			if args.levelStats {
+				switch nativeLineLevel(line) {
+				case LogLevelError:
+					errStats[minKey]++
+				case LogLevelWarn:
+					warnStats[minKey]++
+				}
+			}
+
+			if args.linesUntil > 0 && nr >= args.linesUntil {
+				return true
+			}
+
+			if args.maxNumLines <= 0 {
+				return true
+			}
+
+			lastLines = append(lastLines, nativeAgentLine{nr: nr, line: line})
+			if len(lastLines) > args.maxNumLines*2 {
+				// Drop what we don't need anymore, but not on every line.
+				lastLines = append(lastLines[:0], lastLines[len(lastLines)-args.maxNumLines:]...)
+			}
+
+			return true
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if (args.from != "" && !started) || outsideRange {
+		fmt.Fprintf(na.stderr, "debug:the requested time range is outside of the logs\n")
+		fmt.Fprintf(na.stderr, "p:stage:%d:done\n", nativeAgentStageDone)
+		return nil
+	}
+
+	if len(lastLines) > args.maxNumLines {
+		lastLines = lastLines[len(lastLines)-args.maxNumLines:]
+	}
+
+	fmt.Fprintf(na.stderr, "debug:Filtered out %d from %d lines\n", numFilteredOut, nr)
+
+	fmt.Fprintf(na.stdout, "logfile:%s:0\n", args.logfilePrev)
+	fmt.Fprintf(na.stdout, "logfile:%s:%d\n", args.logfileLast, prevlogLines)
+
+	minKeys := make([]string, 0, len(stats))
+	for k := range stats {
+		minKeys = append(minKeys, k)
+	}
+	sort.Strings(minKeys)
+
+	for _, k := range minKeys {
+		if args.levelStats {
+			fmt.Fprintf(na.stdout, "s:%s,%d,%d,%d\n", k, stats[k], errStats[k], warnStats[k])
+		} else {
+			fmt.Fprintf(na.stdout, "s:%s,%d\n", k, stats[k])
+		}
+	}
+
+	if len(na.stages) > 0 {
+		strs := make([]string, 0, len(stageCounts))
+		for _, n := range stageCounts {
+			strs = append(strs, strconv.Itoa(n))
+		}
+		fmt.Fprintf(na.stdout, "stage_counts:%s\n", strings.Join(strs, ","))
+	}
+
+	if args.activityStats {
+		activityKeys := make([]string, 0, len(activity))
+		for k := range activity {
+			activityKeys = append(activityKeys, k)
+		}
+		sort.Strings(activityKeys)
+
+		for _, k := range activityKeys {
+			fmt.Fprintf(na.stdout, "a:%s,%d\n", k, activity[k])
+		}
+	}
+
+	// If the lines would exceed the transfer budget, only print the estimate.
+	if args.maxTransferBytes > 0 {
+		transferBytes := 0
+		for _, l := range lastLines {
+			if l.line == "" {
+				continue
+			}
+
+			transferBytes += len(fmt.Sprintf("m:%d:%s", l.nr, l.line)) + 1
+		}
+
+		if transferBytes > args.maxTransferBytes {
+			fmt.Fprintf(na.stdout, "transfer_exceeded:%d\n", transferBytes)
+			fmt.Fprintf(na.stderr, "p:stage:%d:done\n", nativeAgentStageDone)
+			return nil
+		}
+	}
+
+	for _, l := range lastLines {
+		// The script skips empty lines, so do we.
+		if l.line == "" {
+			continue
+		}
+
+		fmt.Fprintf(na.stdout, "m:%d:%s\n", l.nr, l.line)
+	}
+
+	fmt.Fprintf(na.stderr, "p:stage:%d:done\n", nativeAgentStageDone)
+
+	return nil
+}
+
+func (na *nativeAgent) firstLast() error {
+	args := na.args
+
+	fmt.Fprintf(na.stderr, "p:stage:%d:looking for first and last occurrences\n", nativeAgentStageQuerying)
+
+	logfiles := na.listLogfilesForFirstLast()
+
+	idxFrom := 0
+	idxTo := len(logfiles) - 1
+
+	if args.from != "" {
+		idxFrom = na.findLogfileIdxByTimestr(logfiles, args.from)
+	}
+
+	if args.to != "" {
+		idxTo = na.findLogfileIdxByTimestr(logfiles, args.to)
+	}
+
+	// scanMatches calls the callback for every matching line within the time
+	// range; the callback returns false to stop.
+	scanMatches := func(fname string, cb func(line string) bool) error {
+		return scanNativeLogfile(fname, func(line string) bool {
+			timestr := na.tp.timestr(line)
+			if args.from != "" && timestr < args.from {
+				return true
+			}
+
+			if args.to != "" && timestr >= args.to {
+				return false
+			}
+
+			if na.pattern != nil && !na.pattern.match(line) {
+				return true
+			}
+
+			return cb(line)
+		})
+	}
+
+	// Go through the files from the oldest to the latest, and stop at the very
+	// first match.
+	found := false
+	for i := idxFrom; i <= idxTo && !found; i++ {
+		if err := scanMatches(logfiles[i], func(line string) bool {
+			fmt.Fprintf(na.stdout, "first:%s\n", line)
+			found = true
+			return false
+		}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	// Now go through the files from the latest to the oldest, and stop at the
+	// first file having any matches; the last match from that file is what
+	// we're looking for.
+	for i := idxTo; i >= idxFrom && found; i-- {
+		lastMatch := ""
+		if err := scanMatches(logfiles[i], func(line string) bool {
+			lastMatch = line
+			return true
+		}); err != nil {
+			return errors.Trace(err)
+		}
+
+		if lastMatch != "" {
+			fmt.Fprintf(na.stdout, "last:%s\n", lastMatch)
+			break
+		}
+	}
+
+	fmt.Fprintf(na.stderr, "p:stage:%d:done\n", nativeAgentStageDone)
+
+	return nil
+}
+
+// listLogfilesForFirstLast returns all the logfiles which the first_last
+// command should look at, from the oldest to the latest, including older
+// rotated (and maybe gzipped) files; see list_logfiles_for_first_last in
+// nerdlog_agent.sh.
+func (na *nativeAgent) listLogfilesForFirstLast() []string {
+	args := na.args
+
+	var older []string
+
+	// Only look for older files if the rotation follows the usual naming scheme.
+	if !na.prevMissing && args.logfilePrev == args.logfileLast+".1" {
+		for n := 2; ; n++ {
+			fname := fmt.Sprintf("%s.%d", args.logfileLast, n)
+			if fileExists(fname + ".gz") {
+				older = append([]string{fname + ".gz"}, older...)
+			} else if fileExists(fname) {
+				older = append([]string{fname}, older...)
+			} else {
+				break
+			}
+		}
+	}
+
+	ret := older
+
+	if !na.prevMissing {
+		if fi, err := os.Stat(args.logfilePrev); err == nil && fi.Size() > 0 {
+			ret = append(ret, args.logfilePrev)
+		}
+	}
+
+	return append(ret, args.logfileLast)
+}
+
+// findLogfileIdxByTimestr binary-searches the logfiles (sorted from the oldest
+// to the latest) for the latest file which starts not later than the given
+// timestr, and returns its index. If the timestr is earlier than all the logs
+// we have, returns 0.
+func (na *nativeAgent) findLogfileIdxByTimestr(logfiles []string, timestr string) int {
+	lo, hi := 0, len(logfiles)-1
+
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+
+		midTimestr := ""
+		scanNativeLogfile(logfiles[mid], func(line string) bool {
+			midTimestr = na.tp.timestr(line)
+			return false
+		})
+
+		if midTimestr == "" || midTimestr <= timestr {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return lo
+}
+
+// scanNativeLogfile calls the callback for every line in the given file
+// (which is gunzipped on the fly if the name ends with .gz), until the
+// callback returns false.
+func scanNativeLogfile(fname string, cb func(line string) bool) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return errors.Annotatef(err, "opening %s", fname)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(fname, ".gz") {
+		gzr, err := gzip.NewReader(f)
+		if err != nil {
+			return errors.Annotatef(err, "gunzipping %s", fname)
+		}
+		defer gzr.Close()
+
+		r = gzr
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	// Awk doesn't strip the trailing \r, so we shouldn't either.
+	scanner.Split(scanLinesPreserveCarriageReturn)
+
+	for scanner.Scan() {
+		if !cb(scanner.Text()) {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return errors.Annotatef(err, "reading %s", fname)
+	}
+
+	return nil
+}
+
+func fileExists(fname string) bool {
+	_, err := os.Stat(fname)
+	return err == nil
+}
+
+// nativeAgentCurYearMonth returns the current year and month, which are used
+// to infer the year of log lines; like the script, it respects the CUR_YEAR
+// and CUR_MONTH env vars.
+func nativeAgentCurYearMonth(env map[string]string) (int, int, error) {
+	now := time.Now()
+	curYear, curMonth := now.Year(), int(now.Month())
+
+	if v := env["CUR_YEAR"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid CUR_YEAR %q", v)
+		}
+		curYear = n
+	}
+
+	if v := env["CUR_MONTH"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid CUR_MONTH %q", v)
+		}
+		curMonth = n
+	}
+
+	return curYear, curMonth, nil
+}
+
+// detectNativeTimezone returns the IANA name of the local timezone, or an
+// empty string if it can't be detected.
+func detectNativeTimezone(env map[string]string) string {
+	// Prefer TZ env var if available, just like the script does.
+	if tz := env["TZ"]; tz != "" {
+		return tz
+	}
+
+	if runtime.GOOS != "windows" {
+		if data, err := os.ReadFile("/etc/timezone"); err == nil {
+			if tz := strings.TrimSpace(string(data)); tz != "" {
+				return tz
+			}
+		}
+
+		if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+			if idx := strings.Index(target, "zoneinfo/"); idx >= 0 {
+				return target[idx+len("zoneinfo/"):]
+			}
+		}
+	}
+
+	// On Windows, there are no IANA names available easily, so resort to a
+	// fixed offset zone if the offset is a whole number of hours. Note that
+	// the sign in Etc/GMT zones is inverted.
+	_, offset := time.Now().Zone()
+	if offset%3600 != 0 {
+		return ""
+	}
+
+	hours := offset / 3600
+	switch {
+	case hours == 0:
+		return "UTC"
+	case hours > 0:
+		return fmt.Sprintf("Etc/GMT-%d", hours)
+	default:
+		return fmt.Sprintf("Etc/GMT+%d", -hours)
+	}
+}
+
+// nativeTimeExpr is a compiled --awktime-* expression. The month is only used
+// by the yearByMonth[month] expression.
+type nativeTimeExpr func(line, month string) string
+
+// nativeTimeParser evaluates the --awktime-* expressions for log lines.
+type nativeTimeParser struct {
+	month     nativeTimeExpr
+	year      nativeTimeExpr
+	day       nativeTimeExpr
+	hhmm      nativeTimeExpr
+	minuteKey nativeTimeExpr
+}
+
+func newNativeTimeParser(
+	awktime *TimeFormatAWKExpr, curYear, curMonth int,
+) (*nativeTimeParser, error) {
+	yearByMonth := map[string]string{}
+	for m := 1; m <= 12; m++ {
+		yearByMonth[fmt.Sprintf("%.2d", m)] = strconv.Itoa(inferYear(m, curYear, curMonth))
+	}
+
+	tp := &nativeTimeParser{}
+
+	exprs := []struct {
+		name string
+		expr string
+		res  *nativeTimeExpr
+	}{
+		{"month", awktime.Month, &tp.month},
+		{"year", awktime.Year, &tp.year},
+		{"day", awktime.Day, &tp.day},
+		{"hhmm", awktime.HHMM, &tp.hhmm},
+		{"minute key", awktime.MinuteKey, &tp.minuteKey},
+	}
+
+	for _, e := range exprs {
+		compiled, err := compileNativeTimeExpr(e.expr, yearByMonth)
+		if err != nil {
+			return nil, errors.Annotatef(err, "compiling %s expression", e.name)
+		}
+
+		*e.res = compiled
+	}
+
+	return tp, nil
+}
+
+// timestr returns the timestamp of the line in the same format as --from and
+// --to ("2006-01-02-15:04"), so that they can be compared lexicographically.
+func (tp *nativeTimeParser) timestr(line string) string {
+	month := tp.month(line, "")
+
+	return tp.year(line, month) + "-" + month + "-" + tp.day(line, month) + "-" + tp.hhmm(line, month)
+}
+
+var (
+	nativeTimeSubstrRegex   = regexp.MustCompile(`^substr\(\$0,\s*(\d+),\s*(\d+)\)$`)
+	nativeTimeSpaceRegex    = regexp.MustCompile(`^\((substr\([^)]*\)) == " "\) \? "0" (substr\([^)]*\)) : (substr\([^)]*\))$`)
+	nativeTimeMonthMapRegex = regexp.MustCompile(`^monthByName\[(.+)\]$`)
+)
+
+// compileNativeTimeExpr compiles one of the --awktime-* expressions. Only the
+// forms generated by GenerateTimeDescr are supported.
+func compileNativeTimeExpr(expr string, yearByMonth map[string]string) (nativeTimeExpr, error) {
+	expr = strings.TrimSpace(expr)
+
+	if m := nativeTimeSubstrRegex.FindStringSubmatch(expr); m != nil {
+		start, _ := strconv.Atoi(m[1])
+		length, _ := strconv.Atoi(m[2])
+
+		return func(line, month string) string {
+			return awkSubstr(line, start, length)
+		}, nil
+	}
+
+	if m := nativeTimeSpaceRegex.FindStringSubmatch(expr); m != nil {
+		var subs [3]nativeTimeExpr
+		for i := range subs {
+			sub, err := compileNativeTimeExpr(m[i+1], yearByMonth)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			subs[i] = sub
+		}
+
+		return func(line, month string) string {
+			if subs[0](line, month) == " " {
+				return "0" + subs[1](line, month)
+			}
+			return subs[2](line, month)
+		}, nil
+	}
+
+	if m := nativeTimeMonthMapRegex.FindStringSubmatch(expr); m != nil {
+		sub, err := compileNativeTimeExpr(m[1], yearByMonth)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return func(line, month string) string {
+			return monthByName[sub(line, month)]
+		}, nil
+	}
+
+	if expr == "yearByMonth[month]" {
+		return func(line, month string) string {
+			return yearByMonth[month]
+		}, nil
+	}
+
+	return nil, errors.Errorf("unsupported expression %q", expr)
+}
+
+// awkSubstr works like substr(s, start, length) in awk (in the bytes mode):
+// start is 1-based, and out-of-range parts are silently truncated.
+func awkSubstr(s string, start, length int) string {
+	end := start - 1 + length
+	if start < 1 {
+		start = 1
+	}
+	if end > len(s) {
+		end = len(s)
+	}
+	if start-1 >= end {
+		return ""
+	}
+
+	return s[start-1 : end]
+}
+
+var monthByName = map[string]string{
+	"Jan": "01",
+	"Feb": "02",
+	"Mar": "03",
+	"Apr": "04",
+	"May": "05",
+	"Jun": "06",
+	"Jul": "07",
+	"Aug": "08",
+	"Sep": "09",
+	"Oct": "10",
+	"Nov": "11",
+	"Dec": "12",
+}
+
+// inferYear is the same as inferYear in nerdlog_agent.sh: since traditional
+// syslog timestamps don't include the year, infer it from the month.
+func inferYear(logMonth, curYear, curMonth int) int {
+	delta := logMonth - curMonth
+
+	switch {
+	case delta <= -11:
+		// Log month is Jan, current is Dec -> next year
+		return curYear + 1
+	case delta >= 8:
+		// Log month is Sep-Dec, current is Jan -> previous year
+		return curYear - 1
+	default:
+		return curYear
+	}
+}
+
+var (
+	nativeErrorWordRegex = regexp.MustCompile(`(^|[^a-z0-9_])(error|erro|err|crit|critical|fatal)([^a-z0-9_]|$)`)
+	nativeWarnWordRegex  = regexp.MustCompile(`(^|[^a-z0-9_])warn(ing)?([^a-z0-9_]|$)`)
+)
+
+// nativeLineLevel is the same as lineLevel in nerdlog_agent.sh: it only
+// tells errors and warnings apart from everything else, and returns
+// LogLevelUnknown for the latter.
+func nativeLineLevel(line string) LogLevel {
+	line = strings.ToLower(line)
+
+	switch {
+	case strings.Contains(line, "[f]"), strings.Contains(line, "[e]"):
+		return LogLevelError
+	case strings.Contains(line, "[w]"):
+		return LogLevelWarn
+	case strings.Contains(line, "[i]"), strings.Contains(line, "[d]"):
+		return LogLevelUnknown
+	case nativeErrorWordRegex.MatchString(line):
+		return LogLevelError
+	case nativeWarnWordRegex.MatchString(line):
+		return LogLevelWarn
+	}
+
+	return LogLevelUnknown
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// TestNativeAgent runs the native agent against the same test cases as
+// TestNerdlogAgent (except the journalctl ones, since the native agent
+// doesn't support journalctl), and expects the same stdout.
+func TestNativeAgent(t *testing.T) {
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("unable to get caller info")
+	}
+
+	parentDir := filepath.Dir(filename)
+	testCasesDir := filepath.Join(parentDir, "core_testdata", "test_cases_agent")
+	repoRoot := filepath.Dir(parentDir)
+
+	testCaseDirs, err := getTestCaseDirs(testCasesDir, agentTestCaseYamlFname)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, testCaseDir := range testCaseDirs {
+		t.Run(testCaseDir, func(t *testing.T) {
+			if err := runNativeAgentTestCase(t, testCasesDir, repoRoot, testCaseDir); err != nil {
+				t.Fatalf("running native agent test case %s: %s", testCaseDir, err.Error())
+			}
+		})
+	}
+}
+
+func runNativeAgentTestCase(t *testing.T, testCasesDir, repoRoot, testName string) error {
+	testCaseDir := filepath.Join(testCasesDir, testName)
+	testCaseDescrFname := filepath.Join(testCaseDir, agentTestCaseYamlFname)
+
+	data, err := os.ReadFile(testCaseDescrFname)
+	if err != nil {
+		return errors.Annotatef(err, "reading yaml test case descriptor %s", testCaseDescrFname)
+	}
+
+	var tc AgentTestCaseYaml
+	if err := yaml.Unmarshal(data, &tc); err != nil {
+		return errors.Annotatef(err, "unmarshaling yaml from %s", testCaseDescrFname)
+	}
+
+	if tc.Logfiles.Kind == LogfilesKindJournalctl {
+		t.Skip("journalctl is not supported by the native agent")
+	}
+
+	// The expected output contains the logfile paths, so we have to use the
+	// same dir as TestNerdlogAgent.
+	testOutputDir := filepath.Join(agentTestOutputRoot, testName)
+	if err := os.MkdirAll(testOutputDir, 0755); err != nil {
+		return errors.Annotatef(err, "unable to create test output dir %s", testOutputDir)
+	}
+
+	resolved, err := resolveLogfiles(testCaseDir, &tc.Logfiles)
+	if err != nil {
+		return errors.Annotatef(err, "resolving logfiles")
+	}
+
+	provisioned, err := provisionLogFiles(resolved, testOutputDir, repoRoot)
+	if err != nil {
+		return errors.Annotatef(err, "provisioning logfiles")
+	}
+
+	command := tc.Command
+	if command == "" {
+		command = "query"
+	}
+
+	args := []string{
+		command,
+		"--logfile-last", provisioned.logfileLast,
+		"--logfile-prev", provisioned.logfilePrev,
+	}
+	args = append(args, tc.Args...)
+
+	curYear := tc.CurYear
+	if curYear == 0 {
+		curYear = 1970
+	}
+
+	curMonth := tc.CurMonth
+	if curMonth == 0 {
+		curMonth = 1
+	}
+
+	env := map[string]string{
+		"TZ":        "UTC",
+		"CUR_YEAR":  fmt.Sprintf("%d", curYear),
+		"CUR_MONTH": fmt.Sprintf("%d", curMonth),
+	}
+
+	for _, kv := range tc.Env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	RunNativeAgent(args, env, &stdout, &stderr)
+
+	wantStdout, err := os.ReadFile(filepath.Join(testCaseDir, "want_stdout"))
+	if err != nil {
+		return errors.Annotatef(err, "reading want_stdout")
+	}
+
+	// The script prints the stats lines in arbitrary order, so sort them before
+	// comparing.
+	assert.Equal(
+		t, sortStatsLines(string(wantStdout)), sortStatsLines(stdout.String()),
+		"test case %s, stderr:\n%s", testName, stderr.String(),
+	)
+
+	return nil
+}
+
+// sortStatsLines sorts the "s:" lines in the agent output, leaving all the
+// other lines in place.
+func sortStatsLines(output string) string {
+	lines := strings.Split(output, "\n")
+
+	var idxs []int
+	var stats []string
+	for i, line := range lines {
+		if strings.HasPrefix(line, "s:") {
+			idxs = append(idxs, i)
+			stats = append(stats, line)
+		}
+	}
+
+	sort.Strings(stats)
+	for i, idx := range idxs {
+		lines[idx] = stats[i]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestNativeTimeParser(t *testing.T) {
+	tp, err := newNativeTimeParser(&TimeFormatAWKExpr{
+		Month:     `monthByName[substr($0, 1, 3)]`,
+		Year:      `yearByMonth[month]`,
+		Day:       `(substr($0, 5, 1) == " ") ? "0" substr($0, 6, 1) : substr($0, 5, 2)`,
+		HHMM:      `substr($0, 8, 5)`,
+		MinuteKey: `substr($0, 1, 12)`,
+	}, 2025, 1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "2025-03-05-10:07", tp.timestr("Mar  5 10:07:46 myhost foo"))
+	assert.Equal(t, "2024-12-15-23:59", tp.timestr("Dec 15 23:59:01 myhost foo"))
+	assert.Equal(t, "Mar  5 10:07", tp.minuteKey("Mar  5 10:07:46 myhost foo", ""))
+
+	// Too short lines shouldn't cause any trouble.
+	assert.Equal(t, "---", tp.timestr(""))
+
+	_, err = newNativeTimeParser(&TimeFormatAWKExpr{
+		Month:     `$1`,
+		Year:      `substr($0, 1, 4)`,
+		Day:       `substr($0, 9, 2)`,
+		HHMM:      `substr($0, 12, 5)`,
+		MinuteKey: `substr($0, 6, 11)`,
+	}, 2025, 1)
+	assert.Error(t, err)
+}
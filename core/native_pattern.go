@@ -0,0 +1,224 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// nativePattern is a compiled awk pattern, as used by the native agent (see
+// RunNativeAgent). Only a subset of awk is supported: regular expressions
+// like /foo/ (optionally as $0 ~ /foo/ or $0 !~ /foo/), combined with !, &&,
+// || and parentheses. It covers what people normally type as a nerdlog
+// pattern, e.g. "/foo/ && !/bar/".
+type nativePattern interface {
+	match(line string) bool
+}
+
+type nativePatternRegexp struct {
+	re *regexp.Regexp
+}
+
+func (p *nativePatternRegexp) match(line string) bool {
+	return p.re.MatchString(line)
+}
+
+type nativePatternNot struct {
+	sub nativePattern
+}
+
+func (p *nativePatternNot) match(line string) bool {
+	return !p.sub.match(line)
+}
+
+type nativePatternAnd struct {
+	left, right nativePattern
+}
+
+func (p *nativePatternAnd) match(line string) bool {
+	return p.left.match(line) && p.right.match(line)
+}
+
+type nativePatternOr struct {
+	left, right nativePattern
+}
+
+func (p *nativePatternOr) match(line string) bool {
+	return p.left.match(line) || p.right.match(line)
+}
+
+// compileNativePattern compiles the given awk pattern. An empty pattern
+// matches every line, and nil is returned for it.
+func compileNativePattern(pattern string) (nativePattern, error) {
+	if strings.TrimSpace(pattern) == "" {
+		return nil, nil
+	}
+
+	p := &nativePatternParser{s: pattern}
+
+	res, err := p.parseOr()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.s) {
+		return nil, errors.Errorf("unexpected %q at position %d", p.s[p.pos:], p.pos)
+	}
+
+	return res, nil
+}
+
+type nativePatternParser struct {
+	s   string
+	pos int
+}
+
+func (p *nativePatternParser) skipSpaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// consume skips spaces, and if the input continues with the given token,
+// consumes it and returns true.
+func (p *nativePatternParser) consume(token string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+
+	return false
+}
+
+func (p *nativePatternParser) parseOr() (nativePattern, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		left = &nativePatternOr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *nativePatternParser) parseAnd() (nativePattern, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		left = &nativePatternAnd{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *nativePatternParser) parseUnary() (nativePattern, error) {
+	if p.consume("!") {
+		sub, err := p.parseUnary()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		return &nativePatternNot{sub: sub}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *nativePatternParser) parsePrimary() (nativePattern, error) {
+	if p.consume("(") {
+		res, err := p.parseOr()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if !p.consume(")") {
+			return nil, errors.Errorf("missing closing parenthesis at position %d", p.pos)
+		}
+
+		return res, nil
+	}
+
+	if p.consume("$0") {
+		negate := false
+		switch {
+		case p.consume("!~"):
+			negate = true
+		case p.consume("~"):
+		default:
+			return nil, errors.Errorf("expected ~ or !~ after $0 at position %d", p.pos)
+		}
+
+		re, err := p.parseRegexp()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+
+		if negate {
+			return &nativePatternNot{sub: re}, nil
+		}
+
+		return re, nil
+	}
+
+	return p.parseRegexp()
+}
+
+func (p *nativePatternParser) parseRegexp() (nativePattern, error) {
+	if !p.consume("/") {
+		return nil, errors.Errorf(
+			"expected a regexp like /foo/ at position %d; only regexps combined with !, && and || are supported", p.pos,
+		)
+	}
+
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return nil, errors.Errorf("unterminated regexp")
+		}
+
+		c := p.s[p.pos]
+		p.pos++
+
+		if c == '/' {
+			break
+		}
+
+		if c == '\\' && p.pos < len(p.s) && p.s[p.pos] == '/' {
+			// Escaped slash, which is only needed for awk, not for Go.
+			sb.WriteByte('/')
+			p.pos++
+			continue
+		}
+
+		sb.WriteByte(c)
+		if c == '\\' && p.pos < len(p.s) {
+			sb.WriteByte(p.s[p.pos])
+			p.pos++
+		}
+	}
+
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, errors.Annotatef(err, "compiling regexp /%s/", sb.String())
+	}
+
+	return &nativePatternRegexp{re: re}, nil
+}
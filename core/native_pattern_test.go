@@ -0,0 +1,54 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativePattern(t *testing.T) {
+	type testCase struct {
+		pattern string
+		line    string
+		want    bool
+	}
+
+	testCases := []testCase{
+		{pattern: "/foo/", line: "some foo here", want: true},
+		{pattern: "/foo/", line: "some bar here", want: false},
+		{pattern: "!/foo/", line: "some bar here", want: true},
+		{pattern: "/foo/ && !/bar/", line: "foo bar", want: false},
+		{pattern: "/foo/ && !/bar/", line: "foo baz", want: true},
+		{pattern: "/foo/ || /bar/", line: "just bar", want: true},
+		{pattern: "(/foo/ || /bar/) && /baz/", line: "bar", want: false},
+		{pattern: "(/foo/ || /bar/) && /baz/", line: "bar baz", want: true},
+		{pattern: "$0 ~ /^Mar/", line: "Mar 10 foo", want: true},
+		{pattern: "$0 !~ /^Mar/", line: "Mar 10 foo", want: false},
+		{pattern: `/a\/b/`, line: "path a/b", want: true},
+		{pattern: `/a\.b/`, line: "path axb", want: false},
+	}
+
+	for _, tc := range testCases {
+		p, err := compileNativePattern(tc.pattern)
+		if !assert.NoError(t, err, "pattern %s", tc.pattern) {
+			continue
+		}
+
+		assert.Equal(t, tc.want, p.match(tc.line), "pattern %s, line %q", tc.pattern, tc.line)
+	}
+
+	p, err := compileNativePattern("  ")
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+
+	for _, pattern := range []string{
+		"/foo",
+		"/foo/ &&",
+		"(/foo/",
+		`$5 == "bar"`,
+		"/foo/ /bar/",
+	} {
+		_, err := compileNativePattern(pattern)
+		assert.Error(t, err, "pattern %s", pattern)
+	}
+}
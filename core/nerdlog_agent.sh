@@ -10,6 +10,11 @@
 
 trap 'echo "exit_code:$?"' EXIT
 
+# If the script is run under "timeout" (see the "timeout" logstream option),
+# then once it times out we get SIGTERM, and we need to tell the Go app what
+# happened, and exit with a non-zero code (like timeout(1) itself does).
+trap 'echo "error:query timed out, see the timeout logstream option" 1>&2; exit 124' TERM
+
 # Arguments:
 #
 # --from, --to: time in the format "2006-01-02-15:04".
@@ -37,6 +42,49 @@ positional_args=()
 
 max_num_lines=100
 
+# If non-zero, and the log lines we're about to print would take more than
+# that many bytes, then instead of printing them, we only print the estimate
+# as "transfer_exceeded:<bytes>" (the timeline histogram is still printed).
+# Can be set with --max-transfer-bytes.
+max_transfer_bytes=0
+
+# If non-empty, the "s:" lines also contain the number of error and warning
+# messages in every minute: "s:<minute_key>,<total>,<errors>,<warnings>". The
+# level is guessed in roughly the same way as the Go app does it (see
+# lineLevel below). Can be set with --level-stats.
+level_stats=""
+
+# If non-zero, the stdout of the query (for log files, not journalctl) is
+# cached next to the index file for that many seconds, keyed by the query
+# arguments, so that re-running the identical query doesn't scan the logs
+# again. Can be set with --cache-ttl.
+cache_ttl=0
+
+# Extra patterns which narrow down the positional pattern one after another;
+# if any are given, the number of lines left after the positional pattern and
+# after every stage is printed as "stage_counts:<n0>,<n1>,...". Can be given
+# with --stage, multiple times.
+stages=()
+
+# Disjoint time windows within --from and --to, in the same format, like
+# "2006-01-02-15:04,2006-01-02-15:04" (the end is exclusive, and can be empty
+# for the last window); if any are given, only the lines within any of them
+# are looked at, as if the rest of the logs didn't exist. Can be given with
+# --range, multiple times.
+ranges=()
+
+# If non-empty, the number of all the lines in every minute, regardless of the
+# pattern and --range, is also printed as "a:<minute_key>,<n>"; it's used to
+# find the periods when there were no logs at all. Can be set with
+# --activity-stats.
+activity_stats=""
+
+# If there is no index yet, and the log files are at least that large (in
+# bytes), then instead of building the index (which means awk-scanning all the
+# logs from the very beginning), we'll binary-search the --from and --to
+# boundaries right in the log files. Can be overridden with --bsearch-min-size.
+bsearch_min_size=268435456
+
 awktime_month='monthByName[substr($0, 1, 3)]'
 awktime_year='yearByMonth[month]'
 awktime_day='(substr($0, 5, 1) == " ") ? "0" substr($0, 6, 1) : substr($0, 5, 2)'
@@ -129,6 +177,9 @@ function concat_cmds_array() {
   done
 } # }}}
 
+# Remember all the args before parsing, since they are part of the cache key.
+orig_args=("$@")
+
 while [[ $# -gt 0 ]]; do
   case $1 in
     -c|--index-file)
@@ -263,11 +314,44 @@ while [[ $# -gt 0 ]]; do
       refresh_index="1"
       shift # past argument
       ;;
+    --bsearch-min-size)
+      bsearch_min_size="$2"
+      shift # past argument
+      shift # past value
+      ;;
     -l|--max-num-lines)
       max_num_lines="$2"
       shift # past argument
       shift # past value
       ;;
+    --max-transfer-bytes)
+      max_transfer_bytes="$2"
+      shift # past argument
+      shift # past value
+      ;;
+    --level-stats)
+      level_stats="1"
+      shift # past argument
+      ;;
+    --cache-ttl)
+      cache_ttl="$2"
+      shift # past argument
+      shift # past value
+      ;;
+    --stage)
+      stages+=("$2")
+      shift # past argument
+      shift # past value
+      ;;
+    --range)
+      ranges+=("$2")
+      shift # past argument
+      shift # past value
+      ;;
+    --activity-stats)
+      activity_stats="1"
+      shift # past argument
+      ;;
 
     --awktime-month)
       awktime_month="$2"
@@ -424,7 +508,7 @@ if [[ "${command}" == "" ]]; then
 fi
 
 case "${command}" in
-  query)
+  query|first_last)
     shift
     # Will be handled below.
     ;;
@@ -502,8 +586,6 @@ case "${command}" in
     exit 1
 esac
 
-# What follows is the handler for the "query" command.
-
 # NOTE: we only show percentages with 5% increments, to save on traffic and
 # other overhead. With all 24 my-nodes, having percentage being printed with
 # 1% increments, it generates extra traffic of about 290KB per single query,
@@ -518,12 +600,144 @@ function printPercentage(numCur, numTotal) {
 }
 '
 
-function run_awk_script_logfiles {
-  awk_pattern=''
+# lineLevel returns 2 for errors, 1 for warnings and 0 for everything else,
+# using the same heuristics as parseLogMsgLevelDefault in the Go app, except
+# that it looks at the whole line, not just the message.
+awk_func_line_level='
+function lineLevel(line) {
+  line = tolower(line);
+
+  if (index(line, "[f]") || index(line, "[e]")) return 2;
+  if (index(line, "[w]")) return 1;
+  if (index(line, "[i]") || index(line, "[d]")) return 0;
+
+  # Not using \y for word boundaries, since it is gawk-specific.
+  if (line ~ /(^|[^a-z0-9_])(error|erro|err|crit|critical|fatal)([^a-z0-9_]|$)/) return 2;
+  if (line ~ /(^|[^a-z0-9_])warn(ing)?([^a-z0-9_]|$)/) return 1;
+
+  return 0;
+}
+'
+
+# When --level-stats is given, awk_level_stats_count should be used right
+# after the stats for curMinKey are incremented, and awk_level_stats_print
+# should be appended to the printed "s:" line.
+awk_level_stats_count=''
+awk_level_stats_print=''
+if [[ "$level_stats" != "" ]]; then
+  awk_level_stats_count='
+    lvl = lineLevel($0);
+    if (lvl == 2) {
+      errStats[curMinKey]++;
+    } else if (lvl == 1) {
+      warnStats[curMinKey]++;
+    }
+  '
+  awk_level_stats_print=' "," (errStats[x]+0) "," (warnStats[x]+0)'
+fi
+
+# When --activity-stats is given, awk_activity_count should be used in the
+# awk scripts before any checks which might skip the line, and
+# awk_activity_print should be used in the END block.
+awk_activity_count=''
+awk_activity_print=''
+if [[ "$activity_stats" != "" ]]; then
+  awk_activity_count='{ activity['"$awktime_minute_key"']++ }'
+  awk_activity_print='
+    for (x in activity) {
+      print "a:" x "," activity[x]
+    }
+  '
+fi
+
+awk_func_infer_year='
+function inferYear(logMonth, curYear, curMonth) {
+  delta = logMonth - curMonth
+
+  if (delta <= -11)       # log month is Jan, current is Dec -> next year
+    return curYear + 1
+  else if (delta >= 8)    # log month is Sep-Dec, current is Jan -> previous year
+    return curYear - 1
+  else
+    return curYear
+}
+'
+
+# awk_vars should be used in the BEGIN section of awk scripts which need to
+# evaluate the --awktime-* expressions: they might refer to monthByName and
+# yearByMonth. The script must also include $awk_func_infer_year.
+awk_vars='
+  monthByName["Jan"] = "01";
+  monthByName["Feb"] = "02";
+  monthByName["Mar"] = "03";
+  monthByName["Apr"] = "04";
+  monthByName["May"] = "05";
+  monthByName["Jun"] = "06";
+  monthByName["Jul"] = "07";
+  monthByName["Aug"] = "08";
+  monthByName["Sep"] = "09";
+  monthByName["Oct"] = "10";
+  monthByName["Nov"] = "11";
+  monthByName["Dec"] = "12";
+
+  curYear = '${CUR_YEAR}';
+  curMonth = '${CUR_MONTH}';
+
+  yearByMonth["01"] = inferYear(1, curYear, curMonth) "";
+  yearByMonth["02"] = inferYear(2, curYear, curMonth) "";
+  yearByMonth["03"] = inferYear(3, curYear, curMonth) "";
+  yearByMonth["04"] = inferYear(4, curYear, curMonth) "";
+  yearByMonth["05"] = inferYear(5, curYear, curMonth) "";
+  yearByMonth["06"] = inferYear(6, curYear, curMonth) "";
+  yearByMonth["07"] = inferYear(7, curYear, curMonth) "";
+  yearByMonth["08"] = inferYear(8, curYear, curMonth) "";
+  yearByMonth["09"] = inferYear(9, curYear, curMonth) "";
+  yearByMonth["10"] = inferYear(10, curYear, curMonth) "";
+  yearByMonth["11"] = inferYear(11, curYear, curMonth) "";
+  yearByMonth["12"] = inferYear(12, curYear, curMonth) "";
+'
+
+# function awk_pattern_checks() {{{
+#
+# Prints the awk rules which filter out the lines not matching the positional
+# pattern and all the stages (see --stage), and count how many lines are left
+# after every stage, for awk_stage_counts_print.
+function awk_pattern_checks() {
   if [[ "$user_pattern" != "" ]]; then
-    awk_pattern="!($user_pattern) {numFilteredOut++; next}"
+    printf '%s\n' "!($user_pattern) {numFilteredOut++; next}"
   fi
 
+  if [[ ${#stages[@]} == 0 ]]; then
+    return
+  fi
+
+  printf '%s\n' "{ stageCounts[0]++ }"
+
+  local i=0
+  for stage in "${stages[@]}"; do
+    i=$((i+1))
+    printf '%s\n' "!($stage) {numFilteredOut++; next}"
+    printf '%s\n' "{ stageCounts[$i]++ }"
+  done
+} # }}}
+
+# If --stage is given, awk_stage_counts_print should be used in the END
+# section of the awk scripts which use awk_pattern_checks, right after the "s:"
+# lines.
+awk_stage_counts_print=''
+if [[ ${#stages[@]} != 0 ]]; then
+  awk_stage_counts_print='
+    stageCountsStr = "stage_counts:" (stageCounts[0]+0);
+    for (i = 1; i <= '${#stages[@]}'; i++) {
+      stageCountsStr = stageCountsStr "," (stageCounts[i]+0);
+    }
+    print stageCountsStr;
+  '
+fi
+
+function run_awk_script_logfiles {
+  awk_pattern="$(awk_pattern_checks)"
+
   # NOTE: this script MUST be executed with the "-b" awk key, which means that
   # awk will work in terms of bytes, not characters. We use length($0) there and
   # we rely on it being number of bytes.
@@ -535,6 +749,7 @@ function run_awk_script_logfiles {
   # "<".
   awk_script='
   '$awk_func_print_percentage'
+  '$awk_func_line_level'
 
   BEGIN {
     bytenr=1; curline=0; maxlines='$max_num_lines'; lastPercent=0;
@@ -545,6 +760,8 @@ function run_awk_script_logfiles {
   NR % 100 == 0 {
     printPercentage(bytenr, '$num_bytes_to_scan')
   }
+  '$awk_activity_count'
+  '$awk_range_check'
   '$awk_pattern'
   {
     # Account for decreased timestamps.
@@ -562,6 +779,7 @@ function run_awk_script_logfiles {
     }
 
     stats[curMinKey]++;
+    '$awk_level_stats_count'
 
     '$lines_until_check'
 
@@ -582,7 +800,29 @@ function run_awk_script_logfiles {
     print "logfile:'$logfile_last':'$prevlog_lines'";
 
     for (x in stats) {
-      print "s:" x "," stats[x]
+      print "s:" x "," stats[x] '"$awk_level_stats_print"'
+    }
+    '"$awk_stage_counts_print"'
+    '"$awk_activity_print"'
+
+    # If the lines would exceed the transfer budget, only print the estimate.
+    maxTransferBytes = '$max_transfer_bytes';
+    if (maxTransferBytes > 0) {
+      transferBytes = 0;
+      for (i = 0; i < maxlines; i++) {
+        if (!lastlines[i]) {
+          continue;
+        }
+
+        # The same as the "m:" line printed below, together with the newline.
+        curNR = lastNRs[i] + '$from_linenr_int' - 1;
+        transferBytes += length("m:" curNR ":" lastlines[i]) + 1;
+      }
+
+      if (transferBytes > maxTransferBytes) {
+        print "transfer_exceeded:" transferBytes;
+        exit;
+      }
     }
 
     for (i = 0; i < maxlines; i++) {
@@ -609,10 +849,7 @@ function run_awk_script_logfiles {
 }
 
 function run_awk_script_journalctl {
-  awk_pattern_check=''
-  if [[ "$user_pattern" != "" ]]; then
-    awk_pattern_check="!($user_pattern) {numFilteredOut++; next}"
-  fi
+  awk_pattern_check="$(awk_pattern_checks)"
 
   awk_skip_n_latest_check=''
   if [[ "$timestamp_until_precise" != "" && "$skip_n_latest" != "" ]]; then
@@ -658,6 +895,7 @@ function run_awk_script_journalctl {
 
   awk_script='
   '$awk_func_print_percentage'
+  '$awk_func_line_level'
 
   # Takes timestamp in the same format as we use for --from and --to and
   # store in the index ("2006-01-02-15:04"), and returns the corresponding unix
@@ -755,10 +993,14 @@ function run_awk_script_journalctl {
     }
   }
 
+  '$awk_activity_count'
+  '$awk_range_check'
   '$awk_pattern_check'
   '$awk_skip_n_latest_check'
   {
-    stats['"$awktime_minute_key"']++;
+    curMinKey = '"$awktime_minute_key"';
+    stats[curMinKey]++;
+    '$awk_level_stats_count'
 
     if (curline < maxlines) {
       lines[curline] = $0;
@@ -773,7 +1015,24 @@ function run_awk_script_journalctl {
     print "logfile:'$logfile_last':0";
 
     for (x in stats) {
-      print "s:" x "," stats[x]
+      print "s:" x "," stats[x] '"$awk_level_stats_print"'
+    }
+    '"$awk_stage_counts_print"'
+    '"$awk_activity_print"'
+
+    # If the lines would exceed the transfer budget, only print the estimate.
+    maxTransferBytes = '$max_transfer_bytes';
+    if (maxTransferBytes > 0) {
+      transferBytes = 0;
+      for (i = 0; i < curline; i++) {
+        # The same as the "m:0:" line printed below, together with the newline.
+        transferBytes += length(lines[i]) + 5;
+      }
+
+      if (transferBytes > maxTransferBytes) {
+        print "transfer_exceeded:" transferBytes;
+        exit;
+      }
     }
 
     for (i = curline-1; i >= 0; i--) {
@@ -788,8 +1047,255 @@ function run_awk_script_journalctl {
   fi
 }
 
+# function cat_logfile() {{{
+#
+# Prints the contents of the given log file, decompressing it if needed.
+function cat_logfile() {
+  case "$1" in
+    *.gz)
+      gzip -dc "$1"
+      ;;
+    *)
+      cat "$1"
+      ;;
+  esac
+} # }}}
+
+# function list_logfiles_for_first_last() {{{
+#
+# Prints all the log files which the first_last command should look at, one per
+# line, from the oldest to the latest. Unlike the query command, which only
+# ever uses $logfile_prev and $logfile_last, here we also pick up older rotated
+# files like /var/log/syslog.2.gz, /var/log/syslog.3.gz etc, since the whole
+# point of the first_last command is to answer "when did this start", and it
+# might have started long ago.
+function list_logfiles_for_first_last() {
+  local older=()
+
+  # Only look for older files if the rotation follows the usual naming scheme.
+  if [[ "$logfile_prev" == "${logfile_last}.1" ]]; then
+    local n=2
+    while true; do
+      if [ -r "${logfile_last}.${n}.gz" ]; then
+        older=("${logfile_last}.${n}.gz" "${older[@]}")
+      elif [ -r "${logfile_last}.${n}" ]; then
+        older=("${logfile_last}.${n}" "${older[@]}")
+      else
+        break
+      fi
+      n=$((n+1))
+    done
+  fi
+
+  local f
+  for f in "${older[@]}"; do
+    echo "$f"
+  done
+
+  # The $logfile_prev might be the dummy empty file, no need to look at it then.
+  if [ -s "$logfile_prev" ]; then
+    echo "$logfile_prev"
+  fi
+
+  echo "$logfile_last"
+} # }}}
+
+# awk_script_set_cur_timestr sets curTimestr to the timestamp of the current
+# line, in the same format as we use for --from and --to ("2006-01-02-15:04"),
+# so that they can be compared lexicographically.
+awk_script_set_cur_timestr='
+  '$awk_func_infer_year'
+  BEGIN { '$awk_vars' }
+  {
+    month = '"$awktime_month"';
+    year = '"$awktime_year"';
+    day = '"$awktime_day"';
+    hhmm = '"$awktime_hhmm"';
+
+    curTimestr = year "-" month "-" day "-" hhmm;
+  }
+'
+
+# If --range is given, awk_range_check should be used in the awk scripts right
+# before the pattern checks: it skips the lines outside of all the ranges.
+awk_range_check=''
+if [[ ${#ranges[@]} != 0 ]]; then
+  range_cond=''
+  for range in "${ranges[@]}"; do
+    if [[ "$range" != *,* ]]; then
+      echo "error:invalid --range $range, expected from,to" 1>&2
+      exit 1
+    fi
+
+    range_from="${range%%,*}"
+    range_to="${range#*,}"
+
+    cond="curTimestr >= \"$range_from\""
+    if [[ "$range_to" != "" ]]; then
+      cond="$cond && curTimestr < \"$range_to\""
+    fi
+
+    if [[ "$range_cond" != "" ]]; then
+      range_cond="$range_cond || "
+    fi
+    range_cond="$range_cond($cond)"
+  done
+
+  awk_range_check="$awk_script_set_cur_timestr"'
+  !('"$range_cond"') { next }
+  '
+fi
+
+# function get_logfile_first_timestr() {{{
+#
+# Prints the timestamp of the first line in the given log file, in the same
+# format as we use for --from and --to ("2006-01-02-15:04"). If the file is
+# empty, prints nothing.
+function get_logfile_first_timestr() {
+  cat_logfile "$1" | head -n 1 | "$awk_binary" -b "$awk_script_set_cur_timestr"'
+  { print curTimestr }
+  '
+} # }}}
+
+# function find_logfile_idx_by_timestr() {{{
+#
+# Binary-searches the global `logfiles` array (which is sorted from the oldest
+# to the latest) for the latest file which starts not later than the given
+# timestr (in the "2006-01-02-15:04" format), and prints its index. If the
+# timestr is earlier than all the logs we have, prints 0.
+#
+# Every step only needs to read a single line from a file, so even with a lot
+# of rotated (and potentially gzipped) files, it's fast.
+function find_logfile_idx_by_timestr() {
+  local lo=0
+  local hi=$(( ${#logfiles[@]} - 1 ))
+
+  while [[ $lo -lt $hi ]]; do
+    local mid=$(( (lo + hi + 1) / 2 ))
+    local mid_timestr="$(get_logfile_first_timestr "${logfiles[$mid]}")"
+
+    if [[ "$mid_timestr" == "" || ! "$mid_timestr" > "$1" ]]; then
+      lo=$mid
+    else
+      hi=$(( mid - 1 ))
+    fi
+  done
+
+  echo $lo
+} # }}}
+
+# function find_first_last() {{{
+#
+# Handler for the first_last command: prints the first and the last log lines
+# matching $user_pattern within the --from and --to range, as "first:<line>"
+# and "last:<line>". If nothing matches, prints nothing.
+function find_first_last() {
+  echo "p:stage:$STAGE_QUERYING:looking for first and last occurrences" 1>&2
+
+  local awk_pattern_check=''
+  if [[ "$user_pattern" != "" ]]; then
+    awk_pattern_check="!($user_pattern) {next}"
+  fi
+
+  if [[ "$logfile_last" == "${SPECIAL_FILENAME_JOURNALCTL}" ]]; then
+    local cmd="$journalctl_binary $JOURNALCTL_FORMAT_FLAG --quiet"
+
+    if [[ "$from" != "" ]]; then
+      cmd="$cmd --since \"${from:0:10} ${from:11}:00\""
+    fi
+
+    if [[ "$to" != "" ]]; then
+      cmd="$cmd --until \"${to:0:10} ${to:11}:00\""
+    fi
+
+    echo "debug:Command to get logs: $cmd" 1>&2
+
+    # Journalctl can do the heavy lifting for us: to get the last occurrence,
+    # just read the logs in reverse, and stop at the first match.
+    eval "$cmd" | "$awk_binary" "$awk_pattern_check"' { print "first:" $0; exit }'
+    eval "$cmd --reverse" | "$awk_binary" "$awk_pattern_check"' { print "last:" $0; exit }'
+
+    echo "p:stage:$STAGE_DONE:done" 1>&2
+    return 0
+  fi
+
+  logfiles=()
+  local f
+  while IFS= read -r f; do
+    logfiles+=("$f")
+  done < <(list_logfiles_for_first_last)
+
+  local idx_from=0
+  local idx_to=$(( ${#logfiles[@]} - 1 ))
+
+  if [[ "$from" != "" ]]; then
+    idx_from=$(find_logfile_idx_by_timestr "$from") || return 1
+  fi
+
+  if [[ "$to" != "" ]]; then
+    idx_to=$(find_logfile_idx_by_timestr "$to") || return 1
+  fi
+
+  echo "debug:Looking at $(( idx_to - idx_from + 1 )) out of ${#logfiles[@]} log files: ${logfiles[*]:$idx_from:$(( idx_to - idx_from + 1 ))}" 1>&2
+
+  local awk_time_check='
+  ("'$from'" != "" && curTimestr < "'$from'") { next }
+  ("'$to'" != "" && curTimestr >= "'$to'") { exit }
+  '
+
+  local line
+  local i
+
+  # Go through the files from the oldest to the latest, and stop at the very
+  # first match.
+  for (( i = idx_from; i <= idx_to; i++ )); do
+    line="$(cat_logfile "${logfiles[$i]}" | "$awk_binary" -b "$awk_script_set_cur_timestr"'
+    '"$awk_time_check"'
+    '"$awk_pattern_check"'
+    { print; exit }
+    ')" || return 1
+
+    if [[ "$line" != "" ]]; then
+      echo "first:$line"
+      break
+    fi
+  done
+
+  # If there was no first match, there won't be the last one either.
+  if [[ "$line" == "" ]]; then
+    echo "p:stage:$STAGE_DONE:done" 1>&2
+    return 0
+  fi
+
+  # Now go through the files from the latest to the oldest, and stop at the
+  # first file having any matches; the last match from that file is what
+  # we're looking for.
+  for (( i = idx_to; i >= idx_from; i-- )); do
+    line="$(cat_logfile "${logfiles[$i]}" | "$awk_binary" -b "$awk_script_set_cur_timestr"'
+    '"$awk_time_check"'
+    '"$awk_pattern_check"'
+    { lastMatch = $0 }
+    END { if (lastMatch != "") print lastMatch }
+    ')" || return 1
+
+    if [[ "$line" != "" ]]; then
+      echo "last:$line"
+      break
+    fi
+  done
+
+  echo "p:stage:$STAGE_DONE:done" 1>&2
+} # }}}
+
 user_pattern=$1
 
+if [[ "${command}" == "first_last" ]]; then
+  find_first_last || exit 1
+  exit 0
+fi
+
+# What follows is the handler for the "query" command.
+
 if [[ "$logfile_last" == "${SPECIAL_FILENAME_JOURNALCTL}" ]]; then
   echo "p:stage:$STAGE_QUERYING:querying logs:Note that journalctl can be SLOW. Consider using log files." 1>&2
 
@@ -898,6 +1404,54 @@ total_size=$((logfile_prev_size+logfile_last_size)) || exit 1
 
 if [[ "$refresh_index" == "1" ]]; then
   rm -f $indexfile || exit 1
+  rm -f ${indexfile}_cache_* || exit 1
+fi
+
+# A portable function to get file modification time as a unix timestamp.
+# Usage: get_file_modtime_unix /path/to/file
+get_file_modtime_unix() {
+  case $os_kind in
+    linux)
+      stat -c %Y "$1"
+      ;;
+    macos|bsd)
+      stat -f %m "$1"
+      ;;
+    *)
+      echo "error:internal error: invalid os_kind '$os_kind'" 1>&2
+      return 1
+  esac
+}
+
+# If caching is enabled, figure out the cache file for this query, and if it's
+# fresh enough, just print it instead of scanning the logs.
+cachefile=""
+if [[ "$cache_ttl" != "" && "$cache_ttl" != "0" ]]; then
+  # The key is all the args (which include the time range and the pattern)
+  # plus the current year; and if the time range is open-ended, then also the
+  # sizes of the log files, since new logs change the result.
+  cache_key="$(printf '%s\n' "${orig_args[@]}" "$CUR_YEAR-$CUR_MONTH")"
+  if [[ "$to" == "" ]]; then
+    cache_key="$cache_key $logfile_prev_size $logfile_last_size"
+  fi
+
+  cachefile="${indexfile}_cache_$(echo "$cache_key" | cksum | tr ' ' '_')"
+
+  # The cache file contains the raw logs, so it's only created readable by the
+  # current user (see mktemp below), and we only trust the ones owned by us.
+  if [ -s "$cachefile" ] && [ -O "$cachefile" ]; then
+    cache_age=$(( $(date +%s) - $(get_file_modtime_unix "$cachefile") ))
+    if [[ $cache_age -ge 0 && $cache_age -lt $cache_ttl ]]; then
+      echo "debug:Using cached result from $cachefile" 1>&2
+      cat "$cachefile" || exit 1
+      echo "p:stage:$STAGE_DONE:done" 1>&2
+      exit 0
+    fi
+  fi
+
+  # Cleanup the stale cache files, if any.
+  find "$(dirname "$indexfile")" -maxdepth 1 -name "$(basename "$indexfile")_cache_*" -user "$(id -u)" \
+    -mmin +$(( (cache_ttl+59)/60 )) -exec rm -f {} + 2>/dev/null
 fi
 
 function refresh_index { # {{{
@@ -905,36 +1459,6 @@ function refresh_index { # {{{
   local last_bytenr=0
   local prevlog_bytes=$(get_prevlog_bytenr)
 
-  awk_vars='
-    monthByName["Jan"] = "01";
-    monthByName["Feb"] = "02";
-    monthByName["Mar"] = "03";
-    monthByName["Apr"] = "04";
-    monthByName["May"] = "05";
-    monthByName["Jun"] = "06";
-    monthByName["Jul"] = "07";
-    monthByName["Aug"] = "08";
-    monthByName["Sep"] = "09";
-    monthByName["Oct"] = "10";
-    monthByName["Nov"] = "11";
-    monthByName["Dec"] = "12";
-
-    curYear = '${CUR_YEAR}';
-    curMonth = '${CUR_MONTH}';
-
-    yearByMonth["01"] = inferYear(1, curYear, curMonth) "";
-    yearByMonth["02"] = inferYear(2, curYear, curMonth) "";
-    yearByMonth["03"] = inferYear(3, curYear, curMonth) "";
-    yearByMonth["04"] = inferYear(4, curYear, curMonth) "";
-    yearByMonth["05"] = inferYear(5, curYear, curMonth) "";
-    yearByMonth["06"] = inferYear(6, curYear, curMonth) "";
-    yearByMonth["07"] = inferYear(7, curYear, curMonth) "";
-    yearByMonth["08"] = inferYear(8, curYear, curMonth) "";
-    yearByMonth["09"] = inferYear(9, curYear, curMonth) "";
-    yearByMonth["10"] = inferYear(10, curYear, curMonth) "";
-    yearByMonth["11"] = inferYear(11, curYear, curMonth) "";
-    yearByMonth["12"] = inferYear(12, curYear, curMonth) "";
-  '
 
   # Add new entries to index, if needed
 
@@ -956,16 +1480,7 @@ function refresh_index { # {{{
   # bunch of other time-filtering logic here. Although it's cool since it
   # includes the year, microseconds, and timezone.
   awk_functions='
-function inferYear(logMonth, curYear, curMonth) {
-  delta = logMonth - curMonth
-
-  if (delta <= -11)       # log month is Jan, current is Dec -> next year
-    return curYear + 1
-  else if (delta >= 8)    # log month is Sep-Dec, current is Jan -> previous year
-    return curYear - 1
-  else
-    return curYear
-}
+'$awk_func_infer_year'
 
 function printIndexLine(outfile, timestr, linenr, bytenr) {
   print "idx\t" timestr "\t" linenr "\t" bytenr >> outfile;
@@ -1124,6 +1639,145 @@ function get_linenr_and_bytenr_from_index() { # {{{
   ' $indexfile
 } # }}}
 
+# function get_line_at_bytenr() {{{
+#
+# Takes a byte number in the two log files concatenated (1-based, just like
+# the byte numbers in the index), finds the first line which starts at or
+# after it, and prints the timestr of that line (in the "2006-01-02-15:04"
+# format) and the byte number where that line starts, space-separated. If
+# there is no such line, prints nothing.
+#
+# It only reads a tiny bit of data around the given offset, so it's fast
+# regardless of the file size.
+function get_line_at_bytenr() {
+  local bytenr=$1
+  local prevlog_bytes=$(get_prevlog_bytenr)
+
+  local file="$logfile_prev"
+  local base=0
+  if [[ $bytenr -gt $prevlog_bytes ]]; then
+    file="$logfile_last"
+    base=$prevlog_bytes
+  fi
+
+  local offset=$(( bytenr - base ))
+  local res
+
+  if [[ $offset -le 1 ]]; then
+    # We're at the very beginning of the file, nothing to align.
+    res="$(head -n 1 "$file" | "$awk_binary" -b "$awk_script_set_cur_timestr"'
+      { print curTimestr " 1" }
+    ')"
+  else
+    # Start reading one byte earlier and skip the first record: if that byte
+    # is a newline, the first record is empty and the next line starts exactly
+    # at $offset; otherwise we skip the rest of the line which we landed in the
+    # middle of.
+    res="$(tail -c +$(( offset - 1 )) "$file" | head -n 2 | "$awk_binary" -b "$awk_script_set_cur_timestr"'
+      NR == 1 { skip = length($0) + 1; next }
+      { print curTimestr " " ('$offset' - 1 + skip); exit }
+    ')"
+  fi
+
+  if [[ "$res" == "" ]]; then
+    # If there are no more lines in the prev logfile, then the next line is
+    # the first one in the last logfile.
+    if [[ "$file" == "$logfile_prev" ]]; then
+      get_line_at_bytenr $(( prevlog_bytes + 1 ))
+    fi
+
+    return 0
+  fi
+
+  local timestr
+  local line_bytenr
+  read -r timestr line_bytenr <<<"$res"
+
+  echo "$timestr $(( base + line_bytenr ))"
+} # }}}
+
+# function get_prevlog_lines_counted() {{{
+#
+# Like get_prevlog_lines_from_index, but counts the lines directly, so it works
+# without the index.
+function get_prevlog_lines_counted() {
+  if [[ "$prevlog_lines_counted" == "" ]]; then
+    prevlog_lines_counted=$(( $(wc -l < "$logfile_prev") )) || return 1
+  fi
+
+  echo $prevlog_lines_counted
+} # }}}
+
+# function get_linenr_and_bytenr_bsearch() {{{
+#
+# Same as get_linenr_and_bytenr_from_index, but instead of using the index,
+# binary-searches the log files directly: seeks to the middle, aligns to the
+# next newline, checks the timestamp there, and so on. Needs about
+# log2(total_size) tiny reads, plus counting the newlines up to the found
+# offset (to get the line number), which is still way faster than awk-scanning
+# the logs from the beginning.
+#
+# NOTE: it assumes that timestamps never decrease; if they do, the boundary it
+# finds might be a bit off.
+function get_linenr_and_bytenr_bsearch() {
+  local target="$1"
+  local lo=1
+  local hi=$(( total_size + 1 ))
+  local timestr
+  local line_bytenr
+
+  while [[ $lo -lt $hi ]]; do
+    local mid=$(( (lo + hi) / 2 ))
+    timestr=""
+    line_bytenr=""
+    read -r timestr line_bytenr <<<"$(get_line_at_bytenr $mid)"
+
+    if [[ "$timestr" == "" || ! "$timestr" < "$target" ]]; then
+      hi=$mid
+    else
+      lo=$(( line_bytenr + 1 ))
+    fi
+  done
+
+  timestr=""
+  line_bytenr=""
+  read -r timestr line_bytenr <<<"$(get_line_at_bytenr $lo)"
+
+  if [[ "$timestr" == "" ]]; then
+    echo "after"
+    return 0
+  fi
+
+  if [[ $line_bytenr == 1 && "$timestr" > "$target" ]]; then
+    echo "before"
+    return 0
+  fi
+
+  local prevlog_bytes=$(get_prevlog_bytenr)
+  local linenr
+  if [[ $line_bytenr -gt $prevlog_bytes ]]; then
+    local prevlog_lines=$(get_prevlog_lines_counted) || return 1
+    linenr=$(( prevlog_lines + $(head -c $(( line_bytenr - prevlog_bytes - 1 )) "$logfile_last" | wc -l) + 1 ))
+  else
+    linenr=$(( $(head -c $(( line_bytenr - 1 )) "$logfile_prev" | wc -l) + 1 ))
+  fi
+
+  echo "found $linenr $line_bytenr"
+} # }}}
+
+# function get_linenr_and_bytenr() {{{
+#
+# Performs lookup by a timestr either using the index, or using binary search
+# (if $use_bsearch is 1). See get_linenr_and_bytenr_from_index for details on
+# the output.
+function get_linenr_and_bytenr() {
+  if [[ "$use_bsearch" == 1 ]]; then
+    get_linenr_and_bytenr_bsearch "$1"
+  else
+    get_linenr_and_bytenr_from_index "$1"
+  fi
+} # }}}
+
 function get_prevlog_lines_from_index() { # {{{
   if ! "$awk_binary" -F"\t" 'BEGIN { found=0 } $1 == "prevlog_lines" { print $2; found = 1; exit } END { if (found == 0) { exit 1 } }' $indexfile ; then
     return 1
@@ -1179,16 +1833,22 @@ if [[ "$from" != "" || "$to" != "" ]]; then
         refresh_and_retry=1
       fi
     fi
+  elif [[ $total_size -ge $bsearch_min_size ]]; then
+    echo "debug:index file doesn't exist or is empty, and logs are large ($total_size bytes), gonna use binary search instead" 1>&2
+    use_bsearch=1
+    refresh_and_retry=1
   else
     echo "debug:index file doesn't exist or is empty, gonna refresh it" 1>&2
     refresh_and_retry=1
   fi
 
   if [[ "$refresh_and_retry" == 1 ]]; then
-    refresh_index || exit 1
+    if [[ "$use_bsearch" != 1 ]]; then
+      refresh_index || exit 1
+    fi
 
     if [[ "$from" != "" ]]; then
-      read -r from_result from_linenr from_bytenr <<<$(get_linenr_and_bytenr_from_index "$from") || exit 1
+      read -r from_result from_linenr from_bytenr <<<$(get_linenr_and_bytenr "$from") || exit 1
 
       if [[ "$from_result" == "before" ]]; then
         echo "debug:the from ${from} isn't found, will use the beginning" 1>&2
@@ -1208,7 +1868,7 @@ if [[ "$from" != "" || "$to" != "" ]]; then
     fi
 
     if [[ "$to" != "" ]]; then
-      read -r to_result to_linenr to_bytenr <<<$(get_linenr_and_bytenr_from_index "$to") || exit 1
+      read -r to_result to_linenr to_bytenr <<<$(get_linenr_and_bytenr "$to") || exit 1
 
       if [[ "$to_result" == "after" ]]; then
         echo "debug:the to ${to} isn't found, will use the end" 1>&2
@@ -1230,8 +1890,15 @@ if [[ "$from" != "" || "$to" != "" ]]; then
   fi
 else
   if ! [ -s $indexfile ]; then
-    echo "debug:neither --from or --to are given, but index doesn't exist at all, gonna rebuild" 1>&2
-    refresh_index || exit 1
+    if [[ $total_size -ge $bsearch_min_size ]]; then
+      # We don't need any boundaries, so the only thing we'd use the index for
+      # is the number of lines in the prev logfile; we can just count them.
+      echo "debug:neither --from or --to are given, and index doesn't exist, but logs are large ($total_size bytes), so not building it" 1>&2
+      use_bsearch=1
+    else
+      echo "debug:neither --from or --to are given, but index doesn't exist at all, gonna rebuild" 1>&2
+      refresh_index || exit 1
+    fi
   fi
 fi
 
@@ -1242,7 +1909,11 @@ fi
 
 echo "p:stage:$STAGE_QUERYING:querying logs" 1>&2
 
-prevlog_lines=$(get_prevlog_lines_from_index)
+if [[ "$use_bsearch" == 1 ]]; then
+  prevlog_lines=$(get_prevlog_lines_counted) || exit 1
+else
+  prevlog_lines=$(get_prevlog_lines_from_index)
+fi
 prevlog_bytes=$(get_prevlog_bytenr)
 
 from_linenr_int=$from_linenr
@@ -1344,6 +2015,15 @@ echo "debug: bash -c '$cmds_concatenated'" 1>&2
 
 # Now execute all those commands, and feed those logs to the awk script
 # which will analyze them and produce the final output.
+#
+# If caching is enabled, the output is also saved to a temporary file, which
+# becomes the cache file once we know the query succeeded. The file is created
+# by mktemp, so it's only readable by the current user, and mv keeps that.
+cachefile_tmp="/dev/null"
+if [[ "$cachefile" != "" ]]; then
+  cachefile_tmp="$(umask 077; mktemp "${cachefile}.tmp.XXXXXX")" || exit 1
+fi
+
 eval $cmds_concatenated | \
   user_pattern="$user_pattern"                          \
   max_num_lines="$max_num_lines"                        \
@@ -1351,13 +2031,20 @@ eval $cmds_concatenated | \
   lines_until_check="$lines_until_check"                \
   prevlog_lines="$prevlog_lines"                        \
   from_linenr_int="$from_linenr_int"                    \
-  run_awk_script_logfiles -
+  run_awk_script_logfiles - | tee "$cachefile_tmp"
 
 codes=(${PIPESTATUS[@]})
 for status in "${codes[@]}"; do
   if [[ $status -ne 0 ]]; then
+    if [[ "$cachefile" != "" ]]; then
+      rm -f "$cachefile_tmp"
+    fi
     exit 1
   fi
 done
 
+if [[ "$cachefile" != "" ]]; then
+  mv "$cachefile_tmp" "$cachefile" || exit 1
+fi
+
 echo "p:stage:$STAGE_DONE:done" 1>&2
@@ -37,7 +37,16 @@ type AgentTestCaseYaml struct {
 	// VARIABLE=VALUE. It'll be passed to cmd.Env directly.
 	Env []string `yaml:"env"`
 
+	// Command is the agent command to run; if empty, "query" is used.
+	Command string `yaml:"command"`
+
 	Args []string `yaml:"args"`
+
+	// Runs is how many times to run the same command in a row (without
+	// removing anything in between, so e.g. the cached results from the
+	// previous runs are used); the want_stdout and want_stderr are checked
+	// for the last run. If not specified, it's run once.
+	Runs int `yaml:"runs"`
 }
 
 type TestCaseLogfiles struct {
@@ -126,9 +135,20 @@ func runAgentTestCase(t *testing.T, nerdlogAgentShFname, testCasesDir, repoRoot,
 
 	os.Remove(indexFname)
 
+	// Also remove the cached results from the previous runs, if any.
+	cacheFnames, _ := filepath.Glob(indexFname + "_cache_*")
+	for _, fname := range cacheFnames {
+		os.Remove(fname)
+	}
+
+	command := tc.Command
+	if command == "" {
+		command = "query"
+	}
+
 	cmdArgs := []string{
 		nerdlogAgentShFname,
-		"query",
+		command,
 		"--logfile-last", provisioned.logfileLast,
 		"--logfile-prev", provisioned.logfilePrev,
 		"--index-file", indexFname,
@@ -149,6 +169,16 @@ func runAgentTestCase(t *testing.T, nerdlogAgentShFname, testCasesDir, repoRoot,
 
 	cmdArgs = append(cmdArgs, tc.Args...)
 
+	// If asked to run the command multiple times, do all the runs except the
+	// last one, without checking anything but stdout; the last one is below.
+	for i := 1; i < tc.Runs; i++ {
+		if err := runNerdlogAgent(t, &tc, cmdArgs, testCaseDir, provisioned.extraEnv, testName, testNerdlogAgentParams{
+			checkStderr: false,
+		}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
 	// Do the full run, with the provided initial index (which in most cases
 	// means, without any index)
 	if err := runNerdlogAgent(t, &tc, cmdArgs, testCaseDir, provisioned.extraEnv, testName, testNerdlogAgentParams{
@@ -162,6 +192,17 @@ func runAgentTestCase(t *testing.T, nerdlogAgentShFname, testCasesDir, repoRoot,
 		return nil
 	}
 
+	// Same for commands other than "query": they don't use the index.
+	if command != "query" {
+		return nil
+	}
+
+	// And if the agent decided to binary-search the logs instead of building the
+	// index, there's nothing to index up either.
+	if _, err := os.Stat(indexFname); os.IsNotExist(err) {
+		return nil
+	}
+
 	// For log files tests, we rerun the test multiple times after removing some
 	// latest lines from the index, expecting it to index up and to produce the same
 	// result.
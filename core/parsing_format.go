@@ -0,0 +1,211 @@
+package core
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// LogFormat is the overall format of log lines, as detected by
+// DetectLogFormat.
+type LogFormat string
+
+const (
+	LogFormatUnknown LogFormat = ""
+
+	// LogFormatSyslog is the traditional syslog format, with the timestamp,
+	// hostname and program, e.g.:
+	//
+	//	Mar  5 10:07:46 myhost myprogram[1234]: Something happened
+	LogFormatSyslog LogFormat = "syslog"
+
+	// LogFormatRFC5424 is the syslog format as per RFC 5424, e.g.:
+	//
+	//	<34>1 2025-03-05T10:07:46.123Z myhost myprogram 1234 ID47 - Something happened
+	//
+	// Since every line must start with a timestamp, nerdlog can only query
+	// these logs if they are written without the "<PRI>VERSION" header.
+	LogFormatRFC5424 LogFormat = "rfc5424"
+
+	// LogFormatJSON is one JSON object per line.
+	LogFormatJSON LogFormat = "json"
+
+	// LogFormatLogfmt is key=value pairs, e.g.:
+	//
+	//	time=2025-03-05T10:07:46Z level=info msg="Something happened"
+	LogFormatLogfmt LogFormat = "logfmt"
+
+	// LogFormatAccessLog is the Common or Combined Log Format, used by Apache
+	// and Nginx access logs, e.g.:
+	//
+	//	127.0.0.1 - - [05/Mar/2025:10:07:46 +0000] "GET / HTTP/1.1" 200 612
+	LogFormatAccessLog LogFormat = "access_log"
+
+	// LogFormatCRI is the format of container logs written by Kubernetes
+	// container runtimes, e.g.:
+	//
+	//	2025-03-05T10:07:46.123456789Z stdout F Something happened
+	LogFormatCRI LogFormat = "cri"
+
+	// LogFormatPlain is any other format where every line starts with a
+	// timestamp.
+	LogFormatPlain LogFormat = "plain"
+)
+
+// Descr returns a human-readable description of the log format.
+func (f LogFormat) Descr() string {
+	switch f {
+	case LogFormatSyslog:
+		return "traditional syslog"
+	case LogFormatRFC5424:
+		return "RFC 5424 syslog"
+	case LogFormatJSON:
+		return "JSON"
+	case LogFormatLogfmt:
+		return "logfmt"
+	case LogFormatAccessLog:
+		return "HTTP access log"
+	case LogFormatCRI:
+		return "CRI container log"
+	case LogFormatPlain:
+		return "plain text with timestamps"
+	default:
+		return "unknown"
+	}
+}
+
+// allLogFormats are all the known formats except LogFormatUnknown, in the
+// order DetectLogFormat prefers them.
+var allLogFormats = []LogFormat{
+	LogFormatCRI,
+	LogFormatRFC5424,
+	LogFormatJSON,
+	LogFormatAccessLog,
+	LogFormatLogfmt,
+	LogFormatSyslog,
+	LogFormatPlain,
+}
+
+// ParseLogFormat parses the log format name, like "syslog" or "json".
+func ParseLogFormat(s string) (LogFormat, error) {
+	for _, f := range allLogFormats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+
+	names := make([]string, 0, len(allLogFormats))
+	for _, f := range allLogFormats {
+		names = append(names, string(f))
+	}
+
+	return LogFormatUnknown, errors.Errorf(
+		"unknown log format %q, valid ones are: %s", s, strings.Join(names, ", "),
+	)
+}
+
+// LogFormatOverride is the log format and the timestamp layout which the user
+// has chosen for a logstream; they are used instead of the detected ones. The
+// format selects how the envelope of every message is parsed (see
+// LStreamClient.parseLogMsgEnvelope), and the layout is how the timestamps
+// are parsed, both by the agent and by nerdlog itself.
+type LogFormatOverride struct {
+	Format LogFormat
+
+	// TimestampLayout is a Go-style time layout like "Jan _2 15:04:05"; if
+	// empty, the detected one is used.
+	TimestampLayout string
+}
+
+// LogFormatOverrides gives the LogFormatOverride-s for the logstreams. It
+// must be safe for concurrent use.
+type LogFormatOverrides interface {
+	// Get returns the override for the logstream with the given name (see
+	// LogStream.Name), if any.
+	Get(lstreamName string) (LogFormatOverride, bool)
+}
+
+var (
+	criLineRegex       = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\S+ (stdout|stderr) [FP] `)
+	rfc5424LineRegex   = regexp.MustCompile(`^(<\d{1,3}>)?1 (\d{4}-\d{2}-\d{2}T\S+|-) \S+ \S+ \S+ \S+ `)
+	accessLogLineRegex = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]+\] "[^"]*" \d{3} \S+`)
+	logfmtKeyRegex     = regexp.MustCompile(`(?:^|\s)[A-Za-z_][\w.\-]*=`)
+)
+
+// DetectLogFormat looks at the given example log lines and returns the format
+// which most of them have; if lines have different formats, the first one
+// in the order of the LogFormat constants wins the tie.
+func DetectLogFormat(logLines []string) LogFormat {
+	counts := map[LogFormat]int{}
+	for _, line := range logLines {
+		counts[detectLineLogFormat(line)]++
+	}
+
+	res := LogFormatUnknown
+	resCount := 0
+	for _, f := range allLogFormats {
+		if counts[f] > resCount {
+			res = f
+			resCount = counts[f]
+		}
+	}
+
+	return res
+}
+
+// detectLineLogFormat returns the format of a single log line.
+func detectLineLogFormat(line string) LogFormat {
+	switch {
+	case criLineRegex.MatchString(line):
+		return LogFormatCRI
+
+	case rfc5424LineRegex.MatchString(line):
+		return LogFormatRFC5424
+
+	case strings.HasPrefix(strings.TrimSpace(line), "{") && json.Valid([]byte(line)):
+		return LogFormatJSON
+
+	case accessLogLineRegex.MatchString(line):
+		return LogFormatAccessLog
+
+	case isLogfmtLine(line):
+		return LogFormatLogfmt
+	}
+
+	layout := DetectTimeLayout(line)
+	if layout == "" {
+		return LogFormatUnknown
+	}
+
+	if tsLen := timestampLenInLine(layout, line); len(line) > tsLen {
+		rest := strings.TrimSpace(line[tsLen:])
+		if syslogRegex.MatchString(rest) {
+			return LogFormatSyslog
+		}
+
+		if _, err := parseRFC5424Envelope(rest); err == nil {
+			return LogFormatRFC5424
+		}
+
+		// The structured logs are often written with the timestamp prepended,
+		// like "2025-03-05T10:07:46Z {...}".
+		if strings.HasPrefix(rest, "{") && json.Valid([]byte(rest)) {
+			return LogFormatJSON
+		}
+
+		if isLogfmtLine(rest) {
+			return LogFormatLogfmt
+		}
+	}
+
+	return LogFormatPlain
+}
+
+// isLogfmtLine returns whether the line starts with a key=value pair, and has
+// at least one more after that.
+func isLogfmtLine(line string) bool {
+	locs := logfmtKeyRegex.FindAllStringIndex(line, -1)
+	return len(locs) >= 2 && locs[0][0] == 0
+}
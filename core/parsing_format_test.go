@@ -0,0 +1,139 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type detectLogFormatTestCase struct {
+	name       string
+	logLines   []string
+	wantFormat LogFormat
+}
+
+func TestDetectLogFormat(t *testing.T) {
+	testCases := []detectLogFormatTestCase{
+		{
+			name: "traditional syslog",
+			logLines: []string{
+				"Apr  8 01:02:03 somehost systemd[1]: Started something.",
+				"Apr  8 01:02:04 somehost kernel: Something else.",
+			},
+			wantFormat: LogFormatSyslog,
+		},
+		{
+			name: "modern rsyslog",
+			logLines: []string{
+				"2024-04-19T14:23:45.123456+02:00 somehost myapp[123]: something happened",
+			},
+			wantFormat: LogFormatSyslog,
+		},
+		{
+			name: "RFC 5424",
+			logLines: []string{
+				`<34>1 2024-04-19T14:23:45.003Z somehost myapp 123 ID47 [exampleSDID@32473 iut="3"] something happened`,
+				"<165>1 2024-04-19T14:23:46.003Z somehost myapp - - - something else",
+			},
+			wantFormat: LogFormatRFC5424,
+		},
+		{
+			name: "RFC 5424 without the header",
+			logLines: []string{
+				`2024-04-19T14:23:45.003Z somehost myapp 123 ID47 [exampleSDID@32473 iut="3"] something happened`,
+			},
+			wantFormat: LogFormatRFC5424,
+		},
+		{
+			name: "JSON",
+			logLines: []string{
+				`{"time":"2024-04-19T14:23:45Z","level":"info","msg":"something happened"}`,
+				`{"time":"2024-04-19T14:23:46Z","level":"error","msg":"something else"}`,
+			},
+			wantFormat: LogFormatJSON,
+		},
+		{
+			name: "logfmt",
+			logLines: []string{
+				`time=2024-04-19T14:23:45Z level=info msg="something happened"`,
+			},
+			wantFormat: LogFormatLogfmt,
+		},
+		{
+			name: "JSON with timestamps",
+			logLines: []string{
+				`2024-04-19T14:23:45Z {"level":"info","msg":"something happened"}`,
+			},
+			wantFormat: LogFormatJSON,
+		},
+		{
+			name: "logfmt with timestamps",
+			logLines: []string{
+				`2024-04-19T14:23:45Z level=info msg="something happened"`,
+			},
+			wantFormat: LogFormatLogfmt,
+		},
+		{
+			name: "access log",
+			logLines: []string{
+				`127.0.0.1 - - [19/Apr/2024:14:23:45 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.5.0"`,
+				`10.0.0.2 - bob [19/Apr/2024:14:23:46 +0000] "POST /api HTTP/1.1" 404 -`,
+			},
+			wantFormat: LogFormatAccessLog,
+		},
+		{
+			name: "CRI",
+			logLines: []string{
+				"2024-04-19T14:23:45.123456789Z stdout F something happened",
+				"2024-04-19T14:23:45.223456789Z stderr P partial line",
+			},
+			wantFormat: LogFormatCRI,
+		},
+		{
+			name: "plain with timestamps",
+			logLines: []string{
+				"2024-04-19T14:23:45.123456Z INFO something happened",
+			},
+			wantFormat: LogFormatPlain,
+		},
+		{
+			name: "mixed, majority wins",
+			logLines: []string{
+				`{"msg":"one"}`,
+				"Apr  8 01:02:03 somehost systemd[1]: Started something.",
+				`{"msg":"two"}`,
+			},
+			wantFormat: LogFormatJSON,
+		},
+		{
+			name: "no timestamps",
+			logLines: []string{
+				"This is a log line without a timestamp.",
+			},
+			wantFormat: LogFormatUnknown,
+		},
+		{
+			name:       "no lines",
+			logLines:   nil,
+			wantFormat: LogFormatUnknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantFormat, DetectLogFormat(tc.logLines))
+		})
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	f, err := ParseLogFormat("logfmt")
+	assert.NoError(t, err)
+	assert.Equal(t, LogFormatLogfmt, f)
+
+	_, err = ParseLogFormat("xml")
+	assert.Error(t, err)
+
+	_, err = ParseLogFormat("")
+	assert.Error(t, err)
+}
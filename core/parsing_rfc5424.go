@@ -0,0 +1,240 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// rfc5424NilValue is used in RFC 5424 messages for the header fields which
+// are not available.
+const rfc5424NilValue = "-"
+
+// rfc5424Envelope is the part of the RFC 5424 syslog message which follows
+// the timestamp:
+//
+//	HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+//
+// E.g.:
+//
+//	myhost myapp 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App"] Something happened
+//
+// Nil values ("-") are represented as empty strings.
+type rfc5424Envelope struct {
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string
+
+	SD []rfc5424SDElement
+
+	Msg string
+}
+
+// rfc5424SDElement is a single structured data element, like
+// [exampleSDID@32473 iut="3" eventSource="App"].
+type rfc5424SDElement struct {
+	ID     string
+	Params []rfc5424SDParam
+}
+
+type rfc5424SDParam struct {
+	Name  string
+	Value string
+}
+
+// parseRFC5424Envelope parses the RFC 5424 message with the timestamp
+// already stripped, see rfc5424Envelope.
+func parseRFC5424Envelope(s string) (*rfc5424Envelope, error) {
+	p := &rfc5424Parser{s: s}
+
+	var headerFields [4]string
+	for i := range headerFields {
+		field, err := p.parseHeaderField()
+		if err != nil {
+			return nil, errors.Annotatef(err, "header field #%d", i+1)
+		}
+
+		if field != rfc5424NilValue {
+			headerFields[i] = field
+		}
+	}
+
+	env := &rfc5424Envelope{
+		Hostname: headerFields[0],
+		AppName:  headerFields[1],
+		ProcID:   headerFields[2],
+		MsgID:    headerFields[3],
+	}
+
+	sd, err := p.parseStructuredData()
+	if err != nil {
+		return nil, errors.Annotatef(err, "structured data")
+	}
+	env.SD = sd
+
+	if p.pos < len(p.s) {
+		if p.s[p.pos] != ' ' {
+			return nil, errors.Errorf("expected a space after structured data at position %d", p.pos)
+		}
+
+		// The message might start with the UTF-8 BOM, which we don't need.
+		env.Msg = strings.TrimPrefix(p.s[p.pos+1:], "\xEF\xBB\xBF")
+	}
+
+	return env, nil
+}
+
+// setContext populates the LogMsg context with the envelope fields.
+// Structured data parameters are added as "<SD-ID>.<PARAM-NAME>", e.g.
+// "exampleSDID@32473.iut", and the list of all SD-IDs is added as "sd_ids".
+func (env *rfc5424Envelope) setContext(ctx map[string]string) {
+	setIfNotEmpty := func(key, value string) {
+		if value != "" {
+			ctx[key] = value
+		}
+	}
+
+	setIfNotEmpty("hostname", env.Hostname)
+	setIfNotEmpty("program", env.AppName)
+	setIfNotEmpty("pid", env.ProcID)
+	setIfNotEmpty("msgid", env.MsgID)
+
+	sdIDs := make([]string, 0, len(env.SD))
+	for _, elem := range env.SD {
+		sdIDs = append(sdIDs, elem.ID)
+
+		for _, param := range elem.Params {
+			key := elem.ID + "." + param.Name
+
+			// The same param can be repeated in an element, so if it happens,
+			// keep all values.
+			if prev, ok := ctx[key]; ok {
+				ctx[key] = prev + "," + param.Value
+			} else {
+				ctx[key] = param.Value
+			}
+		}
+	}
+
+	setIfNotEmpty("sd_ids", strings.Join(sdIDs, ","))
+}
+
+type rfc5424Parser struct {
+	s   string
+	pos int
+}
+
+// parseHeaderField parses a non-empty field terminated by a space, and
+// consumes that space.
+func (p *rfc5424Parser) parseHeaderField() (string, error) {
+	end := strings.IndexByte(p.s[p.pos:], ' ')
+	if end <= 0 {
+		return "", errors.Errorf("expected a non-empty field followed by a space at position %d", p.pos)
+	}
+
+	field := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+
+	return field, nil
+}
+
+// parseStructuredData parses either the nil value "-", or one or more SD
+// elements like [id param="value"], with no spaces in between.
+func (p *rfc5424Parser) parseStructuredData() ([]rfc5424SDElement, error) {
+	if strings.HasPrefix(p.s[p.pos:], rfc5424NilValue) {
+		p.pos += len(rfc5424NilValue)
+		return nil, nil
+	}
+
+	var ret []rfc5424SDElement
+	for p.pos < len(p.s) && p.s[p.pos] == '[' {
+		p.pos++
+
+		elem := rfc5424SDElement{
+			ID: p.parseSDName(),
+		}
+		if elem.ID == "" {
+			return nil, errors.Errorf("expected SD-ID at position %d", p.pos)
+		}
+
+		for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+			p.pos++
+
+			param, err := p.parseSDParam()
+			if err != nil {
+				return nil, errors.Annotatef(err, "SD element %q", elem.ID)
+			}
+
+			elem.Params = append(elem.Params, *param)
+		}
+
+		if p.pos >= len(p.s) || p.s[p.pos] != ']' {
+			return nil, errors.Errorf("expected ] at position %d", p.pos)
+		}
+		p.pos++
+
+		ret = append(ret, elem)
+	}
+
+	if len(ret) == 0 {
+		return nil, errors.Errorf("expected - or [ at position %d", p.pos)
+	}
+
+	return ret, nil
+}
+
+// parseSDName parses SD-ID or PARAM-NAME: printable ASCII chars except '=',
+// space, ']' and '"'.
+func (p *rfc5424Parser) parseSDName() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			break
+		}
+		p.pos++
+	}
+
+	return p.s[start:p.pos]
+}
+
+// parseSDParam parses name="value", where the value might contain escaped
+// chars \", \\ and \].
+func (p *rfc5424Parser) parseSDParam() (*rfc5424SDParam, error) {
+	name := p.parseSDName()
+	if name == "" {
+		return nil, errors.Errorf("expected PARAM-NAME at position %d", p.pos)
+	}
+
+	if !strings.HasPrefix(p.s[p.pos:], `="`) {
+		return nil, errors.Errorf(`expected =" after %q at position %d`, name, p.pos)
+	}
+	p.pos += 2
+
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return nil, errors.Errorf("unterminated value of %q", name)
+		}
+
+		c := p.s[p.pos]
+		p.pos++
+
+		switch c {
+		case '"':
+			return &rfc5424SDParam{Name: name, Value: sb.String()}, nil
+
+		case '\\':
+			// Only these three chars can be escaped; for any other char, the
+			// backslash is kept as is.
+			if p.pos < len(p.s) && strings.IndexByte(`"\]`, p.s[p.pos]) >= 0 {
+				sb.WriteByte(p.s[p.pos])
+				p.pos++
+				continue
+			}
+		}
+
+		sb.WriteByte(c)
+	}
+}
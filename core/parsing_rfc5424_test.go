@@ -0,0 +1,88 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRFC5424Envelope(t *testing.T) {
+	type testCase struct {
+		name        string
+		input       string
+		wantContext map[string]string
+		wantMsg     string
+		wantErr     bool
+	}
+
+	testCases := []testCase{
+		{
+			name:  "example from the RFC",
+			input: `mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] BOMAn application event log entry...`,
+			wantContext: map[string]string{
+				"hostname":                      "mymachine.example.com",
+				"program":                       "evntslog",
+				"msgid":                         "ID47",
+				"sd_ids":                        "exampleSDID@32473",
+				"exampleSDID@32473.iut":         "3",
+				"exampleSDID@32473.eventSource": "Application",
+				"exampleSDID@32473.eventID":     "1011",
+			},
+			wantMsg: "BOMAn application event log entry...",
+		},
+		{
+			name:  "multiple SD elements, escapes and BOM",
+			input: "myhost myapp 1234 - [a@1 x=\"q\\\"uo\\]te\\\\\" x=\"2\"][b@2][c@3 y=\"\"] \xEF\xBB\xBFhello world",
+			wantContext: map[string]string{
+				"hostname": "myhost",
+				"program":  "myapp",
+				"pid":      "1234",
+				"sd_ids":   "a@1,b@2,c@3",
+				"a@1.x":    `q"uo]te\,2`,
+				"c@3.y":    "",
+			},
+			wantMsg: "hello world",
+		},
+		{
+			name:        "all nil values and no message",
+			input:       "- - - - -",
+			wantContext: map[string]string{},
+			wantMsg:     "",
+		},
+		{
+			name:    "traditional syslog",
+			input:   "myhost myapp[123]: Something happened",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated SD element",
+			input:   `myhost myapp - - [a@1 x="1" hello`,
+			wantErr: true,
+		},
+		{
+			name:    "no space after SD",
+			input:   `myhost myapp - - [a@1]hello`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, err := parseRFC5424Envelope(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			ctx := map[string]string{}
+			env.setContext(ctx)
+
+			assert.Equal(t, tc.wantContext, ctx)
+			assert.Equal(t, tc.wantMsg, env.Msg)
+		})
+	}
+}
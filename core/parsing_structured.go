@@ -0,0 +1,233 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// structuredMsgKeys are the keys of JSON and logfmt messages which contain
+// the actual message, in the order of preference.
+var structuredMsgKeys = []string{"msg", "message"}
+
+// structuredLevelKeys are the keys of JSON and logfmt messages which contain
+// the level, in the order of preference.
+var structuredLevelKeys = []string{"level", "lvl", "severity"}
+
+// parseCRIEnvelope parses the CRI container log message with the timestamp
+// already stripped, like "stdout F Something happened": the stream is added
+// to the context as "stream", and for the partial lines (with the "P" tag),
+// "partial" is set to "true". Returns false if the message doesn't look like
+// that.
+func parseCRIEnvelope(logMsg *LogMsg) bool {
+	parts := strings.SplitN(logMsg.Msg, " ", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	stream, tag := parts[0], parts[1]
+	if (stream != "stdout" && stream != "stderr") || (tag != "F" && tag != "P") {
+		return false
+	}
+
+	logMsg.Context["stream"] = stream
+	if tag == "P" {
+		logMsg.Context["partial"] = "true"
+	}
+
+	logMsg.Msg = ""
+	if len(parts) == 3 {
+		logMsg.Msg = parts[2]
+	}
+
+	return true
+}
+
+// parseJSONEnvelope parses the message which is a JSON object (with the
+// timestamp already stripped): the top-level fields are added to the
+// context (the nested objects and arrays as JSON), see setStructuredFields.
+// Returns false if the message isn't a JSON object.
+func parseJSONEnvelope(logMsg *LogMsg) bool {
+	if !strings.HasPrefix(logMsg.Msg, "{") {
+		return false
+	}
+
+	dec := json.NewDecoder(strings.NewReader(logMsg.Msg))
+	dec.UseNumber()
+
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return false
+	}
+
+	strFields := make(map[string]string, len(fields))
+	for key, val := range fields {
+		switch v := val.(type) {
+		case nil:
+			// Nothing to add.
+		case string:
+			strFields[key] = v
+		case json.Number:
+			strFields[key] = v.String()
+		case bool:
+			strFields[key] = strconv.FormatBool(v)
+		default:
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err == nil {
+				strFields[key] = strings.TrimSpace(buf.String())
+			}
+		}
+	}
+
+	setStructuredFields(logMsg, strFields)
+	return true
+}
+
+// parseLogfmtEnvelope parses the logfmt message (with the timestamp already
+// stripped), like `level=info msg="Something happened" user=alice`: the
+// fields are added to the context, see setStructuredFields. Returns false if
+// the message isn't logfmt.
+func parseLogfmtEnvelope(logMsg *LogMsg) bool {
+	if !isLogfmtLine(logMsg.Msg) {
+		return false
+	}
+
+	fields := parseLogfmt(logMsg.Msg)
+	if len(fields) == 0 {
+		return false
+	}
+
+	setStructuredFields(logMsg, fields)
+	return true
+}
+
+// parseLogfmt parses the key=value pairs; the values can be double-quoted,
+// with the Go-style escapes. The bare words without "=" are ignored.
+func parseLogfmt(s string) map[string]string {
+	fields := map[string]string{}
+
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return fields
+		}
+
+		end := strings.IndexAny(s, "= \t")
+		if end < 0 || s[end] != '=' {
+			// A bare word, skip it.
+			if end < 0 {
+				return fields
+			}
+
+			s = s[end:]
+			continue
+		}
+
+		key := s[:end]
+		s = s[end+1:]
+
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			quoted, rest, ok := cutQuoted(s)
+			if !ok {
+				// Unterminated quote: take the rest as is.
+				val, s = s[1:], ""
+			} else {
+				val, s = quoted, rest
+			}
+		} else {
+			valEnd := strings.IndexAny(s, " \t")
+			if valEnd < 0 {
+				valEnd = len(s)
+			}
+
+			val, s = s[:valEnd], s[valEnd:]
+		}
+
+		if key != "" {
+			fields[key] = val
+		}
+	}
+}
+
+// cutQuoted takes the string starting with a double-quoted value, and returns
+// the unquoted value and the rest of the string after the closing quote.
+func cutQuoted(s string) (val, rest string, ok bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			val, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				// Some escapes which Go doesn't know, just strip the quotes then.
+				val = s[1:i]
+			}
+
+			return val, s[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+// setStructuredFields populates the LogMsg from the fields of a JSON or
+// logfmt message: the message field becomes the Msg, the level field (which
+// is also kept in the context) sets the Level, and the rest are added to the
+// context, without overwriting the existing keys (like "lstream").
+func setStructuredFields(logMsg *LogMsg, fields map[string]string) {
+	msg, msgKey := firstField(fields, structuredMsgKeys)
+	level, levelKey := firstField(fields, structuredLevelKeys)
+
+	for key, val := range fields {
+		if key == msgKey {
+			continue
+		}
+
+		if _, exists := logMsg.Context[key]; exists {
+			continue
+		}
+
+		logMsg.Context[key] = val
+	}
+
+	if msgKey != "" {
+		logMsg.Msg = msg
+	}
+
+	if levelKey != "" {
+		logMsg.Level = levelFromString(level)
+	}
+}
+
+// firstField returns the value and the key of the first of the keys which is
+// present in the fields; the key is empty if none is.
+func firstField(fields map[string]string, keys []string) (string, string) {
+	for _, key := range keys {
+		if val, ok := fields[key]; ok {
+			return val, key
+		}
+	}
+
+	return "", ""
+}
+
+// levelFromString returns the LogLevel for the level name used in the
+// structured logs, like "info", "WARNING" or "crit".
+func levelFromString(s string) LogLevel {
+	switch strings.ToLower(s) {
+	case "trace", "debug", "dbg":
+		return LogLevelDebug
+	case "info", "information", "notice":
+		return LogLevelInfo
+	case "warn", "warning":
+		return LogLevelWarn
+	case "error", "err", "crit", "critical", "fatal", "panic", "alert", "emerg":
+		return LogLevelError
+	default:
+		return LogLevelUnknown
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStructuredEnvelopes(t *testing.T) {
+	type testCase struct {
+		name  string
+		parse func(logMsg *LogMsg) bool
+		input string
+
+		wantOK      bool
+		wantMsg     string
+		wantLevel   LogLevel
+		wantContext map[string]string
+	}
+
+	testCases := []testCase{
+		{
+			name:    "JSON",
+			parse:   parseJSONEnvelope,
+			input:   `{"level":"WARNING","msg":"disk <full>","user":"alice","n":42,"ok":true,"nil":null,"req":{"path":"/a&b"},"lstream":"spoofed"}`,
+			wantOK:  true,
+			wantMsg: "disk <full>",
+			wantContext: map[string]string{
+				"lstream": "myhost",
+				"level":   "WARNING",
+				"user":    "alice",
+				"n":       "42",
+				"ok":      "true",
+				"req":     `{"path":"/a&b"}`,
+			},
+			wantLevel: LogLevelWarn,
+		},
+		{
+			name:        "JSON without the message",
+			parse:       parseJSONEnvelope,
+			input:       `{"event":"login"}`,
+			wantOK:      true,
+			wantMsg:     `{"event":"login"}`,
+			wantContext: map[string]string{"lstream": "myhost", "event": "login"},
+		},
+		{
+			name:        "not JSON",
+			parse:       parseJSONEnvelope,
+			input:       `{broken`,
+			wantMsg:     `{broken`,
+			wantContext: map[string]string{"lstream": "myhost"},
+		},
+		{
+			name:    "logfmt",
+			parse:   parseLogfmtEnvelope,
+			input:   `level=error msg="can't \"connect\"" addr=10.0.0.1:80 bare dur=1.5s`,
+			wantOK:  true,
+			wantMsg: `can't "connect"`,
+			wantContext: map[string]string{
+				"lstream": "myhost",
+				"level":   "error",
+				"addr":    "10.0.0.1:80",
+				"dur":     "1.5s",
+			},
+			wantLevel: LogLevelError,
+		},
+		{
+			name:        "not logfmt",
+			parse:       parseLogfmtEnvelope,
+			input:       "just a=message",
+			wantMsg:     "just a=message",
+			wantContext: map[string]string{"lstream": "myhost"},
+		},
+		{
+			name:        "CRI",
+			parse:       parseCRIEnvelope,
+			input:       "stderr P partial line",
+			wantOK:      true,
+			wantMsg:     "partial line",
+			wantContext: map[string]string{"lstream": "myhost", "stream": "stderr", "partial": "true"},
+		},
+		{
+			name:        "not CRI",
+			parse:       parseCRIEnvelope,
+			input:       "stdin F foo",
+			wantMsg:     "stdin F foo",
+			wantContext: map[string]string{"lstream": "myhost"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logMsg := &LogMsg{
+				Msg:     tc.input,
+				Context: map[string]string{"lstream": "myhost"},
+			}
+
+			assert.Equal(t, tc.wantOK, tc.parse(logMsg))
+			assert.Equal(t, tc.wantMsg, logMsg.Msg)
+			assert.Equal(t, tc.wantLevel, logMsg.Level)
+			assert.Equal(t, tc.wantContext, logMsg.Context)
+		})
+	}
+}
@@ -132,6 +132,20 @@ func GetTimeFormatDescrFromLogLines(logLines []string) (*TimeFormatDescr, error)
 	return descrs[0], nil
 }
 
+// timestampLenInLine returns the length of the timestamp with the given
+// layout at the beginning of the log line. Normally it's just the length of
+// the layout, but if the layout ends with the offset like "Z07" or "Z07:00",
+// and the actual timestamp is in UTC and ends with just "Z", it's shorter.
+func timestampLenInLine(layout, logLine string) int {
+	zIdx := strings.Index(layout, "Z07")
+	if zIdx >= 0 && len(logLine) > zIdx && logLine[zIdx] == 'Z' {
+		// We have a Z in the timestamp, so there should be no offset after it.
+		return zIdx + 1
+	}
+
+	return len(layout)
+}
+
 // DetectTimeLayout tries to detect a time format from a log line.
 //
 // TODO: it's pretty simplistic and could be improved, even to avoid having
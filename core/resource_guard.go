@@ -0,0 +1,83 @@
+package core
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// ioniceArgs returns the ionice arguments for the scheduling class given as
+// in ConfigLogStreamOptions.IONice: "idle", "best-effort", or
+// "best-effort:<level>".
+func ioniceArgs(class string) ([]string, error) {
+	parts := strings.SplitN(class, ":", 2)
+	name := parts[0]
+	hasLevel := len(parts) == 2
+
+	switch name {
+	case "idle":
+		if hasLevel {
+			return nil, errors.Errorf("invalid ionice %q: idle class has no levels", class)
+		}
+		return []string{"-c", "3"}, nil
+
+	case "best-effort":
+		if !hasLevel {
+			return []string{"-c", "2"}, nil
+		}
+
+		level := parts[1]
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 0 || n > 7 {
+			return nil, errors.Errorf("invalid ionice %q: level must be from 0 to 7", class)
+		}
+		return []string{"-c", "2", "-n", level}, nil
+	}
+
+	return nil, errors.Errorf(
+		"invalid ionice %q: valid values are idle, best-effort, best-effort:<level>", class,
+	)
+}
+
+// ValidateIONice returns an error if the given ionice option value is
+// invalid; see ConfigLogStreamOptions.IONice.
+func ValidateIONice(class string) error {
+	if class == "" {
+		return nil
+	}
+
+	_, err := ioniceArgs(class)
+	return errors.Trace(err)
+}
+
+// resourceGuardArgs returns the command prefix which limits the resources
+// which the agent script can use on the host, like
+// "nice -n 10 ionice -c 3 timeout 300", according to the logstream options.
+// If there are no limits, returns nil.
+//
+// The options are expected to be validated by the LStreamsResolver already,
+// so an invalid IONice is just ignored here.
+func resourceGuardArgs(opts LogStreamOptions) []string {
+	var parts []string
+
+	if opts.Nice != 0 {
+		parts = append(parts, "nice", "-n", strconv.Itoa(opts.Nice))
+	}
+
+	if opts.IONice != "" {
+		if args, err := ioniceArgs(opts.IONice); err == nil {
+			parts = append(parts, "ionice")
+			parts = append(parts, args...)
+		}
+	}
+
+	if opts.Timeout > 0 {
+		// timeout(1) only supports whole seconds portably.
+		secs := int(math.Ceil(opts.Timeout.Seconds()))
+		parts = append(parts, "timeout", strconv.Itoa(secs))
+	}
+
+	return parts
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceGuardArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     LogStreamOptions
+		wantArgs []string
+	}{
+		{
+			name:     "no limits",
+			opts:     LogStreamOptions{},
+			wantArgs: nil,
+		},
+		{
+			name: "all limits",
+			opts: LogStreamOptions{
+				Nice:    10,
+				IONice:  "idle",
+				Timeout: 90500 * time.Millisecond,
+			},
+			wantArgs: []string{"nice", "-n", "10", "ionice", "-c", "3", "timeout", "91"},
+		},
+		{
+			name: "best-effort with level",
+			opts: LogStreamOptions{
+				IONice: "best-effort:7",
+			},
+			wantArgs: []string{"ionice", "-c", "2", "-n", "7"},
+		},
+		{
+			name: "invalid ionice is ignored",
+			opts: LogStreamOptions{
+				Nice:   5,
+				IONice: "best-effort:8",
+			},
+			wantArgs: []string{"nice", "-n", "5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantArgs, resourceGuardArgs(tt.opts))
+		})
+	}
+}
+
+func TestValidateIONice(t *testing.T) {
+	assert.NoError(t, ValidateIONice(""))
+	assert.NoError(t, ValidateIONice("idle"))
+	assert.NoError(t, ValidateIONice("best-effort"))
+	assert.NoError(t, ValidateIONice("best-effort:0"))
+	assert.Error(t, ValidateIONice("idle:1"))
+	assert.Error(t, ValidateIONice("best-effort:x"))
+	assert.Error(t, ValidateIONice("realtime"))
+}
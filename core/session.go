@@ -0,0 +1,338 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dimonomid/clock"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/dimonomid/ssh_config"
+	"github.com/juju/errors"
+)
+
+// Session is the blocking API on top of LStreamsManager, for the tools
+// embedding nerdlog core without the TUI: it connects to the logstreams, and
+// then the queries can be run one by one, each returning the merged result.
+//
+// Since there's nobody to ask for the credentials, the data requests (like
+// the ssh key passphrase) fail, unless SessionParams.AuthCallback supplies
+// them.
+type Session struct {
+	params SessionParams
+
+	lsman     *LStreamsManager
+	updatesCh chan LStreamsManagerUpdate
+
+	mtx sync.Mutex
+
+	// state is the latest state of the LStreamsManager; nil until the first
+	// update.
+	state *LStreamsManagerState
+
+	// stateChangedCh is closed (and replaced with a new one) whenever the state
+	// changes.
+	stateChangedCh chan struct{}
+
+	// bootstrapIssues contains the last bootstrap issue of every logstream
+	// which had any.
+	bootstrapIssues map[string]string
+
+	// respCh is where the next LogResp goes; nil if no query is in progress.
+	respCh chan *LogRespTotal
+
+	// queryMtx makes sure that only one query runs at a time.
+	queryMtx sync.Mutex
+
+	// staleRespCh is the respCh of the query whose caller gave up waiting for
+	// it; the next query has to wait for it to finish first. Guarded by
+	// queryMtx.
+	staleRespCh chan *LogRespTotal
+
+	closeOnce sync.Once
+
+	// closingCh is closed as soon as Close is called, to stop the queries and
+	// streams still in progress; doneCh is closed once it's done.
+	closingCh chan struct{}
+	doneCh    chan struct{}
+}
+
+// SessionParams are the params for NewSession; see LStreamsManagerParams for
+// the details on most of them.
+type SessionParams struct {
+	// LStreams is the logstreams spec to connect to, like "web-*,db-01".
+	LStreams string
+
+	ConfigLogStreams ConfigLogStreams
+	SSHConfig        *ssh_config.Config
+	SSHKeys          []string
+
+	// ClientID must be non-empty, see LStreamsManagerParams.ClientID.
+	ClientID string
+
+	AuthCallback          AuthCallback
+	AllowPasswordAuth     bool
+	CapabilitiesCache     CapabilitiesCache
+	LogFormatOverrides    LogFormatOverrides
+	ShellTransportFactory ShellTransportFactory
+
+	Logger *log.Logger
+	Clock  clock.Clock
+}
+
+// NewSession creates the session and starts connecting to the logstreams;
+// use WaitConnected to wait for the connection. The session must be closed
+// with Close once it's not needed.
+func NewSession(params SessionParams) (*Session, error) {
+	if params.ClientID == "" {
+		return nil, errors.Errorf("ClientID is empty")
+	}
+
+	params.Logger = params.Logger.WithNamespaceAppended("Session")
+
+	// Check the logstreams spec first, since LStreamsManager panics if the
+	// initial one is invalid.
+	u, err := user.Current()
+	if err != nil {
+		return nil, errors.Annotatef(err, "getting current OS user")
+	}
+
+	resolver := NewLStreamsResolver(LStreamsResolverParams{
+		CurOSUser: u.Username,
+
+		ConfigLogStreams: params.ConfigLogStreams,
+		SSHConfig:        params.SSHConfig,
+	})
+	if _, err := resolver.Resolve(params.LStreams); err != nil {
+		return nil, errors.Annotatef(err, "parsing lstreams %q", params.LStreams)
+	}
+
+	s := &Session{
+		params: params,
+
+		updatesCh:       make(chan LStreamsManagerUpdate, 128),
+		stateChangedCh:  make(chan struct{}),
+		bootstrapIssues: map[string]string{},
+		closingCh:       make(chan struct{}),
+		doneCh:          make(chan struct{}),
+	}
+
+	s.lsman = NewLStreamsManager(LStreamsManagerParams{
+		ConfigLogStreams:  params.ConfigLogStreams,
+		SSHConfig:         params.SSHConfig,
+		SSHKeys:           params.SSHKeys,
+		Logger:            params.Logger,
+		InitialLStreams:   params.LStreams,
+		ClientID:          params.ClientID,
+		UpdatesCh:         s.updatesCh,
+		CapabilitiesCache: params.CapabilitiesCache,
+		AuthCallback:      params.AuthCallback,
+		AllowPasswordAuth: params.AllowPasswordAuth,
+		Clock:             params.Clock,
+
+		LogFormatOverrides:    params.LogFormatOverrides,
+		ShellTransportFactory: params.ShellTransportFactory,
+	})
+
+	go s.run()
+
+	return s, nil
+}
+
+func (s *Session) run() {
+	for {
+		select {
+		case upd := <-s.updatesCh:
+			s.handleUpdate(upd)
+		case <-s.doneCh:
+			return
+		}
+	}
+}
+
+func (s *Session) handleUpdate(upd LStreamsManagerUpdate) {
+	switch {
+	case upd.State != nil:
+		s.mtx.Lock()
+		s.state = upd.State
+		close(s.stateChangedCh)
+		s.stateChangedCh = make(chan struct{})
+		s.mtx.Unlock()
+
+	case upd.LogResp != nil:
+		s.mtx.Lock()
+		respCh := s.respCh
+		s.respCh = nil
+		s.mtx.Unlock()
+
+		if respCh == nil {
+			s.params.Logger.Warnf("Got a LogResp without a query in progress, ignoring")
+			return
+		}
+
+		respCh <- upd.LogResp
+
+	case upd.BootstrapIssue != nil:
+		s.mtx.Lock()
+		s.bootstrapIssues[upd.BootstrapIssue.LStreamName] = upd.BootstrapIssue.Err
+		s.mtx.Unlock()
+
+	case upd.DataRequest != nil:
+		// There's nobody to ask, so just respond with nothing and let the
+		// connection fail; the AuthCallback should have handled it.
+		s.params.Logger.Errorf("Can't respond to data request: %s", upd.DataRequest.Message)
+		go func(ch chan<- string) {
+			ch <- ""
+		}(upd.DataRequest.ResponseCh)
+	}
+}
+
+// State returns the latest state of the logstreams; nil if it's not known
+// yet.
+func (s *Session) State() *LStreamsManagerState {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.state
+}
+
+// WaitConnected waits until all the logstreams are connected and idle. The
+// failing connections are retried, so it only returns an error if there are
+// no matching logstreams at all, or if the ctx is done: then the error
+// describes which logstreams aren't connected, and why.
+func (s *Session) WaitConnected(ctx context.Context) error {
+	for {
+		s.mtx.Lock()
+		state := s.state
+		stateChangedCh := s.stateChangedCh
+		s.mtx.Unlock()
+
+		if state != nil {
+			if state.NoMatchingLStreams {
+				return errors.Errorf("no matching lstreams for %q", s.params.LStreams)
+			}
+
+			if state.Connected && !state.Busy {
+				return nil
+			}
+		}
+
+		select {
+		case <-stateChangedCh:
+		case <-ctx.Done():
+			return errors.Annotatef(ctx.Err(), "waiting for connection (%s)", s.notConnectedDescr())
+		}
+	}
+}
+
+// notConnectedDescr returns the description of the logstreams which aren't
+// connected yet, like "db-01: connecting, last error: ...".
+func (s *Session) notConnectedDescr() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.state == nil {
+		return "no state yet"
+	}
+
+	var parts []string
+	for lsState, names := range s.state.LStreamsByState {
+		if isStateConnected(lsState) {
+			continue
+		}
+
+		for name := range names {
+			part := fmt.Sprintf("%s: %s", name, lsState)
+			if issue, ok := s.bootstrapIssues[name]; ok {
+				part += ", last error: " + issue
+			}
+
+			parts = append(parts, part)
+		}
+	}
+	sort.Strings(parts)
+
+	if len(parts) == 0 {
+		return "busy with another query"
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// QueryLogs waits for the connection (see WaitConnected), runs the query on
+// all the logstreams, and returns the merged result. The errors from the
+// individual logstreams are in the LogRespTotal.Errs, so the result can be
+// partial.
+//
+// If the ctx is done before the result comes, the ctx error is returned;
+// the query is still running on the hosts though, so the next QueryLogs
+// waits for it to finish first.
+func (s *Session) QueryLogs(ctx context.Context, params QueryLogsParams) (*LogRespTotal, error) {
+	s.queryMtx.Lock()
+	defer s.queryMtx.Unlock()
+
+	resp, err := s.queryLogs(ctx, params)
+	return resp, errors.Trace(err)
+}
+
+// queryLogs is QueryLogs which expects the queryMtx to be locked by the
+// caller.
+func (s *Session) queryLogs(ctx context.Context, params QueryLogsParams) (*LogRespTotal, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if s.staleRespCh != nil {
+		select {
+		case <-s.staleRespCh:
+			s.staleRespCh = nil
+		case <-ctx.Done():
+			return nil, errors.Annotatef(ctx.Err(), "waiting for the previous query to finish")
+		case <-s.closingCh:
+			return nil, errSessionClosed
+		}
+	}
+
+	if err := s.WaitConnected(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	// Buffered, so that the response can be delivered even if we give up
+	// waiting for it.
+	respCh := make(chan *LogRespTotal, 1)
+
+	s.mtx.Lock()
+	s.respCh = respCh
+	s.mtx.Unlock()
+
+	s.lsman.QueryLogs(params)
+
+	select {
+	case resp := <-respCh:
+		return resp, nil
+	case <-ctx.Done():
+		s.staleRespCh = respCh
+		return nil, errors.Trace(ctx.Err())
+	case <-s.closingCh:
+		s.staleRespCh = respCh
+		return nil, errSessionClosed
+	}
+}
+
+// errSessionClosed is returned by the queries interrupted by Session.Close.
+var errSessionClosed = errors.New("session is closed")
+
+// Close disconnects from all the logstreams, and waits for it to complete.
+// The queries in progress fail with errSessionClosed, and so do the streams
+// (see StreamLogs), even if their consumers stopped reading.
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closingCh)
+		s.lsman.Close()
+		s.lsman.Wait()
+		close(s.doneCh)
+	})
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"context"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// LogMsgStream delivers the messages loaded by Session.StreamLogs.
+type LogMsgStream struct {
+	msgsCh       chan LogMsg
+	numMsgsTotal int
+
+	// err is set before msgsCh is closed.
+	err error
+}
+
+// Msgs returns the channel with the messages, from the latest to the
+// earliest. It's closed once all the messages are delivered, or on error (see
+// Err).
+func (st *LogMsgStream) Msgs() <-chan LogMsg {
+	return st.msgsCh
+}
+
+// Err returns the error which stopped the stream, like the ctx error; nil if
+// all the messages were delivered. It must only be called once the Msgs
+// channel is closed.
+func (st *LogMsgStream) Err() error {
+	return st.err
+}
+
+// NumMsgsTotal returns the number of the messages matching the query, which
+// is how many messages the stream delivers unless there's an error.
+func (st *LogMsgStream) NumMsgsTotal() int {
+	return st.numMsgsTotal
+}
+
+// StreamLogs runs the query like QueryLogs, but delivers all the matching
+// messages in the time range, not just the latest ones. They're loaded page by
+// page, MaxNumLines from every logstream at a time, and the next page is only
+// loaded once the previous one is consumed, so no matter how many messages
+// there are, only about a page of them is kept in memory.
+//
+// The first page is loaded before StreamLogs returns, so the errors like a
+// missing connection are returned right away; the later ones are reported by
+// LogMsgStream.Err. Until the stream is over, the other queries wait, so
+// either all the messages must be read, or the ctx canceled, or the session
+// closed.
+func (s *Session) StreamLogs(ctx context.Context, params QueryLogsParams) (*LogMsgStream, error) {
+	if params.MaxNumLines <= 0 {
+		return nil, errors.Errorf("MaxNumLines (the page size) must be positive")
+	}
+
+	if params.CountOnly || params.LoadEarlier {
+		return nil, errors.Errorf("can't stream logs with CountOnly or LoadEarlier")
+	}
+
+	params.Streaming = true
+
+	s.queryMtx.Lock()
+
+	resp, err := s.queryLogs(ctx, params)
+	if err == nil {
+		err = logRespErr(resp)
+	}
+	if err != nil {
+		s.queryMtx.Unlock()
+		return nil, errors.Trace(err)
+	}
+
+	st := &LogMsgStream{
+		// Unbuffered, so that the next page isn't loaded until the consumer
+		// takes all the messages from the current one.
+		msgsCh:       make(chan LogMsg),
+		numMsgsTotal: resp.NumMsgsTotal,
+	}
+
+	go func() {
+		defer s.queryMtx.Unlock()
+		defer close(st.msgsCh)
+
+		st.err = s.streamLogs(ctx, params, resp, st.msgsCh)
+	}()
+
+	return st, nil
+}
+
+// streamLogs delivers the messages from the first page resp to msgsCh, and
+// then keeps loading and delivering the earlier pages, until all the
+// messages are delivered.
+func (s *Session) streamLogs(
+	ctx context.Context, params QueryLogsParams, resp *LogRespTotal, msgsCh chan<- LogMsg,
+) error {
+	params.LoadEarlier = true
+	numDelivered := 0
+
+	for {
+		// Every page is sorted from the earliest to the latest, but the pages
+		// go back in time, so deliver every page backwards.
+		for i := len(resp.Logs) - 1; i >= 0; i-- {
+			select {
+			case msgsCh <- resp.Logs[i]:
+			case <-ctx.Done():
+				return errors.Trace(ctx.Err())
+			case <-s.closingCh:
+				return errSessionClosed
+			}
+		}
+
+		numDelivered += len(resp.Logs)
+		if numDelivered >= resp.NumMsgsTotal {
+			return nil
+		}
+
+		if len(resp.Logs) == 0 {
+			return errors.Errorf(
+				"no more logs after %d of %d messages", numDelivered, resp.NumMsgsTotal,
+			)
+		}
+
+		var err error
+		resp, err = s.queryLogs(ctx, params)
+		if err == nil {
+			err = logRespErr(resp)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// logRespErr returns the error combining the LogRespTotal.Errs, if any.
+func logRespErr(resp *LogRespTotal) error {
+	if len(resp.Errs) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(resp.Errs))
+	for _, err := range resp.Errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return errors.Errorf("%s", strings.Join(msgs, "; "))
+}
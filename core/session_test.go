@@ -0,0 +1,224 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/clock"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSessionParams(lstreams string) SessionParams {
+	return SessionParams{
+		LStreams: lstreams,
+		ConfigLogStreams: ConfigLogStreams{
+			"tiny": {
+				Hostname: "localhost",
+				LogFiles: []string{
+					"core_testdata/input_logfiles/tiny/syslog",
+					"core_testdata/input_logfiles/tiny/syslog.1",
+				},
+				Options: ConfigLogStreamOptions{NativeScan: true},
+			},
+		},
+		ClientID: "session_test",
+		Clock:    clock.New(),
+	}
+}
+
+func TestSessionQueryLogs(t *testing.T) {
+	sess, err := NewSession(newTestSessionParams("tiny"))
+	require.NoError(t, err)
+	defer sess.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	require.NoError(t, sess.WaitConnected(ctx))
+	assert.True(t, sess.State().Connected)
+
+	resp, err := sess.QueryLogs(ctx, QueryLogsParams{
+		MaxNumLines: 3,
+		Query:       "/Cache cleared/",
+	})
+	require.NoError(t, err)
+	require.Empty(t, resp.Errs)
+
+	assert.Equal(t, 3, resp.NumMsgsTotal)
+	if assert.Len(t, resp.Logs, 3) {
+		assert.Equal(t, "<crit> Cache cleared", resp.Logs[0].Msg)
+		assert.Equal(t, "tiny", resp.Logs[0].Context["lstream"])
+		assert.Equal(t, "<warning> Cache cleared", resp.Logs[2].Msg)
+	}
+
+	// A canceled query doesn't break the next one.
+	canceledCtx, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	_, err = sess.QueryLogs(canceledCtx, QueryLogsParams{MaxNumLines: 3})
+	assert.Error(t, err)
+
+	resp, err = sess.QueryLogs(ctx, QueryLogsParams{MaxNumLines: 3, Query: "/Firewall/"})
+	require.NoError(t, err)
+	for _, msg := range resp.Logs {
+		assert.Contains(t, msg.Msg, "Firewall")
+	}
+}
+
+func TestSessionInvalidLStreams(t *testing.T) {
+	_, err := NewSession(newTestSessionParams("nonexisting-*"))
+	assert.Error(t, err)
+
+	params := newTestSessionParams("tiny")
+	params.ClientID = ""
+	_, err = NewSession(params)
+	assert.Error(t, err)
+}
+
+func TestSessionStreamLogs(t *testing.T) {
+	sess, err := NewSession(newTestSessionParams("tiny"))
+	require.NoError(t, err)
+	defer sess.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	all, err := sess.QueryLogs(ctx, QueryLogsParams{MaxNumLines: 1000})
+	require.NoError(t, err)
+	require.Empty(t, all.Errs)
+
+	// The messages come in pages of 3, but all of them are delivered, from the
+	// latest to the earliest.
+	stream, err := sess.StreamLogs(ctx, QueryLogsParams{MaxNumLines: 3})
+	require.NoError(t, err)
+	assert.Equal(t, all.NumMsgsTotal, stream.NumMsgsTotal())
+
+	var streamed []LogMsg
+	for msg := range stream.Msgs() {
+		streamed = append(streamed, msg)
+	}
+	require.NoError(t, stream.Err())
+
+	require.Len(t, streamed, len(all.Logs))
+	for i, msg := range streamed {
+		assert.Equal(t, all.Logs[len(all.Logs)-1-i].OrigLine, msg.OrigLine)
+	}
+
+	// If the consumer gives up, the stream stops, and the next query works.
+	streamCtx, streamCancel := context.WithCancel(ctx)
+	stream, err = sess.StreamLogs(streamCtx, QueryLogsParams{MaxNumLines: 3})
+	require.NoError(t, err)
+
+	<-stream.Msgs()
+	streamCancel()
+	for range stream.Msgs() {
+	}
+	assert.Equal(t, context.Canceled, errors.Cause(stream.Err()))
+
+	resp, err := sess.QueryLogs(ctx, QueryLogsParams{MaxNumLines: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, all.NumMsgsTotal, len(resp.Logs))
+
+	// If the consumer just stops reading, closing the session stops the stream.
+	stream, err = sess.StreamLogs(ctx, QueryLogsParams{MaxNumLines: 3})
+	require.NoError(t, err)
+
+	<-stream.Msgs()
+	sess.Close()
+	for range stream.Msgs() {
+	}
+	assert.Equal(t, errSessionClosed, errors.Cause(stream.Err()))
+}
+
+// mapLogFormatOverrides is a LogFormatOverrides for tests.
+type mapLogFormatOverrides map[string]LogFormatOverride
+
+func (m mapLogFormatOverrides) Get(lstreamName string) (LogFormatOverride, bool) {
+	override, ok := m[lstreamName]
+	return override, ok
+}
+
+func TestSessionLogFormat(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(logFile, []byte(
+		`2025-03-10T10:00:00Z {"level":"error","msg":"disk full","user":"alice"}`+"\n"+
+			`2025-03-10T10:01:00Z {"level":"info","msg":"disk cleaned","user":"bob"}`+"\n",
+	), 0644))
+
+	queryLogs := func(overrides LogFormatOverrides) []LogMsg {
+		params := newTestSessionParams("app")
+		params.ConfigLogStreams = ConfigLogStreams{
+			"app": {
+				Hostname: "localhost",
+				LogFiles: []string{logFile},
+				Options:  ConfigLogStreamOptions{NativeScan: true},
+			},
+		}
+		params.LogFormatOverrides = overrides
+
+		sess, err := NewSession(params)
+		require.NoError(t, err)
+		defer sess.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		resp, err := sess.QueryLogs(ctx, QueryLogsParams{
+			From:        time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC),
+			MaxNumLines: 10,
+		})
+		require.NoError(t, err)
+		require.Empty(t, resp.Errs)
+		require.Len(t, resp.Logs, 2)
+
+		return resp.Logs
+	}
+
+	// The detected format is used by default.
+	logs := queryLogs(nil)
+	assert.Equal(t, "disk full", logs[0].Msg)
+	assert.Equal(t, LogLevelError, logs[0].Level)
+	assert.Equal(t, "alice", logs[0].Context["user"])
+	assert.Equal(t, "app", logs[0].Context["lstream"])
+
+	// With the override, the lines are parsed as the plain text.
+	logs = queryLogs(mapLogFormatOverrides{
+		"app": {Format: LogFormatPlain},
+	})
+	assert.Equal(t, `{"level":"info","msg":"disk cleaned","user":"bob"}`, logs[1].Msg)
+	assert.Equal(t, LogLevelInfo, logs[1].Level)
+	assert.Empty(t, logs[1].Context["user"])
+
+	// The broken timestamp layout fails the bootstrap.
+	params := newTestSessionParams("app")
+	params.ConfigLogStreams = ConfigLogStreams{
+		"app": {
+			Hostname: "localhost",
+			LogFiles: []string{logFile},
+			Options:  ConfigLogStreamOptions{NativeScan: true},
+		},
+	}
+	params.LogFormatOverrides = mapLogFormatOverrides{
+		"app": {Format: LogFormatJSON, TimestampLayout: "no layout"},
+	}
+
+	sess, err := NewSession(params)
+	require.NoError(t, err)
+	defer sess.Close()
+
+	// The bootstrap happens when the logstream is already connected, so
+	// WaitConnected might return before it fails; the failed bootstrap is
+	// retried though, so eventually the error is there.
+	assert.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := sess.WaitConnected(ctx)
+		return err != nil && strings.Contains(err.Error(), "overridden timestamp layout")
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -13,6 +13,12 @@ type ShellTransport interface {
 	Connect(resCh chan<- ShellConnUpdate)
 }
 
+// ShellTransportFactory creates the transport for the logstream; it can be
+// given to LStreamsManager to use some custom transports instead of the
+// default ones (ssh, local or native), like coretest.ShellTransportFake in
+// tests.
+type ShellTransportFactory func(ls LogStream) ShellTransport
+
 // ShellConn provides an abstraction of a shell connection; can be implemented
 // by local shell, or SSH, or maybe something else.
 type ShellConn interface {
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+)
+
+// ShellTransportNative is an implementation of ShellTransport which doesn't
+// spawn any actual shell: the connection gets the commands from LStreamClient
+// as they are (see nativeConn), and runs the agent natively in Go (see
+// RunNativeAgent). It's used for localhost on systems without a POSIX shell
+// (Windows), and it can also be used on any system to avoid depending on
+// bash and gawk.
+type ShellTransportNative struct {
+	params ShellTransportNativeParams
+}
+
+type ShellTransportNativeParams struct {
+	Logger *log.Logger
+}
+
+// NewShellTransportNative creates a new ShellTransportNative.
+func NewShellTransportNative(params ShellTransportNativeParams) *ShellTransportNative {
+	return &ShellTransportNative{
+		params: params,
+	}
+}
+
+// Connect "connects" to the native agent (which always succeeds right away)
+// and sends the result to the provided channel.
+func (s *ShellTransportNative) Connect(resCh chan<- ShellConnUpdate) {
+	go func() {
+		resCh <- ShellConnUpdate{
+			Result: &ShellConnResult{
+				Conn: NewShellConnNative(s.params.Logger, RunNativeAgent),
+			},
+		}
+	}()
+}
+
+// nativeConn is implemented by the ShellConns without a real shell behind
+// them: instead of writing shell scripts to the Stdin, LStreamClient gives
+// them the commands as they are, and they print the same output to Stdout and
+// Stderr as the shell would, including the "command_done" markers.
+type nativeConn interface {
+	ShellConn
+
+	// runCmd starts the command, and returns right away. LStreamClient only
+	// runs one command at a time: the next one is started after the
+	// "command_done" markers of the previous one are received.
+	runCmd(cmd nativeCmd)
+}
+
+// nativeCmd is a single command for the nativeConn, corresponding to the
+// lstreamCmd. Exactly one of bootstrap, ping and agent is set.
+type nativeCmd struct {
+	// idx is the command index, printed in the "command_done" markers.
+	idx int
+
+	// bootstrap is the logstream_info invocation of the bootstrap command;
+	// there is nothing to upload, so it's only that, and the "bootstrap ok"
+	// or "bootstrap failed" line.
+	bootstrap *agentInvocation
+
+	ping bool
+
+	// agent is the agent invocation of the queryLogs or firstLast commands.
+	agent *agentInvocation
+}
+
+// ShellConnNative is the nativeConn which runs the agent in-process, with the
+// given NativeAgentFunc.
+type ShellConnNative struct {
+	logger *log.Logger
+
+	// runAgent runs the agent; normally it's RunNativeAgent.
+	runAgent NativeAgentFunc
+
+	// env are the env vars of the nerdlog process, which the agent is run with
+	// (plus the agentInvocation.env).
+	env map[string]string
+
+	// cmdCh is only 1-buffered: since LStreamClient runs one command at a
+	// time, and the previous one has been received by the time the next one
+	// comes, runCmd never blocks.
+	cmdCh chan nativeCmd
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+
+	stdout *io.PipeReader
+	stderr *io.PipeReader
+}
+
+var _ nativeConn = &ShellConnNative{}
+
+// NewShellConnNative creates the connection, and starts the goroutine running
+// the commands. It's exported for the custom transports running some other
+// agent in-process, like the coretest.ShellTransportFake.
+func NewShellConnNative(logger *log.Logger, runAgent NativeAgentFunc) *ShellConnNative {
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if idx := strings.Index(kv, "="); idx > 0 {
+			env[kv[:idx]] = kv[idx+1:]
+		}
+	}
+
+	s := &ShellConnNative{
+		logger:   logger,
+		runAgent: runAgent,
+		env:      env,
+		cmdCh:    make(chan nativeCmd, 1),
+		closeCh:  make(chan struct{}),
+		stdout:   stdoutR,
+		stderr:   stderrR,
+	}
+
+	go s.run(stdoutW, stderrW)
+
+	return s
+}
+
+// Stdin returns the writer which rejects everything: there is no shell to
+// write to, the commands are given to runCmd instead.
+func (s *ShellConnNative) Stdin() io.Writer {
+	return nativeNoStdin{}
+}
+
+func (s *ShellConnNative) Stdout() io.Reader {
+	return s.stdout
+}
+
+func (s *ShellConnNative) Stderr() io.Reader {
+	return s.stderr
+}
+
+// Close makes the connection goroutine exit (after the current command, if
+// any), and close the stdout and stderr.
+func (s *ShellConnNative) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+	})
+}
+
+func (s *ShellConnNative) runCmd(cmd nativeCmd) {
+	select {
+	case s.cmdCh <- cmd:
+	case <-s.closeCh:
+	}
+}
+
+func (s *ShellConnNative) run(stdout, stderr *io.PipeWriter) {
+	defer func() {
+		stdout.Close()
+		stderr.Close()
+	}()
+
+	for {
+		select {
+		case cmd := <-s.cmdCh:
+			s.handleCmd(cmd, stdout, stderr)
+
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+func (s *ShellConnNative) handleCmd(cmd nativeCmd, stdout, stderr io.Writer) {
+	switch {
+	case cmd.bootstrap != nil:
+		fmt.Fprintf(stdout, "reset_output\n")
+		fmt.Fprintf(stderr, "reset_output\n")
+
+		// Just like the bootstrap script, print "exit_code" after the agent's
+		// own one.
+		if code := s.runAgentInvocation(cmd.bootstrap, stdout, stderr); code != 0 {
+			fmt.Fprintf(stdout, "bootstrap failed\n")
+			fmt.Fprintf(stdout, "exit_code:1\n")
+		} else {
+			fmt.Fprintf(stdout, "bootstrap ok\n")
+			fmt.Fprintf(stdout, "exit_code:0\n")
+		}
+
+	case cmd.ping:
+		code := 0
+		if u, err := user.Current(); err != nil {
+			fmt.Fprintf(stderr, "whoami: %s\n", err.Error())
+			code = 1
+		} else {
+			fmt.Fprintf(stdout, "%s\n", u.Username)
+		}
+
+		fmt.Fprintf(stdout, "exit_code:%d\n", code)
+
+	case cmd.agent != nil:
+		if !cmd.agent.gzip {
+			s.runAgentInvocation(cmd.agent, stdout, stderr)
+			break
+		}
+
+		fmt.Fprintf(stdout, "%s\n", gzipStartMarker)
+
+		gzw := gzip.NewWriter(stdout)
+		s.runAgentInvocation(cmd.agent, gzw, stderr)
+		gzw.Close()
+
+		fmt.Fprintf(stdout, "%s\n", gzipEndMarker)
+	}
+
+	fmt.Fprintf(stdout, "command_done:%d\n", cmd.idx)
+	fmt.Fprintf(stderr, "command_done:%d\n", cmd.idx)
+}
+
+// runAgentInvocation runs the agent and returns its exit code. The resource
+// guard wrappers make no sense for the native scanning, which happens right
+// in the nerdlog process, so they're ignored.
+func (s *ShellConnNative) runAgentInvocation(inv *agentInvocation, stdout, stderr io.Writer) int {
+	if inv.sudo {
+		fmt.Fprintf(stderr, "error:sudo is not supported with the native local scanning\n")
+		fmt.Fprintf(stdout, "exit_code:1\n")
+		return 1
+	}
+
+	env := make(map[string]string, len(s.env)+len(inv.env))
+	for k, v := range s.env {
+		env[k] = v
+	}
+	for _, kv := range inv.env {
+		if idx := strings.Index(kv, "="); idx > 0 {
+			env[kv[:idx]] = kv[idx+1:]
+		}
+	}
+
+	if s.logger != nil {
+		s.logger.Verbose2f("Running native agent: %v", inv.args)
+	}
+
+	return s.runAgent(inv.args, env, stdout, stderr)
+}
+
+// nativeNoStdin is the Stdin of the ShellConnNative.
+type nativeNoStdin struct{}
+
+func (nativeNoStdin) Write(p []byte) (int, error) {
+	return 0, errors.New("native connection has no shell stdin")
+}
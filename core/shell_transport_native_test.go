@@ -0,0 +1,140 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellConnNative(t *testing.T) {
+	var gotArgs [][]string
+	var gotEnv []string
+
+	agent := func(args []string, env map[string]string, stdout, stderr io.Writer) int {
+		gotArgs = append(gotArgs, args)
+		gotEnv = append(gotEnv, env["CUR_YEAR"])
+
+		if args[0] == "logstream_info" && args[2] == "/var/log/missing" {
+			fmt.Fprintf(stderr, "error:no such file\n")
+			fmt.Fprintf(stdout, "exit_code:1\n")
+			return 1
+		}
+
+		fmt.Fprintf(stdout, "hello %s\n", args[0])
+		fmt.Fprintf(stdout, "exit_code:0\n")
+		return 0
+	}
+
+	conn := NewShellConnNative(nil, agent)
+
+	_, err := conn.Stdin().Write([]byte("echo foo\n"))
+	assert.Error(t, err)
+
+	var stderr bytes.Buffer
+	stderrDone := make(chan struct{})
+	go func() {
+		io.Copy(&stderr, conn.Stderr())
+		close(stderrDone)
+	}()
+
+	go func() {
+		// The commands are given one by one, like LStreamClient does: it's fine
+		// since the stdout is being read concurrently.
+		conn.runCmd(nativeCmd{idx: 1, bootstrap: &agentInvocation{
+			env:  []string{"CUR_YEAR=2025"},
+			args: []string{"logstream_info", "--logfile-last", "/var/log/syslog"},
+		}})
+		conn.runCmd(nativeCmd{idx: 2, bootstrap: &agentInvocation{
+			args: []string{"logstream_info", "--logfile-last", "/var/log/missing"},
+		}})
+		conn.runCmd(nativeCmd{idx: 3, agent: &agentInvocation{
+			args:     []string{"query", "--max-num-lines", "10"},
+			wrappers: []string{"nice", "-n", "10"},
+			gzip:     true,
+		}})
+		conn.runCmd(nativeCmd{idx: 4, agent: &agentInvocation{
+			args: []string{"first_last"},
+			sudo: true,
+		}})
+		conn.Close()
+	}()
+
+	stdout, err := io.ReadAll(conn.Stdout())
+	assert.NoError(t, err)
+	<-stderrDone
+
+	r := bufio.NewReader(bytes.NewReader(stdout))
+	readLine := func() string {
+		line, _ := r.ReadString('\n')
+		return line
+	}
+
+	assert.Equal(t, "reset_output\n", readLine())
+	assert.Equal(t, "hello logstream_info\n", readLine())
+	assert.Equal(t, "exit_code:0\n", readLine())
+	assert.Equal(t, "bootstrap ok\n", readLine())
+	assert.Equal(t, "exit_code:0\n", readLine())
+	assert.Equal(t, "command_done:1\n", readLine())
+
+	assert.Equal(t, "reset_output\n", readLine())
+	assert.Equal(t, "exit_code:1\n", readLine())
+	assert.Equal(t, "bootstrap failed\n", readLine())
+	assert.Equal(t, "exit_code:1\n", readLine())
+	assert.Equal(t, "command_done:2\n", readLine())
+
+	assert.Equal(t, "gzip_start\n", readLine())
+
+	gzr, err := gzip.NewReader(r)
+	if assert.NoError(t, err) {
+		gzr.Multistream(false)
+		data, err := io.ReadAll(gzr)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello query\nexit_code:0\n", string(data))
+	}
+
+	assert.Equal(t, "gzip_end\n", readLine())
+	assert.Equal(t, "command_done:3\n", readLine())
+
+	// The agent isn't run with sudo.
+	assert.Equal(t, "exit_code:1\n", readLine())
+	assert.Equal(t, "command_done:4\n", readLine())
+	assert.Equal(t, "", readLine())
+
+	assert.Equal(t, [][]string{
+		{"logstream_info", "--logfile-last", "/var/log/syslog"},
+		{"logstream_info", "--logfile-last", "/var/log/missing"},
+		{"query", "--max-num-lines", "10"},
+	}, gotArgs)
+	assert.Equal(t, "2025", gotEnv[0])
+
+	assert.Equal(
+		t,
+		"reset_output\ncommand_done:1\n"+
+			"reset_output\nerror:no such file\ncommand_done:2\n"+
+			"command_done:3\n"+
+			"error:sudo is not supported with the native local scanning\ncommand_done:4\n",
+		stderr.String(),
+	)
+}
+
+func TestAgentInvocationShellCmd(t *testing.T) {
+	inv := &agentInvocation{
+		env:      []string{"CUR_YEAR=2025", "CUR_MONTH=03"},
+		args:     []string{"query", "--from", "2025-03-10-10:00", "--stage", "/it's/", "--level-stats"},
+		sudo:     true,
+		wrappers: []string{"nice", "-n", "10"},
+		gzip:     true,
+	}
+
+	assert.Equal(
+		t,
+		"echo gzip_start ; sudo -n CUR_YEAR=2025 CUR_MONTH=03 nice -n 10 bash '/tmp/agent.sh' "+
+			"query --from '2025-03-10-10:00' --stage '/it'\"'\"'s/' --level-stats | gzip ; echo gzip_end",
+		inv.shellCmd("/tmp/agent.sh"),
+	)
+}
@@ -41,6 +41,16 @@ type ShellTransportSSHParams struct {
 
 	// EphemeralKeyProvider optionally provides ephemeral SSH keys for authentication.
 	EphemeralKeyProvider EphemeralKeyProvider
+
+	// AuthCallback is optional; if set, it's used to get the key passphrase
+	// (and the password, if AllowPasswordAuth is set) before asking the user.
+	AuthCallback AuthCallback
+
+	// AllowPasswordAuth enables the password and keyboard-interactive auth,
+	// with the credentials from the AuthCallback or from the user. It's off by
+	// default, because the host keys aren't verified yet, so the password could
+	// be sent to whoever pretends to be the host.
+	AllowPasswordAuth bool
 }
 
 func (st *ShellTransportSSH) Connect(resCh chan<- ShellConnUpdate) {
@@ -66,7 +76,7 @@ func (st *ShellTransportSSH) doConnect(
 
 	var sshClient *ssh.Client
 
-	conf, err := st.getClientConfig(resCh, logger, connDetails.Host.User)
+	conf, err := st.getClientConfig(resCh, logger, connDetails.Host.User, connDetails.Host.Addr)
 	if err != nil {
 		res.Err = errors.Annotatef(err, "getting ssh client for %s", connDetails.Host.User)
 		return res
@@ -196,26 +206,130 @@ type AuthMethodWMeta struct {
 	Descr string
 }
 
-func (st *ShellTransportSSH) getClientConfig(resCh chan<- ShellConnUpdate, logger *log.Logger, username string) (*ClientConfigWMeta, error) {
+func (st *ShellTransportSSH) getClientConfig(resCh chan<- ShellConnUpdate, logger *log.Logger, username, addr string) (*ClientConfigWMeta, error) {
+	var authMethods []ssh.AuthMethod
+	var descr string
+
 	auth, err := st.getSSHAuthMethod(resCh, logger)
 	if err != nil {
-		return nil, errors.Trace(err)
+		if !st.params.AllowPasswordAuth {
+			return nil, errors.Trace(err)
+		}
+
+		// No usable keys, but the password can still be used.
+		logger.Infof("Key auth is not available: %s; relying on the password auth", err.Error())
+		descr = "using password auth"
+	} else {
+		authMethods = append(authMethods, auth.AuthMethod)
+		descr = auth.Descr
+	}
+
+	if st.params.AllowPasswordAuth {
+		authMethods = append(
+			authMethods,
+			st.getPasswordAuthMethod(resCh, username, addr),
+			st.getKeyboardInteractiveAuthMethod(resCh, username, addr),
+		)
 	}
 
 	return &ClientConfigWMeta{
 		ClientConfig: &ssh.ClientConfig{
 			User: username,
-			Auth: []ssh.AuthMethod{auth.AuthMethod},
+			Auth: authMethods,
 
 			// TODO: fix it
 			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 
 			Timeout: connectionTimeout,
 		},
-		Descr: auth.Descr,
+		Descr: descr,
 	}, nil
 }
 
+// getAuthData returns the requested credentials: from the AuthCallback if
+// it's set and handles the request, or otherwise from the user via the
+// ShellConnDataRequest with the given title and message.
+func (st *ShellTransportSSH) getAuthData(
+	resCh chan<- ShellConnUpdate, req AuthRequest, title, message string,
+) (string, error) {
+	if st.params.AuthCallback != nil {
+		data, err := st.params.AuthCallback(req)
+		if errors.Cause(err) != ErrAuthNotHandled {
+			return data, errors.Trace(err)
+		}
+	}
+
+	dataCh := make(chan string, 1)
+
+	resCh <- ShellConnUpdate{
+		DataRequest: &ShellConnDataRequest{
+			Title:      title,
+			Message:    message,
+			DataKind:   ShellConnDataKindPassword,
+			ResponseCh: dataCh,
+		},
+	}
+
+	// Now wait for the client code to provide the data.
+	//
+	// TODO: support teardown; as of now, if the user tries to exit the app,
+	// it'll be stuck on the "Closing connections" stage, until the Ctrl+C is
+	// pressed.
+	return <-dataCh, nil
+}
+
+func (st *ShellTransportSSH) getPasswordAuthMethod(
+	resCh chan<- ShellConnUpdate, username, addr string,
+) ssh.AuthMethod {
+	return ssh.PasswordCallback(func() (string, error) {
+		return st.getAuthData(
+			resCh,
+			AuthRequest{
+				Kind:   AuthKindPassword,
+				User:   username,
+				Addr:   addr,
+				Prompt: fmt.Sprintf("Password for %s@%s", username, addr),
+			},
+			"SSH password",
+			fmt.Sprintf("Please enter the password for %s@%s.", username, addr),
+		)
+	})
+}
+
+func (st *ShellTransportSSH) getKeyboardInteractiveAuthMethod(
+	resCh chan<- ShellConnUpdate, username, addr string,
+) ssh.AuthMethod {
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, 0, len(questions))
+		for i, question := range questions {
+			message := question
+			if instruction != "" {
+				message = instruction + "\n" + question
+			}
+
+			answer, err := st.getAuthData(
+				resCh,
+				AuthRequest{
+					Kind:   AuthKindKeyboardInteractive,
+					User:   username,
+					Addr:   addr,
+					Prompt: question,
+					Echo:   echos[i],
+				},
+				fmt.Sprintf("SSH auth for %s@%s", username, addr),
+				message,
+			)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+
+			answers = append(answers, answer)
+		}
+
+		return answers, nil
+	})
+}
+
 var (
 	sshAuthMethodShared    *AuthMethodWMeta
 	sshAuthMethodSharedMtx sync.Mutex
@@ -319,25 +433,20 @@ func (st *ShellTransportSSH) getSSHAuthMethod(resCh chan<- ShellConnUpdate, logg
 		if _, ok := err.(*ssh.PassphraseMissingError); ok {
 			// We need a passphrase to decrypt the private key. Request it from
 			// the client code.
-			passphraseCh := make(chan string, 1)
-
-			resCh <- ShellConnUpdate{
-				DataRequest: &ShellConnDataRequest{
-					Title:      "SSH key is passphrase-protected",
-					Message:    fmt.Sprintf("Unable to use ssh-agent: %s, falling back to ssh keys.\nPlease enter passphrase for %s.\nAlternatively, use ssh-agent, and make sure the SSH_AUTH_SOCK environment variable is set correctly.\nTo use a different ssh key, provide it with the --ssh-key flag.", sshAgentErr.Error(), keyPath),
-					DataKind:   ShellConnDataKindPassword,
-					ResponseCh: passphraseCh,
+			passphrase, err := st.getAuthData(
+				resCh,
+				AuthRequest{
+					Kind:    AuthKindPassphrase,
+					KeyPath: keyPath,
+					Prompt:  fmt.Sprintf("Passphrase for %s", keyPath),
 				},
+				"SSH key is passphrase-protected",
+				fmt.Sprintf("Unable to use ssh-agent: %s, falling back to ssh keys.\nPlease enter passphrase for %s.\nAlternatively, use ssh-agent, and make sure the SSH_AUTH_SOCK environment variable is set correctly.\nTo use a different ssh key, provide it with the --ssh-key flag.", sshAgentErr.Error(), keyPath),
+			)
+			if err != nil {
+				return nil, errors.Annotatef(err, "getting passphrase for %s", keyPath)
 			}
 
-			// Now wait for the client code to provide the passphrase.
-			//
-			// TODO: support teardown; as of now, if the user tries to exit the app,
-			// it'll be stuck on the "Closing connections" stage, until the Ctrl+C is
-			// pressed.
-			passphrase := <-passphraseCh
-
-			var err error
 			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(passphrase))
 			if err != nil {
 				// Something has failed even with the provided passphrase.
@@ -387,7 +496,7 @@ func (st *ShellTransportSSH) getJumphostClient(resCh chan<- ShellConnUpdate, log
 			return nil, errors.New("Address not found")
 		}
 
-		conf, err := st.getClientConfig(resCh, logger, jhConfig.User)
+		conf, err := st.getClientConfig(resCh, logger, jhConfig.User, jhConfig.Addr)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -0,0 +1,5 @@
+package core
+
+// Windows doesn't have the IANA timezone database, so embed it; otherwise
+// loading the host timezone reported by the native agent would fail.
+import _ "time/tzdata"
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserAgentClass is the broad class of the client, as derived from the user
+// agent string of an HTTP access log message by ClassifyUserAgent.
+type UserAgentClass string
+
+const (
+	// UserAgentClassMonitor is for health checks and uptime monitors, like
+	// kube-probe or ELB-HealthChecker.
+	UserAgentClassMonitor UserAgentClass = "monitor"
+
+	// UserAgentClassBot is for search engines and other crawlers.
+	UserAgentClassBot UserAgentClass = "bot"
+
+	// UserAgentClassTool is for HTTP libraries and command line tools, like
+	// curl or python-requests.
+	UserAgentClassTool UserAgentClass = "tool"
+
+	// UserAgentClassBrowser is for the actual browsers; the family is then
+	// the browser name, like "chrome" or "firefox".
+	UserAgentClassBrowser UserAgentClass = "browser"
+
+	// UserAgentClassUnknown is for everything else, including the empty user
+	// agent.
+	UserAgentClassUnknown UserAgentClass = "unknown"
+)
+
+// AllUserAgentClasses contains all the classes except UserAgentClassUnknown,
+// in the order in which ClassifyUserAgent checks them.
+var AllUserAgentClasses = []UserAgentClass{
+	UserAgentClassMonitor,
+	UserAgentClassBot,
+	UserAgentClassTool,
+	UserAgentClassBrowser,
+}
+
+// userAgentRule classifies the user agents containing the given token (case
+// sensitive, since that's how awk matches it too, see UserAgentClassTokens).
+type userAgentRule struct {
+	class  UserAgentClass
+	family string
+	token  string
+}
+
+// userAgentRules are checked in order, and the first match wins; so the
+// rules of every class must be together, in the order of
+// AllUserAgentClasses, and within a class, the more specific tokens must go
+// first (e.g. every Chrome user agent mentions Safari too).
+var userAgentRules = []userAgentRule{
+	{UserAgentClassMonitor, "kube-probe", "kube-probe/"},
+	{UserAgentClassMonitor, "elb", "ELB-HealthChecker/"},
+	{UserAgentClassMonitor, "google-hc", "GoogleHC/"},
+	{UserAgentClassMonitor, "consul", "Consul Health Check"},
+	{UserAgentClassMonitor, "blackbox-exporter", "Blackbox Exporter/"},
+	{UserAgentClassMonitor, "prometheus", "Prometheus/"},
+	{UserAgentClassMonitor, "zabbix", "Zabbix"},
+	{UserAgentClassMonitor, "nagios", "check_http/"},
+	{UserAgentClassMonitor, "pingdom", "Pingdom"},
+	{UserAgentClassMonitor, "uptimerobot", "UptimeRobot/"},
+	{UserAgentClassMonitor, "statuscake", "StatusCake"},
+	{UserAgentClassMonitor, "datadog", "Datadog Agent/"},
+	{UserAgentClassMonitor, "newrelic", "NewRelicPinger/"},
+	{UserAgentClassMonitor, "site24x7", "Site24x7"},
+
+	{UserAgentClassBot, "googlebot", "Googlebot"},
+	{UserAgentClassBot, "bingbot", "bingbot/"},
+	{UserAgentClassBot, "yandexbot", "YandexBot/"},
+	{UserAgentClassBot, "baiduspider", "Baiduspider"},
+	{UserAgentClassBot, "duckduckbot", "DuckDuckBot"},
+	{UserAgentClassBot, "applebot", "Applebot/"},
+	{UserAgentClassBot, "ahrefsbot", "AhrefsBot/"},
+	{UserAgentClassBot, "semrushbot", "SemrushBot"},
+	{UserAgentClassBot, "mj12bot", "MJ12bot/"},
+	{UserAgentClassBot, "dotbot", "DotBot/"},
+	{UserAgentClassBot, "petalbot", "PetalBot"},
+	{UserAgentClassBot, "bytespider", "Bytespider"},
+	{UserAgentClassBot, "gptbot", "GPTBot/"},
+	{UserAgentClassBot, "claudebot", "ClaudeBot/"},
+	{UserAgentClassBot, "ccbot", "CCBot/"},
+	{UserAgentClassBot, "facebook", "facebookexternalhit/"},
+	{UserAgentClassBot, "twitterbot", "Twitterbot/"},
+	{UserAgentClassBot, "slackbot", "Slackbot"},
+	// Generic ones, for all the other crawlers out there. Note the "/": a plain
+	// "bot" would match "robots.txt" in the request line too.
+	{UserAgentClassBot, "other", "bot/"},
+	{UserAgentClassBot, "other", "Bot/"},
+	{UserAgentClassBot, "other", "crawler"},
+	{UserAgentClassBot, "other", "Crawler"},
+	{UserAgentClassBot, "other", "spider"},
+	{UserAgentClassBot, "other", "Spider"},
+
+	{UserAgentClassTool, "curl", "curl/"},
+	{UserAgentClassTool, "wget", "Wget/"},
+	{UserAgentClassTool, "python-requests", "python-requests/"},
+	{UserAgentClassTool, "python", "Python-urllib/"},
+	{UserAgentClassTool, "python", "aiohttp/"},
+	{UserAgentClassTool, "python", "python-httpx/"},
+	{UserAgentClassTool, "go", "Go-http-client/"},
+	{UserAgentClassTool, "okhttp", "okhttp/"},
+	{UserAgentClassTool, "java", "Java/"},
+	{UserAgentClassTool, "java", "Apache-HttpClient/"},
+	{UserAgentClassTool, "node", "node-fetch/"},
+	{UserAgentClassTool, "node", "axios/"},
+	{UserAgentClassTool, "perl", "libwww-perl/"},
+	{UserAgentClassTool, "httpie", "HTTPie/"},
+	{UserAgentClassTool, "postman", "PostmanRuntime/"},
+
+	{UserAgentClassBrowser, "edge", "Edg/"},
+	{UserAgentClassBrowser, "opera", "OPR/"},
+	{UserAgentClassBrowser, "samsung", "SamsungBrowser/"},
+	{UserAgentClassBrowser, "firefox", "Firefox/"},
+	{UserAgentClassBrowser, "chrome", "Chrome/"},
+	{UserAgentClassBrowser, "chrome", "CriOS/"},
+	{UserAgentClassBrowser, "safari", "Safari/"},
+	{UserAgentClassBrowser, "other", "Mozilla/"},
+}
+
+// ClassifyUserAgent returns the class and the family of the client with the
+// given user agent string; e.g. for a Googlebot user agent it returns
+// UserAgentClassBot and "googlebot", and for a Firefox one,
+// UserAgentClassBrowser and "firefox".
+//
+// For the user agents which don't match any known pattern (including the
+// empty ones and "-"), it returns UserAgentClassUnknown and an empty family.
+func ClassifyUserAgent(ua string) (UserAgentClass, string) {
+	for _, rule := range userAgentRules {
+		if strings.Contains(ua, rule.token) {
+			return rule.class, rule.family
+		}
+	}
+
+	return UserAgentClassUnknown, ""
+}
+
+// UserAgentClassTokens returns the tokens which ClassifyUserAgent looks for
+// to recognize the given class, and the tokens of all the classes which are
+// checked before it; so the user agent is of the given class if it contains
+// any of the tokens, but none of the preceding ones.
+//
+// It's meant to build awk patterns for filtering by class, since the agent
+// only sees the raw lines.
+func UserAgentClassTokens(class UserAgentClass) (tokens, preceding []string) {
+	for _, rule := range userAgentRules {
+		switch {
+		case rule.class == class:
+			tokens = append(tokens, rule.token)
+		case len(tokens) == 0:
+			preceding = append(preceding, rule.token)
+		default:
+			return tokens, preceding
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	return tokens, preceding
+}
+
+// accessLogMsgRegex matches the Common or Combined Log Format message, with
+// or without the syslog envelope already stripped, e.g.:
+//
+//	1.2.3.4 - bob [05/Mar/2025:10:07:46 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.5.0"
+//
+// The referer and the user agent are only present in the Combined format.
+var accessLogMsgRegex = regexp.MustCompile(
+	`^(\S+) \S+ (\S+) \[[^\]]+\] "([^"]*)" (\d{3}) (\S+)(?: "([^"]*)" "([^"]*)")?`,
+)
+
+// parseAccessLogMsg checks whether the message is an HTTP access log line,
+// and if so, populates the context with its fields: client_ip, user (if
+// any), method, path, status, bytes, and for the Combined format, also
+// referer, user_agent and the derived ua_class and ua_family (see
+// ClassifyUserAgent). Returns whether it was an access log line.
+func parseAccessLogMsg(msg string, ctx map[string]string) bool {
+	idxs := accessLogMsgRegex.FindStringSubmatchIndex(msg)
+	if idxs == nil {
+		return false
+	}
+
+	matches := make([]string, len(idxs)/2)
+	for i := range matches {
+		if idxs[2*i] >= 0 {
+			matches[i] = msg[idxs[2*i]:idxs[2*i+1]]
+		}
+	}
+
+	setIfNotEmpty := func(key, value string) {
+		if value != "" && value != "-" {
+			ctx[key] = value
+		}
+	}
+
+	setIfNotEmpty("client_ip", matches[1])
+	setIfNotEmpty("user", matches[2])
+
+	// The request line is normally like "GET /foo HTTP/1.1", but for the
+	// garbage requests it can be anything, so only take it apart if it looks
+	// right.
+	if reqParts := strings.Fields(matches[3]); len(reqParts) == 3 {
+		ctx["method"] = reqParts[0]
+		ctx["path"] = reqParts[1]
+	}
+
+	ctx["status"] = matches[4]
+	setIfNotEmpty("bytes", matches[5])
+
+	// The Combined format has the user agent; the Common one doesn't, so we
+	// can't say anything about the client then.
+	if isCombined := idxs[2*7] >= 0; !isCombined {
+		return true
+	}
+
+	setIfNotEmpty("referer", matches[6])
+	setIfNotEmpty("user_agent", matches[7])
+
+	class, family := ClassifyUserAgent(matches[7])
+	ctx["ua_class"] = string(class)
+	setIfNotEmpty("ua_family", family)
+
+	return true
+}
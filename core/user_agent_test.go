@@ -0,0 +1,170 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyUserAgent(t *testing.T) {
+	type testCase struct {
+		ua         string
+		wantClass  UserAgentClass
+		wantFamily string
+	}
+
+	testCases := []testCase{
+		{
+			ua:         "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			wantClass:  UserAgentClassBot,
+			wantFamily: "googlebot",
+		},
+		{
+			ua:         "Mozilla/5.0 (compatible; SomeNewCrawler/1.0; +https://example.com)",
+			wantClass:  UserAgentClassBot,
+			wantFamily: "other",
+		},
+		{
+			ua:         "kube-probe/1.29",
+			wantClass:  UserAgentClassMonitor,
+			wantFamily: "kube-probe",
+		},
+		{
+			ua:         "ELB-HealthChecker/2.0",
+			wantClass:  UserAgentClassMonitor,
+			wantFamily: "elb",
+		},
+		{
+			ua:         "curl/8.5.0",
+			wantClass:  UserAgentClassTool,
+			wantFamily: "curl",
+		},
+		{
+			ua:         "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+			wantClass:  UserAgentClassBrowser,
+			wantFamily: "firefox",
+		},
+		{
+			ua:         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			wantClass:  UserAgentClassBrowser,
+			wantFamily: "chrome",
+		},
+		{
+			ua:         "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0",
+			wantClass:  UserAgentClassBrowser,
+			wantFamily: "edge",
+		},
+		{
+			ua:         "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			wantClass:  UserAgentClassBrowser,
+			wantFamily: "safari",
+		},
+		{
+			ua:         "-",
+			wantClass:  UserAgentClassUnknown,
+			wantFamily: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		class, family := ClassifyUserAgent(tc.ua)
+		assert.Equal(t, tc.wantClass, class, "ua %q", tc.ua)
+		assert.Equal(t, tc.wantFamily, family, "ua %q", tc.ua)
+	}
+}
+
+func TestUserAgentClassTokens(t *testing.T) {
+	tokens, preceding := UserAgentClassTokens(UserAgentClassMonitor)
+	assert.Contains(t, tokens, "kube-probe/")
+	assert.Empty(t, preceding)
+
+	tokens, preceding = UserAgentClassTokens(UserAgentClassTool)
+	assert.Contains(t, tokens, "curl/")
+	assert.NotContains(t, tokens, "Googlebot")
+	assert.Contains(t, preceding, "Googlebot")
+	assert.Contains(t, preceding, "kube-probe/")
+	assert.NotContains(t, preceding, "Firefox/")
+
+	tokens, preceding = UserAgentClassTokens(UserAgentClassUnknown)
+	assert.Nil(t, tokens)
+	assert.Nil(t, preceding)
+}
+
+func TestParseAccessLogMsg(t *testing.T) {
+	type testCase struct {
+		name        string
+		input       string
+		wantOK      bool
+		wantContext map[string]string
+	}
+
+	testCases := []testCase{
+		{
+			name:   "combined format",
+			input:  `203.0.113.5 - - [05/Mar/2025:10:07:46 +0000] "GET /robots.txt HTTP/1.1" 200 612 "-" "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)"`,
+			wantOK: true,
+			wantContext: map[string]string{
+				"client_ip":  "203.0.113.5",
+				"method":     "GET",
+				"path":       "/robots.txt",
+				"status":     "200",
+				"bytes":      "612",
+				"user_agent": "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+				"ua_class":   "bot",
+				"ua_family":  "bingbot",
+			},
+		},
+		{
+			name:   "combined format with user, referer and unknown user agent",
+			input:  `10.0.0.2 - bob [05/Mar/2025:10:07:46 +0000] "POST /login HTTP/2.0" 302 - "https://example.com/" "-"`,
+			wantOK: true,
+			wantContext: map[string]string{
+				"client_ip": "10.0.0.2",
+				"user":      "bob",
+				"method":    "POST",
+				"path":      "/login",
+				"status":    "302",
+				"referer":   "https://example.com/",
+				"ua_class":  "unknown",
+			},
+		},
+		{
+			name:   "common format",
+			input:  `127.0.0.1 - - [05/Mar/2025:10:07:46 +0000] "GET / HTTP/1.1" 200 612`,
+			wantOK: true,
+			wantContext: map[string]string{
+				"client_ip": "127.0.0.1",
+				"method":    "GET",
+				"path":      "/",
+				"status":    "200",
+				"bytes":     "612",
+			},
+		},
+		{
+			name:   "garbage request line",
+			input:  `198.51.100.7 - - [05/Mar/2025:10:07:46 +0000] "\x16\x03\x01" 400 157 "-" "-"`,
+			wantOK: true,
+			wantContext: map[string]string{
+				"client_ip": "198.51.100.7",
+				"status":    "400",
+				"bytes":     "157",
+				"ua_class":  "unknown",
+			},
+		},
+		{
+			name:        "not an access log",
+			input:       "Something happened",
+			wantOK:      false,
+			wantContext: map[string]string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := map[string]string{}
+			ok := parseAccessLogMsg(tc.input, ctx)
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.wantContext, ctx)
+		})
+	}
+}
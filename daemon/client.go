@@ -0,0 +1,268 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+)
+
+// Client is attached to a session of the daemon, and it implements the same
+// API as the *core.LStreamsManager, so the UI can use either of them.
+//
+// If there was already another client attached to the session, this one is
+// read-only: it receives all the updates, but all the requests are no-ops
+// (and SetLStreams returns ErrReadOnly).
+type Client struct {
+	params ClientParams
+
+	netConn net.Conn
+
+	readOnly bool
+
+	encMtx sync.Mutex
+	enc    *json.Encoder
+
+	// setLStreamsMtx serializes SetLStreams calls, since the daemon responds to
+	// them in order.
+	setLStreamsMtx   sync.Mutex
+	lastSetLStreamID int
+	setLStreamsCh    chan *setLStreamsResp
+
+	// torndownCh is closed once the connection to the daemon is closed.
+	torndownCh chan struct{}
+}
+
+type ClientParams struct {
+	// SocketPath is the path to the daemon unix socket.
+	SocketPath string
+
+	// Session is the name of the session to attach to. If empty,
+	// DefaultSessionName is used.
+	Session string
+
+	UpdatesCh chan<- core.LStreamsManagerUpdate
+
+	// OnSharedQuery, if not nil, is called whenever the read-write client
+	// shares its query (see ShareQuery). It's called from a separate goroutine.
+	OnSharedQuery func(query string)
+
+	Logger *log.Logger
+}
+
+// NewClient connects to the daemon and attaches to the session. If the
+// session didn't exist, it is created; otherwise, it continues with whatever
+// logstreams are already connected there.
+func NewClient(params ClientParams) (*Client, error) {
+	params.Logger = params.Logger.WithNamespaceAppended("DaemonClient")
+
+	netConn, err := net.Dial("unix", params.SocketPath)
+	if err != nil {
+		return nil, errors.Annotatef(err, "connecting to the daemon at %s (is it running? start it with nerdlog --daemon)", params.SocketPath)
+	}
+
+	c := &Client{
+		params:        params,
+		netConn:       netConn,
+		enc:           json.NewEncoder(netConn),
+		setLStreamsCh: make(chan *setLStreamsResp, 1),
+		torndownCh:    make(chan struct{}),
+	}
+
+	if err := c.send(clientMsg{
+		Attach: &attachReq{Session: params.Session},
+	}); err != nil {
+		netConn.Close()
+		return nil, errors.Annotatef(err, "sending attach request")
+	}
+
+	dec := json.NewDecoder(netConn)
+
+	var msg serverMsg
+	if err := dec.Decode(&msg); err != nil {
+		netConn.Close()
+		return nil, errors.Annotatef(err, "reading attach response")
+	}
+
+	if msg.AttachResp == nil {
+		netConn.Close()
+		return nil, errors.Errorf("got unexpected response to attach request")
+	}
+
+	if msg.AttachResp.Err != "" {
+		netConn.Close()
+		return nil, errors.Errorf("attaching to the session: %s", msg.AttachResp.Err)
+	}
+
+	c.readOnly = msg.AttachResp.ReadOnly
+
+	go c.readLoop(dec)
+
+	return c, nil
+}
+
+func (c *Client) readLoop(dec *json.Decoder) {
+	defer close(c.torndownCh)
+
+	for {
+		var msg serverMsg
+		if err := dec.Decode(&msg); err != nil {
+			c.params.Logger.Verbose1f("Connection to the daemon closed: %s", err)
+			return
+		}
+
+		switch {
+		case msg.SetLStreamsResp != nil:
+			c.setLStreamsCh <- msg.SetLStreamsResp
+
+		case msg.SharedQuery != "":
+			if c.params.OnSharedQuery != nil {
+				c.params.OnSharedQuery(msg.SharedQuery)
+			}
+
+		case msg.Update != nil:
+			upd := unmarshalUpdate(msg.Update)
+
+			if msg.Update.DataRequest != nil {
+				upd.DataRequest = c.newDataRequest(msg.Update.DataRequest)
+			}
+
+			c.params.UpdatesCh <- upd
+
+		default:
+			c.params.Logger.Warnf("Empty message from the daemon")
+		}
+	}
+}
+
+// newDataRequest creates a local data request for the one received from the
+// daemon: once the UI responds to it, the response is forwarded to the
+// daemon.
+func (c *Client) newDataRequest(wdr *wireDataRequest) *core.ShellConnDataRequest {
+	respCh := make(chan string, 1)
+
+	go func() {
+		select {
+		case data := <-respCh:
+			c.send(clientMsg{
+				DataResponse: &dataResponse{ID: wdr.ID, Data: data},
+			})
+		case <-c.torndownCh:
+		}
+	}()
+
+	return &core.ShellConnDataRequest{
+		Title:      wdr.Title,
+		Message:    wdr.Message,
+		DataKind:   wdr.DataKind,
+		ResponseCh: respCh,
+	}
+}
+
+func (c *Client) send(msg clientMsg) error {
+	c.encMtx.Lock()
+	defer c.encMtx.Unlock()
+
+	if err := c.enc.Encode(msg); err != nil {
+		c.params.Logger.Errorf("Failed to send message to the daemon: %s", err)
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// ReadOnly returns whether another client is in control of the session, so
+// this one can only watch.
+func (c *Client) ReadOnly() bool {
+	return c.readOnly
+}
+
+// sendIfReadWrite sends the message unless the client is read-only, in
+// which case it's a no-op.
+func (c *Client) sendIfReadWrite(msg clientMsg) {
+	if c.readOnly {
+		c.params.Logger.Verbose1f("Read-only, not sending the request")
+		return
+	}
+
+	c.send(msg)
+}
+
+// ShareQuery makes the read-only clients of the same session mirror the given
+// query on their UI; it's an opaque string for the daemon.
+func (c *Client) ShareQuery(query string) {
+	c.sendIfReadWrite(clientMsg{ShareQuery: query})
+}
+
+func (c *Client) QueryLogs(params core.QueryLogsParams) {
+	c.sendIfReadWrite(clientMsg{QueryLogs: &params})
+}
+
+func (c *Client) FindFirstLast(params core.FindFirstLastParams) {
+	c.sendIfReadWrite(clientMsg{FindFirstLast: &params})
+}
+
+func (c *Client) SetLStreams(logStreamsSpec string) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+
+	c.setLStreamsMtx.Lock()
+	defer c.setLStreamsMtx.Unlock()
+
+	c.lastSetLStreamID++
+	id := c.lastSetLStreamID
+
+	if err := c.send(clientMsg{
+		SetLStreams: &setLStreamsReq{ID: id, Spec: logStreamsSpec},
+	}); err != nil {
+		return errors.Annotatef(err, "sending request to the daemon")
+	}
+
+	for {
+		select {
+		case resp := <-c.setLStreamsCh:
+			if resp.ID != id {
+				// Response to some earlier request which we've given up on; ignore.
+				continue
+			}
+
+			if resp.Err != "" {
+				return errors.New(resp.Err)
+			}
+
+			return nil
+
+		case <-c.torndownCh:
+			return errors.Errorf("connection to the daemon is closed")
+		}
+	}
+}
+
+func (c *Client) Ping() {
+	c.sendIfReadWrite(clientMsg{Ping: true})
+}
+
+func (c *Client) Reconnect() {
+	c.sendIfReadWrite(clientMsg{Reconnect: true})
+}
+
+func (c *Client) Disconnect() {
+	c.sendIfReadWrite(clientMsg{Disconnect: true})
+}
+
+// Close detaches from the session; the session itself, together with all its
+// connections, stays alive in the daemon. It doesn't wait for the connection
+// to be closed; use Wait for it.
+func (c *Client) Close() {
+	c.netConn.Close()
+}
+
+// Wait waits for the connection to the daemon to be closed. Typically used
+// after calling Close().
+func (c *Client) Wait() {
+	<-c.torndownCh
+}
@@ -0,0 +1,237 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLStreamsManager records the calls and lets the test send updates.
+type fakeLStreamsManager struct {
+	updatesCh chan<- core.LStreamsManagerUpdate
+
+	queryLogsCh chan core.QueryLogsParams
+	closedCh    chan struct{}
+}
+
+func (f *fakeLStreamsManager) QueryLogs(params core.QueryLogsParams) {
+	f.queryLogsCh <- params
+}
+
+func (f *fakeLStreamsManager) FindFirstLast(params core.FindFirstLastParams) {}
+
+func (f *fakeLStreamsManager) SetLStreams(logStreamsSpec string) error {
+	if logStreamsSpec == "bad" {
+		return errors.Errorf("bad logstreams")
+	}
+
+	return nil
+}
+
+func (f *fakeLStreamsManager) Ping()       {}
+func (f *fakeLStreamsManager) Reconnect()  {}
+func (f *fakeLStreamsManager) Disconnect() {}
+func (f *fakeLStreamsManager) Close()      { close(f.closedCh) }
+func (f *fakeLStreamsManager) Wait()       { <-f.closedCh }
+
+func TestDaemon(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "nerdlog_daemon_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	socketPath := filepath.Join(tmpDir, "daemon.sock")
+
+	var fakes []*fakeLStreamsManager
+
+	srv, err := NewServer(ServerParams{
+		SocketPath: socketPath,
+		NewLStreamsManager: func(updatesCh chan<- core.LStreamsManagerUpdate) LStreamsManager {
+			f := &fakeLStreamsManager{
+				updatesCh:   updatesCh,
+				queryLogsCh: make(chan core.QueryLogsParams, 1),
+				closedCh:    make(chan struct{}),
+			}
+			fakes = append(fakes, f)
+			return f
+		},
+	})
+	require.NoError(t, err)
+
+	go srv.Serve()
+	defer srv.Close()
+
+	// Another daemon on the same socket should refuse to start.
+	_, err = NewServer(ServerParams{SocketPath: socketPath})
+	assert.Error(t, err)
+
+	updatesCh := make(chan core.LStreamsManagerUpdate, 16)
+	client, err := NewClient(ClientParams{
+		SocketPath: socketPath,
+		UpdatesCh:  updatesCh,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(fakes))
+	fake := fakes[0]
+
+	// Requests should be forwarded to the manager.
+	from := time.Date(2025, 3, 12, 9, 0, 0, 0, time.UTC)
+	client.QueryLogs(core.QueryLogsParams{From: from, Query: "/foo/"})
+	gotParams := <-fake.queryLogsCh
+	assert.True(t, from.Equal(gotParams.From))
+	assert.Equal(t, "/foo/", gotParams.Query)
+
+	assert.NoError(t, client.SetLStreams("good"))
+	assert.EqualError(t, client.SetLStreams("bad"), "bad logstreams")
+
+	// Updates should be forwarded to the client, including errors.
+	fake.updatesCh <- core.LStreamsManagerUpdate{
+		State: &core.LStreamsManagerState{NumLStreams: 2, Connected: true},
+	}
+	fake.updatesCh <- core.LStreamsManagerUpdate{
+		LogResp: &core.LogRespTotal{
+			NumMsgsTotal: 3,
+			Errs:         []error{errors.Errorf("something failed")},
+		},
+	}
+
+	upd := <-updatesCh
+	require.NotNil(t, upd.State)
+	assert.Equal(t, 2, upd.State.NumLStreams)
+
+	upd = <-updatesCh
+	require.NotNil(t, upd.LogResp)
+	assert.Equal(t, 3, upd.LogResp.NumMsgsTotal)
+	require.Equal(t, 1, len(upd.LogResp.Errs))
+	assert.Equal(t, "something failed", upd.LogResp.Errs[0].Error())
+
+	// Data requests should make it to the client, and the response should make
+	// it back to the manager.
+	dataRespCh := make(chan string, 1)
+	fake.updatesCh <- core.LStreamsManagerUpdate{
+		DataRequest: &core.ShellConnDataRequest{
+			Title:      "Passphrase",
+			ResponseCh: dataRespCh,
+		},
+	}
+
+	upd = <-updatesCh
+	require.NotNil(t, upd.DataRequest)
+	assert.Equal(t, "Passphrase", upd.DataRequest.Title)
+	upd.DataRequest.ResponseCh <- "secret"
+	assert.Equal(t, "secret", <-dataRespCh)
+
+	// The second client of the same session is read-only: it gets the current
+	// state right away, and then follows the first one.
+	roUpdatesCh := make(chan core.LStreamsManagerUpdate, 16)
+	roSharedQueryCh := make(chan string, 1)
+	roClient, err := NewClient(ClientParams{
+		SocketPath: socketPath,
+		UpdatesCh:  roUpdatesCh,
+		OnSharedQuery: func(query string) {
+			roSharedQueryCh <- query
+		},
+	})
+	require.NoError(t, err)
+	assert.True(t, roClient.ReadOnly())
+	assert.False(t, client.ReadOnly())
+	assert.Equal(t, 1, len(fakes))
+
+	upd = <-roUpdatesCh
+	require.NotNil(t, upd.State)
+	upd = <-roUpdatesCh
+	require.NotNil(t, upd.LogResp)
+
+	assert.Equal(t, ErrReadOnly, roClient.SetLStreams("good"))
+
+	client.ShareQuery("nerdlog --pattern /foo/")
+	assert.Equal(t, "nerdlog --pattern /foo/", <-roSharedQueryCh)
+
+	// Requests from the read-only client are ignored, so the only query which
+	// makes it to the manager is the one from the read-write client.
+	roClient.QueryLogs(core.QueryLogsParams{Query: "/ro/"})
+	client.QueryLogs(core.QueryLogsParams{Query: "/rw/"})
+	gotParams = <-fake.queryLogsCh
+	assert.Equal(t, "/rw/", gotParams.Query)
+
+	// Updates go to both clients, but data requests only to the read-write one.
+	fake.updatesCh <- core.LStreamsManagerUpdate{
+		DataRequest: &core.ShellConnDataRequest{
+			Title:      "Passphrase",
+			ResponseCh: dataRespCh,
+		},
+	}
+	fake.updatesCh <- core.LStreamsManagerUpdate{
+		State: &core.LStreamsManagerState{NumLStreams: 2, Busy: true},
+	}
+
+	upd = <-updatesCh
+	require.NotNil(t, upd.DataRequest)
+	upd.DataRequest.ResponseCh <- "secret2"
+	assert.Equal(t, "secret2", <-dataRespCh)
+
+	upd = <-updatesCh
+	require.NotNil(t, upd.State)
+	assert.True(t, upd.State.Busy)
+
+	upd = <-roUpdatesCh
+	require.NotNil(t, upd.State)
+	assert.True(t, upd.State.Busy)
+
+	roClient.Close()
+	roClient.Wait()
+
+	// But a different session is fine, and it gets its own manager.
+	client2, err := NewClient(ClientParams{
+		SocketPath: socketPath,
+		Session:    "other",
+		UpdatesCh:  make(chan core.LStreamsManagerUpdate, 16),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(fakes))
+	client2.Close()
+	client2.Wait()
+
+	// After detaching, the session stays alive, and the next client gets the
+	// last state and logs right away, without a new manager being created.
+	client.Close()
+	client.Wait()
+
+	// The daemon might not have noticed the detach yet, in which case we'd be
+	// read-only, so retry for a bit.
+	require.Eventually(t, func() bool {
+		updatesCh = make(chan core.LStreamsManagerUpdate, 16)
+		client, err = NewClient(ClientParams{
+			SocketPath: socketPath,
+			UpdatesCh:  updatesCh,
+		})
+		require.NoError(t, err)
+
+		if client.ReadOnly() {
+			client.Close()
+			client.Wait()
+			return false
+		}
+
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, len(fakes))
+
+	assert.False(t, client.ReadOnly())
+
+	upd = <-updatesCh
+	require.NotNil(t, upd.State)
+	assert.Equal(t, 2, upd.State.NumLStreams)
+
+	upd = <-updatesCh
+	require.NotNil(t, upd.LogResp)
+	assert.Equal(t, 3, upd.LogResp.NumMsgsTotal)
+
+	client.Close()
+	client.Wait()
+}
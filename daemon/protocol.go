@@ -0,0 +1,209 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/juju/errors"
+)
+
+// The protocol between the daemon and its clients is very simple: it's a
+// stream of JSON-encoded messages in both directions over a unix socket.
+// The client sends clientMsg-s, and the daemon sends serverMsg-s.
+//
+// The very first message from the client must be the attach request; all the
+// others are basically mirroring the LStreamsManager API.
+
+// LStreamsManager is the part of the *core.LStreamsManager API which the
+// daemon needs; it exists mostly to make it possible to use a fake in tests.
+type LStreamsManager interface {
+	QueryLogs(params core.QueryLogsParams)
+	FindFirstLast(params core.FindFirstLastParams)
+	SetLStreams(logStreamsSpec string) error
+	Ping()
+	Reconnect()
+	Disconnect()
+	Close()
+	Wait()
+}
+
+// ErrReadOnly is returned when a read-only client tries to change anything
+// in the session.
+var ErrReadOnly = errors.Errorf("attached to the session in read-only mode")
+
+// DefaultSessionName is the name of the session which clients attach to
+// unless specified otherwise.
+const DefaultSessionName = "default"
+
+// DefaultSocketPath returns the default path to the daemon unix socket.
+func DefaultSocketPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Annotatef(err, "getting cache dir")
+	}
+
+	return filepath.Join(cacheDir, "nerdlog", "daemon.sock"), nil
+}
+
+type clientMsg struct {
+	// Exactly one of the fields below must be set.
+
+	Attach        *attachReq                `json:",omitempty"`
+	QueryLogs     *core.QueryLogsParams     `json:",omitempty"`
+	FindFirstLast *core.FindFirstLastParams `json:",omitempty"`
+	SetLStreams   *setLStreamsReq           `json:",omitempty"`
+	Ping          bool                      `json:",omitempty"`
+	Reconnect     bool                      `json:",omitempty"`
+	Disconnect    bool                      `json:",omitempty"`
+	DataResponse  *dataResponse             `json:",omitempty"`
+
+	// ShareQuery is the current query of the read-write client, as a nerdlog
+	// shell command (see QueryFull.MarshalShellCmd), which is forwarded to all
+	// the read-only clients so they can mirror it on the UI. The daemon doesn't
+	// interpret it in any way.
+	ShareQuery string `json:",omitempty"`
+}
+
+type attachReq struct {
+	// Session is the name of the session to attach to; if it doesn't exist
+	// yet, it will be created.
+	Session string
+}
+
+type setLStreamsReq struct {
+	// ID is an arbitrary number chosen by the client, which will be returned
+	// in the corresponding setLStreamsResp.
+	ID   int
+	Spec string
+}
+
+type dataResponse struct {
+	// ID is the same as in the corresponding wireDataRequest.
+	ID   int
+	Data string
+}
+
+type serverMsg struct {
+	// Exactly one of the fields below must be set.
+
+	AttachResp      *attachResp      `json:",omitempty"`
+	SetLStreamsResp *setLStreamsResp `json:",omitempty"`
+	Update          *wireUpdate      `json:",omitempty"`
+
+	// SharedQuery is the ShareQuery forwarded from the read-write client.
+	SharedQuery string `json:",omitempty"`
+}
+
+type attachResp struct {
+	// Err is empty if the client attached successfully.
+	Err string
+
+	// ReadOnly is true if there is another client in control of the session,
+	// so this one can only watch.
+	ReadOnly bool
+}
+
+type setLStreamsResp struct {
+	ID  int
+	Err string
+}
+
+// wireUpdate is the same as core.LStreamsManagerUpdate, but adjusted to be
+// JSON-friendly: errors are replaced with strings, and the data request has
+// an ID instead of a channel.
+type wireUpdate struct {
+	State *core.LStreamsManagerState `json:",omitempty"`
+
+	LogResp     *core.LogRespTotal `json:",omitempty"`
+	LogRespErrs []string           `json:",omitempty"`
+
+	FirstLastResp     *core.FirstLastRespTotal `json:",omitempty"`
+	FirstLastRespErrs []string                 `json:",omitempty"`
+
+	BootstrapIssue    *core.BootstrapIssue    `json:",omitempty"`
+	LogFormatDetected *core.LogFormatDetected `json:",omitempty"`
+
+	DataRequest *wireDataRequest `json:",omitempty"`
+}
+
+type wireDataRequest struct {
+	ID       int
+	Title    string
+	Message  string
+	DataKind core.ShellConnDataKind
+}
+
+// marshalUpdate converts the update to the wire format. Data requests are
+// handled separately by the caller, since they need an ID.
+func marshalUpdate(upd core.LStreamsManagerUpdate) *wireUpdate {
+	wu := &wireUpdate{
+		State:             upd.State,
+		BootstrapIssue:    upd.BootstrapIssue,
+		LogFormatDetected: upd.LogFormatDetected,
+	}
+
+	if upd.LogResp != nil {
+		lr := *upd.LogResp
+		wu.LogRespErrs = errsToStrings(lr.Errs)
+		lr.Errs = nil
+		wu.LogResp = &lr
+	}
+
+	if upd.FirstLastResp != nil {
+		flr := *upd.FirstLastResp
+		wu.FirstLastRespErrs = errsToStrings(flr.Errs)
+		flr.Errs = nil
+		wu.FirstLastResp = &flr
+	}
+
+	return wu
+}
+
+// unmarshalUpdate is the opposite of marshalUpdate. Data requests are handled
+// separately by the caller, since they need a response channel.
+func unmarshalUpdate(wu *wireUpdate) core.LStreamsManagerUpdate {
+	upd := core.LStreamsManagerUpdate{
+		State:             wu.State,
+		BootstrapIssue:    wu.BootstrapIssue,
+		LogFormatDetected: wu.LogFormatDetected,
+	}
+
+	if wu.LogResp != nil {
+		upd.LogResp = wu.LogResp
+		upd.LogResp.Errs = stringsToErrs(wu.LogRespErrs)
+	}
+
+	if wu.FirstLastResp != nil {
+		upd.FirstLastResp = wu.FirstLastResp
+		upd.FirstLastResp.Errs = stringsToErrs(wu.FirstLastRespErrs)
+	}
+
+	return upd
+}
+
+func errsToStrings(errs []error) []string {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	ret := make([]string, 0, len(errs))
+	for _, err := range errs {
+		ret = append(ret, err.Error())
+	}
+
+	return ret
+}
+
+func stringsToErrs(strs []string) []error {
+	if len(strs) == 0 {
+		return nil
+	}
+
+	ret := make([]error, 0, len(strs))
+	for _, s := range strs {
+		ret = append(ret, errors.New(s))
+	}
+
+	return ret
+}
@@ -0,0 +1,492 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dimonomid/nerdlog/core"
+	"github.com/dimonomid/nerdlog/log"
+	"github.com/juju/errors"
+)
+
+// serverConnOutBufSize is how many messages can be queued for a client before
+// we consider it stuck and drop it.
+const serverConnOutBufSize = 1024
+
+// Server is the nerdlog daemon: it listens on a unix socket and keeps
+// LStreamsManager-s (and thus ssh connections) alive between client
+// attachments, so that restarting nerdlog, or running multiple instances of
+// it, reuses warm connections.
+//
+// Every LStreamsManager belongs to a named session; a client attaches to a
+// session, and when it detaches, the session stays alive until the daemon
+// is stopped. Multiple clients can be attached to the same session: the
+// first one is in control, and the others are read-only followers, which see
+// everything the first one does.
+type Server struct {
+	params ServerParams
+
+	listener net.Listener
+
+	mtx      sync.Mutex
+	sessions map[string]*session
+	closed   bool
+}
+
+type ServerParams struct {
+	// SocketPath is the path to the unix socket to listen on.
+	SocketPath string
+
+	// NewLStreamsManager creates a new LStreamsManager for a new session. The
+	// manager must send all its updates to the given updatesCh.
+	NewLStreamsManager func(updatesCh chan<- core.LStreamsManagerUpdate) LStreamsManager
+
+	Logger *log.Logger
+}
+
+// NewServer creates the unix socket and returns the server; to start serving
+// clients, call Serve.
+func NewServer(params ServerParams) (*Server, error) {
+	params.Logger = params.Logger.WithNamespaceAppended("Daemon")
+
+	if err := os.MkdirAll(filepath.Dir(params.SocketPath), 0700); err != nil {
+		return nil, errors.Annotatef(err, "creating dir for the socket")
+	}
+
+	// If the socket file already exists, check whether there is another
+	// daemon listening on it; if not, then it's a leftover from a daemon which
+	// didn't exit cleanly, so just remove it.
+	if _, err := os.Stat(params.SocketPath); err == nil {
+		conn, err := net.Dial("unix", params.SocketPath)
+		if err == nil {
+			conn.Close()
+			return nil, errors.Errorf("another daemon is already listening on %s", params.SocketPath)
+		}
+
+		if err := os.Remove(params.SocketPath); err != nil {
+			return nil, errors.Annotatef(err, "removing stale socket %s", params.SocketPath)
+		}
+	}
+
+	listener, err := net.Listen("unix", params.SocketPath)
+	if err != nil {
+		return nil, errors.Annotatef(err, "listening on %s", params.SocketPath)
+	}
+
+	return &Server{
+		params:   params,
+		listener: listener,
+		sessions: map[string]*session{},
+	}, nil
+}
+
+// Serve accepts client connections until Close is called.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mtx.Lock()
+			closed := s.closed
+			s.mtx.Unlock()
+
+			if closed {
+				return nil
+			}
+
+			return errors.Annotatef(err, "accepting connection")
+		}
+
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops accepting new clients, and tears down all the sessions,
+// waiting for their LStreamsManager-s to finish.
+func (s *Server) Close() {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		return
+	}
+	s.closed = true
+	sessions := s.sessions
+	s.sessions = map[string]*session{}
+	s.mtx.Unlock()
+
+	s.listener.Close()
+
+	for _, sess := range sessions {
+		sess.close()
+	}
+}
+
+// getOrCreateSession returns the session with the given name, creating it
+// if needed.
+func (s *Server) getOrCreateSession(name string) (*session, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return nil, errors.Errorf("daemon is shutting down")
+	}
+
+	if sess, ok := s.sessions[name]; ok {
+		return sess, nil
+	}
+
+	s.params.Logger.Infof("Creating session %q", name)
+
+	updatesCh := make(chan core.LStreamsManagerUpdate, 128)
+	sess := &session{
+		name:            name,
+		lsman:           s.params.NewLStreamsManager(updatesCh),
+		updatesCh:       updatesCh,
+		doneCh:          make(chan struct{}),
+		pendingDataReqs: map[int]*core.ShellConnDataRequest{},
+		logger:          s.params.Logger.WithNamespaceAppended(name),
+	}
+	s.sessions[name] = sess
+
+	go sess.run()
+
+	return sess, nil
+}
+
+func (s *Server) handleConn(netConn net.Conn) {
+	sc := &serverConn{
+		netConn: netConn,
+		outCh:   make(chan serverMsg, serverConnOutBufSize),
+		doneCh:  make(chan struct{}),
+	}
+
+	defer sc.close()
+
+	// Until the client is attached, the writeLoop isn't running, so errors are
+	// written directly.
+	replyAttachErr := func(errStr string) {
+		json.NewEncoder(netConn).Encode(serverMsg{
+			AttachResp: &attachResp{Err: errStr},
+		})
+	}
+
+	dec := json.NewDecoder(netConn)
+
+	// The first message must be the attach request.
+	var msg clientMsg
+	if err := dec.Decode(&msg); err != nil {
+		s.params.Logger.Warnf("Failed to read attach request: %s", err)
+		return
+	}
+
+	if msg.Attach == nil {
+		replyAttachErr("the first message must be an attach request")
+		return
+	}
+
+	sessName := msg.Attach.Session
+	if sessName == "" {
+		sessName = DefaultSessionName
+	}
+
+	sess, err := s.getOrCreateSession(sessName)
+	if err != nil {
+		replyAttachErr(err.Error())
+		return
+	}
+
+	if err := sess.attach(sc); err != nil {
+		replyAttachErr(err.Error())
+		return
+	}
+	defer sess.detach(sc)
+
+	for {
+		var msg clientMsg
+		if err := dec.Decode(&msg); err != nil {
+			// Most likely the client has just detached.
+			sess.logger.Verbose1f("Client connection closed: %s", err)
+			return
+		}
+
+		sess.handleClientMsg(sc, msg)
+	}
+}
+
+// session holds an LStreamsManager and the clients attached to it.
+type session struct {
+	name string
+
+	lsman     LStreamsManager
+	updatesCh chan core.LStreamsManagerUpdate
+
+	// doneCh is closed once the session is fully torn down.
+	doneCh chan struct{}
+
+	logger *log.Logger
+
+	mtx sync.Mutex
+
+	// clients contains all currently attached clients, in the order of
+	// attachment.
+	clients []*serverConn
+
+	// rwClient is the client which is in control of the session, or nil if
+	// there's none. It's the one which attached first; all the other ones are
+	// read-only. If the read-write client detaches, the read-only ones stay
+	// read-only, and the next newly attached client will be read-write.
+	rwClient *serverConn
+
+	// lastState, lastSharedQuery and lastLogResp are replayed to every newly
+	// attached client, so that it can show the current state right away.
+	lastState       *core.LStreamsManagerState
+	lastSharedQuery string
+	lastLogResp     *core.LogRespTotal
+
+	// pendingDataReqs contains data requests (e.g. passphrases) which weren't
+	// responded to yet, keyed by their ID. They are only sent to the read-write
+	// client, and they are replayed when a new read-write client attaches,
+	// since otherwise the connection would be stuck forever.
+	pendingDataReqs map[int]*core.ShellConnDataRequest
+	lastDataReqID   int
+}
+
+func (sess *session) run() {
+	for {
+		select {
+		case upd := <-sess.updatesCh:
+			sess.handleUpdate(upd)
+		case <-sess.doneCh:
+			return
+		}
+	}
+}
+
+func (sess *session) handleUpdate(upd core.LStreamsManagerUpdate) {
+	sess.mtx.Lock()
+	defer sess.mtx.Unlock()
+
+	wu := marshalUpdate(upd)
+
+	switch {
+	case upd.State != nil:
+		sess.lastState = upd.State
+	case upd.LogResp != nil:
+		sess.lastLogResp = upd.LogResp
+	case upd.DataRequest != nil:
+		sess.lastDataReqID++
+		sess.pendingDataReqs[sess.lastDataReqID] = upd.DataRequest
+		wu.DataRequest = marshalDataRequest(sess.lastDataReqID, upd.DataRequest)
+
+		// Only the read-write client can respond to data requests.
+		if sess.rwClient != nil {
+			sess.rwClient.send(serverMsg{Update: wu})
+		}
+		return
+	}
+
+	sess.broadcast(serverMsg{Update: wu})
+}
+
+// broadcast sends the message to all attached clients. Must be called with
+// mtx locked.
+func (sess *session) broadcast(msg serverMsg) {
+	for _, sc := range sess.clients {
+		sc.send(msg)
+	}
+}
+
+func (sess *session) attach(sc *serverConn) error {
+	sess.mtx.Lock()
+	defer sess.mtx.Unlock()
+
+	if sess.rwClient == nil {
+		sess.rwClient = sc
+	} else {
+		sc.readOnly = true
+	}
+
+	sess.logger.Infof("Client attached (read-only: %v)", sc.readOnly)
+	sess.clients = append(sess.clients, sc)
+
+	go sc.writeLoop()
+
+	sc.send(serverMsg{AttachResp: &attachResp{ReadOnly: sc.readOnly}})
+
+	if sess.lastState != nil {
+		sc.send(serverMsg{Update: &wireUpdate{State: sess.lastState}})
+	}
+
+	if sess.lastSharedQuery != "" {
+		sc.send(serverMsg{SharedQuery: sess.lastSharedQuery})
+	}
+
+	if sess.lastLogResp != nil {
+		sc.send(serverMsg{Update: marshalUpdate(core.LStreamsManagerUpdate{
+			LogResp: sess.lastLogResp,
+		})})
+	}
+
+	if !sc.readOnly {
+		for id, dataReq := range sess.pendingDataReqs {
+			sc.send(serverMsg{Update: &wireUpdate{
+				DataRequest: marshalDataRequest(id, dataReq),
+			}})
+		}
+	}
+
+	return nil
+}
+
+func (sess *session) detach(sc *serverConn) {
+	sess.mtx.Lock()
+	defer sess.mtx.Unlock()
+
+	for i, cur := range sess.clients {
+		if cur == sc {
+			sess.clients = append(sess.clients[:i], sess.clients[i+1:]...)
+			break
+		}
+	}
+
+	if sess.rwClient == sc {
+		sess.rwClient = nil
+	}
+
+	sess.logger.Infof("Client detached (read-only: %v)", sc.readOnly)
+}
+
+func (sess *session) handleClientMsg(sc *serverConn, msg clientMsg) {
+	if sc.readOnly {
+		// Read-only clients can't do anything to the session; the client side
+		// is supposed to not even try, so just reply to SetLStreams (since the
+		// client is waiting for a response) and ignore the rest.
+		if msg.SetLStreams != nil {
+			sc.send(serverMsg{SetLStreamsResp: &setLStreamsResp{
+				ID:  msg.SetLStreams.ID,
+				Err: ErrReadOnly.Error(),
+			}})
+		}
+
+		sess.logger.Warnf("Ignoring request from a read-only client")
+		return
+	}
+
+	switch {
+	case msg.QueryLogs != nil:
+		sess.lsman.QueryLogs(*msg.QueryLogs)
+	case msg.FindFirstLast != nil:
+		sess.lsman.FindFirstLast(*msg.FindFirstLast)
+	case msg.SetLStreams != nil:
+		var errStr string
+		if err := sess.lsman.SetLStreams(msg.SetLStreams.Spec); err != nil {
+			errStr = err.Error()
+		}
+
+		sc.send(serverMsg{SetLStreamsResp: &setLStreamsResp{
+			ID:  msg.SetLStreams.ID,
+			Err: errStr,
+		}})
+	case msg.Ping:
+		sess.lsman.Ping()
+	case msg.Reconnect:
+		sess.lsman.Reconnect()
+	case msg.Disconnect:
+		sess.lsman.Disconnect()
+	case msg.ShareQuery != "":
+		sess.mtx.Lock()
+		sess.lastSharedQuery = msg.ShareQuery
+		for _, cur := range sess.clients {
+			if cur != sc {
+				cur.send(serverMsg{SharedQuery: msg.ShareQuery})
+			}
+		}
+		sess.mtx.Unlock()
+	case msg.DataResponse != nil:
+		sess.mtx.Lock()
+		dataReq, ok := sess.pendingDataReqs[msg.DataResponse.ID]
+		delete(sess.pendingDataReqs, msg.DataResponse.ID)
+		sess.mtx.Unlock()
+
+		if ok {
+			dataReq.ResponseCh <- msg.DataResponse.Data
+		}
+	default:
+		sess.logger.Warnf("Empty message from client")
+	}
+}
+
+func (sess *session) close() {
+	sess.logger.Infof("Closing session")
+
+	sess.lsman.Close()
+	sess.lsman.Wait()
+	close(sess.doneCh)
+
+	sess.mtx.Lock()
+	for _, sc := range sess.clients {
+		sc.close()
+	}
+	sess.clients = nil
+	sess.rwClient = nil
+	sess.mtx.Unlock()
+}
+
+func marshalDataRequest(id int, dataReq *core.ShellConnDataRequest) *wireDataRequest {
+	return &wireDataRequest{
+		ID:       id,
+		Title:    dataReq.Title,
+		Message:  dataReq.Message,
+		DataKind: dataReq.DataKind,
+	}
+}
+
+// serverConn is a single client connection on the daemon side.
+type serverConn struct {
+	netConn net.Conn
+
+	// readOnly is set once on attach, and never changes after that.
+	readOnly bool
+
+	// outCh is the queue of messages to send to the client. It's consumed by
+	// writeLoop.
+	outCh chan serverMsg
+
+	closeOnce sync.Once
+	doneCh    chan struct{}
+}
+
+// send queues the message to be sent to the client. It never blocks: if the
+// client doesn't keep up, it's dropped.
+func (sc *serverConn) send(msg serverMsg) {
+	select {
+	case sc.outCh <- msg:
+	case <-sc.doneCh:
+	default:
+		sc.close()
+	}
+}
+
+func (sc *serverConn) writeLoop() {
+	enc := json.NewEncoder(sc.netConn)
+	for {
+		select {
+		case msg := <-sc.outCh:
+			if err := enc.Encode(msg); err != nil {
+				sc.close()
+				return
+			}
+		case <-sc.doneCh:
+			return
+		}
+	}
+}
+
+func (sc *serverConn) close() {
+	sc.closeOnce.Do(func() {
+		close(sc.doneCh)
+		sc.netConn.Close()
+	})
+}
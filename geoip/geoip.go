@@ -0,0 +1,99 @@
+// Package geoip looks up IP addresses in local MaxMind DB files, like
+// GeoLite2-City.mmdb, GeoLite2-Country.mmdb or GeoLite2-ASN.mmdb.
+package geoip
+
+import (
+	"net"
+	"os"
+
+	"github.com/juju/errors"
+)
+
+// DB is a MaxMind DB file loaded in memory.
+type DB struct {
+	db *mmdb
+}
+
+// Info is the information about an IP address; fields which are not present
+// in the database are left empty.
+type Info struct {
+	CountryCode string
+	Country     string
+	City        string
+
+	ASN    uint
+	ASNOrg string
+}
+
+// Open reads the MaxMind DB file at the given path.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	db, err := parseMMDB(buf)
+	if err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", path)
+	}
+
+	return &DB{db: db}, nil
+}
+
+// DatabaseType returns the type of the database from its metadata, e.g.
+// "GeoLite2-City".
+func (db *DB) DatabaseType() string {
+	return db.db.metadata.databaseType
+}
+
+// Lookup returns the info about the given IP, or nil if the database doesn't
+// have it.
+func (db *DB) Lookup(ip net.IP) (*Info, error) {
+	key := ip.To4()
+	if key == nil {
+		key = ip.To16()
+	}
+	if key == nil {
+		return nil, errors.Errorf("invalid IP %q", ip)
+	}
+
+	rec, err := db.db.lookup(key)
+	if err != nil {
+		return nil, errors.Annotatef(err, "looking up %s", ip)
+	}
+
+	recMap, ok := rec.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	info := &Info{}
+
+	if country, ok := recMap["country"].(map[string]interface{}); ok {
+		info.CountryCode, _ = country["iso_code"].(string)
+		info.Country = englishName(country)
+	}
+
+	if city, ok := recMap["city"].(map[string]interface{}); ok {
+		info.City = englishName(city)
+	}
+
+	if asn, ok := recMap["autonomous_system_number"].(uint64); ok {
+		info.ASN = uint(asn)
+	}
+	info.ASNOrg, _ = recMap["autonomous_system_organization"].(string)
+
+	return info, nil
+}
+
+// englishName returns the English name from the "names" map which is used
+// for countries and cities in GeoIP databases.
+func englishName(m map[string]interface{}) string {
+	names, ok := m["names"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	name, _ := names["en"].(string)
+	return name
+}
@@ -0,0 +1,238 @@
+package geoip
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testEncoder encodes data fields in the MaxMind DB format, just enough to
+// build small test databases.
+type testEncoder struct {
+	bytes.Buffer
+}
+
+func (e *testEncoder) ctrl(typ, size int) {
+	sizeBits := size
+	if size >= 29 {
+		// Only sizes up to 284 are supported here.
+		sizeBits = 29
+	}
+
+	if typ > 7 {
+		e.WriteByte(byte(sizeBits))
+		e.WriteByte(byte(typ - 7))
+	} else {
+		e.WriteByte(byte(typ<<5 | sizeBits))
+	}
+
+	if size >= 29 {
+		e.WriteByte(byte(size - 29))
+	}
+}
+
+func (e *testEncoder) str(s string) {
+	e.ctrl(mmdbTypeString, len(s))
+	e.WriteString(s)
+}
+
+func (e *testEncoder) uint(typ int, v uint64, size int) {
+	e.ctrl(typ, size)
+	for i := size - 1; i >= 0; i-- {
+		e.WriteByte(byte(v >> (8 * uint(i))))
+	}
+}
+
+func (e *testEncoder) mapHeader(numPairs int) {
+	e.ctrl(mmdbTypeMap, numPairs)
+}
+
+// pointer writes a pointer of the smallest kind (up to 2047).
+func (e *testEncoder) pointer(ptr int) {
+	e.WriteByte(byte(mmdbTypePointer<<5 | (ptr >> 8)))
+	e.WriteByte(byte(ptr))
+}
+
+// buildTestDB builds an IPv4 database with 24-bit records, which has the
+// data only for 10.0.0.0/8 and 192.168.0.0/16.
+func buildTestDB() []byte {
+	var data testEncoder
+
+	// Record for 10.0.0.0/8: a city.
+	rec10 := data.Len()
+	data.mapHeader(2)
+	data.str("country")
+	data.mapHeader(2)
+	data.str("iso_code")
+	data.str("DE")
+	namesOffset := data.Len()
+	data.str("names")
+	data.mapHeader(1)
+	data.str("en")
+	data.str("Germany")
+	data.str("city")
+	data.mapHeader(1)
+	data.pointer(namesOffset)
+	data.mapHeader(2)
+	data.str("en")
+	data.str("Berlin")
+	data.str("de")
+	data.str("Berlin")
+
+	// Record for 192.168.0.0/16: an ASN.
+	rec192 := data.Len()
+	data.mapHeader(2)
+	data.str("autonomous_system_number")
+	data.uint(mmdbTypeUint32, 64512, 2)
+	data.str("autonomous_system_organization")
+	data.str("Example Org")
+
+	type prefix struct {
+		bits []byte
+		rec  int
+	}
+
+	prefixBits := func(ip []byte, n int) []byte {
+		var ret []byte
+		for i := 0; i < n; i++ {
+			ret = append(ret, (ip[i/8]>>(7-uint(i%8)))&1)
+		}
+		return ret
+	}
+
+	prefixes := []prefix{
+		{bits: prefixBits([]byte{10}, 8), rec: rec10},
+		{bits: prefixBits([]byte{192, 168}, 16), rec: rec192},
+	}
+
+	// Build the tree: nodes[i] is [left, right]; -1 means not found, values
+	// <= -2 mean data records.
+	nodes := [][2]int{{-1, -1}}
+	for _, p := range prefixes {
+		node := 0
+		for i, bit := range p.bits {
+			if i == len(p.bits)-1 {
+				nodes[node][bit] = -2 - p.rec
+				break
+			}
+
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	nodeCount := len(nodes)
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		for _, v := range n {
+			var rec int
+			switch {
+			case v == -1:
+				rec = nodeCount
+			case v <= -2:
+				rec = nodeCount + dataSectionSeparatorSize + (-2 - v)
+			default:
+				rec = v
+			}
+			buf.Write([]byte{byte(rec >> 16), byte(rec >> 8), byte(rec)})
+		}
+	}
+
+	buf.Write(make([]byte, dataSectionSeparatorSize))
+	buf.Write(data.Bytes())
+
+	var meta testEncoder
+	meta.mapHeader(4)
+	meta.str("node_count")
+	meta.uint(mmdbTypeUint32, uint64(nodeCount), 4)
+	meta.str("record_size")
+	meta.uint(mmdbTypeUint16, 24, 2)
+	meta.str("ip_version")
+	meta.uint(mmdbTypeUint16, 4, 2)
+	meta.str("database_type")
+	meta.str("Test-City")
+
+	buf.Write(metadataStartMarker)
+	buf.Write(meta.Bytes())
+
+	return buf.Bytes()
+}
+
+func TestLookup(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(fname, buildTestDB(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(fname)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "Test-City", db.DatabaseType())
+
+	info, err := db.Lookup(net.ParseIP("10.1.2.3"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Info{CountryCode: "DE", Country: "Germany", City: "Berlin"}, info)
+
+	info, err = db.Lookup(net.ParseIP("192.168.100.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, &Info{ASN: 64512, ASNOrg: "Example Org"}, info)
+
+	info, err = db.Lookup(net.ParseIP("11.0.0.1"))
+	assert.NoError(t, err)
+	assert.Nil(t, info)
+
+	_, err = db.Lookup(net.ParseIP("2001:db8::1"))
+	assert.Error(t, err)
+}
+
+func TestOpenInvalid(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(fname, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Open(fname)
+	assert.Error(t, err)
+}
+
+func TestDecodeBogusSizes(t *testing.T) {
+	// The maximum size is over 16M items, while the data is only a few bytes;
+	// the decoder must fail without trying to allocate all that.
+	for _, typ := range []int{mmdbTypeMap, mmdbTypeArray} {
+		var enc testEncoder
+		if typ > 7 {
+			enc.WriteByte(31)
+			enc.WriteByte(byte(typ - 7))
+		} else {
+			enc.WriteByte(byte(typ<<5 | 31))
+		}
+		enc.Write([]byte{0xFF, 0xFF, 0xFF})
+		enc.str("foo")
+		enc.str("bar")
+
+		d := &mmdbDecoder{buf: enc.Bytes()}
+		_, _, err := d.decode(0, 0)
+		assert.Error(t, err, "type %d", typ)
+	}
+
+	// The sizes which fit are fine.
+	var enc testEncoder
+	enc.ctrl(mmdbTypeArray, 2)
+	enc.str("foo")
+	enc.str("bar")
+
+	d := &mmdbDecoder{buf: enc.Bytes()}
+	val, _, err := d.decode(0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"foo", "bar"}, val)
+}
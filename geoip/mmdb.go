@@ -0,0 +1,426 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/big"
+
+	"github.com/juju/errors"
+)
+
+// This file implements a minimal reader of the MaxMind DB format, enough to
+// look up IP addresses in GeoLite2 / GeoIP2 databases. The format is
+// described here: https://maxmind.github.io/MaxMind-DB/
+
+var metadataStartMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// metadataMaxSize is how far from the end of the file the metadata can be.
+const metadataMaxSize = 128 * 1024
+
+// dataSectionSeparatorSize is the size of zeros between the search tree and
+// the data section.
+const dataSectionSeparatorSize = 16
+
+// Data field types.
+const (
+	mmdbTypeExtended  = 0
+	mmdbTypePointer   = 1
+	mmdbTypeString    = 2
+	mmdbTypeDouble    = 3
+	mmdbTypeBytes     = 4
+	mmdbTypeUint16    = 5
+	mmdbTypeUint32    = 6
+	mmdbTypeMap       = 7
+	mmdbTypeInt32     = 8
+	mmdbTypeUint64    = 9
+	mmdbTypeUint128   = 10
+	mmdbTypeArray     = 11
+	mmdbTypeContainer = 12
+	mmdbTypeEndMarker = 13
+	mmdbTypeBool      = 14
+	mmdbTypeFloat     = 15
+)
+
+// maxDecodeDepth protects from stack overflows on malformed databases.
+const maxDecodeDepth = 32
+
+type mmdbMetadata struct {
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+}
+
+// mmdb is a parsed MaxMind DB file.
+type mmdb struct {
+	buf []byte
+
+	metadata mmdbMetadata
+
+	tree []byte
+	data []byte
+}
+
+func parseMMDB(buf []byte) (*mmdb, error) {
+	searchFrom := 0
+	if len(buf) > metadataMaxSize {
+		searchFrom = len(buf) - metadataMaxSize
+	}
+
+	markerIdx := bytes.LastIndex(buf[searchFrom:], metadataStartMarker)
+	if markerIdx < 0 {
+		return nil, errors.Errorf("metadata marker not found, not a MaxMind DB file")
+	}
+	metadataBuf := buf[searchFrom+markerIdx+len(metadataStartMarker):]
+
+	metadataRaw, _, err := (&mmdbDecoder{buf: metadataBuf}).decode(0, 0)
+	if err != nil {
+		return nil, errors.Annotatef(err, "decoding metadata")
+	}
+
+	metadataMap, ok := metadataRaw.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("metadata is not a map")
+	}
+
+	db := &mmdb{buf: buf}
+	db.metadata.nodeCount = uintFromMap(metadataMap, "node_count")
+	db.metadata.recordSize = uintFromMap(metadataMap, "record_size")
+	db.metadata.ipVersion = uintFromMap(metadataMap, "ip_version")
+	db.metadata.databaseType, _ = metadataMap["database_type"].(string)
+
+	switch db.metadata.recordSize {
+	case 24, 28, 32:
+		// Supported
+	default:
+		return nil, errors.Errorf("unsupported record size %d", db.metadata.recordSize)
+	}
+
+	switch db.metadata.ipVersion {
+	case 4, 6:
+		// Supported
+	default:
+		return nil, errors.Errorf("unsupported ip version %d", db.metadata.ipVersion)
+	}
+
+	treeSize := db.metadata.nodeCount * db.metadata.recordSize / 4
+	if treeSize+dataSectionSeparatorSize > uint(searchFrom+markerIdx) {
+		return nil, errors.Errorf("search tree of %d nodes doesn't fit in the file", db.metadata.nodeCount)
+	}
+
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+dataSectionSeparatorSize : searchFrom+markerIdx]
+
+	return db, nil
+}
+
+// readNode returns the record of the given node: left if bit is 0, right if
+// bit is 1.
+func (db *mmdb) readNode(node uint, bit uint) uint {
+	nodeSize := db.metadata.recordSize / 4
+	b := db.tree[node*nodeSize : (node+1)*nodeSize]
+
+	switch db.metadata.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// lookup returns the decoded data record for the given IP (4 or 16 bytes
+// long), or nil if there is no record for it.
+func (db *mmdb) lookup(ip []byte) (interface{}, error) {
+	node := uint(0)
+
+	if len(ip) == 4 && db.metadata.ipVersion == 6 {
+		// IPv4 addresses are in the ::/96 subtree.
+		for i := 0; i < 96 && node < db.metadata.nodeCount; i++ {
+			node = db.readNode(node, 0)
+		}
+	} else if len(ip) == 16 && db.metadata.ipVersion == 4 {
+		return nil, errors.Errorf("IPv6 lookup in an IPv4-only database")
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.metadata.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = db.readNode(node, bit)
+	}
+
+	switch {
+	case node == db.metadata.nodeCount:
+		// Not found
+		return nil, nil
+
+	case node < db.metadata.nodeCount:
+		return nil, errors.Errorf("invalid search tree: no data after all the address bits")
+	}
+
+	offset := node - db.metadata.nodeCount - dataSectionSeparatorSize
+	if offset >= uint(len(db.data)) {
+		return nil, errors.Errorf("invalid data offset %d", offset)
+	}
+
+	val, _, err := (&mmdbDecoder{buf: db.data}).decode(offset, 0)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return val, nil
+}
+
+// mmdbDecoder decodes the data fields; pointers in the data are offsets
+// relative to the start of buf.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// decode decodes the field at the given offset, and returns its value (maps
+// are represented as map[string]interface{}, arrays as []interface{},
+// unsigned integers as uint64, etc), and the offset of the next field.
+func (d *mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.Errorf("data is nested too deep")
+	}
+
+	typ, size, offset, err := d.decodeCtrl(offset)
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+
+	if typ == mmdbTypePointer {
+		ptr, newOffset, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, errors.Trace(err)
+		}
+
+		val, _, err := d.decode(ptr, depth+1)
+		if err != nil {
+			return nil, 0, errors.Annotatef(err, "following pointer to %d", ptr)
+		}
+
+		return val, newOffset, nil
+	}
+
+	switch typ {
+	case mmdbTypeMap:
+		// Every pair takes at least 2 bytes, so the bogus sizes are rejected
+		// before allocating anything.
+		if err := d.checkNumItems(size, 2, offset); err != nil {
+			return nil, 0, errors.Trace(err)
+		}
+
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var key, val interface{}
+
+			key, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, errors.Annotatef(err, "map key")
+			}
+
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.Errorf("map key is not a string: %v", key)
+			}
+
+			val, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, errors.Annotatef(err, "map value for %q", keyStr)
+			}
+
+			m[keyStr] = val
+		}
+		return m, offset, nil
+
+	case mmdbTypeArray:
+		if err := d.checkNumItems(size, 1, offset); err != nil {
+			return nil, 0, errors.Trace(err)
+		}
+
+		arr := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var val interface{}
+
+			val, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, errors.Annotatef(err, "array item #%d", i)
+			}
+
+			arr = append(arr, val)
+		}
+		return arr, offset, nil
+
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+
+	case mmdbTypeContainer, mmdbTypeEndMarker:
+		return nil, offset, nil
+	}
+
+	// All other types have a payload of the given size.
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errors.Errorf("field of type %d and size %d at %d is out of bounds", typ, size, offset)
+	}
+	payload := d.buf[offset : offset+size]
+	offset += size
+
+	switch typ {
+	case mmdbTypeString:
+		return string(payload), offset, nil
+
+	case mmdbTypeBytes:
+		return append([]byte(nil), payload...), offset, nil
+
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, errors.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), offset, nil
+
+	case mmdbTypeFloat:
+		if size != 4 {
+			return nil, 0, errors.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), offset, nil
+
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		if size > 8 {
+			return nil, 0, errors.Errorf("invalid uint size %d", size)
+		}
+		var v uint64
+		for _, b := range payload {
+			v = v<<8 | uint64(b)
+		}
+		return v, offset, nil
+
+	case mmdbTypeInt32:
+		if size > 4 {
+			return nil, 0, errors.Errorf("invalid int32 size %d", size)
+		}
+		var v uint32
+		for _, b := range payload {
+			v = v<<8 | uint32(b)
+		}
+		return int64(int32(v)), offset, nil
+
+	case mmdbTypeUint128:
+		return new(big.Int).SetBytes(payload), offset, nil
+	}
+
+	return nil, 0, errors.Errorf("unknown data type %d", typ)
+}
+
+// checkNumItems returns an error if the map or array with the given number of
+// items, each taking at least minItemSize bytes, can't fit in the rest of the
+// buffer after the offset.
+func (d *mmdbDecoder) checkNumItems(numItems, minItemSize, offset uint) error {
+	if offset > uint(len(d.buf)) || numItems > (uint(len(d.buf))-offset)/minItemSize {
+		return errors.Errorf("%d items at %d are out of bounds", numItems, offset)
+	}
+
+	return nil
+}
+
+// decodeCtrl decodes the control byte(s) of the field at the given offset,
+// and returns the type, the size, and the offset right after the control
+// bytes. For pointers, the size is the raw 5 bits of the control byte.
+func (d *mmdbDecoder) decodeCtrl(offset uint) (typ, size, newOffset uint, err error) {
+	readByte := func() (uint, error) {
+		if offset >= uint(len(d.buf)) {
+			return 0, errors.Errorf("unexpected end of data at %d", offset)
+		}
+		b := d.buf[offset]
+		offset++
+		return uint(b), nil
+	}
+
+	ctrl, err := readByte()
+	if err != nil {
+		return 0, 0, 0, errors.Trace(err)
+	}
+
+	typ = ctrl >> 5
+	if typ == mmdbTypeExtended {
+		ext, err := readByte()
+		if err != nil {
+			return 0, 0, 0, errors.Trace(err)
+		}
+		typ = 7 + ext
+	}
+
+	size = ctrl & 0x1F
+	if typ == mmdbTypePointer || size < 29 {
+		return typ, size, offset, nil
+	}
+
+	numExtra := size - 28
+	var extra uint
+	for i := uint(0); i < numExtra; i++ {
+		b, err := readByte()
+		if err != nil {
+			return 0, 0, 0, errors.Trace(err)
+		}
+		extra = extra<<8 | b
+	}
+
+	switch numExtra {
+	case 1:
+		size = 29 + extra
+	case 2:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+
+	return typ, size, offset, nil
+}
+
+// decodePointer decodes the pointer, given the 5 size bits from the control
+// byte, and the offset right after the control byte. It returns the pointer
+// value and the offset after the pointer.
+func (d *mmdbDecoder) decodePointer(sizeBits, offset uint) (uint, uint, error) {
+	ss := (sizeBits >> 3) & 0x3
+	vvv := sizeBits & 0x7
+
+	numBytes := ss + 1
+	if offset+numBytes > uint(len(d.buf)) {
+		return 0, 0, errors.Errorf("pointer at %d is out of bounds", offset)
+	}
+
+	var v uint
+	if ss != 3 {
+		v = vvv
+	}
+	for _, b := range d.buf[offset : offset+numBytes] {
+		v = v<<8 | uint(b)
+	}
+
+	switch ss {
+	case 1:
+		v += 2048
+	case 2:
+		v += 526336
+	}
+
+	return v, offset + numBytes, nil
+}
+
+func uintFromMap(m map[string]interface{}, key string) uint {
+	v, _ := m[key].(uint64)
+	return uint(v)
+}
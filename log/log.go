@@ -137,13 +137,26 @@ func (l *Logger) Errorf(format string, a ...interface{}) {
 func (l *Logger) Printf(level LogLevel, format string, a ...interface{}) {
 	l = l.thisOrDefault()
 
+	if level < l.minLevel && level < recordsMinLevel {
+		return
+	}
+
+	msg := fmt.Sprintf(format, a...)
+
+	addRecord(Record{
+		Time:      time.Now(),
+		Level:     level,
+		Namespace: l.namespace,
+		Msg:       msg,
+	})
+
 	if level < l.minLevel {
 		return
 	}
 
 	if l.namespace != "" {
-		printf(l.toStdout, "[%s] %s", l.namespace, fmt.Sprintf(format, a...))
+		printf(l.toStdout, "[%s] %s", l.namespace, msg)
 	} else {
-		printf(l.toStdout, "%s", l.namespace, fmt.Sprintf(format, a...))
+		printf(l.toStdout, "%s", msg)
 	}
 }
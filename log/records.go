@@ -0,0 +1,114 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// MaxRecentRecords is how many of the latest log records are kept in memory,
+// to be shown on the UI (see RecentRecords).
+const MaxRecentRecords = 5000
+
+// recordsMinLevel is the minimum level of records kept in memory, regardless
+// of the logger's own level. It's lower than the default logger level, so
+// that when something goes wrong, there's some useful context on the UI even
+// if nerdlog wasn't started with a more verbose --loglevel.
+const recordsMinLevel = Verbose1
+
+// Record is a single log message, as kept in memory.
+type Record struct {
+	Time      time.Time
+	Level     LogLevel
+	Namespace string
+	Msg       string
+}
+
+// String returns a human-readable representation of the record, similar to
+// how it's printed to the log file.
+func (r Record) String() string {
+	var sb strings.Builder
+
+	sb.WriteString(r.Time.Format("15:04:05.000"))
+	sb.WriteString(" ")
+	sb.WriteString(fmt.Sprintf("%-7s", r.Level.String()))
+	sb.WriteString(" ")
+
+	if r.Namespace != "" {
+		sb.WriteString("[")
+		sb.WriteString(r.Namespace)
+		sb.WriteString("] ")
+	}
+
+	sb.WriteString(strings.TrimRight(r.Msg, "\n"))
+
+	return sb.String()
+}
+
+var recentRecords []Record
+var recentRecordsNext int
+var recentRecordsMtx sync.Mutex
+
+func addRecord(r Record) {
+	recentRecordsMtx.Lock()
+	defer recentRecordsMtx.Unlock()
+
+	if len(recentRecords) < MaxRecentRecords {
+		recentRecords = append(recentRecords, r)
+		return
+	}
+
+	recentRecords[recentRecordsNext] = r
+	recentRecordsNext = (recentRecordsNext + 1) % MaxRecentRecords
+}
+
+// RecentRecords returns up to MaxRecentRecords latest records with the level
+// minLevel or higher, oldest first. Note that records with levels lower than
+// Verbose1 are only kept if the logger was created with such a level.
+func RecentRecords(minLevel LogLevel) []Record {
+	recentRecordsMtx.Lock()
+	defer recentRecordsMtx.Unlock()
+
+	ret := make([]Record, 0, len(recentRecords))
+	for i := 0; i < len(recentRecords); i++ {
+		r := recentRecords[(recentRecordsNext+i)%len(recentRecords)]
+		if r.Level >= minLevel {
+			ret = append(ret, r)
+		}
+	}
+
+	return ret
+}
+
+func (l LogLevel) String() string {
+	switch l {
+	case Verbose3:
+		return "verbose3"
+	case Verbose2:
+		return "verbose2"
+	case Verbose1:
+		return "verbose1"
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseLogLevel parses the level name as returned by LogLevel.String.
+func ParseLogLevel(s string) (LogLevel, error) {
+	for l := Verbose3; l <= Error; l++ {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+
+	return Info, errors.Errorf("invalid log level %q, try error, warning, info, verbose1, verbose2 or verbose3", s)
+}
@@ -0,0 +1,53 @@
+package log
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentRecords(t *testing.T) {
+	// Using Error as the min level so that nothing gets printed to the log
+	// file, but still, the records should be kept for levels Verbose1 and up.
+	logger := NewLogger(Error).WithNamespaceAppended("Test")
+
+	logger.Verbose3f("verbose3 msg")
+	logger.Verbose1f("verbose1 msg")
+	logger.Warnf("warning msg %d", 1)
+
+	records := RecentRecords(Verbose3)
+	if assert.Equal(t, 2, len(records)) {
+		assert.Equal(t, Verbose1, records[0].Level)
+		assert.Equal(t, "verbose1 msg", records[0].Msg)
+		assert.Equal(t, "Test", records[0].Namespace)
+
+		assert.Equal(t, Warning, records[1].Level)
+		assert.Equal(t, "warning msg 1", records[1].Msg)
+	}
+
+	records = RecentRecords(Warning)
+	assert.Equal(t, 1, len(records))
+
+	// Overflow the buffer, and make sure we get the latest records, in order.
+	for i := 0; i < MaxRecentRecords+10; i++ {
+		logger.Infof("msg %d", i)
+	}
+
+	records = RecentRecords(Verbose3)
+	if assert.Equal(t, MaxRecentRecords, len(records)) {
+		assert.Equal(t, "msg 10", records[0].Msg)
+		assert.Equal(t, fmt.Sprintf("msg %d", MaxRecentRecords+9), records[len(records)-1].Msg)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for l := Verbose3; l <= Error; l++ {
+		got, err := ParseLogLevel(l.String())
+		assert.NoError(t, err)
+		assert.Equal(t, l, got)
+	}
+
+	_, err := ParseLogLevel("foo")
+	assert.Error(t, err)
+}